@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/stemstr/storage/internal/audit"
+	"github.com/stemstr/storage/internal/moderation"
+	"github.com/stemstr/storage/internal/nip98"
+	"github.com/stemstr/storage/internal/service"
+	"github.com/stemstr/storage/internal/subscription"
+)
+
+type ctxKey int
+
+const adminPubkeyKey ctxKey = iota
+
+// requireAdmin only allows requests carrying a valid NIP-98 auth event
+// signed by one of the configured admin pubkeys.
+func (h *handlers) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pubkey, err := nip98.Authenticate(r, h.requestURL(r))
+		if err != nil {
+			log.Printf("admin auth failed: %v", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if len(h.config.AdminPubkeys) == 0 || !pubkeyIsAllowed(h.config.AdminPubkeys, pubkey) {
+			log.Printf("admin auth failed: %q is not an admin", pubkey)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), adminPubkeyKey, pubkey)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestURL is the absolute URL a client is expected to sign for r.
+func (h *handlers) requestURL(r *http.Request) string {
+	return strings.TrimSuffix(h.config.APIBase, "/") + r.URL.RequestURI()
+}
+
+// adminPubkey returns the authenticated admin for a request context.
+func adminPubkey(ctx context.Context) string {
+	pubkey, _ := ctx.Value(adminPubkeyKey).(string)
+	return pubkey
+}
+
+// recordAudit writes an admin action to the audit log. The action has
+// already been applied, but a failure is returned so the request fails
+// rather than leaving an unaudited action looking successful.
+func (h *handlers) recordAudit(ctx context.Context, action, target string, before, after any) error {
+	return h.audit.Record(ctx, adminPubkey(ctx), action, target, before, after)
+}
+
+// handleAdminListAudit lists audit log entries
+func (h *handlers) handleAdminListAudit(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pagination(r)
+
+	entries, err := h.audit.List(r.Context(), limit, offset)
+	if err != nil {
+		log.Printf("err: audit.List: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// handleAdminSearchSubscriptions lists subscriptions filtered by pubkey,
+// status and provider query params
+func (h *handlers) handleAdminSearchSubscriptions(w http.ResponseWriter, r *http.Request) {
+	var (
+		q             = r.URL.Query()
+		limit, offset = pagination(r)
+	)
+
+	subs, err := h.subs.SearchSubscriptions(r.Context(), subscription.SearchFilter{
+		Pubkey:   q.Get("pubkey"),
+		Status:   subscription.SubscriptionStatus(q.Get("status")),
+		Provider: q.Get("provider"),
+		Limit:    limit,
+		Offset:   offset,
+	})
+	if err != nil {
+		log.Printf("err: subs.SearchSubscriptions: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if subs == nil {
+		subs = []subscription.Subscription{}
+	}
+
+	writeJSON(w, http.StatusOK, subs)
+}
+
+// handleAdminGetSubscription fetches a subscription by id
+func (h *handlers) handleAdminGetSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid subscription id", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.subs.GetSubscription(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, subscription.ErrSubscriptionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("err: subs.GetSubscription: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sub)
+}
+
+// handleAdminGrantSubscription creates a free subscription
+func (h *handlers) handleAdminGrantSubscription(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var data struct {
+		Pubkey string `json:"pubkey"`
+		Days   int    `json:"days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "expected JSON payload", http.StatusBadRequest)
+		return
+	}
+	if !validPubkey(data.Pubkey) {
+		http.Error(w, "invalid pubkey", http.StatusBadRequest)
+		return
+	}
+	if data.Days <= 0 {
+		http.Error(w, "days must be positive", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.subs.GrantSubscription(ctx, data.Pubkey, data.Days)
+	if err != nil {
+		log.Printf("err: subs.GrantSubscription: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.recordAudit(ctx, "subscription.grant", strconv.FormatInt(sub.ID, 10), nil, sub); err != nil {
+		log.Printf("err: audit.Record: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+// handleAdminSetSubscriptionStatus manually marks a subscription paid,
+// refunded or cancelled
+func (h *handlers) handleAdminSetSubscriptionStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid subscription id", http.StatusBadRequest)
+		return
+	}
+
+	var data struct {
+		Status subscription.SubscriptionStatus `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "expected JSON payload", http.StatusBadRequest)
+		return
+	}
+	switch data.Status {
+	case subscription.StatusPaid, subscription.StatusRefunded, subscription.StatusCancelled:
+	default:
+		http.Error(w, "status must be paid, refunded or cancelled", http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.subs.GetSubscription(ctx, id)
+	if err != nil {
+		if errors.Is(err, subscription.ErrSubscriptionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("err: subs.GetSubscription: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	after, err := h.subs.Transition(ctx, id, data.Status)
+	if err != nil {
+		if errors.Is(err, subscription.ErrInvalidTransition) || errors.Is(err, subscription.ErrStatusConflict) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("err: subs.Transition: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.recordAudit(ctx, "subscription.status", strconv.FormatInt(id, 10), before, after); err != nil {
+		log.Printf("err: audit.Record: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, after)
+}
+
+// handleAdminGetSubscriptionHistory lists the status transitions of a
+// subscription
+func (h *handlers) handleAdminGetSubscriptionHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid subscription id", http.StatusBadRequest)
+		return
+	}
+
+	changes, err := h.subs.GetStatusHistory(r.Context(), id)
+	if err != nil {
+		log.Printf("err: subs.GetStatusHistory: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if changes == nil {
+		changes = []subscription.StatusChange{}
+	}
+
+	writeJSON(w, http.StatusOK, changes)
+}
+
+// handleAdminListPromoCodes lists promo codes
+func (h *handlers) handleAdminListPromoCodes(w http.ResponseWriter, r *http.Request) {
+	codes, err := h.subs.ListPromoCodes(r.Context())
+	if err != nil {
+		log.Printf("err: subs.ListPromoCodes: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if codes == nil {
+		codes = []subscription.PromoCode{}
+	}
+
+	writeJSON(w, http.StatusOK, codes)
+}
+
+// handleAdminCreatePromoCode adds a promo code
+func (h *handlers) handleAdminCreatePromoCode(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var data subscription.PromoCode
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "expected JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	promo, err := h.subs.CreatePromoCode(ctx, data)
+	switch {
+	case errors.Is(err, subscription.ErrInvalidPromoCode):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, subscription.ErrPromoCodeExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("err: subs.CreatePromoCode: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.recordAudit(ctx, "promo_code.create", promo.Code, nil, promo); err != nil {
+		log.Printf("err: audit.Record: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, promo)
+}
+
+// handleAdminDeleteSample deletes a sample's files
+func (h *handlers) handleAdminDeleteSample(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx = r.Context()
+		sum = chi.URLParam(r, "sum")
+	)
+
+	before, err := h.svc.LookupSample(ctx, sum)
+	if err != nil && !errors.Is(err, service.ErrNotFound) {
+		log.Printf("err: svc.LookupSample: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.svc.DeleteSample(ctx, sum); err != nil {
+		log.Printf("err: svc.DeleteSample: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.recordAudit(ctx, "sample.delete", sum, before, nil); err != nil {
+		log.Printf("err: audit.Record: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminListBans lists banned pubkeys
+func (h *handlers) handleAdminListBans(w http.ResponseWriter, r *http.Request) {
+	bans, err := h.bans.ListBans(r.Context())
+	if err != nil {
+		log.Printf("err: bans.ListBans: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if bans == nil {
+		bans = []moderation.Ban{}
+	}
+
+	writeJSON(w, http.StatusOK, bans)
+}
+
+// handleAdminBan bans a pubkey
+func (h *handlers) handleAdminBan(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx    = r.Context()
+		pubkey = chi.URLParam(r, "pubkey")
+	)
+
+	if !validPubkey(pubkey) {
+		http.Error(w, "invalid pubkey", http.StatusBadRequest)
+		return
+	}
+
+	var data struct {
+		Reason      string `json:"reason"`
+		HideSamples bool   `json:"hide_samples"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, "expected JSON payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	before, err := h.bans.GetBan(ctx, pubkey)
+	if err != nil && !errors.Is(err, moderation.ErrBanNotFound) {
+		log.Printf("err: bans.GetBan: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ban, err := h.bans.Ban(ctx, moderation.Ban{
+		Pubkey:      pubkey,
+		Reason:      data.Reason,
+		HideSamples: data.HideSamples,
+	})
+	if err != nil {
+		log.Printf("err: bans.Ban: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.recordAudit(ctx, "ban.create", ban.Pubkey, before, ban); err != nil {
+		log.Printf("err: audit.Record: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ban)
+}
+
+// handleAdminUnban removes a pubkey from the ban list
+func (h *handlers) handleAdminUnban(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx    = r.Context()
+		pubkey = chi.URLParam(r, "pubkey")
+	)
+
+	before, err := h.bans.GetBan(ctx, pubkey)
+	if err != nil {
+		if errors.Is(err, moderation.ErrBanNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("err: bans.GetBan: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.bans.Unban(ctx, pubkey); err != nil {
+		log.Printf("err: bans.Unban: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.recordAudit(ctx, "ban.delete", before.Pubkey, before, nil); err != nil {
+		log.Printf("err: audit.Record: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pagination reads limit and offset query params. Invalid values are
+// treated as unset.
+func pagination(r *http.Request) (limit, offset int) {
+	q := r.URL.Query()
+	limit, _ = strconv.Atoi(q.Get("limit"))
+	offset, _ = strconv.Atoi(q.Get("offset"))
+	return limit, offset
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	jsonb, _ := json.Marshal(v)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonb)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stemstr/storage/internal/audit"
+	"github.com/stemstr/storage/internal/moderation"
+	"github.com/stemstr/storage/internal/nip98"
+	"github.com/stemstr/storage/internal/subscription/repo/memory"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	const apiBase = "http://localhost:9000"
+
+	var (
+		adminSK    = nostr.GeneratePrivateKey()
+		adminPK, _ = nostr.GetPublicKey(adminSK)
+		otherSK    = nostr.GeneratePrivateKey()
+	)
+
+	authHeader := func(sk string) string {
+		event := nostr.Event{
+			Kind:      nip98.Kind,
+			CreatedAt: nostr.Now(),
+			Tags: nostr.Tags{
+				{"u", apiBase + "/admin/bans"},
+				{"method", "GET"},
+			},
+		}
+		assert.NoError(t, event.Sign(sk))
+		b, _ := json.Marshal(event)
+		return "Nostr " + base64.StdEncoding.EncodeToString(b)
+	}
+
+	var tests = []struct {
+		name         string
+		adminPubkeys []string
+		header       string
+		status       int
+	}{
+		{"admin", []string{adminPK}, authHeader(adminSK), http.StatusOK},
+		{"not admin", []string{adminPK}, authHeader(otherSK), http.StatusForbidden},
+		{"no admins configured", []string{}, authHeader(adminSK), http.StatusForbidden},
+		{"no auth", []string{adminPK}, "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handlers{config: Config{APIBase: apiBase, AdminPubkeys: tt.adminPubkeys}}
+
+			var actor any
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				actor = r.Context().Value(adminPubkeyKey)
+			})
+
+			r := httptest.NewRequest("GET", "/admin/bans", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.requireAdmin(next).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, adminPK, actor)
+			}
+		})
+	}
+}
+
+// failingAuditRepo fails every audit write.
+type failingAuditRepo struct {
+	*memory.Repo
+}
+
+func (failingAuditRepo) CreateAuditEntry(ctx context.Context, entry audit.Entry) error {
+	return errors.New("audit log unavailable")
+}
+
+func TestAdminAuditFailure(t *testing.T) {
+	repo := memory.New()
+	bans, err := moderation.New(repo)
+	assert.NoError(t, err)
+	auditLog, err := audit.New(failingAuditRepo{repo})
+	assert.NoError(t, err)
+
+	h := &handlers{bans: bans, audit: auditLog}
+	router := chi.NewRouter()
+	router.Put("/admin/bans/{pubkey}", h.handleAdminBan)
+
+	// Unaudited actions fail even though they were applied
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/bans/"+testPubkey, nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"strings"
 
 	"github.com/kelseyhightower/envconfig"
 	"gopkg.in/yaml.v3"
@@ -13,36 +14,110 @@ const (
 	defaultStreamChunkSizeSeconds = 10
 	defaultStreamCodec            = "libmp3lame"
 	defaultStreamBitrate          = "128k"
+	defaultReconcileInterval      = 15
+	defaultReconcileMaxBackoff    = 300
+	defaultRateCacheSeconds       = 60
+	defaultRateMaxStaleSeconds    = 3600
 )
 
+var defaultRateSources = []string{"coingecko", "coinbase"}
+
 type Config struct {
 	// API settings
-	Port                   int      `yaml:"port" envconfig:"PORT"`
-	APIBase                string   `yaml:"api_base" envconfig:"API_BASE"`
-	StreamBase             string   `yaml:"stream_base" envconfig:"STREAM_BASE"`
-	DownloadBase           string   `yaml:"download_base" envconfig:"DOWNLOAD_BASE"`
-	MediaStorageDir        string   `yaml:"media_storage_dir" envconfig:"MEDIA_STORAGE_DIR"`
-	StreamStorageDir       string   `yaml:"stream_storage_dir" envconfig:"STREAM_STORAGE_DIR"`
-	WavStorageDir          string   `yaml:"wav_storage_dir" envconfig:"WAV_STORAGE_DIR"`
-	StreamFFMPEG           string   `yaml:"stream_ffmpeg" envconfig:"STREAM_FFMPEG"`
-	StreamChunkSizeSeconds int      `yaml:"stream_chunk_size_seconds" envconfig:"STREAM_CHUNK_SIZE_SECONDS"`
-	StreamCodec            string   `yaml:"stream_codec" envconfig:"STREAM_CODEC"`
-	StreamBitrate          string   `yaml:"stream_bitrate" envconfig:"STREAM_BITRATE"`
-	MaxUploadSizeMB        int64    `yaml:"max_upload_size_mb" envconfig:"MAX_UPLOAD_SIZE_MB"`
-	AcceptedMimetypes      []string `yaml:"accepted_mimetypes" envconfig:"ACCEPTED_MIMETYPES"`
-	S3Bucket               string   `yaml:"s3_bucket" envconfig:"S3_BUCKET"`
-	AllowedPubkeys         []string `yaml:"allowed_pubkeys" envconfig:"ALLOWED_PUBKEYS"`
-	LightningProvider      string   `yaml:"lightning_provider" envconfig:"LIGHTNING_PROVIDER"`
-	NodelessAPIKey         string   `yaml:"nodeless_apikey" envconfig:"NODELESS_APIKEY"`
-	NodelessStoreID        string   `yaml:"nodeless_storeid" envconfig:"NODELESS_STOREID"`
-	NodelessTestnet        bool     `yaml:"nodeless_testnet" envconfig:"NODELESS_TESTNET"`
-	ZBDAPIKey              string   `yaml:"zbd_apikey" envconfig:"ZBD_APIKEY"`
-	SubscriptionDB         string   `yaml:"subscription_db"`
-	SubscriptionOptions    []struct {
-		Days int `yaml:"days" json:"days"`
-		Sats int `yaml:"sats" json:"sats"`
-	} `yaml:"subscription_options"`
-	BlastrNsec string `yaml:"blastr_nsec" envconfig:"BLASTR_NSEC"`
+	Port                   int                  `yaml:"port" envconfig:"PORT"`
+	APIBase                string               `yaml:"api_base" envconfig:"API_BASE"`
+	StreamBase             string               `yaml:"stream_base" envconfig:"STREAM_BASE"`
+	DownloadBase           string               `yaml:"download_base" envconfig:"DOWNLOAD_BASE"`
+	MediaStorageDir        string               `yaml:"media_storage_dir" envconfig:"MEDIA_STORAGE_DIR"`
+	StreamStorageDir       string               `yaml:"stream_storage_dir" envconfig:"STREAM_STORAGE_DIR"`
+	WavStorageDir          string               `yaml:"wav_storage_dir" envconfig:"WAV_STORAGE_DIR"`
+	StreamFFMPEG           string               `yaml:"stream_ffmpeg" envconfig:"STREAM_FFMPEG"`
+	StreamChunkSizeSeconds int                  `yaml:"stream_chunk_size_seconds" envconfig:"STREAM_CHUNK_SIZE_SECONDS"`
+	StreamCodec            string               `yaml:"stream_codec" envconfig:"STREAM_CODEC"`
+	StreamBitrate          string               `yaml:"stream_bitrate" envconfig:"STREAM_BITRATE"`
+	MaxUploadSizeMB        int64                `yaml:"max_upload_size_mb" envconfig:"MAX_UPLOAD_SIZE_MB"`
+	AcceptedMimetypes      []string             `yaml:"accepted_mimetypes" envconfig:"ACCEPTED_MIMETYPES"`
+	S3Bucket               string               `yaml:"s3_bucket" envconfig:"S3_BUCKET"`
+	AllowedPubkeys         []string             `yaml:"allowed_pubkeys" envconfig:"ALLOWED_PUBKEYS"`
+	AdminPubkeys           []string             `yaml:"admin_pubkeys" envconfig:"ADMIN_PUBKEYS"`
+	LightningProvider      string               `yaml:"lightning_provider" envconfig:"LIGHTNING_PROVIDER"`
+	NodelessAPIKey         string               `yaml:"nodeless_apikey" envconfig:"NODELESS_APIKEY"`
+	NodelessStoreID        string               `yaml:"nodeless_storeid" envconfig:"NODELESS_STOREID"`
+	NodelessTestnet        bool                 `yaml:"nodeless_testnet" envconfig:"NODELESS_TESTNET"`
+	NodelessWebhookSecret  string               `yaml:"nodeless_webhook_secret" envconfig:"NODELESS_WEBHOOK_SECRET"`
+	ZBDAPIKey              string               `yaml:"zbd_apikey" envconfig:"ZBD_APIKEY"`
+	LNDRestURL             string               `yaml:"lnd_rest_url" envconfig:"LND_REST_URL"`
+	LNDMacaroon            string               `yaml:"lnd_macaroon" envconfig:"LND_MACAROON"`
+	LNDTLSCert             string               `yaml:"lnd_tls_cert" envconfig:"LND_TLS_CERT"`
+	CLNRestURL             string               `yaml:"cln_rest_url" envconfig:"CLN_REST_URL"`
+	CLNRune                string               `yaml:"cln_rune" envconfig:"CLN_RUNE"`
+	CLNTLSCert             string               `yaml:"cln_tls_cert" envconfig:"CLN_TLS_CERT"`
+	NWCURI                 string               `yaml:"nwc_uri" envconfig:"NWC_URI"`
+	CashuMints             []string             `yaml:"cashu_mints" envconfig:"CASHU_MINTS"`
+	SubscriptionDB         string               `yaml:"subscription_db"`
+	SubscriptionOptions    []SubscriptionOption `yaml:"subscription_options"`
+	BlastrNsec             string               `yaml:"blastr_nsec" envconfig:"BLASTR_NSEC"`
+	// ZapName is the lightning address name, <name>@<api_base host>, that
+	// accepts zaps for subscriptions. Receipts are signed with BlastrNsec.
+	ZapName string `yaml:"zap_name" envconfig:"ZAP_NAME"`
+
+	// Seconds between passes of the unpaid invoice reconciler, and the
+	// cap on how long it waits between checks of a single invoice.
+	ReconcileIntervalSeconds   int `yaml:"reconcile_interval_seconds" envconfig:"RECONCILE_INTERVAL_SECONDS"`
+	ReconcileMaxBackoffSeconds int `yaml:"reconcile_max_backoff_seconds" envconfig:"RECONCILE_MAX_BACKOFF_SECONDS"`
+
+	// Exchange rate sources for fiat priced subscription options, tried in
+	// order. Rates are cached for RateCacheSeconds and used for up to
+	// RateMaxStaleSeconds when every source fails, after which StaticRates
+	// (BTC price by currency) are the last resort.
+	RateSources         []string           `yaml:"rate_sources" envconfig:"RATE_SOURCES"`
+	RateCacheSeconds    int                `yaml:"rate_cache_seconds" envconfig:"RATE_CACHE_SECONDS"`
+	RateMaxStaleSeconds int                `yaml:"rate_max_stale_seconds" envconfig:"RATE_MAX_STALE_SECONDS"`
+	StaticRates         map[string]float64 `yaml:"static_rates" envconfig:"STATIC_RATES"`
+
+	// Prices of a single upload for pubkeys without a subscription, by size
+	// and length. Pay-per-upload is disabled when both are zero.
+	UploadSatsPerMB     float64 `yaml:"upload_sats_per_mb" envconfig:"UPLOAD_SATS_PER_MB"`
+	UploadSatsPerMinute float64 `yaml:"upload_sats_per_minute" envconfig:"UPLOAD_SATS_PER_MINUTE"`
+
+	// Waveform peaks stored with each sample and served from /waveform.
+	// Each point summarizes WaveformSamplesPerPixel frames (default 256) at
+	// WaveformBits resolution, 8 (default) or 16. WaveformRMS adds RMS
+	// values to the JSON format.
+	WaveformSamplesPerPixel int  `yaml:"waveform_samples_per_pixel" envconfig:"WAVEFORM_SAMPLES_PER_PIXEL"`
+	WaveformBits            int  `yaml:"waveform_bits" envconfig:"WAVEFORM_BITS"`
+	WaveformRMS             bool `yaml:"waveform_rms" envconfig:"WAVEFORM_RMS"`
+
+	// Preview images stored with each sample and served from /image, a
+	// waveform and a mel spectrogram of SpectrogramBands bands (default
+	// 128), WaveformImageWidth by WaveformImageHeight (default 1200x300).
+	// Waveform colors are hex, e.g. #9747ff. The background is
+	// transparent unless set.
+	WaveformImageWidth  int    `yaml:"waveform_image_width" envconfig:"WAVEFORM_IMAGE_WIDTH"`
+	WaveformImageHeight int    `yaml:"waveform_image_height" envconfig:"WAVEFORM_IMAGE_HEIGHT"`
+	WaveformColor       string `yaml:"waveform_color" envconfig:"WAVEFORM_COLOR"`
+	WaveformPlayedColor string `yaml:"waveform_played_color" envconfig:"WAVEFORM_PLAYED_COLOR"`
+	WaveformBackground  string `yaml:"waveform_background" envconfig:"WAVEFORM_BACKGROUND"`
+	SpectrogramBands    int    `yaml:"spectrogram_bands" envconfig:"SPECTROGRAM_BANDS"`
+}
+
+// SubscriptionOption is a subscription length and its price. The price is
+// either Sats, or Price in Currency converted at invoice time.
+type SubscriptionOption struct {
+	Days     int     `yaml:"days" json:"days"`
+	Sats     int     `yaml:"sats" json:"sats,omitempty"`
+	Price    float64 `yaml:"price" json:"price,omitempty"`
+	Currency string  `yaml:"currency" json:"currency,omitempty"`
+}
+
+// hasFiatPricing reports whether any subscription option is priced in fiat.
+func (c *Config) hasFiatPricing() bool {
+	for _, opt := range c.SubscriptionOptions {
+		if opt.Currency != "" {
+			return true
+		}
+	}
+	return false
 }
 
 // Load Config from a yaml file at path.
@@ -87,4 +162,22 @@ func (c *Config) applyDefaults() {
 	if c.StreamBitrate == "" {
 		c.StreamBitrate = defaultStreamBitrate
 	}
+	if c.ReconcileIntervalSeconds == 0 {
+		c.ReconcileIntervalSeconds = defaultReconcileInterval
+	}
+	if c.ReconcileMaxBackoffSeconds == 0 {
+		c.ReconcileMaxBackoffSeconds = defaultReconcileMaxBackoff
+	}
+	if len(c.RateSources) == 0 {
+		c.RateSources = defaultRateSources
+	}
+	if c.RateCacheSeconds == 0 {
+		c.RateCacheSeconds = defaultRateCacheSeconds
+	}
+	if c.RateMaxStaleSeconds == 0 {
+		c.RateMaxStaleSeconds = defaultRateMaxStaleSeconds
+	}
+	for i, opt := range c.SubscriptionOptions {
+		c.SubscriptionOptions[i].Currency = strings.ToUpper(opt.Currency)
+	}
 }
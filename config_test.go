@@ -28,6 +28,9 @@ subscription_options:
     sats: 1000
   - days: 14
     sats: 2000
+  - days: 30
+    price: 5
+    currency: usd
 `))
 	assert.NoError(t, err)
 
@@ -39,8 +42,10 @@ subscription_options:
 	assert.Equal(t, "http://localhost:9000/download", cfg.DownloadBase)
 	assert.Equal(t, "http://localhost:9000/stream", cfg.StreamBase)
 	assert.Equal(t, []string{"image/jpg", "image/png"}, cfg.AcceptedMimetypes)
-	assert.Len(t, cfg.SubscriptionOptions, 2)
+	assert.Len(t, cfg.SubscriptionOptions, 3)
 	assert.Equal(t, 7, cfg.SubscriptionOptions[0].Days)
+	assert.Equal(t, SubscriptionOption{Days: 30, Price: 5, Currency: "USD"}, cfg.SubscriptionOptions[2])
+	assert.Equal(t, defaultRateSources, cfg.RateSources)
 }
 
 func TestLoadConfigFromEnv(t *testing.T) {
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stemstr/storage/internal/moderation"
+	"github.com/stemstr/storage/internal/service"
+	"github.com/stemstr/storage/internal/waveform"
+)
+
+const testPubkey = "0000000000000000000000000000000000000000000000000000000000000001"
+
+func TestSubscribeAndUpload(t *testing.T) {
+	srv := newTestServer(t, Config{
+		SubscriptionOptions: []SubscriptionOption{{Days: 30, Sats: 1000}},
+	})
+	data := readTestWAV(t)
+
+	resp, _ := srv.upload(t, testPubkey, data)
+	assert.Equal(t, http.StatusPaymentRequired, resp.StatusCode)
+
+	resp, body := srv.request(t, http.MethodPost, "/subscription/"+testPubkey+"?days=30")
+	if !assert.Equal(t, http.StatusPaymentRequired, resp.StatusCode) {
+		return
+	}
+	assert.NoError(t, srv.ln.Pay(body["lightning_invoice"].(string)))
+
+	assert.Eventually(t, func() bool {
+		resp, _ := srv.request(t, http.MethodGet, "/subscription/"+testPubkey)
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	resp, body = srv.upload(t, testPubkey, data)
+	if !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+	assert.NotEmpty(t, body["download_hash"])
+	assert.NotEmpty(t, body["waveform"])
+	assert.NotEmpty(t, body["peaks_url"])
+	assert.NotEmpty(t, body["image"])
+	assert.NotEmpty(t, body["thumb"])
+
+	srv.assertDownload(t, data)
+	srv.assertPeaks(t, data)
+	srv.assertImages(t, data)
+}
+
+func TestHiddenSamples(t *testing.T) {
+	// A file uploaded by someone else first is still hidden with a ban of
+	// everyone who uploaded it.
+	for name, firstUploader := range map[string]string{
+		"own upload":    "",
+		"shared upload": "4b2d9f0e5e8fd7bd1dd3a1e8b8c4c6f5bf0a7d3bd6a1a9b1d5b52f8c7a0e6d21",
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := newTestServer(t, Config{
+				SubscriptionOptions: []SubscriptionOption{{Days: 30, Sats: 1000}},
+			})
+			data := readTestWAV(t)
+			sum := sha256Hex(data)
+
+			if firstUploader != "" {
+				assert.NoError(t, srv.repo.CreateSample(context.Background(), service.Sample{Sum: sum, Pubkey: firstUploader, Mimetype: "audio/wave"}))
+			}
+
+			_, body := srv.request(t, http.MethodPost, "/subscription/"+testPubkey+"?days=30")
+			assert.NoError(t, srv.ln.Pay(body["lightning_invoice"].(string)))
+			assert.Eventually(t, func() bool {
+				resp, _ := srv.request(t, http.MethodGet, "/subscription/"+testPubkey)
+				return resp.StatusCode == http.StatusOK
+			}, 5*time.Second, 10*time.Millisecond)
+			resp, _ := srv.upload(t, testPubkey, data)
+			if !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+				return
+			}
+
+			// Streams redirect to the CDN, so don't follow them
+			client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}}
+			get := func(path string) int {
+				resp, err := client.Get(srv.URL + path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				return resp.StatusCode
+			}
+
+			paths := map[string]int{
+				"/download/" + sum + ".wav":  http.StatusOK,
+				"/waveform/" + sum + ".json": http.StatusOK,
+				"/stream/" + sum + ".m3u8":   http.StatusTemporaryRedirect,
+				"/stream/" + sum + "000.ts":  http.StatusTemporaryRedirect,
+			}
+			for path, status := range paths {
+				assert.Equal(t, status, get(path), path)
+			}
+
+			_, err := srv.repo.CreateBan(context.Background(), moderation.Ban{Pubkey: testPubkey, HideSamples: true})
+			assert.NoError(t, err)
+			for path := range paths {
+				assert.Equal(t, http.StatusNotFound, get(path), path)
+			}
+		})
+	}
+}
+
+// Samples uploaded before peaks were generated have no waveform to redraw.
+func TestImageWithoutPeaks(t *testing.T) {
+	srv := newTestServer(t, Config{})
+	sum := sha256Hex([]byte("no peaks"))
+	err := srv.repo.CreateSample(context.Background(), service.Sample{Sum: sum, Pubkey: testPubkey, Mimetype: "audio/wave"})
+	assert.NoError(t, err)
+
+	for _, name := range []string{"waveform.png", "waveform.png?played=0.5", "waveform.svg?played=1"} {
+		resp, _ := srv.request(t, http.MethodGet, "/image/"+sum+"/"+name)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, name)
+	}
+}
+
+func TestSubscriptionHistory(t *testing.T) {
+	srv := newTestServer(t, Config{
+		SubscriptionOptions: []SubscriptionOption{{Days: 30, Sats: 1000}, {Days: 365, Sats: 10000}},
+	})
+
+	_, body := srv.request(t, http.MethodPost, "/subscription/"+testPubkey+"?days=30")
+	assert.NoError(t, srv.ln.Pay(body["lightning_invoice"].(string)))
+	assert.Eventually(t, func() bool {
+		resp, _ := srv.request(t, http.MethodGet, "/subscription/"+testPubkey)
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	srv.request(t, http.MethodPost, "/subscription/"+testPubkey+"?days=365")
+
+	var history []map[string]any
+	srv.getJSON(t, "/subscription/"+testPubkey+"/history", &history)
+	if assert.Len(t, history, 2) {
+		assert.EqualValues(t, 365, history[0]["days"])
+		assert.Equal(t, "pending", history[0]["status"])
+		assert.EqualValues(t, 30, history[1]["days"])
+		assert.Equal(t, "paid", history[1]["status"])
+	}
+
+	srv.getJSON(t, "/subscription/"+testPubkey+"/history?limit=1&offset=1", &history)
+	if assert.Len(t, history, 1) {
+		assert.EqualValues(t, 30, history[0]["days"])
+	}
+}
+
+func TestPayPerUpload(t *testing.T) {
+	srv := newTestServer(t, Config{
+		UploadSatsPerMB: 10,
+	})
+	data := readTestWAV(t)
+
+	resp, body := srv.upload(t, testPubkey, data)
+	if !assert.Equal(t, http.StatusPaymentRequired, resp.StatusCode) {
+		return
+	}
+	assert.Equal(t, "pending", body["status"])
+	assert.EqualValues(t, 12, body["sats"])
+	invoiceID := body["invoice_id"].(string)
+
+	// Held until paid
+	resp, _ = srv.request(t, http.MethodGet, "/download/"+sha256Hex(data)+".wav")
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+
+	assert.NoError(t, srv.ln.Pay(body["lightning_invoice"].(string)))
+
+	assert.Eventually(t, func() bool {
+		_, body := srv.request(t, http.MethodGet, "/upload/"+invoiceID)
+		return body["status"] == "processed"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	srv.assertDownload(t, data)
+}
+
+func TestSeveralPayments(t *testing.T) {
+	srv := newTestServer(t, Config{
+		SubscriptionOptions: []SubscriptionOption{{Days: 30, Sats: 1000}},
+		UploadSatsPerMB:     10,
+	})
+	pubkeys := []string{
+		testPubkey,
+		"0000000000000000000000000000000000000000000000000000000000000002",
+	}
+
+	// Each payment is confirmed as the provider reports it, not just the
+	// first. Reading the subscription would check the invoice itself, so
+	// look at the history instead.
+	for _, pubkey := range pubkeys {
+		_, body := srv.request(t, http.MethodPost, "/subscription/"+pubkey+"?days=30")
+		assert.NoError(t, srv.ln.Pay(body["lightning_invoice"].(string)))
+
+		var history []map[string]any
+		srv.getJSON(t, "/subscription/"+pubkey+"/history", &history)
+		if assert.Len(t, history, 1, pubkey) {
+			assert.Equal(t, "paid", history[0]["status"], pubkey)
+		}
+	}
+
+	data := readTestWAV(t)
+	uploader := "0000000000000000000000000000000000000000000000000000000000000003"
+	_, body := srv.upload(t, uploader, data)
+	assert.NoError(t, srv.ln.Pay(body["lightning_invoice"].(string)))
+	assert.Eventually(t, func() bool {
+		resp, _ := srv.request(t, http.MethodGet, "/download/"+sha256Hex(data)+".wav")
+		return resp.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPendingRenewals(t *testing.T) {
+	srv := newTestServer(t, Config{
+		SubscriptionOptions: []SubscriptionOption{
+			{Days: 30, Sats: 1000},
+			{Days: 365, Sats: 10000},
+		},
+	})
+
+	_, body := srv.request(t, http.MethodPost, "/subscription/"+testPubkey+"?days=30")
+	assert.NoError(t, srv.ln.Pay(body["lightning_invoice"].(string)))
+
+	// Two renewals requested before either is paid, then paid in the
+	// opposite order. Each period follows the last one paid.
+	_, month := srv.request(t, http.MethodPost, "/subscription/"+testPubkey+"?days=30")
+	_, year := srv.request(t, http.MethodPost, "/subscription/"+testPubkey+"?days=365")
+	assert.NoError(t, srv.ln.Pay(year["lightning_invoice"].(string)))
+	assert.NoError(t, srv.ln.Pay(month["lightning_invoice"].(string)))
+
+	var history []struct {
+		Status    string `json:"status"`
+		StartsAt  int64  `json:"starts_at"`
+		ExpiresAt int64  `json:"expires_at"`
+	}
+	srv.getJSON(t, "/subscription/"+testPubkey+"/history", &history)
+	if !assert.Len(t, history, 3) {
+		return
+	}
+	for _, sub := range history {
+		assert.Equal(t, "paid", sub.Status)
+	}
+
+	// Newest first
+	first, renewal, yearly := history[2], history[1], history[0]
+	assert.Equal(t, first.ExpiresAt, yearly.StartsAt)
+	assert.Equal(t, yearly.ExpiresAt, renewal.StartsAt)
+	assert.Equal(t, int64(30*24*time.Hour/time.Second), renewal.ExpiresAt-renewal.StartsAt)
+}
+
+func TestUploadMismatchedContent(t *testing.T) {
+	srv := newTestServer(t, Config{
+		UploadSatsPerMB: 10,
+	})
+	data, err := os.ReadFile("internal/encoder/testdata/test.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, _ := srv.uploadFile(t, testPubkey, "test.wav", data)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, _ = srv.uploadFile(t, testPubkey, "test.mp3", data)
+	assert.Equal(t, http.StatusPaymentRequired, resp.StatusCode)
+
+	// Voice memos are Opus, in Ogg files named either way
+	data, err = os.ReadFile("internal/encoder/testdata/test.opus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range []string{"memo.ogg", "memo.opus"} {
+		resp, _ = srv.uploadFile(t, testPubkey, filename, data)
+		assert.Equal(t, http.StatusPaymentRequired, resp.StatusCode, filename)
+	}
+
+	// A CAF of IMA ADPCM, which the encoder doesn't take
+	ima4 := []byte("caff\x00\x01\x00\x00desc\x00\x00\x00\x00\x00\x00\x00\x20" +
+		"\x40\xe5\x88\x80\x00\x00\x00\x00ima4\x00\x00\x00\x00")
+	resp, _ = srv.uploadFile(t, testPubkey, "test.caf", append(ima4, make([]byte, 32)...))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// upload posts data as a WAV from pubkey.
+func (s *testServer) upload(t *testing.T, pubkey string, data []byte) (*http.Response, map[string]any) {
+	t.Helper()
+	return s.uploadFile(t, pubkey, "test.wav", data)
+}
+
+// uploadFile posts data as filename from pubkey.
+func (s *testServer) uploadFile(t *testing.T, pubkey, filename string, data []byte) (*http.Response, map[string]any) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("pk", pubkey)
+	mw.WriteField("sum", sha256Hex(data))
+	mw.WriteField("filename", filename)
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	mw.Close()
+
+	resp, err := http.Post(s.URL+"/upload", mw.FormDataContentType(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, decodeBody(t, resp)
+}
+
+// request makes a request without a body, decoding any JSON response.
+func (s *testServer) request(t *testing.T, method, path string) (*http.Response, map[string]any) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, s.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, decodeBody(t, resp)
+}
+
+// getJSON decodes the JSON response to a GET of path into v.
+func (s *testServer) getJSON(t *testing.T, path string, v any) {
+	t.Helper()
+
+	resp, err := http.Get(s.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %v: %v", path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertDownload checks data, a WAV, can be downloaded.
+func (s *testServer) assertDownload(t *testing.T, data []byte) {
+	t.Helper()
+
+	resp, err := http.Get(fmt.Sprintf("%v/download/%v.wav", s.URL, sha256Hex(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	downloaded, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, data, downloaded)
+}
+
+// assertPeaks checks the peaks of data, a WAV, are served in both formats.
+func (s *testServer) assertPeaks(t *testing.T, data []byte) {
+	t.Helper()
+
+	var peaks waveform.Peaks
+	s.getJSON(t, "/waveform/"+sha256Hex(data)+".json", &peaks)
+	assert.Equal(t, 2, peaks.Version)
+	assert.NotZero(t, peaks.Length)
+
+	resp, err := http.Get(fmt.Sprintf("%v/waveform/%v.dat", s.URL, sha256Hex(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	dat, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	var datPeaks waveform.Peaks
+	assert.NoError(t, datPeaks.UnmarshalBinary(dat))
+	assert.Equal(t, peaks, datPeaks)
+
+	resp, _ = s.request(t, http.MethodGet, "/waveform/unknown.json")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// assertImages checks the preview images of data, a WAV, are served.
+func (s *testServer) assertImages(t *testing.T, data []byte) {
+	t.Helper()
+
+	get := func(path string) (*http.Response, []byte) {
+		resp, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp, body
+	}
+
+	prefix := "/image/" + sha256Hex(data) + "/"
+	images := map[string][]byte{}
+	for _, name := range []string{"waveform.png", "spectrogram.png", "waveform.png?played=0.5"} {
+		resp, body := get(prefix + name)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, name)
+		assert.Equal(t, "image/png", resp.Header.Get("Content-Type"), name)
+		_, err := png.Decode(bytes.NewReader(body))
+		assert.NoError(t, err, name)
+		images[name] = body
+	}
+	assert.NotEqual(t, images["waveform.png"], images["waveform.png?played=0.5"])
+
+	resp, body := get(prefix + "waveform.svg")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/svg+xml", resp.Header.Get("Content-Type"))
+	assert.True(t, bytes.HasPrefix(body, []byte("<svg")))
+
+	resp, _ = get(prefix + "waveform.png?played=2")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = get(prefix + "unknown.png")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func decodeBody(t *testing.T, resp *http.Response) map[string]any {
+	t.Helper()
+	defer resp.Body.Close()
+
+	var body map[string]any
+	if resp.Header.Get("Content-Type") == "application/json" {
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return body
+}
+
+func readTestWAV(t *testing.T) []byte {
+	data, err := os.ReadFile("internal/encoder/testdata/test.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func sha256Hex(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
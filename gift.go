@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+	"github.com/nbd-wtf/go-nostr/nip19"
+
+	"github.com/stemstr/storage/internal/subscription"
+)
+
+// giftNotifier DMs the recipients of gift subscriptions from the blastr
+// key.
+type giftNotifier struct {
+	sk   string
+	send func(ctx context.Context, ev nostr.Event) error
+}
+
+func newGiftNotifier(nsec string, send func(ctx context.Context, ev nostr.Event) error) (*giftNotifier, error) {
+	_, sk, err := nip19.Decode(nsec)
+	if err != nil {
+		return nil, fmt.Errorf("blastr_nsec: %w", err)
+	}
+
+	return &giftNotifier{sk: sk.(string), send: send}, nil
+}
+
+// NotifyGift implements subscription.GiftNotifier.
+func (n *giftNotifier) NotifyGift(ctx context.Context, sub subscription.Subscription) error {
+	shared, err := nip04.ComputeSharedSecret(sub.Pubkey, n.sk)
+	if err != nil {
+		return fmt.Errorf("ComputeSharedSecret: %w", err)
+	}
+
+	from, err := nip19.EncodePublicKey(sub.GiftedBy)
+	if err != nil {
+		return fmt.Errorf("EncodePublicKey: %w", err)
+	}
+	content, err := nip04.Encrypt(fmt.Sprintf("nostr:%s gifted you a %d day Stemstr subscription 🎁", from, sub.Days), shared)
+	if err != nil {
+		return fmt.Errorf("Encrypt: %w", err)
+	}
+
+	return n.send(ctx, nostr.Event{
+		Kind:    nostr.KindEncryptedDirectMessage,
+		Tags:    nostr.Tags{{"p", sub.Pubkey}},
+		Content: content,
+	})
+}
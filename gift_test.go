@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stemstr/storage/internal/subscription"
+)
+
+func TestGiftNotifier(t *testing.T) {
+	var (
+		botSK          = nostr.GeneratePrivateKey()
+		botPK, _       = nostr.GetPublicKey(botSK)
+		nsec, _        = nip19.EncodePrivateKey(botSK)
+		recipientSK    = nostr.GeneratePrivateKey()
+		recipientPK, _ = nostr.GetPublicKey(recipientSK)
+		payerPK, _     = nostr.GetPublicKey(nostr.GeneratePrivateKey())
+		payerNpub, _   = nip19.EncodePublicKey(payerPK)
+	)
+
+	var sent nostr.Event
+	n, err := newGiftNotifier(nsec, func(ctx context.Context, ev nostr.Event) error {
+		sent = ev
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = n.NotifyGift(context.Background(), subscription.Subscription{Pubkey: recipientPK, GiftedBy: payerPK, Days: 30})
+	assert.NoError(t, err)
+	assert.Equal(t, nostr.KindEncryptedDirectMessage, sent.Kind)
+	assert.Equal(t, recipientPK, sent.Tags.GetFirst([]string{"p", ""}).Value())
+
+	// The recipient can read it
+	shared, err := nip04.ComputeSharedSecret(botPK, recipientSK)
+	assert.NoError(t, err)
+	msg, err := nip04.Decrypt(sent.Content, shared)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(msg, "nostr:"+payerNpub+" gifted you a 30 day"))
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/stemstr/storage/internal/nip98"
+	"github.com/stemstr/storage/internal/subscription"
+)
+
+// kindFollowSet is a NIP-51 set of pubkeys, which can be imported as the
+// members of a group.
+const kindFollowSet = 30000
+
+// authenticateOwner checks r carries NIP-98 auth from the pubkey in the
+// URL, writing an error response if it doesn't.
+func (h *handlers) authenticateOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	owner := chi.URLParam(r, "pubkey")
+
+	pubkey, err := nip98.Authenticate(r, h.requestURL(r))
+	if err != nil {
+		log.Printf("group auth failed: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	if pubkey != owner {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return "", false
+	}
+
+	return owner, true
+}
+
+// handleGetGroupMembers lists the pubkeys sharing a subscription
+func (h *handlers) handleGetGroupMembers(w http.ResponseWriter, r *http.Request) {
+	members, err := h.subs.GetGroupMembers(r.Context(), chi.URLParam(r, "pubkey"))
+	if err != nil {
+		log.Printf("err: subs.GetGroupMembers: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if members == nil {
+		members = []subscription.GroupMember{}
+	}
+
+	writeJSON(w, http.StatusOK, members)
+}
+
+// handleAddGroupMember shares the owner's subscription with a pubkey
+func (h *handlers) handleAddGroupMember(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.authenticateOwner(w, r)
+	if !ok {
+		return
+	}
+
+	member := chi.URLParam(r, "member")
+	if !validPubkey(member) {
+		http.Error(w, "invalid pubkey", http.StatusBadRequest)
+		return
+	}
+
+	err := h.subs.AddGroupMember(r.Context(), owner, member)
+	if err != nil {
+		writeGroupError(w, "AddGroupMember", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRemoveGroupMember stops sharing the owner's subscription with a
+// pubkey
+func (h *handlers) handleRemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.authenticateOwner(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.subs.RemoveGroupMember(r.Context(), owner, chi.URLParam(r, "member"))
+	if errors.Is(err, subscription.ErrGroupMemberNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("err: subs.RemoveGroupMember: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleImportGroupMembers replaces the owner's group with the pubkeys of a
+// NIP-51 follow set signed by the owner.
+func (h *handlers) handleImportGroupMembers(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.authenticateOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var list nostr.Event
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		http.Error(w, "expected JSON nostr event", http.StatusBadRequest)
+		return
+	}
+	members, err := listMembers(list, owner)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.subs.SetGroupMembers(r.Context(), owner, members); err != nil {
+		writeGroupError(w, "SetGroupMembers", err)
+		return
+	}
+
+	h.handleGetGroupMembers(w, r)
+}
+
+// listMembers extracts the pubkeys of a NIP-51 follow set published by
+// owner.
+func listMembers(list nostr.Event, owner string) ([]string, error) {
+	if list.Kind != kindFollowSet {
+		return nil, fmt.Errorf("list must be kind %d", kindFollowSet)
+	}
+	if list.PubKey != owner {
+		return nil, errors.New("list must be signed by the owner")
+	}
+	if list.ID != list.GetID() {
+		return nil, errors.New("list id mismatch")
+	}
+	if ok, err := list.CheckSignature(); err != nil || !ok {
+		return nil, errors.New("invalid list signature")
+	}
+
+	var members []string
+	for _, tag := range list.Tags.GetAll([]string{"p", ""}) {
+		if !validPubkey(tag.Value()) {
+			return nil, fmt.Errorf("invalid pubkey %q", tag.Value())
+		}
+		members = append(members, tag.Value())
+	}
+
+	return members, nil
+}
+
+func writeGroupError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, subscription.ErrSubscriptionNotFound):
+		http.Error(w, "owner has no active subscription", http.StatusPaymentRequired)
+	case errors.Is(err, subscription.ErrInvalidGroupMember), errors.Is(err, subscription.ErrGroupFull):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("err: subs.%v: %v", op, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
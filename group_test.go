@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListMembers(t *testing.T) {
+	var (
+		ownerSK    = nostr.GeneratePrivateKey()
+		ownerPK, _ = nostr.GetPublicKey(ownerSK)
+		otherSK    = nostr.GeneratePrivateKey()
+		memberA, _ = nostr.GetPublicKey(nostr.GeneratePrivateKey())
+		memberB, _ = nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	)
+
+	list := func(sk string, kind int, tags nostr.Tags) nostr.Event {
+		ev := nostr.Event{Kind: kind, CreatedAt: nostr.Now(), Tags: tags}
+		assert.NoError(t, ev.Sign(sk))
+		return ev
+	}
+	members := nostr.Tags{{"d", "band"}, {"p", memberA}, {"p", memberB, "wss://relay.example"}}
+
+	var tests = []struct {
+		name    string
+		list    nostr.Event
+		members []string
+		wantErr bool
+	}{
+		{"follow set", list(ownerSK, kindFollowSet, members), []string{memberA, memberB}, false},
+		{"empty", list(ownerSK, kindFollowSet, nostr.Tags{{"d", "band"}}), nil, false},
+		{"wrong kind", list(ownerSK, nostr.KindContactList, members), nil, true},
+		{"not the owner", list(otherSK, kindFollowSet, members), nil, true},
+		{"bad pubkey", list(ownerSK, kindFollowSet, nostr.Tags{{"p", "npub1xyz"}}), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := listMembers(tt.list, ownerPK)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.members, got)
+		})
+	}
+
+	// Tampered
+	ev := list(ownerSK, kindFollowSet, members)
+	ev.Tags = append(ev.Tags, nostr.Tag{"p", memberA})
+	_, err := listMembers(ev, ownerPK)
+	assert.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/json"
@@ -10,28 +11,63 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/stemstr/storage/internal/audit"
+	"github.com/stemstr/storage/internal/cashu"
 	"github.com/stemstr/storage/internal/mimes"
+	"github.com/stemstr/storage/internal/moderation"
+	"github.com/stemstr/storage/internal/nip98"
+	"github.com/stemstr/storage/internal/rates"
 	"github.com/stemstr/storage/internal/service"
 	"github.com/stemstr/storage/internal/subscription"
+	"github.com/stemstr/storage/internal/subscription/ln/nodeless"
+	"github.com/stemstr/storage/internal/upload"
+	"github.com/stemstr/storage/internal/zap"
 )
 
 type handlers struct {
 	config Config
 	svc    *service.Service
 	subs   *subscription.SubscriptionService
+	bans   *moderation.Service
+	audit  *audit.Log
 	blastr blastrIface
+	zbd    paymentVerifier
+	// nodeless is set when nodeless webhooks are configured.
+	nodeless nodelessWebhooks
+	// zaps is set when zaps are configured.
+	zaps *zap.Service
+	// cashu is set when trusted mints are configured.
+	cashu *cashu.Service
+	// uploads is set when pay-per-upload is enabled.
+	uploads *upload.Service
 }
 
 type blastrIface interface {
 	SendText(context.Context, string) error
 }
 
+type paymentVerifier interface {
+	VerifyPayment(ctx context.Context, invoiceID string) (*subscription.Payment, error)
+}
+
+// paymentWatcher is implemented by providers that push payments from their
+// own node rather than calling a webhook.
+type paymentWatcher interface {
+	WatchPayments(ctx context.Context, paid func(subscription.Payment))
+}
+
+type nodelessWebhooks interface {
+	paymentVerifier
+	ParseWebhook(body []byte, signature string) (*nodeless.WebhookEvent, error)
+}
+
 // handleDownloadMedia fetches stored media
 func (h *handlers) handleDownloadMedia(w http.ResponseWriter, r *http.Request) {
 	var (
@@ -44,6 +80,17 @@ func (h *handlers) handleDownloadMedia(w http.ResponseWriter, r *http.Request) {
 		filename += ".wav"
 	}
 
+	hidden, err := h.sampleHidden(ctx, strings.TrimSuffix(filename, ".wav"))
+	if err != nil {
+		log.Printf("err: sampleHidden: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hidden {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
 	resp, err := h.svc.GetSample(ctx, filename)
 	if err != nil {
 		log.Printf("err: svc.GetSample: %v", err)
@@ -59,62 +106,321 @@ func (h *handlers) handleDownloadMedia(w http.ResponseWriter, r *http.Request) {
 	w.Write(resp.Data)
 }
 
+// handleGetPeaks serves a sample's waveform peaks in the audiowaveform
+// JSON or binary format, by the extension of the filename.
+func (h *handlers) handleGetPeaks(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx      = r.Context()
+		filename = chi.URLParam(r, "filename")
+		ext      = path.Ext(filename)
+	)
+
+	if ext != ".json" && ext != ".dat" {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	hidden, err := h.sampleHidden(ctx, strings.TrimSuffix(filename, ext))
+	if err != nil {
+		log.Printf("err: sampleHidden: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hidden {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	// Samples uploaded before peaks were generated have none.
+	resp, err := h.svc.GetPeaks(ctx, filename)
+	if errors.Is(err, service.ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("err: svc.GetPeaks: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp.Data)))
+	w.Header().Set("Content-Type", resp.ContentType)
+	w.Write(resp.Data)
+}
+
+// handleGetImage serves a sample's preview images. Waveform images are
+// redrawn with playback progress when the played query parameter, from 0
+// to 1, is given.
+func (h *handlers) handleGetImage(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx  = r.Context()
+		sum  = chi.URLParam(r, "sum")
+		name = chi.URLParam(r, "name")
+	)
+
+	hidden, err := h.sampleHidden(ctx, sum)
+	if err != nil {
+		log.Printf("err: sampleHidden: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hidden {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	var resp *service.GetSampleResponse
+	played := r.URL.Query().Get("played")
+	if played != "" && (name == service.WaveformPNG || name == service.WaveformSVG) {
+		fraction, parseErr := strconv.ParseFloat(played, 64)
+		if parseErr != nil || fraction < 0 || fraction > 1 {
+			http.Error(w, "played must be from 0 to 1", http.StatusBadRequest)
+			return
+		}
+		resp, err = h.svc.RenderWaveformImage(ctx, sum, name, fraction)
+	} else {
+		resp, err = h.svc.GetImage(ctx, sum, name)
+	}
+	// Samples uploaded before images were generated have none.
+	if errors.Is(err, service.ErrNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("err: svc.GetImage: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp.Data)))
+	w.Header().Set("Content-Type", resp.ContentType)
+	w.Write(resp.Data)
+}
+
 // handleGetStream redirects requests for stream files to the new CDN.
 // Some early notes have a stream_url pointed at the api.
 func (h *handlers) handleGetStream(w http.ResponseWriter, r *http.Request) {
-	var filename = chi.URLParam(r, "filename")
+	var (
+		ctx      = r.Context()
+		filename = chi.URLParam(r, "filename")
+	)
+
+	// Stream files are the sample's sum followed by .m3u8 for the index,
+	// or a segment number and .ts.
+	sum := strings.TrimSuffix(filename, path.Ext(filename))
+	if len(sum) > sha256.Size*2 {
+		sum = sum[:sha256.Size*2]
+	}
+	hidden, err := h.sampleHidden(ctx, sum)
+	if err != nil {
+		log.Printf("err: sampleHidden: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hidden {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
 
 	cdnURL, _ := url.JoinPath("https://cdn.stemstr.app/stream", filename)
 	http.Redirect(w, r, cdnURL, http.StatusTemporaryRedirect)
 }
 
-// handleGetSubscriptionOptions returns subscription options
+// handleGetSubscriptionOptions returns subscription options. Fiat priced
+// options include their current price in sats.
 func (h *handlers) handleGetSubscriptionOptions(w http.ResponseWriter, r *http.Request) {
-	jsonb, _ := json.Marshal(h.config.SubscriptionOptions)
+	ctx := r.Context()
+
+	options := make([]SubscriptionOption, 0, len(h.config.SubscriptionOptions))
+	for _, opt := range h.config.SubscriptionOptions {
+		sats, _, err := h.subs.PriceInSats(ctx, newSubscription("", opt))
+		if err != nil {
+			log.Printf("err: subs.PriceInSats: %v", err)
+			http.Error(w, "exchange rate unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		opt.Sats = sats
+		options = append(options, opt)
+	}
+	jsonb, _ := json.Marshal(options)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(jsonb)
 	return
 }
 
-// handleGetSubscription fetches the active subscription for a pubkey
+// handleGetSubscription fetches the active subscription for a pubkey along
+// with any paid renewals queued after it
 func (h *handlers) handleGetSubscription(w http.ResponseWriter, r *http.Request) {
 	var (
 		ctx    = r.Context()
 		pubkey = chi.URLParam(r, "pubkey")
 	)
 
-	sub, err := h.subs.GetActiveSubscription(ctx, pubkey)
+	sub, queued, err := h.subs.GetSubscriptionPeriods(ctx, pubkey)
 	if err != nil {
-		switch {
-		case errors.Is(err, subscription.ErrSubscriptionNotFound):
-			log.Printf("sub not found: pk=%v\n", pubkey)
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		case errors.Is(err, subscription.ErrSubscriptionExpired):
-			log.Printf("sub expired: pk=%v\n", pubkey)
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		default:
-			log.Printf("err: subs.GetSubscriptionStatus: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		log.Printf("err: subs.GetSubscriptionPeriods: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sub == nil {
+		log.Printf("sub not found: pk=%v\n", pubkey)
+		http.Error(w, subscription.ErrSubscriptionNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	queuedPeriods := []map[string]any{}
+	paidThrough := sub.ExpiresAt
+	for _, q := range queued {
+		queuedPeriods = append(queuedPeriods, subscriptionPeriod(q))
+		if q.ExpiresAt.After(paidThrough) {
+			paidThrough = q.ExpiresAt
 		}
 	}
 
-	jsonb, _ := json.Marshal(map[string]any{
-		"days":       sub.Days,
-		"created_at": sub.CreatedAt.Unix(),
-		"expires_at": sub.ExpiresAt.Unix(),
-	})
+	resp := subscriptionPeriod(*sub)
+	resp["queued"] = queuedPeriods
+	resp["paid_through"] = paidThrough.Unix()
+	if sub.Pubkey != pubkey {
+		// Shared by a group owner
+		resp["owner"] = sub.Pubkey
+	}
+	jsonb, _ := json.Marshal(resp)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(jsonb)
 }
 
+// handleGetSubscriptionHistory lists every subscription for pubkey, newest
+// first, paginated by limit and offset query params.
+func (h *handlers) handleGetSubscriptionHistory(w http.ResponseWriter, r *http.Request) {
+	var (
+		pubkey        = chi.URLParam(r, "pubkey")
+		limit, offset = pagination(r)
+	)
+
+	subs, err := h.subs.GetSubscriptionHistory(r.Context(), pubkey, limit, offset)
+	if err != nil {
+		log.Printf("err: subs.GetSubscriptionHistory: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	history := []map[string]any{}
+	for _, sub := range subs {
+		period := subscriptionPeriod(sub)
+		period["status"] = sub.Status
+		period["sats"] = sub.Sats
+		history = append(history, period)
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
 // handleCreateSubscription creates a new subscription. If pubkey already
-// has an active subscription, it will be returned.
+// has an active subscription, the new one is a renewal starting when the
+// existing paid time runs out. A promo code may be applied with ?code=, in
+// which case days may be omitted for codes granting free days. Requests
+// with NIP-98 auth from another pubkey are gifts to pubkey.
 func (h *handlers) handleCreateSubscription(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx     = r.Context()
+		pubkey  = chi.URLParam(r, "pubkey")
+		daysStr = r.URL.Query().Get("days")
+		code    = r.URL.Query().Get("code")
+	)
+
+	if daysStr == "" && code == "" {
+		http.Error(w, "must provide days query param", http.StatusBadRequest)
+		return
+	}
+
+	banned, err := h.bans.IsBanned(ctx, pubkey)
+	if err != nil {
+		log.Printf("err: bans.IsBanned: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if banned {
+		log.Printf("createSubscription blocked: %q is banned", pubkey)
+		http.Error(w, "pubkey banned", http.StatusForbidden)
+		return
+	}
+
+	var opt SubscriptionOption
+	if daysStr != "" {
+		days, err := strconv.Atoi(daysStr)
+		if err != nil {
+			http.Error(w, "days must be a valid subscription days", http.StatusBadRequest)
+			return
+		}
+
+		var ok bool
+		opt, ok = h.subscriptionOption(days)
+		if !ok {
+			http.Error(w, "invalid subscription days", http.StatusBadRequest)
+			return
+		}
+	}
+	newSub := newSubscription(pubkey, opt)
+
+	if r.Header.Get("Authorization") != "" {
+		payer, err := nip98.Authenticate(r, h.requestURL(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if payer != pubkey {
+			newSub.GiftedBy = payer
+		}
+	}
+
+	var sub *subscription.Subscription
+	if code != "" {
+		sub, err = h.subs.CreateSubscriptionWithCode(ctx, newSub, code)
+	} else {
+		sub, err = h.subs.CreateSubscription(ctx, newSub)
+	}
+	switch {
+	case errors.Is(err, subscription.ErrPromoCodeNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, subscription.ErrInvalidPromoCode):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, subscription.ErrPromoCodeExpired),
+		errors.Is(err, subscription.ErrPromoCodeExhausted),
+		errors.Is(err, subscription.ErrPromoCodeRedeemed):
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	case errors.Is(err, rates.ErrNoRate):
+		log.Printf("err: subs.CreateSubscription: %v", err)
+		http.Error(w, "exchange rate unavailable", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if sub.Status == subscription.StatusPaid {
+		// Promo code covered the whole price
+		writeJSON(w, http.StatusCreated, subscriptionPeriod(*sub))
+		return
+	}
+
+	resp := subscriptionPeriod(*sub)
+	resp["lightning_invoice"] = sub.LightningInvoice
+	writeJSON(w, http.StatusPaymentRequired, resp)
+}
+
+// handleCreateSubscriptionCashu buys a subscription with a Cashu token,
+// which is redeemed at its mint before the subscription is activated.
+func (h *handlers) handleCreateSubscriptionCashu(w http.ResponseWriter, r *http.Request) {
+	if h.cashu == nil {
+		http.Error(w, "cashu not configured", http.StatusNotFound)
+		return
+	}
+
 	var (
 		ctx     = r.Context()
 		pubkey  = chi.URLParam(r, "pubkey")
@@ -125,73 +431,96 @@ func (h *handlers) handleCreateSubscription(w http.ResponseWriter, r *http.Reque
 		http.Error(w, "must provide days query param", http.StatusBadRequest)
 		return
 	}
-	days, err := strconv.Atoi(daysStr)
+
+	banned, err := h.bans.IsBanned(ctx, pubkey)
 	if err != nil {
-		http.Error(w, "days must be a valid subscription days", http.StatusBadRequest)
+		log.Printf("err: bans.IsBanned: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if banned {
+		log.Printf("createSubscription blocked: %q is banned", pubkey)
+		http.Error(w, "pubkey banned", http.StatusForbidden)
 		return
 	}
 
-	subOptions := map[int]int{}
-	for _, opt := range h.config.SubscriptionOptions {
-		subOptions[opt.Days] = opt.Sats
+	days, err := strconv.Atoi(daysStr)
+	if err != nil {
+		http.Error(w, "days must be a valid subscription days", http.StatusBadRequest)
+		return
 	}
 
-	sats, ok := subOptions[days]
+	opt, ok := h.subscriptionOption(days)
 	if !ok {
 		http.Error(w, "invalid subscription days", http.StatusBadRequest)
 		return
 	}
-	now := time.Now()
-	expiry := now.Add(time.Hour * 24 * time.Duration(days))
 
-	existingSub, err := h.subs.GetActiveSubscription(ctx, pubkey)
-	if err != nil {
-		switch {
-		case errors.Is(err, subscription.ErrSubscriptionNotFound):
-			// noop
-			log.Printf("sub not found: pk=%v\n", pubkey)
-		case errors.Is(err, subscription.ErrSubscriptionExpired):
-			// noop
-			log.Printf("sub expired: pk=%v\n", pubkey)
-		default:
-			log.Printf("err: subs.GetSubscriptionStatus: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	var req struct {
+		Token string `json:"token"`
 	}
-
-	if existingSub != nil {
-		log.Printf("createSubscription: already exists! %#v", *existingSub)
-		http.Error(w, "active subscription", http.StatusConflict)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "expected JSON payload with token", http.StatusBadRequest)
 		return
 	}
 
-	sub, err := h.subs.CreateSubscription(ctx, subscription.Subscription{
-		Pubkey:    pubkey,
-		Days:      days,
-		Sats:      sats,
-		CreatedAt: now,
-		ExpiresAt: expiry,
-	})
-	if err != nil {
+	sub, change, err := h.cashu.Pay(ctx, newSubscription(pubkey, opt), req.Token)
+	switch {
+	case errors.Is(err, cashu.ErrInvalidToken),
+		errors.Is(err, cashu.ErrUntrustedMint),
+		errors.Is(err, cashu.ErrUnsupportedUnit),
+		errors.Is(err, cashu.ErrRejected):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, cashu.ErrInsufficient):
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+		return
+	case errors.Is(err, rates.ErrNoRate):
+		log.Printf("err: cashu.Pay: %v", err)
+		http.Error(w, "exchange rate unavailable", http.StatusServiceUnavailable)
+		return
+	case err != nil && change != "":
+		// The token was spent, so what's left of it must still be
+		// handed back.
+		log.Printf("err: cashu.Pay: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]any{
+			"error":  err.Error(),
+			"change": change,
+		})
+		return
+	case err != nil:
+		log.Printf("err: cashu.Pay: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	jsonb, _ := json.Marshal(map[string]any{
-		"lightning_invoice": sub.LightningInvoice,
-		"days":              sub.Days,
-		"created_at":        sub.CreatedAt.Unix(),
-		"expires_at":        sub.ExpiresAt.Unix(),
-	})
+	h.announceSubscription()
+	resp := subscriptionPeriod(*sub)
+	if change != "" {
+		resp["change"] = change
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
 
-	w.WriteHeader(http.StatusPaymentRequired)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonb)
-	return
+func subscriptionPeriod(sub subscription.Subscription) map[string]any {
+	return map[string]any{
+		"days":       sub.Days,
+		"created_at": sub.CreatedAt.Unix(),
+		"starts_at":  sub.StartsAt.Unix(),
+		"expires_at": sub.ExpiresAt.Unix(),
+	}
 }
 
+// handleCallbackZBDCharge handles ZBD charge callbacks. The payload is only
+// used to find the charge, which is then re-fetched from ZBD before the
+// subscription is marked paid. Callbacks that can't be acted on are still
+// acknowledged so ZBD doesn't retry them forever.
 func (h *handlers) handleCallbackZBDCharge(w http.ResponseWriter, r *http.Request) {
+	if h.zbd == nil {
+		http.Error(w, "zbd not configured", http.StatusNotFound)
+		return
+	}
+
 	var data struct {
 		Amount      string `json:"amount"`      // "1000000"
 		ConfirmedAt string `json:"confirmedAt"` // "2023-07-31T21:14:44.000Z"
@@ -213,25 +542,169 @@ func (h *handlers) handleCallbackZBDCharge(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if data.Status == "completed" {
-		ctx := r.Context()
-		err := h.subs.UpdateInvoiceStatus(ctx, data.ID, subscription.StatusPaid)
-		if err != nil {
-			log.Printf("error: updateInvoiceStatus: invoice_id=%v err=%v", data.ID, err.Error())
-			http.Error(w, "unable to update invoice status", http.StatusInternalServerError)
+	if data.Status != "completed" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ctx := r.Context()
+	payment, err := h.zbd.VerifyPayment(ctx, data.ID)
+	if err != nil {
+		if errors.Is(err, subscription.ErrInvoiceUnpaid) {
+			log.Printf("warn: zbd callback not confirmed: invoice_id=%v err=%v", data.ID, err)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		log.Printf("error: zbd.VerifyPayment: invoice_id=%v err=%v", data.ID, err)
+		http.Error(w, "unable to verify charge", http.StatusInternalServerError)
+		return
+	}
+
+	if !h.confirmPayment(ctx, *payment) {
+		http.Error(w, "unable to update invoice status", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleCallbackNodeless handles Nodeless store webhooks. Deliveries must be
+// signed with the webhook secret. Payments are re-fetched from Nodeless
+// before the subscription is marked paid.
+func (h *handlers) handleCallbackNodeless(w http.ResponseWriter, r *http.Request) {
+	if h.nodeless == nil {
+		http.Error(w, "nodeless webhooks not configured", http.StatusNotFound)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "unable to read body", http.StatusBadRequest)
+		return
+	}
+
+	event, err := h.nodeless.ParseWebhook(body, r.Header.Get(nodeless.SignatureHeader))
+	if err != nil {
+		if errors.Is(err, nodeless.ErrInvalidSignature) {
+			log.Printf("warn: nodeless webhook rejected: %v", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
+		http.Error(w, "expected JSON payload", http.StatusBadRequest)
+		return
+	}
 
-		go func() {
-			if h.blastr != nil {
-				h.blastr.SendText(context.Background(), "new subscription")
+	ctx := r.Context()
+	switch event.Status {
+	case "paid", "overpaid":
+		payment, err := h.nodeless.VerifyPayment(ctx, event.InvoiceID)
+		if err != nil {
+			if errors.Is(err, subscription.ErrInvoiceUnpaid) {
+				log.Printf("warn: nodeless webhook not confirmed: invoice_id=%v err=%v", event.InvoiceID, err)
+				w.WriteHeader(http.StatusOK)
+				return
 			}
-		}()
+			log.Printf("error: nodeless.VerifyPayment: invoice_id=%v err=%v", event.InvoiceID, err)
+			http.Error(w, "unable to verify invoice", http.StatusInternalServerError)
+			return
+		}
+		if !h.confirmPayment(ctx, *payment) {
+			http.Error(w, "unable to update invoice status", http.StatusInternalServerError)
+			return
+		}
+	case "expired":
+		err := h.subs.UpdateInvoiceStatus(ctx, event.InvoiceID, subscription.StatusInvoiceExpired)
+		switch {
+		case errors.Is(err, subscription.ErrSubscriptionNotFound),
+			errors.Is(err, subscription.ErrInvalidTransition),
+			errors.Is(err, subscription.ErrStatusConflict):
+			log.Printf("warn: nodeless expiry not applied: invoice_id=%v err=%v", event.InvoiceID, err)
+		case err != nil:
+			log.Printf("error: UpdateInvoiceStatus: invoice_id=%v err=%v", event.InvoiceID, err)
+			http.Error(w, "unable to update invoice status", http.StatusInternalServerError)
+			return
+		}
+	case "underpaid":
+		// Leave the subscription pending. The invoice can still be
+		// topped up before it expires.
+		log.Printf("warn: nodeless invoice underpaid: invoice_id=%v", event.InvoiceID)
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// confirmPayment applies a verified payment and announces new
+// subscriptions. It returns false if the webhook should be retried.
+func (h *handlers) confirmPayment(ctx context.Context, payment subscription.Payment) bool {
+	newlyPaid, err := h.subs.ConfirmPayment(ctx, payment)
+	if errors.Is(err, subscription.ErrSubscriptionNotFound) && h.uploads != nil {
+		return h.confirmUploadPayment(ctx, payment)
+	}
+	switch {
+	case errors.Is(err, subscription.ErrSubscriptionNotFound):
+		log.Printf("warn: %v payment for unknown invoice: invoice_id=%v", payment.Provider, payment.InvoiceID)
+		return true
+	case errors.Is(err, subscription.ErrUnderpaid), errors.Is(err, subscription.ErrInvalidTransition):
+		log.Printf("warn: %v payment not applied: invoice_id=%v err=%v", payment.Provider, payment.InvoiceID, err)
+		return true
+	case err != nil:
+		log.Printf("error: ConfirmPayment: invoice_id=%v err=%v", payment.InvoiceID, err)
+		return false
+	}
+
+	if newlyPaid {
+		h.announceSubscription()
+	}
+
+	return true
+}
+
+// confirmUploadPayment is confirmPayment for pay-per-upload invoices.
+func (h *handlers) confirmUploadPayment(ctx context.Context, payment subscription.Payment) bool {
+	_, err := h.uploads.ConfirmPayment(ctx, payment)
+	switch {
+	case errors.Is(err, upload.ErrUploadNotFound):
+		log.Printf("warn: %v payment for unknown invoice: invoice_id=%v", payment.Provider, payment.InvoiceID)
+	case errors.Is(err, subscription.ErrUnderpaid):
+		log.Printf("warn: %v upload payment not applied: invoice_id=%v err=%v", payment.Provider, payment.InvoiceID, err)
+	case err != nil:
+		log.Printf("error: uploads.ConfirmPayment: invoice_id=%v err=%v", payment.InvoiceID, err)
+		return false
+	}
+
+	return true
+}
+
+func (h *handlers) announceSubscription() {
+	go func() {
+		if h.blastr != nil {
+			h.blastr.SendText(context.Background(), "new subscription")
+		}
+	}()
+}
+
+// subscriptionOption looks up the days subscription option.
+func (h *handlers) subscriptionOption(days int) (SubscriptionOption, bool) {
+	for _, opt := range h.config.SubscriptionOptions {
+		if opt.Days == days {
+			return opt, true
+		}
+	}
+	return SubscriptionOption{}, false
+}
+
+// newSubscription is a new subscription for pubkey priced by opt.
+func newSubscription(pubkey string, opt SubscriptionOption) subscription.Subscription {
+	return subscription.Subscription{
+		Pubkey:    pubkey,
+		Days:      opt.Days,
+		Sats:      opt.Sats,
+		Currency:  opt.Currency,
+		FiatPrice: opt.Price,
+		CreatedAt: time.Now(),
+	}
+}
+
 // handleUpload handles user media uploads
 func (h *handlers) handleUpload(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -247,7 +720,32 @@ func (h *handlers) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := h.subs.GetActiveSubscription(ctx, req.Pubkey); err != nil {
+	if !pubkeyIsAllowed(h.config.AllowedPubkeys, req.Pubkey) {
+		log.Printf("upload blocked: %q not in allowed_pubkeys", req.Pubkey)
+		http.Error(w, "pubkey not allowed", http.StatusForbidden)
+		return
+	}
+
+	banned, err := h.bans.IsBanned(ctx, req.Pubkey)
+	if err != nil {
+		log.Printf("err: bans.IsBanned: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if banned {
+		log.Printf("upload blocked: %q is banned", req.Pubkey)
+		http.Error(w, "pubkey banned", http.StatusForbidden)
+		return
+	}
+
+	_, err = h.subs.GetActiveSubscription(ctx, req.Pubkey)
+	if err != nil && !errors.Is(err, subscription.ErrSubscriptionNotFound) {
+		log.Printf("err: subs.GetActiveSubscription: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	subscribed := err == nil
+	if !subscribed && h.uploads == nil {
 		log.Printf("upload blocked: subscription not found for %q, err: %v", req.Pubkey, err)
 		http.Error(w, "Subscription required", http.StatusPaymentRequired)
 		return
@@ -282,22 +780,38 @@ func (h *handlers) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := h.svc.NewSample(ctx, req)
+	// The mimetype is declared by the filename, so check it's what the file
+	// actually contains before handing it to the encoder.
+	detected, err := mimes.Detect(bytes.NewReader(req.Data))
 	if err != nil {
+		log.Printf("err: mimes.Detect: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if detected.Mimetype != req.Mimetype {
+		log.Printf("upload rejected: %q content detected as %q\n", req.Mimetype, detected.Mimetype)
+		http.Error(w, "content does not match its type", http.StatusBadRequest)
+		return
+	}
+	// Containers like CAF and MP4 can carry codecs the encoder can't decode.
+	if detected.Codec == "" {
+		log.Printf("upload rejected: unknown codec in %q\n", detected.Mimetype)
+		http.Error(w, "unsupported audio codec", http.StatusBadRequest)
+		return
+	}
 
-	streamPath, _ := url.JoinPath(h.config.StreamBase, resp.MediaID+".m3u8")
-	downloadPath, _ := url.JoinPath(h.config.DownloadBase, resp.MediaID+".wav")
+	if !subscribed {
+		h.handlePayPerUpload(w, r, req)
+		return
+	}
 
-	data, err := json.Marshal(map[string]any{
-		"stream_url":    streamPath,
-		"download_url":  downloadPath,
-		"download_hash": resp.DownloadHash,
-		"waveform":      resp.Waveform,
-	})
+	resp, err := h.svc.NewSample(ctx, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
+	data, err := json.Marshal(h.sampleResponse(resp.MediaID, resp.DownloadHash, resp.Waveform))
 	if err != nil {
 		log.Printf("failed to marshal resp: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -309,6 +823,36 @@ func (h *handlers) handleUpload(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+// sampleResponse is the response body describing an uploaded sample.
+func (h *handlers) sampleResponse(mediaID, downloadHash string, waveform any) map[string]any {
+	streamPath, _ := url.JoinPath(h.config.StreamBase, mediaID+".m3u8")
+	downloadPath, _ := url.JoinPath(h.config.DownloadBase, mediaID+".wav")
+	// The binary format is at the same path with a .dat extension.
+	peaksPath, _ := url.JoinPath(h.config.APIBase, "waveform", mediaID+".json")
+	imagePath, _ := url.JoinPath(h.config.APIBase, "image", mediaID, service.WaveformPNG)
+	thumbPath, _ := url.JoinPath(h.config.APIBase, "image", mediaID, service.SpectrogramPNG)
+
+	return map[string]any{
+		"stream_url":    streamPath,
+		"download_url":  downloadPath,
+		"download_hash": downloadHash,
+		"waveform":      waveform,
+		"peaks_url":     peaksPath,
+		"image":         imagePath,
+		"thumb":         thumbPath,
+		// Tags for the NIP-94 file metadata event of the download.
+		"nip94_event": map[string]any{
+			"tags": [][]string{
+				{"url", downloadPath},
+				{"m", "audio/wave"},
+				{"x", downloadHash},
+				{"image", imagePath},
+				{"thumb", thumbPath},
+			},
+		},
+	}
+}
+
 var (
 	ErrLogin = fmt.Errorf("login required")
 )
@@ -378,6 +922,27 @@ func pubkeyIsAllowed(pubkeys []string, pubkey string) bool {
 	return allowed
 }
 
+// sampleHidden reports whether the sample with sum was uploaded by any
+// pubkey whose ban hides their samples.
+func (h *handlers) sampleHidden(ctx context.Context, sum string) (bool, error) {
+	owners, err := h.svc.SampleOwners(ctx, sum)
+	if err != nil {
+		return false, fmt.Errorf("svc.SampleOwners: %w", err)
+	}
+
+	for _, owner := range owners {
+		hidden, err := h.bans.SamplesHidden(ctx, owner)
+		if err != nil {
+			return false, err
+		}
+		if hidden {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
 func (h *handlers) handleDebugStream(w http.ResponseWriter, r *http.Request) {
 	const html = `<html>
 	<head>
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stemstr/storage/internal/audit"
+	"github.com/stemstr/storage/internal/encoder"
+	"github.com/stemstr/storage/internal/moderation"
+	"github.com/stemstr/storage/internal/service"
+	blob "github.com/stemstr/storage/internal/storage/blob"
+	ls "github.com/stemstr/storage/internal/storage/filesystem"
+	"github.com/stemstr/storage/internal/subscription"
+	mockln "github.com/stemstr/storage/internal/subscription/ln/mock"
+	"github.com/stemstr/storage/internal/subscription/repo/memory"
+	"github.com/stemstr/storage/internal/upload"
+	"github.com/stemstr/storage/internal/waveform"
+)
+
+// testServer is the full API backed by memory, with a mock LN provider
+// whose invoices tests pay with ln.Pay.
+type testServer struct {
+	*httptest.Server
+	ln    *mockln.Client
+	repo  *memory.Repo
+	blobs *blob.Memory
+}
+
+// newTestServer starts the API with cfg. Pay-per-upload is enabled if cfg
+// prices uploads.
+func newTestServer(t *testing.T, cfg Config) *testServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	if cfg.MaxUploadSizeMB == 0 {
+		cfg.MaxUploadSizeMB = defaultMaxUploadSizeMB
+	}
+	cfg.LightningProvider = "mock"
+
+	var (
+		ln    = mockln.New()
+		repo  = memory.New()
+		blobs = blob.NewMemory()
+		enc   = fakeEncoder{duration: 10 * time.Second}
+	)
+
+	subs, err := subscription.New(repo, ln, cfg.LightningProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bans, err := moderation.New(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog, err := audit.New(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := service.New(service.Config{
+		OriginalMediaLocalDir: t.TempDir(),
+		StreamMediaLocalDir:   t.TempDir(),
+		WAVMediaLocalDir:      t.TempDir(),
+	}, ls.New(), blobs, enc, waveform.New(enc), repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var uploads *upload.Service
+	if pricing := (upload.Pricing{SatsPerMB: cfg.UploadSatsPerMB, SatsPerMinute: cfg.UploadSatsPerMinute}); pricing.Enabled() {
+		uploads, err = upload.New(repo, svc, ln, cfg.LightningProvider, pricing)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := &handlers{
+		config:  cfg,
+		svc:     svc,
+		subs:    subs,
+		bans:    bans,
+		audit:   auditLog,
+		uploads: uploads,
+	}
+	go ln.WatchPayments(ctx, func(p subscription.Payment) {
+		h.confirmPayment(ctx, p)
+	})
+
+	srv := httptest.NewServer(newRouter(h))
+	t.Cleanup(srv.Close)
+
+	return &testServer{
+		Server: srv,
+		ln:     ln,
+		repo:   repo,
+		blobs:  blobs,
+	}
+}
+
+// fakeEncoder stands in for ffmpeg. Uploads must already be WAVs, which
+// are copied as is.
+type fakeEncoder struct {
+	duration time.Duration
+}
+
+func (e fakeEncoder) HLS(ctx context.Context, req encoder.EncodeRequest) (encoder.EncodeHLSResponse, error) {
+	resp := encoder.EncodeHLSResponse{
+		IndexFilepath:    req.OutputPath + ".m3u8",
+		SegmentFilepaths: []string{req.OutputPath + "0.ts"},
+	}
+	if err := os.WriteFile(resp.IndexFilepath, []byte("#EXTM3U\n"), 0644); err != nil {
+		return resp, err
+	}
+	if err := os.WriteFile(resp.SegmentFilepaths[0], []byte("segment"), 0644); err != nil {
+		return resp, err
+	}
+
+	return resp, nil
+}
+
+func (e fakeEncoder) WAV(ctx context.Context, req encoder.EncodeRequest) (encoder.EncodeWAVResponse, error) {
+	resp := encoder.EncodeWAVResponse{Filepath: req.OutputPath}
+	if req.Mimetype != "audio/wave" {
+		return resp, fmt.Errorf("fakeEncoder: can't encode %v", req.Mimetype)
+	}
+
+	data, err := os.ReadFile(req.InputPath)
+	if err != nil {
+		return resp, err
+	}
+
+	return resp, os.WriteFile(req.OutputPath, data, 0644)
+}
+
+// PCM isn't needed as WAVs are analyzed directly.
+func (e fakeEncoder) PCM(ctx context.Context, req encoder.EncodeRequest) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("fakeEncoder: can't decode %v", req.Mimetype)
+}
+
+func (e fakeEncoder) Duration(ctx context.Context, req encoder.EncodeRequest) (time.Duration, error) {
+	return e.duration, nil
+}
@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+func New(repo auditRepo) (*Log, error) {
+	return &Log{
+		repo: repo,
+	}, nil
+}
+
+// Log records administrative actions.
+type Log struct {
+	repo auditRepo
+}
+
+type auditRepo interface {
+	CreateAuditEntry(ctx context.Context, entry Entry) error
+	ListAuditEntries(ctx context.Context, limit, offset int) ([]Entry, error)
+}
+
+// Record writes an audit entry. before and after are the JSON encodable
+// states of target around the action; either may be nil.
+func (l *Log) Record(ctx context.Context, actor, action, target string, before, after any) error {
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return fmt.Errorf("marshal before: %w", err)
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return fmt.Errorf("marshal after: %w", err)
+	}
+
+	return l.repo.CreateAuditEntry(ctx, Entry{
+		Actor:  actor,
+		Action: action,
+		Target: target,
+		Before: beforeJSON,
+		After:  afterJSON,
+	})
+}
+
+// List returns audit entries, newest first.
+func (l *Log) List(ctx context.Context, limit, offset int) ([]Entry, error) {
+	if limit <= 0 || limit > maxListLimit {
+		limit = maxListLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	return l.repo.ListAuditEntries(ctx, limit, offset)
+}
+
+const maxListLimit = 100
+
+type Entry struct {
+	ID        int64           `json:"id" db:"id"`
+	Actor     string          `json:"actor" db:"actor"`
+	Action    string          `json:"action" db:"action"`
+	Target    string          `json:"target" db:"target"`
+	Before    json.RawMessage `json:"before" db:"before"`
+	After     json.RawMessage `json:"after" db:"after"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
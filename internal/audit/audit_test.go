@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAuditRepo struct {
+	entries []Entry
+}
+
+func (m *mockAuditRepo) CreateAuditEntry(ctx context.Context, entry Entry) error {
+	m.entries = append(m.entries, entry)
+	return nil
+}
+func (m *mockAuditRepo) ListAuditEntries(ctx context.Context, limit, offset int) ([]Entry, error) {
+	return m.entries, nil
+}
+
+func TestRecord(t *testing.T) {
+	repo := &mockAuditRepo{}
+	l, err := New(repo)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	err = l.Record(ctx, "admin", "ban", "xxx", nil, map[string]any{"pubkey": "xxx"})
+	assert.NoError(t, err)
+
+	assert.Len(t, repo.entries, 1)
+	entry := repo.entries[0]
+	assert.Equal(t, "admin", entry.Actor)
+	assert.Equal(t, "ban", entry.Action)
+	assert.Equal(t, "xxx", entry.Target)
+	assert.JSONEq(t, `null`, string(entry.Before))
+	assert.JSONEq(t, `{"pubkey":"xxx"}`, string(entry.After))
+}
@@ -0,0 +1,150 @@
+package cashu
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// BlindedMessage is an output for the mint to sign (NUT-00).
+type BlindedMessage struct {
+	Amount int    `json:"amount"`
+	ID     string `json:"id"`
+	B      string `json:"B_"`
+}
+
+// BlindSignature is the mint's signature of a BlindedMessage.
+type BlindSignature struct {
+	Amount int    `json:"amount"`
+	ID     string `json:"id"`
+	C      string `json:"C_"`
+}
+
+// Keyset is a mint's public keys by amount (NUT-01).
+type Keyset struct {
+	ID   string         `json:"id"`
+	Unit string         `json:"unit"`
+	Keys map[int]string `json:"keys"`
+}
+
+const hashToCurveDomain = "Secp256k1_HashToCurve_Cashu_"
+
+// hashToCurve maps a secret to the point the mint signs (NUT-00).
+func hashToCurve(secret []byte) (*btcec.PublicKey, error) {
+	msg := sha256.Sum256(append([]byte(hashToCurveDomain), secret...))
+
+	var counter [4]byte
+	for i := uint32(0); i < 1<<16; i++ {
+		binary.LittleEndian.PutUint32(counter[:], i)
+		h := sha256.Sum256(append(msg[:], counter[:]...))
+		if p, err := btcec.ParsePubKey(append([]byte{0x02}, h[:]...)); err == nil {
+			return p, nil
+		}
+	}
+	return nil, errors.New("no point found")
+}
+
+// blankOutput is a blank output for change and what's needed to unblind its
+// signature.
+type blankOutput struct {
+	message BlindedMessage
+	secret  string
+	r       *btcec.PrivateKey
+}
+
+// blankOutputs makes enough blank outputs for the mint to return up to
+// excess sats as change (NUT-08). The mint picks their amounts.
+func blankOutputs(keysetID string, excess int) ([]blankOutput, error) {
+	if excess <= 0 {
+		return nil, nil
+	}
+	n := bits.Len(uint(excess - 1))
+	if n == 0 {
+		n = 1
+	}
+
+	outputs := make([]blankOutput, n)
+	for i := range outputs {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		secret := hex.EncodeToString(b)
+
+		y, err := hashToCurve([]byte(secret))
+		if err != nil {
+			return nil, err
+		}
+		r, err := btcec.NewPrivateKey()
+		if err != nil {
+			return nil, err
+		}
+
+		// B_ = Y + rG
+		var yJ, rG, blinded btcec.JacobianPoint
+		y.AsJacobian(&yJ)
+		btcec.ScalarBaseMultNonConst(&r.Key, &rG)
+		btcec.AddNonConst(&yJ, &rG, &blinded)
+		blinded.ToAffine()
+
+		outputs[i] = blankOutput{
+			message: BlindedMessage{
+				// Ignored by the mint, which sets the amount of change
+				Amount: 1,
+				ID:     keysetID,
+				B:      hex.EncodeToString(btcec.NewPublicKey(&blinded.X, &blinded.Y).SerializeCompressed()),
+			},
+			secret: secret,
+			r:      r,
+		}
+	}
+
+	return outputs, nil
+}
+
+// unblind turns the mint's signature of o into a proof: C = C_ - rK, where
+// K is the mint's key for the amount.
+func (o blankOutput) unblind(sig BlindSignature, keyset *Keyset) (Proof, error) {
+	key, ok := keyset.Keys[sig.Amount]
+	if !ok || sig.ID != keyset.ID {
+		return Proof{}, fmt.Errorf("no key for %d sats in keyset %s", sig.Amount, sig.ID)
+	}
+	k, err := parsePoint(key)
+	if err != nil {
+		return Proof{}, fmt.Errorf("mint key: %w", err)
+	}
+	signed, err := parsePoint(sig.C)
+	if err != nil {
+		return Proof{}, fmt.Errorf("signature: %w", err)
+	}
+
+	var kJ, rK, signedJ, c btcec.JacobianPoint
+	k.AsJacobian(&kJ)
+	btcec.ScalarMultNonConst(&o.r.Key, &kJ, &rK)
+	rK.ToAffine()
+	rK.Y.Negate(1).Normalize()
+	signed.AsJacobian(&signedJ)
+	btcec.AddNonConst(&signedJ, &rK, &c)
+	c.ToAffine()
+
+	return Proof{
+		Amount: sig.Amount,
+		ID:     sig.ID,
+		Secret: o.secret,
+		C:      hex.EncodeToString(btcec.NewPublicKey(&c.X, &c.Y).SerializeCompressed()),
+	}, nil
+}
+
+func parsePoint(s string) (*btcec.PublicKey, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return btcec.ParsePubKey(b)
+}
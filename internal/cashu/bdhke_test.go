@@ -0,0 +1,80 @@
+package cashu
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// testMintKey signs for every amount of testKeyset.
+var testMintKey, _ = btcec.PrivKeyFromBytes([]byte("a deterministic test mint key!!!"))
+
+func testKeyset() *Keyset {
+	keyset := &Keyset{ID: "009a1f293253e41e", Unit: "sat", Keys: map[int]string{}}
+	for amount := 1; amount <= 1<<20; amount <<= 1 {
+		keyset.Keys[amount] = hex.EncodeToString(testMintKey.PubKey().SerializeCompressed())
+	}
+	return keyset
+}
+
+// mintSign signs a blinded message as the mint does: C_ = kB_.
+func mintSign(blinded string) string {
+	b, err := parsePoint(blinded)
+	if err != nil {
+		panic(err)
+	}
+	var bJ, c btcec.JacobianPoint
+	b.AsJacobian(&bJ)
+	btcec.ScalarMultNonConst(&testMintKey.Key, &bJ, &c)
+	c.ToAffine()
+	return hex.EncodeToString(btcec.NewPublicKey(&c.X, &c.Y).SerializeCompressed())
+}
+
+// TestHashToCurve checks the test vectors of NUT-00.
+func TestHashToCurve(t *testing.T) {
+	tests := map[string]string{
+		"0000000000000000000000000000000000000000000000000000000000000000": "024cce997d3b518f739663b757deaec95bcd9473c30a14ac2fd04023a739d1a725",
+		"0000000000000000000000000000000000000000000000000000000000000001": "022e7158e11c9506f1aa4248bf531298daa7febd6194f003edcd9b93ade6253acf",
+		"0000000000000000000000000000000000000000000000000000000000000002": "026cdbe15362df59cd1dd3c9c11de8aedac2106eca69236ecd9fbe117af897be4f",
+	}
+	for secret, want := range tests {
+		b, _ := hex.DecodeString(secret)
+		p, err := hashToCurve(b)
+		assert.NoError(t, err)
+		assert.Equal(t, want, hex.EncodeToString(p.SerializeCompressed()), secret)
+	}
+}
+
+func TestBlankOutputs(t *testing.T) {
+	keyset := testKeyset()
+
+	for excess, want := range map[int]int{0: 0, 1: 1, 2: 1, 3: 2, 4: 2, 5: 3, 10: 4, 1000: 10} {
+		outputs, err := blankOutputs(keyset.ID, excess)
+		assert.NoError(t, err)
+		assert.Len(t, outputs, want, excess)
+	}
+
+	// Unblinded signatures are the mint's signature of the secret, kY
+	outputs, err := blankOutputs(keyset.ID, 8)
+	assert.NoError(t, err)
+	for i, o := range outputs {
+		proof, err := o.unblind(BlindSignature{Amount: 1 << i, ID: keyset.ID, C: mintSign(o.message.B)}, keyset)
+		assert.NoError(t, err)
+		assert.Equal(t, 1<<i, proof.Amount)
+
+		y, err := hashToCurve([]byte(proof.Secret))
+		assert.NoError(t, err)
+		var yJ, ky btcec.JacobianPoint
+		y.AsJacobian(&yJ)
+		btcec.ScalarMultNonConst(&testMintKey.Key, &yJ, &ky)
+		ky.ToAffine()
+		assert.Equal(t, hex.EncodeToString(btcec.NewPublicKey(&ky.X, &ky.Y).SerializeCompressed()), proof.C)
+	}
+
+	_, err = outputs[0].unblind(BlindSignature{Amount: 3, ID: keyset.ID, C: mintSign(outputs[0].message.B)}, keyset)
+	assert.Error(t, err)
+	_, err = outputs[0].unblind(BlindSignature{Amount: 1, ID: "00ffffffffffffff", C: mintSign(outputs[0].message.B)}, keyset)
+	assert.Error(t, err)
+}
@@ -0,0 +1,166 @@
+// Package cashu accepts Cashu ecash tokens as subscription payments.
+// Tokens are redeemed by melting them at their mint to pay a subscription
+// invoice from the configured LNProvider, so they can't be spent twice.
+package cashu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/stemstr/storage/internal/subscription"
+)
+
+// Provider identifies cashu payments.
+const Provider = "cashu"
+
+func New(subs subscriptionService, mint Mint, trustedMints []string) (*Service, error) {
+	if len(trustedMints) == 0 {
+		return nil, fmt.Errorf("at least one trusted mint required")
+	}
+
+	trusted := make(map[string]bool, len(trustedMints))
+	for _, m := range trustedMints {
+		trusted[normalizeMint(m)] = true
+	}
+
+	return &Service{
+		subs:    subs,
+		mint:    mint,
+		trusted: trusted,
+	}, nil
+}
+
+type Service struct {
+	subs    subscriptionService
+	mint    Mint
+	trusted map[string]bool
+}
+
+type subscriptionService interface {
+	CreateSubscription(ctx context.Context, sub subscription.Subscription) (*subscription.Subscription, error)
+	ConfirmPayment(ctx context.Context, p subscription.Payment) (bool, error)
+	Cancel(ctx context.Context, id int64) (*subscription.Subscription, error)
+}
+
+func normalizeMint(u string) string {
+	return strings.TrimSuffix(strings.TrimSpace(u), "/")
+}
+
+// Pay buys sub with a serialized token. The token is checked against the
+// trusted mints and sub.Sats before anything is created, then melted to pay
+// a new subscription invoice. The paid subscription is returned along with
+// change, a token of whatever the invoice and the mint's fees didn't use,
+// or "" if there's none. Change is returned even if confirming the payment
+// fails, as the token has been spent.
+func (s *Service) Pay(ctx context.Context, sub subscription.Subscription, serialized string) (*subscription.Subscription, string, error) {
+	token, err := Decode(serialized)
+	if err != nil {
+		return nil, "", err
+	}
+
+	mintURL := normalizeMint(token.Mint)
+	if !s.trusted[mintURL] {
+		return nil, "", fmt.Errorf("%w: %s", ErrUntrustedMint, token.Mint)
+	}
+	if token.Unit != "sat" {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnsupportedUnit, token.Unit)
+	}
+	if token.Amount() < sub.Sats {
+		return nil, "", fmt.Errorf("%w: %d sats for %d sat subscription", ErrInsufficient, token.Amount(), sub.Sats)
+	}
+
+	newSub, err := s.subs.CreateSubscription(ctx, sub)
+	if err != nil {
+		return nil, "", fmt.Errorf("CreateSubscription: %w", err)
+	}
+
+	// Once the token can't pay the invoice nobody else will, so the
+	// subscription is cancelled rather than left pending.
+	cancel := func() {
+		if _, err := s.subs.Cancel(ctx, newSub.ID); err != nil {
+			log.Printf("error: Cancel: sub=%v err=%v", newSub.ID, err)
+		}
+	}
+
+	// Fiat prices are only known in sats once the invoice is created
+	if token.Amount() < newSub.Sats {
+		cancel()
+		return nil, "", fmt.Errorf("%w: %d sats for %d sat subscription", ErrInsufficient, token.Amount(), newSub.Sats)
+	}
+
+	quote, err := s.mint.MeltQuote(ctx, mintURL, newSub.LightningInvoice)
+	if err != nil {
+		cancel()
+		return nil, "", err
+	}
+	if need := quote.Amount + quote.FeeReserve; token.Amount() < need {
+		cancel()
+		return nil, "", fmt.Errorf("%w: %d sats, mint needs %d including fees", ErrInsufficient, token.Amount(), need)
+	}
+
+	keyset, err := s.mint.Keyset(ctx, mintURL, token.Unit)
+	if err != nil {
+		cancel()
+		return nil, "", err
+	}
+	outputs, err := blankOutputs(keyset.ID, token.Amount()-quote.Amount)
+	if err != nil {
+		cancel()
+		return nil, "", fmt.Errorf("blankOutputs: %w", err)
+	}
+	messages := make([]BlindedMessage, len(outputs))
+	for i, o := range outputs {
+		messages[i] = o.message
+	}
+
+	result, err := s.mint.Melt(ctx, mintURL, quote.Quote, token.Proofs, messages)
+	if err != nil {
+		// Other errors, like a timeout, leave the payment in doubt. If
+		// the mint completes it the subscription is picked up like any
+		// other paid invoice.
+		if errors.Is(err, ErrRejected) {
+			cancel()
+		}
+		return nil, "", err
+	}
+	if !result.Paid {
+		// The mint may still complete the payment. If so the
+		// subscription is picked up like any other paid invoice.
+		return nil, "", fmt.Errorf("%w: invoice not paid", ErrRejected)
+	}
+
+	change := Token{Mint: token.Mint, Unit: token.Unit}
+	for i, sig := range result.Change {
+		if i >= len(outputs) {
+			break
+		}
+		proof, err := outputs[i].unblind(sig, keyset)
+		if err != nil {
+			log.Printf("error: cashu change: sub=%v err=%v", newSub.ID, err)
+			continue
+		}
+		change.Proofs = append(change.Proofs, proof)
+	}
+	var serializedChange string
+	if len(change.Proofs) > 0 {
+		if serializedChange, err = change.Encode(); err != nil {
+			log.Printf("error: cashu change: sub=%v err=%v", newSub.ID, err)
+		}
+	}
+
+	_, err = s.subs.ConfirmPayment(ctx, subscription.Payment{
+		Provider:  Provider,
+		InvoiceID: newSub.InvoiceID,
+		WebhookID: quote.Quote,
+		Sats:      newSub.Sats,
+	})
+	if err != nil {
+		return nil, serializedChange, fmt.Errorf("ConfirmPayment: %w", err)
+	}
+	newSub.Status = subscription.StatusPaid
+
+	return newSub, serializedChange, nil
+}
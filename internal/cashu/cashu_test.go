@@ -0,0 +1,187 @@
+package cashu
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stemstr/storage/internal/subscription"
+)
+
+func token(t *testing.T, mint, unit string, amounts ...int) string {
+	var proofs []Proof
+	for i, a := range amounts {
+		proofs = append(proofs, Proof{Amount: a, ID: "009a1f293253e41e", Secret: fmt.Sprint(i), C: testC})
+	}
+	return encodeV3(t, map[string]any{
+		"token": []any{map[string]any{"mint": mint, "proofs": proofs}},
+		"unit":  unit,
+	}, base64.RawURLEncoding)
+}
+
+func TestPay(t *testing.T) {
+	const mintURL = "https://mint.example"
+	pending := &subscription.Subscription{ID: 1, Pubkey: "xxx", Days: 30, Sats: 1000, InvoiceID: "inv", LightningInvoice: "lnbc", Status: subscription.StatusPending}
+
+	tests := []struct {
+		name          string
+		token         string
+		subs          *mockSubscriptionService
+		mint          *mockMint
+		err           error
+		wantErr       bool
+		wantCreated   bool
+		wantCancelled bool
+		wantChange    int
+	}{
+		{
+			name:        "paid",
+			token:       token(t, mintURL, "sat", 512, 512),
+			subs:        &mockSubscriptionService{CreateSub: pending},
+			mint:        &mockMint{Quote: &MeltQuote{Quote: "q1", Amount: 1000, FeeReserve: 10}, Paid: true, Change: []int{4, 16}},
+			wantCreated: true,
+			wantChange:  20,
+		},
+		{
+			name:        "all fees used",
+			token:       token(t, mintURL, "sat", 1000, 10),
+			subs:        &mockSubscriptionService{CreateSub: pending},
+			mint:        &mockMint{Quote: &MeltQuote{Quote: "q1", Amount: 1000, FeeReserve: 10}, Paid: true},
+			wantCreated: true,
+		},
+		{
+			name:        "trailing slash mint",
+			token:       token(t, mintURL+"/", "sat", 1024),
+			subs:        &mockSubscriptionService{CreateSub: pending},
+			mint:        &mockMint{Quote: &MeltQuote{Quote: "q1", Amount: 1000}, Paid: true},
+			wantCreated: true,
+		},
+		{
+			name:    "untrusted mint",
+			token:   token(t, "https://evil.example", "sat", 1024),
+			subs:    &mockSubscriptionService{CreateSub: pending},
+			mint:    &mockMint{},
+			err:     ErrUntrustedMint,
+			wantErr: true,
+		},
+		{
+			name:    "wrong unit",
+			token:   token(t, mintURL, "usd", 1024),
+			subs:    &mockSubscriptionService{CreateSub: pending},
+			mint:    &mockMint{},
+			err:     ErrUnsupportedUnit,
+			wantErr: true,
+		},
+		{
+			name:    "below price",
+			token:   token(t, mintURL, "sat", 512),
+			subs:    &mockSubscriptionService{CreateSub: pending},
+			mint:    &mockMint{},
+			err:     ErrInsufficient,
+			wantErr: true,
+		},
+		{
+			name:          "below fee reserve",
+			token:         token(t, mintURL, "sat", 1000),
+			subs:          &mockSubscriptionService{CreateSub: pending},
+			mint:          &mockMint{Quote: &MeltQuote{Quote: "q1", Amount: 1000, FeeReserve: 10}},
+			err:           ErrInsufficient,
+			wantErr:       true,
+			wantCreated:   true,
+			wantCancelled: true,
+		},
+		{
+			name:          "already spent",
+			token:         token(t, mintURL, "sat", 1024),
+			subs:          &mockSubscriptionService{CreateSub: pending},
+			mint:          &mockMint{Quote: &MeltQuote{Quote: "q1", Amount: 1000}, MeltErr: fmt.Errorf("melt: %w: Token already spent.", ErrRejected)},
+			err:           ErrRejected,
+			wantErr:       true,
+			wantCreated:   true,
+			wantCancelled: true,
+		},
+		{
+			name:        "unpaid",
+			token:       token(t, mintURL, "sat", 1024),
+			subs:        &mockSubscriptionService{CreateSub: pending},
+			mint:        &mockMint{Quote: &MeltQuote{Quote: "q1", Amount: 1000}, Paid: false},
+			err:         ErrRejected,
+			wantErr:     true,
+			wantCreated: true,
+		},
+		{
+			name:          "quote failed",
+			token:         token(t, mintURL, "sat", 1024),
+			subs:          &mockSubscriptionService{CreateSub: pending},
+			mint:          &mockMint{QuoteErr: fmt.Errorf("melt quote: 500 Internal Server Error")},
+			wantErr:       true,
+			wantCreated:   true,
+			wantCancelled: true,
+		},
+		{
+			name:        "melt in doubt",
+			token:       token(t, mintURL, "sat", 1024),
+			subs:        &mockSubscriptionService{CreateSub: pending},
+			mint:        &mockMint{Quote: &MeltQuote{Quote: "q1", Amount: 1000}, MeltErr: fmt.Errorf("melt: context deadline exceeded")},
+			wantErr:     true,
+			wantCreated: true,
+		},
+		{
+			name:    "invalid token",
+			token:   "cashuAnope",
+			subs:    &mockSubscriptionService{CreateSub: pending},
+			mint:    &mockMint{},
+			err:     ErrInvalidToken,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := New(tt.subs, tt.mint, []string{mintURL + "/"})
+			assert.NoError(t, err)
+
+			sub, change, err := svc.Pay(context.Background(), subscription.Subscription{Pubkey: "xxx", Days: 30, Sats: 1000}, tt.token)
+			assert.Equal(t, tt.wantCreated, tt.subs.Created)
+			if tt.wantCancelled {
+				assert.Equal(t, []int64{pending.ID}, tt.subs.Cancelled)
+			} else {
+				assert.Empty(t, tt.subs.Cancelled)
+			}
+			if tt.wantErr {
+				if tt.err != nil {
+					assert.ErrorIs(t, err, tt.err)
+				} else {
+					assert.Error(t, err)
+				}
+				assert.Nil(t, tt.subs.Confirmed)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, subscription.StatusPaid, sub.Status)
+			assert.NotEmpty(t, tt.mint.Melted)
+			assert.Equal(t, &subscription.Payment{Provider: Provider, InvoiceID: "inv", WebhookID: "q1", Sats: 1000}, tt.subs.Confirmed)
+
+			// Blank outputs for anything the invoice might not use
+			assert.NotEmpty(t, tt.mint.Outputs)
+			if tt.wantChange == 0 {
+				assert.Empty(t, change)
+				return
+			}
+			got, err := Decode(change)
+			if assert.NoError(t, err) {
+				assert.Equal(t, mintURL, got.Mint)
+				assert.Equal(t, tt.wantChange, got.Amount())
+			}
+		})
+	}
+}
+
+func TestNewRequiresMints(t *testing.T) {
+	_, err := New(&mockSubscriptionService{}, &mockMint{}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,15 @@
+package cashu
+
+import "errors"
+
+var (
+	ErrInvalidToken    = errors.New("invalid cashu token")
+	ErrUntrustedMint   = errors.New("mint not trusted")
+	ErrUnsupportedUnit = errors.New("token unit not supported")
+	// ErrInsufficient is returned when a token doesn't cover the
+	// subscription price plus the mint's fee reserve.
+	ErrInsufficient = errors.New("token amount too low")
+	// ErrRejected is returned when the mint refuses to redeem a token,
+	// e.g. because it has already been spent.
+	ErrRejected = errors.New("token rejected by mint")
+)
@@ -0,0 +1,139 @@
+package cashu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Mint redeems tokens at a Cashu mint by melting them into a lightning
+// invoice (NUT-05).
+type Mint interface {
+	MeltQuote(ctx context.Context, mintURL, bolt11 string) (*MeltQuote, error)
+	// Keyset fetches the mint's active keyset for unit.
+	Keyset(ctx context.Context, mintURL, unit string) (*Keyset, error)
+	// Melt spends proofs to pay a quoted invoice. Whatever the invoice and
+	// its fees don't use is signed into outputs as change (NUT-08).
+	// ErrRejected is returned if the mint refuses the proofs.
+	Melt(ctx context.Context, mintURL, quote string, proofs []Proof, outputs []BlindedMessage) (*MeltResult, error)
+}
+
+type MeltQuote struct {
+	Quote      string `json:"quote"`
+	Amount     int    `json:"amount"`
+	FeeReserve int    `json:"fee_reserve"`
+}
+
+type MeltResult struct {
+	Paid bool
+	// Change signs the first outputs passed to Melt, in order.
+	Change []BlindSignature
+}
+
+// NewHTTPMint creates a Mint that talks to mints over their v1 REST API.
+func NewHTTPMint() *HTTPMint {
+	return &HTTPMint{
+		// Melting waits for the lightning payment to complete.
+		http: &http.Client{Timeout: time.Minute},
+	}
+}
+
+type HTTPMint struct {
+	http *http.Client
+}
+
+func (m *HTTPMint) MeltQuote(ctx context.Context, mintURL, bolt11 string) (*MeltQuote, error) {
+	var quote MeltQuote
+	err := m.do(ctx, http.MethodPost, mintURL, "/v1/melt/quote/bolt11", map[string]string{
+		"request": bolt11,
+		"unit":    "sat",
+	}, &quote)
+	if err != nil {
+		return nil, fmt.Errorf("melt quote: %w", err)
+	}
+
+	return &quote, nil
+}
+
+func (m *HTTPMint) Keyset(ctx context.Context, mintURL, unit string) (*Keyset, error) {
+	var resp struct {
+		Keysets []Keyset `json:"keysets"`
+	}
+	if err := m.do(ctx, http.MethodGet, mintURL, "/v1/keys", nil, &resp); err != nil {
+		return nil, fmt.Errorf("keys: %w", err)
+	}
+
+	for _, keyset := range resp.Keysets {
+		if keyset.Unit == unit {
+			return &keyset, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no %s keyset", ErrUnsupportedUnit, unit)
+}
+
+func (m *HTTPMint) Melt(ctx context.Context, mintURL, quote string, proofs []Proof, outputs []BlindedMessage) (*MeltResult, error) {
+	var resp struct {
+		// Older mints report paid, newer ones state.
+		Paid   bool             `json:"paid"`
+		State  string           `json:"state"`
+		Change []BlindSignature `json:"change"`
+	}
+	err := m.do(ctx, http.MethodPost, mintURL, "/v1/melt/bolt11", map[string]any{
+		"quote":   quote,
+		"inputs":  proofs,
+		"outputs": outputs,
+	}, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("melt: %w", err)
+	}
+
+	return &MeltResult{
+		Paid:   resp.Paid || resp.State == "PAID",
+		Change: resp.Change,
+	}, nil
+}
+
+func (m *HTTPMint) do(ctx context.Context, method, mintURL, path string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(mintURL, "/")+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := m.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Mints report protocol errors, like spent proofs, with a 400
+		var mintErr struct {
+			Detail string `json:"detail"`
+			Code   int    `json:"code"`
+		}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if resp.StatusCode == http.StatusBadRequest && json.Unmarshal(respBody, &mintErr) == nil && mintErr.Detail != "" {
+			return fmt.Errorf("%w: %s (code %d)", ErrRejected, mintErr.Detail, mintErr.Code)
+		}
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,90 @@
+package cashu
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mintServer is an in-process stand-in for a mint's keys and melt
+// endpoints. Proofs can only be melted once, and the first output is signed
+// as 2 sats of change.
+func mintServer(t *testing.T) *httptest.Server {
+	spent := map[string]bool{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/keys", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		usd := Keyset{ID: "00ffffffffffffff", Unit: "usd"}
+		json.NewEncoder(w).Encode(map[string]any{"keysets": []*Keyset{&usd, testKeyset()}})
+	})
+	mux.HandleFunc("/v1/melt/quote/bolt11", func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "lnbc", req["request"])
+		assert.Equal(t, "sat", req["unit"])
+		json.NewEncoder(w).Encode(MeltQuote{Quote: "q1", Amount: 1000, FeeReserve: 4})
+	})
+	mux.HandleFunc("/v1/melt/bolt11", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Quote   string           `json:"quote"`
+			Inputs  []Proof          `json:"inputs"`
+			Outputs []BlindedMessage `json:"outputs"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		for _, p := range req.Inputs {
+			if spent[p.Secret] {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]any{"detail": "Token already spent.", "code": 11001})
+				return
+			}
+		}
+		for _, p := range req.Inputs {
+			spent[p.Secret] = true
+		}
+		var change []BlindSignature
+		if len(req.Outputs) > 0 {
+			change = append(change, BlindSignature{Amount: 2, ID: req.Outputs[0].ID, C: mintSign(req.Outputs[0].B)})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"state": "PAID", "change": change})
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestHTTPMint(t *testing.T) {
+	srv := mintServer(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+	mint := NewHTTPMint()
+
+	quote, err := mint.MeltQuote(ctx, srv.URL+"/", "lnbc")
+	assert.NoError(t, err)
+	assert.Equal(t, &MeltQuote{Quote: "q1", Amount: 1000, FeeReserve: 4}, quote)
+
+	keyset, err := mint.Keyset(ctx, srv.URL, "sat")
+	assert.NoError(t, err)
+	assert.Equal(t, testKeyset(), keyset)
+	_, err = mint.Keyset(ctx, srv.URL, "eur")
+	assert.ErrorIs(t, err, ErrUnsupportedUnit)
+
+	outputs, err := blankOutputs(keyset.ID, 24)
+	assert.NoError(t, err)
+	proofs := []Proof{{Amount: 1024, ID: "009a1f293253e41e", Secret: "s1", C: testC}}
+	result, err := mint.Melt(ctx, srv.URL, quote.Quote, proofs, []BlindedMessage{outputs[0].message})
+	assert.NoError(t, err)
+	assert.True(t, result.Paid)
+	if assert.Len(t, result.Change, 1) {
+		assert.Equal(t, 2, result.Change[0].Amount)
+	}
+
+	// Double spend
+	_, err = mint.Melt(ctx, srv.URL, quote.Quote, proofs, nil)
+	assert.ErrorIs(t, err, ErrRejected)
+	assert.ErrorContains(t, err, "already spent")
+}
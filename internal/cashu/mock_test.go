@@ -0,0 +1,71 @@
+package cashu
+
+import (
+	"context"
+
+	"github.com/stemstr/storage/internal/subscription"
+)
+
+type mockSubscriptionService struct {
+	CreateSub  *subscription.Subscription
+	CreateErr  error
+	ConfirmErr error
+
+	// Created records whether CreateSubscription was called
+	Created bool
+	// Confirmed records the last payment passed to ConfirmPayment
+	Confirmed *subscription.Payment
+	// Cancelled records the ids passed to Cancel
+	Cancelled []int64
+}
+
+func (m *mockSubscriptionService) CreateSubscription(ctx context.Context, sub subscription.Subscription) (*subscription.Subscription, error) {
+	m.Created = true
+	return m.CreateSub, m.CreateErr
+}
+func (m *mockSubscriptionService) ConfirmPayment(ctx context.Context, p subscription.Payment) (bool, error) {
+	m.Confirmed = &p
+	return m.ConfirmErr == nil, m.ConfirmErr
+}
+func (m *mockSubscriptionService) Cancel(ctx context.Context, id int64) (*subscription.Subscription, error) {
+	m.Cancelled = append(m.Cancelled, id)
+	return nil, nil
+}
+
+type mockMint struct {
+	Quote    *MeltQuote
+	QuoteErr error
+	Paid     bool
+	MeltErr  error
+	// Change is signed into the outputs passed to Melt with testMintKey
+	Change []int
+
+	// Melted records the proofs passed to Melt
+	Melted []Proof
+	// Outputs records the outputs passed to Melt
+	Outputs []BlindedMessage
+}
+
+func (m *mockMint) MeltQuote(ctx context.Context, mintURL, bolt11 string) (*MeltQuote, error) {
+	return m.Quote, m.QuoteErr
+}
+func (m *mockMint) Keyset(ctx context.Context, mintURL, unit string) (*Keyset, error) {
+	return testKeyset(), nil
+}
+func (m *mockMint) Melt(ctx context.Context, mintURL, quote string, proofs []Proof, outputs []BlindedMessage) (*MeltResult, error) {
+	m.Melted = proofs
+	m.Outputs = outputs
+	if m.MeltErr != nil {
+		return nil, m.MeltErr
+	}
+
+	result := &MeltResult{Paid: m.Paid}
+	for i, amount := range m.Change {
+		result.Change = append(result.Change, BlindSignature{
+			Amount: amount,
+			ID:     outputs[i].ID,
+			C:      mintSign(outputs[i].B),
+		})
+	}
+	return result, nil
+}
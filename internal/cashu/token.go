@@ -0,0 +1,184 @@
+package cashu
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	prefixV3 = "cashuA"
+	prefixV4 = "cashuB"
+)
+
+// Token is a decoded Cashu token. Only single mint tokens are supported.
+type Token struct {
+	Mint   string
+	Unit   string
+	Memo   string
+	Proofs []Proof
+}
+
+// Proof is a Cashu proof as sent to the mint (NUT-00).
+type Proof struct {
+	Amount int    `json:"amount"`
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+	C      string `json:"C"`
+}
+
+// Amount is the total value of the token's proofs.
+func (t *Token) Amount() int {
+	var total int
+	for _, p := range t.Proofs {
+		total += p.Amount
+	}
+	return total
+}
+
+// Decode parses a serialized V3 (cashuA) or V4 (cashuB) token.
+func Decode(s string) (*Token, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "cashu:")
+
+	var (
+		token *Token
+		err   error
+	)
+	switch {
+	case strings.HasPrefix(s, prefixV3):
+		token, err = decodeV3(strings.TrimPrefix(s, prefixV3))
+	case strings.HasPrefix(s, prefixV4):
+		token, err = decodeV4(strings.TrimPrefix(s, prefixV4))
+	default:
+		return nil, fmt.Errorf("%w: unknown version", ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if token.Mint == "" || len(token.Proofs) == 0 {
+		return nil, fmt.Errorf("%w: no proofs", ErrInvalidToken)
+	}
+	if token.Unit == "" {
+		token.Unit = "sat"
+	}
+
+	return token, nil
+}
+
+// decodeBase64 accepts both padded and unpadded, standard and URL safe
+// encodings, all of which are seen in the wild.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	s = strings.NewReplacer("+", "-", "/", "_").Replace(s)
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func decodeV3(s string) (*Token, error) {
+	b, err := decodeBase64(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var v3 struct {
+		Token []struct {
+			Mint   string  `json:"mint"`
+			Proofs []Proof `json:"proofs"`
+		} `json:"token"`
+		Unit string `json:"unit"`
+		Memo string `json:"memo"`
+	}
+	if err := json.Unmarshal(b, &v3); err != nil {
+		return nil, err
+	}
+
+	token := &Token{Unit: v3.Unit, Memo: v3.Memo}
+	for _, entry := range v3.Token {
+		if token.Mint != "" && entry.Mint != token.Mint {
+			return nil, fmt.Errorf("multiple mints")
+		}
+		token.Mint = entry.Mint
+		token.Proofs = append(token.Proofs, entry.Proofs...)
+	}
+
+	return token, nil
+}
+
+// tokenV4 is the CBOR layout of a V4 token, proofs grouped by keyset.
+type tokenV4 struct {
+	Mint   string     `cbor:"m"`
+	Unit   string     `cbor:"u"`
+	Memo   string     `cbor:"d,omitempty"`
+	Tokens []keysetV4 `cbor:"t"`
+}
+
+type keysetV4 struct {
+	ID     []byte    `cbor:"i"`
+	Proofs []proofV4 `cbor:"p"`
+}
+
+type proofV4 struct {
+	Amount int    `cbor:"a"`
+	Secret string `cbor:"s"`
+	C      []byte `cbor:"c"`
+}
+
+func decodeV4(s string) (*Token, error) {
+	b, err := decodeBase64(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var v4 tokenV4
+	if err := cbor.Unmarshal(b, &v4); err != nil {
+		return nil, err
+	}
+
+	token := &Token{Mint: v4.Mint, Unit: v4.Unit, Memo: v4.Memo}
+	for _, entry := range v4.Tokens {
+		id := hex.EncodeToString(entry.ID)
+		for _, p := range entry.Proofs {
+			token.Proofs = append(token.Proofs, Proof{
+				Amount: p.Amount,
+				ID:     id,
+				Secret: p.Secret,
+				C:      hex.EncodeToString(p.C),
+			})
+		}
+	}
+
+	return token, nil
+}
+
+// Encode serializes t as a V4 (cashuB) token.
+func (t *Token) Encode() (string, error) {
+	v4 := tokenV4{Mint: t.Mint, Unit: t.Unit, Memo: t.Memo}
+	for _, p := range t.Proofs {
+		id, err := hex.DecodeString(p.ID)
+		if err != nil {
+			return "", fmt.Errorf("keyset id: %w", err)
+		}
+		c, err := hex.DecodeString(p.C)
+		if err != nil {
+			return "", fmt.Errorf("proof C: %w", err)
+		}
+
+		if n := len(v4.Tokens); n == 0 || !bytes.Equal(v4.Tokens[n-1].ID, id) {
+			v4.Tokens = append(v4.Tokens, keysetV4{ID: id})
+		}
+		last := &v4.Tokens[len(v4.Tokens)-1]
+		last.Proofs = append(last.Proofs, proofV4{Amount: p.Amount, Secret: p.Secret, C: c})
+	}
+
+	b, err := cbor.Marshal(v4)
+	if err != nil {
+		return "", err
+	}
+	return prefixV4 + base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,117 @@
+package cashu
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+const testC = "02bc9097997d81afb2cc7346b5e4345a9346bd2a506eb7958598a72f0cf85163ea"
+
+func encodeV3(t *testing.T, v any, enc *base64.Encoding) string {
+	b, err := json.Marshal(v)
+	assert.NoError(t, err)
+	return "cashuA" + enc.EncodeToString(b)
+}
+
+func TestDecode(t *testing.T) {
+	c, _ := hex.DecodeString(testC)
+	id, _ := hex.DecodeString("009a1f293253e41e")
+	v4, err := cbor.Marshal(map[string]any{
+		"m": "https://mint.example",
+		"u": "sat",
+		"t": []any{
+			map[string]any{
+				"i": id,
+				"p": []any{
+					map[string]any{"a": 8, "s": "secret1", "c": c},
+					map[string]any{"a": 2, "s": "secret2", "c": c},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	v3 := map[string]any{
+		"token": []any{
+			map[string]any{
+				"mint": "https://mint.example",
+				"proofs": []Proof{
+					{Amount: 8, ID: "009a1f293253e41e", Secret: "secret1", C: testC},
+					{Amount: 2, ID: "009a1f293253e41e", Secret: "secret2", C: testC},
+				},
+			},
+		},
+		"unit": "sat",
+	}
+
+	want := &Token{
+		Mint: "https://mint.example",
+		Unit: "sat",
+		Proofs: []Proof{
+			{Amount: 8, ID: "009a1f293253e41e", Secret: "secret1", C: testC},
+			{Amount: 2, ID: "009a1f293253e41e", Secret: "secret2", C: testC},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    *Token
+		wantErr bool
+	}{
+		{"v3 url safe", encodeV3(t, v3, base64.RawURLEncoding), want, false},
+		{"v3 padded standard", encodeV3(t, v3, base64.StdEncoding), want, false},
+		{"v3 uri", "cashu:" + encodeV3(t, v3, base64.URLEncoding), want, false},
+		{"v4", "cashuB" + base64.RawURLEncoding.EncodeToString(v4), want, false},
+		{"unknown version", "cashuZabc", nil, true},
+		{"bad base64", "cashuA!!!", nil, true},
+		{"bad json", "cashuA" + base64.RawURLEncoding.EncodeToString([]byte("{")), nil, true},
+		{"no proofs", encodeV3(t, map[string]any{"token": []any{map[string]any{"mint": "https://mint.example"}}}, base64.RawURLEncoding), nil, true},
+		{"multiple mints", encodeV3(t, map[string]any{"token": []any{
+			map[string]any{"mint": "https://a.example", "proofs": []Proof{{Amount: 1}}},
+			map[string]any{"mint": "https://b.example", "proofs": []Proof{{Amount: 1}}},
+		}}, base64.RawURLEncoding), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := Decode(tt.token)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidToken)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, token)
+			assert.Equal(t, 10, token.Amount())
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	token := &Token{
+		Mint: "https://mint.example",
+		Unit: "sat",
+		Proofs: []Proof{
+			{Amount: 8, ID: "009a1f293253e41e", Secret: "secret1", C: testC},
+			{Amount: 2, ID: "009a1f293253e41e", Secret: "secret2", C: testC},
+			{Amount: 1, ID: "00ad268c4d1f5826", Secret: "secret3", C: testC},
+		},
+	}
+
+	s, err := token.Encode()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(s, "cashuB"))
+	got, err := Decode(s)
+	assert.NoError(t, err)
+	assert.Equal(t, token, got)
+
+	token.Proofs[0].C = "not hex"
+	_, err = token.Encode()
+	assert.Error(t, err)
+}
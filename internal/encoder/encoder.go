@@ -3,17 +3,33 @@ package encoder
 import (
 	"context"
 	"errors"
+	"io"
+	"time"
 )
 
 var (
 	ErrUnsupportedType = errors.New("unsupported type")
+	ErrUnknownDuration = errors.New("unknown duration")
 )
 
 type Encoder interface {
 	HLS(context.Context, EncodeRequest) (EncodeHLSResponse, error)
 	WAV(context.Context, EncodeRequest) (EncodeWAVResponse, error)
+	// Duration reads the length of the audio at req.InputPath.
+	Duration(context.Context, EncodeRequest) (time.Duration, error)
+	// PCM decodes the audio at req.InputPath to raw PCM, streamed as
+	// it's decoded. Closing the stream stops decoding.
+	PCM(context.Context, EncodeRequest) (io.ReadCloser, error)
 }
 
+// The format of raw PCM from Encoder.PCM: signed 16 bit little endian
+// samples, interleaved by channel.
+const (
+	PCMChannels   = 2
+	PCMSampleRate = 44100
+	PCMBits       = 16
+)
+
 type EncodeRequest struct {
 	Mimetype   string
 	InputPath  string
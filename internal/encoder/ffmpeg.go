@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // newFfmpeg returns a new ffmpeg Encoder
@@ -97,6 +98,111 @@ func (e *ffmpegEncoder) WAV(ctx context.Context, req EncodeRequest) (EncodeWAVRe
 	}, nil
 }
 
+// Duration reads the length of the audio from the input's headers, or
+// from the stream when they don't say. The stream is copied rather than
+// decoded so this is cheap.
+func (e *ffmpegEncoder) Duration(ctx context.Context, req EncodeRequest) (time.Duration, error) {
+	args := []string{
+		"-hide_banner",
+		"-i", req.InputPath,
+		"-map", "a",
+		"-c", "copy",
+		"-f", "null", "-",
+	}
+
+	cmd := exec.CommandContext(ctx, e.bin, args...)
+	var out strings.Builder
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		log.Printf("probe failure: %v\n cmd=%q", err, cmd.String())
+		return 0, err
+	}
+
+	return parseDuration(out.String())
+}
+
+// PCM decodes the audio to raw PCM on ffmpeg's stdout.
+func (e *ffmpegEncoder) PCM(ctx context.Context, req EncodeRequest) (io.ReadCloser, error) {
+	args := defaultPCMArgs(req.InputPath)
+
+	cmd := exec.CommandContext(ctx, e.bin, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stream := &pcmStream{cmd: cmd, stdout: stdout}
+	cmd.Stderr = &stream.stderr
+
+	if err := cmd.Start(); err != nil {
+		log.Printf("decode failure: %v\n cmd=%q", err, cmd.String())
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// pcmStream is ffmpeg's stdout while it decodes.
+type pcmStream struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr strings.Builder
+	eof    bool
+}
+
+func (s *pcmStream) Read(p []byte) (int, error) {
+	n, err := s.stdout.Read(p)
+	if err == io.EOF {
+		s.eof = true
+	}
+	return n, err
+}
+
+// Close stops ffmpeg if it's still decoding. Decoding errors are returned
+// once the whole stream has been read.
+func (s *pcmStream) Close() error {
+	if !s.eof {
+		s.cmd.Process.Kill()
+		s.cmd.Wait()
+		return nil
+	}
+
+	if err := s.cmd.Wait(); err != nil {
+		log.Printf("decode failure: %v\n cmd=%q", err, s.cmd.String())
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(s.stderr.String()))
+	}
+	return nil
+}
+
+// parseDuration finds the "Duration: 00:01:02.50" ffmpeg logs for its
+// input, or the time of its progress when that's unknown.
+func parseDuration(output string) (time.Duration, error) {
+	_, after, found := strings.Cut(output, "Duration: ")
+	if !found {
+		return 0, ErrUnknownDuration
+	}
+	stamp, _, _ := strings.Cut(after, ",")
+
+	// Live recordings, like WebM from MediaRecorder, have no duration in
+	// their headers, so use the last time reached copying the stream.
+	if stamp == "N/A" {
+		i := strings.LastIndex(output, "time=")
+		if i < 0 {
+			return 0, ErrUnknownDuration
+		}
+		stamp, _, _ = strings.Cut(output[i+len("time="):], " ")
+	}
+
+	var h, m int
+	var sec float64
+	if _, err := fmt.Sscanf(stamp, "%d:%d:%f", &h, &m, &sec); err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownDuration, stamp)
+	}
+
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second)), nil
+}
+
 func hlsIndexPath(outputPath string) string {
 	return fmt.Sprintf("%s.m3u8", outputPath)
 }
@@ -163,6 +269,22 @@ func defaultWAVArgs(opts EncodeOpts, inputPath, outputPath string) []string {
 	}
 }
 
+func defaultPCMArgs(inputPath string) []string {
+	// ffmpeg -i test.aif -f s16le -acodec pcm_s16le -ac 2 -ar 44100 -
+
+	return []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-i", inputPath,
+		"-map", "0:a:0",
+		"-f", "s16le",
+		"-acodec", "pcm_s16le",
+		"-ac", strconv.Itoa(PCMChannels),
+		"-ar", strconv.Itoa(PCMSampleRate),
+		"-",
+	}
+}
+
 func copyFile(src, dst string) error {
 	stat, err := os.Stat(src)
 	if err != nil {
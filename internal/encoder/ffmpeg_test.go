@@ -2,9 +2,12 @@ package encoder
 
 import (
 	"context"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -28,6 +31,11 @@ func TestHLS(t *testing.T) {
 		{"audio/mp4", "./testdata/test.m4a", filepath.Join(outputDir, "test.m4a")},
 		{"audio/wave", "./testdata/test.wav", filepath.Join(outputDir, "test.wav")},
 		{"audio/ogg", "./testdata/test.ogg", filepath.Join(outputDir, "test.ogg")},
+		{"audio/ogg", "./testdata/test.opus", filepath.Join(outputDir, "test.opus")},
+		{"audio/mp4", "./testdata/test-alac.m4a", filepath.Join(outputDir, "test-alac.m4a")},
+		{"audio/webm", "./testdata/test.webm", filepath.Join(outputDir, "test.webm")},
+		{"audio/x-caf", "./testdata/test.caf", filepath.Join(outputDir, "test.caf")},
+		{"audio/x-wavpack", "./testdata/test.wv", filepath.Join(outputDir, "test.wv")},
 	}
 
 	var (
@@ -77,6 +85,11 @@ func TestWAV(t *testing.T) {
 		{"audio/mp4", "./testdata/test.m4a", filepath.Join(outputDir, "test.wav")},
 		{"audio/wave", "./testdata/test.wav", filepath.Join(outputDir, "test.wav")},
 		{"audio/ogg", "./testdata/test.ogg", filepath.Join(outputDir, "test.wav")},
+		{"audio/ogg", "./testdata/test.opus", filepath.Join(outputDir, "test.wav")},
+		{"audio/mp4", "./testdata/test-alac.m4a", filepath.Join(outputDir, "test.wav")},
+		{"audio/webm", "./testdata/test.webm", filepath.Join(outputDir, "test.wav")},
+		{"audio/x-caf", "./testdata/test.caf", filepath.Join(outputDir, "test.wav")},
+		{"audio/x-wavpack", "./testdata/test.wv", filepath.Join(outputDir, "test.wav")},
 	}
 
 	var (
@@ -100,3 +113,99 @@ func TestWAV(t *testing.T) {
 		})
 	}
 }
+
+func TestPCM(t *testing.T) {
+	if _, err := exec.LookPath(ffmpegPath); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+
+	var tests = []struct {
+		mimeType  string
+		inputPath string
+	}{
+		{"audio/aiff", "./testdata/test.aif"},
+		{"audio/flac", "./testdata/test.flac"},
+		{"audio/mp3", "./testdata/test.mp3"},
+		{"audio/mp4", "./testdata/test.m4a"},
+		{"audio/wave", "./testdata/test.wav"},
+		{"audio/ogg", "./testdata/test.ogg"},
+		{"audio/ogg", "./testdata/test.opus"},
+		{"audio/mp4", "./testdata/test-alac.m4a"},
+		{"audio/webm", "./testdata/test.webm"},
+		{"audio/x-caf", "./testdata/test.caf"},
+		{"audio/x-wavpack", "./testdata/test.wv"},
+	}
+
+	var (
+		ctx = context.Background()
+		enc = New(ffmpegPath, EncodeOpts{})
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.mimeType, func(t *testing.T) {
+			stream, err := enc.PCM(ctx, EncodeRequest{
+				Mimetype:  tt.mimeType,
+				InputPath: tt.inputPath,
+			})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			data, err := io.ReadAll(stream)
+			assert.NoError(t, err)
+			assert.NoError(t, stream.Close())
+			assert.NotEmpty(t, data)
+			assert.Zero(t, len(data)%(PCMChannels*PCMBits/8))
+		})
+	}
+
+	// Decoding errors are returned on Close
+	stream, err := enc.PCM(ctx, EncodeRequest{InputPath: "./testdata/missing.wav"})
+	if assert.NoError(t, err) {
+		io.ReadAll(stream)
+		assert.Error(t, stream.Close())
+	}
+
+	// Closing early stops ffmpeg
+	stream, err = enc.PCM(ctx, EncodeRequest{Mimetype: "audio/wave", InputPath: "./testdata/test.wav"})
+	if assert.NoError(t, err) {
+		_, err = stream.Read(make([]byte, 16))
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Close())
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	var tests = []struct {
+		output   string
+		duration time.Duration
+		wantErr  bool
+	}{
+		{
+			output:   "Input #0, wav, from 'test.wav':\n  Duration: 00:00:05.12, bitrate: 1411 kb/s\n",
+			duration: 5120 * time.Millisecond,
+		},
+		{
+			output:   "  Duration: 01:02:03.50, start: 0.025057, bitrate: 128 kb/s",
+			duration: time.Hour + 2*time.Minute + 3500*time.Millisecond,
+		},
+		{
+			// WebM from MediaRecorder, timed by copying the stream
+			output:   "  Duration: N/A, start: 0.000000, bitrate: N/A\nsize=N/A time=00:00:00.50 bitrate=N/A\rsize=N/A time=00:00:01.98 bitrate=N/A speed= 612x\n",
+			duration: 1980 * time.Millisecond,
+		},
+		{output: "  Duration: N/A, bitrate: N/A", wantErr: true},
+		{output: "  Duration: N/A, bitrate: N/A\nsize=N/A time=N/A bitrate=N/A", wantErr: true},
+		{output: "test.wav: Invalid data found when processing input", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		d, err := parseDuration(tt.output)
+		if tt.wantErr {
+			assert.ErrorIs(t, err, ErrUnknownDuration)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.duration, d)
+	}
+}
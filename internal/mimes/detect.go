@@ -0,0 +1,257 @@
+package mimes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Audio codecs Detect identifies inside a container.
+const (
+	CodecAAC     = "aac"
+	CodecALAC    = "alac"
+	CodecFLAC    = "flac"
+	CodecMP3     = "mp3"
+	CodecOpus    = "opus"
+	CodecPCM     = "pcm"
+	CodecVorbis  = "vorbis"
+	CodecWavPack = "wavpack"
+)
+
+// Format is a file's format as detected from its content.
+type Format struct {
+	// Mimetype is that of the container, as FromFilename gives for its
+	// extension.
+	Mimetype string
+	// Codec is the audio codec, or "" if it isn't known.
+	Codec string
+}
+
+// sniffLen is the number of bytes read to detect a format, enough for the
+// headers checked and the start of the first Ogg packet.
+const sniffLen = 64
+
+// maxID3Tags bounds the number of consecutive ID3 tags skipped.
+const maxID3Tags = 4
+
+// Detect identifies the format of r from its headers, returning the zero
+// Format if it isn't a supported format. Unlike FromFilename it can't be
+// fooled by renaming a file.
+func Detect(r io.ReaderAt) (Format, error) {
+	var offset int64
+	for i := 0; i <= maxID3Tags; i++ {
+		head, err := readAt(r, offset, sniffLen)
+		if err != nil {
+			return Format{}, err
+		}
+
+		// ID3 tags are prepended to MP3s, and sometimes FLACs.
+		if size, ok := id3Size(head); ok && i < maxID3Tags {
+			offset += size
+			continue
+		}
+
+		switch {
+		case offset == 0 && isWAV(head):
+			return Format{Mimetype: "audio/wave", Codec: CodecPCM}, nil
+		case offset == 0 && isAIFF(head):
+			return Format{Mimetype: "audio/aiff", Codec: CodecPCM}, nil
+		case bytes.HasPrefix(head, []byte("fLaC")):
+			return Format{Mimetype: "audio/flac", Codec: CodecFLAC}, nil
+		case offset == 0 && bytes.HasPrefix(head, []byte("OggS")):
+			return detectOgg(head), nil
+		case offset == 0 && len(head) >= 8 && bytes.Equal(head[4:8], []byte("ftyp")):
+			return detectMP4(r)
+		case offset == 0 && bytes.HasPrefix(head, ebmlMagic):
+			return detectWebM(r)
+		case offset == 0 && bytes.HasPrefix(head, []byte("caff")):
+			return detectCAF(head), nil
+		case offset == 0 && isWavPack(head):
+			return Format{Mimetype: "audio/x-wavpack", Codec: CodecWavPack}, nil
+		}
+
+		mp3, err := isMP3(r, offset)
+		if err != nil {
+			return Format{}, err
+		}
+		if mp3 {
+			return Format{Mimetype: "audio/mp3", Codec: CodecMP3}, nil
+		}
+		return Format{}, nil
+	}
+
+	return Format{}, nil
+}
+
+// readAt reads up to n bytes at offset, fewer at the end of r.
+func readAt(r io.ReaderAt, offset int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := r.ReadAt(buf, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:read], nil
+}
+
+func isWAV(head []byte) bool {
+	return len(head) >= 12 &&
+		(bytes.HasPrefix(head, []byte("RIFF")) || bytes.HasPrefix(head, []byte("RF64"))) &&
+		bytes.Equal(head[8:12], []byte("WAVE"))
+}
+
+func isAIFF(head []byte) bool {
+	return len(head) >= 12 &&
+		bytes.HasPrefix(head, []byte("FORM")) &&
+		(bytes.Equal(head[8:12], []byte("AIFF")) || bytes.Equal(head[8:12], []byte("AIFC")))
+}
+
+// isWavPack checks for the header of a WavPack 4 or 5 block.
+func isWavPack(head []byte) bool {
+	if len(head) < 32 || !bytes.HasPrefix(head, []byte("wvpk")) {
+		return false
+	}
+	version := binary.LittleEndian.Uint16(head[8:])
+	return version >= 0x402 && version <= 0x410
+}
+
+// detectOgg identifies the codec of an Ogg stream from the first packet,
+// which must start on the first page.
+func detectOgg(head []byte) Format {
+	if len(head) < 27 {
+		return Format{}
+	}
+	start := 27 + int(head[26])
+	if start > len(head) {
+		return Format{}
+	}
+	packet := head[start:]
+
+	switch {
+	case bytes.HasPrefix(packet, []byte("OpusHead")):
+		return Format{Mimetype: "audio/ogg", Codec: CodecOpus}
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")):
+		return Format{Mimetype: "audio/ogg", Codec: CodecVorbis}
+	case bytes.HasPrefix(packet, []byte("\x7fFLAC")):
+		return Format{Mimetype: "audio/ogg", Codec: CodecFLAC}
+	}
+	// Theora video, or a codec we don't accept
+	return Format{}
+}
+
+// cafCodecs maps CAF format IDs to codecs.
+var cafCodecs = map[string]string{
+	"lpcm": CodecPCM,
+	"alac": CodecALAC,
+	"aac ": CodecAAC,
+	"opus": CodecOpus,
+	"flac": CodecFLAC,
+	".mp3": CodecMP3,
+}
+
+// detectCAF reads the codec from the desc chunk, which is always first.
+func detectCAF(head []byte) Format {
+	if len(head) < 32 || binary.BigEndian.Uint16(head[4:]) != 1 || !bytes.Equal(head[8:12], []byte("desc")) {
+		return Format{}
+	}
+	return Format{Mimetype: "audio/x-caf", Codec: cafCodecs[string(head[28:32])]}
+}
+
+// id3Size is the size of the ID3v2 tag at the start of head, including its
+// header and footer.
+func id3Size(head []byte) (int64, bool) {
+	if len(head) < 10 || !bytes.HasPrefix(head, []byte("ID3")) {
+		return 0, false
+	}
+
+	// The size is syncsafe, 7 bits a byte.
+	var size int64
+	for _, b := range head[6:10] {
+		if b&0x80 != 0 {
+			return 0, false
+		}
+		size = size<<7 | int64(b)
+	}
+
+	size += 10
+	if head[5]&0x10 != 0 {
+		size += 10
+	}
+	return size, true
+}
+
+// mpegFrame is an MPEG audio layer III frame header.
+type mpegFrame struct {
+	length int
+}
+
+// Bitrates in kbit/s by index, for MPEG-1 and MPEG-2/2.5 layer III.
+var (
+	mpeg1Bitrates = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, -1}
+	mpeg2Bitrates = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, -1}
+)
+
+// Sample rates by index, for MPEG-1. MPEG-2 halves and MPEG-2.5 quarters
+// them.
+var mpegSampleRates = [4]int{44100, 48000, 32000, -1}
+
+// parseMPEGFrame parses a layer III frame header. Free format frames,
+// without a bitrate, aren't supported.
+func parseMPEGFrame(h []byte) (mpegFrame, bool) {
+	if len(h) < 4 || h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+		return mpegFrame{}, false
+	}
+
+	version := h[1] >> 3 & 0x3 // 0 MPEG-2.5, 1 reserved, 2 MPEG-2, 3 MPEG-1
+	layer := h[1] >> 1 & 0x3   // 1 layer III
+	if version == 1 || layer != 1 {
+		return mpegFrame{}, false
+	}
+
+	bitrates, shift := mpeg1Bitrates, 0
+	switch version {
+	case 2:
+		bitrates, shift = mpeg2Bitrates, 1
+	case 0:
+		bitrates, shift = mpeg2Bitrates, 2
+	}
+
+	bitrate := bitrates[h[2]>>4]
+	sampleRate := mpegSampleRates[h[2]>>2&0x3]
+	if bitrate <= 0 || sampleRate < 0 {
+		return mpegFrame{}, false
+	}
+	sampleRate >>= shift
+	padding := int(h[2] >> 1 & 0x1)
+
+	// MPEG-2 and 2.5 frames hold half the samples.
+	samples := 144
+	if version != 3 {
+		samples = 72
+	}
+
+	return mpegFrame{length: samples*bitrate*1000/sampleRate + padding}, true
+}
+
+// isMP3 checks for a layer III frame at offset followed by another, or the
+// end of r.
+func isMP3(r io.ReaderAt, offset int64) (bool, error) {
+	head, err := readAt(r, offset, 4)
+	if err != nil {
+		return false, err
+	}
+	frame, ok := parseMPEGFrame(head)
+	if !ok {
+		return false, nil
+	}
+
+	next, err := readAt(r, offset+int64(frame.length), 4)
+	if err != nil {
+		return false, err
+	}
+	if len(next) == 0 {
+		return true, nil
+	}
+	_, ok = parseMPEGFrame(next)
+	return ok, nil
+}
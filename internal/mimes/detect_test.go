@@ -0,0 +1,165 @@
+package mimes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	codecs := map[string]string{
+		"test.aif":      CodecPCM,
+		"test.caf":      CodecALAC,
+		"test.flac":     CodecFLAC,
+		"test.m4a":      CodecAAC,
+		"test-alac.m4a": CodecALAC,
+		"test.mp3":      CodecMP3,
+		"test.ogg":      CodecVorbis,
+		"test.opus":     CodecOpus,
+		"test.wav":      CodecPCM,
+		"test.webm":     CodecOpus,
+		"test.wv":       CodecWavPack,
+	}
+
+	files, err := filepath.Glob("../encoder/testdata/test*.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test files")
+	}
+
+	for _, file := range files {
+		name := filepath.Base(file)
+		t.Run(name, func(t *testing.T) {
+			codec, ok := codecs[name]
+			if !ok {
+				t.Fatalf("no codec expected for %s", name)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			format, err := Detect(bytes.NewReader(data))
+			assert.NoError(t, err)
+			assert.Equal(t, Format{Mimetype: FromFilename(name), Codec: codec}, format)
+		})
+	}
+}
+
+func TestDetectHeaders(t *testing.T) {
+	mp3Frame := append([]byte{0xff, 0xfb, 0x90, 0x64}, make([]byte, 413)...)
+
+	var tests = []struct {
+		name     string
+		data     []byte
+		expected Format
+	}{
+		{"rf64", []byte("RF64\xff\xff\xff\xffWAVEds64"), Format{"audio/wave", CodecPCM}},
+		{"aifc", []byte("FORM\x00\x00\x00\x00AIFCFVER"), Format{"audio/aiff", CodecPCM}},
+		{"id3 flac", append([]byte("ID3\x04\x00\x00\x00\x00\x00\x02ab"), "fLaC"...), Format{"audio/flac", CodecFLAC}},
+		{"id3 mp3", append([]byte("ID3\x03\x00\x00\x00\x00\x00\x00"), mp3Frame...), Format{"audio/mp3", CodecMP3}},
+		{"id3 footer", append([]byte("ID3\x04\x00\x10\x00\x00\x00\x00"+"3DI\x04\x00\x10\x00\x00\x00\x00"), mp3Frame...), Format{"audio/mp3", CodecMP3}},
+		{"mp3 frames", append(append([]byte{}, mp3Frame...), mp3Frame...), Format{"audio/mp3", CodecMP3}},
+		{"mp3 bad second frame", append(append([]byte{}, mp3Frame...), "junk"...), Format{}},
+		{"mpeg layer ii", []byte{0xff, 0xfd, 0x90, 0x64}, Format{}},
+		{"mp3 bad bitrate", []byte{0xff, 0xfb, 0xf0, 0x64}, Format{}},
+		{"ogg flac", oggPage("\x7fFLAC\x01\x00"), Format{"audio/ogg", CodecFLAC}},
+		{"ogg theora", oggPage("\x80theora"), Format{}},
+		{"caf lpcm", cafDesc("lpcm"), Format{"audio/x-caf", CodecPCM}},
+		{"caf unknown codec", cafDesc("ima4"), Format{"audio/x-caf", ""}},
+		{"m4a without moov", mp4Box("ftyp", []byte("M4A \x00\x00\x00\x00M4A ")), Format{}},
+		{"m4a followed by junk", append(mp4Box("ftyp", []byte("M4A \x00\x00\x00\x00M4A ")), "\x7fELF\x02\x01\x01\x00junk"...), Format{}},
+		{"video relabelled m4a", mp4File("M4A ", "M4A ", mp4Track("vide", "avc1"), mp4Track("soun", "mp4a")), Format{}},
+		{"m4a video only", mp4File("M4A ", "mp42", mp4Track("vide", "avc1")), Format{}},
+		{"m4a compatible brand", mp4File("mp42", "M4A ", mp4Track("soun", "mp4a")), Format{"audio/mp4", CodecAAC}},
+		{"mp4 audio only", mp4File("isom", "mp42", mp4Track("soun", "mp4a")), Format{"audio/mp4", CodecAAC}},
+		{"mp4 video", mp4File("isom", "avc1", mp4Track("vide", "avc1"), mp4Track("soun", "mp4a")), Format{}},
+		{"mp4 no audio", mp4File("isom", "mp42", mp4Track("text", "tx3g")), Format{}},
+		{"mp4 without moov", mp4Box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2avc1mp41")), Format{}},
+		{"webm vorbis", webmFile("webm", webmTrack(trackAudio, "A_VORBIS")), Format{"audio/webm", CodecVorbis}},
+		{"webm video", webmFile("webm", webmTrack(trackVideo, "V_VP8"), webmTrack(trackAudio, "A_OPUS")), Format{}},
+		{"matroska", webmFile("matroska", webmTrack(trackAudio, "A_OPUS")), Format{}},
+		{"wavpack bad version", append([]byte("wvpk\x00\x00\x00\x00\x00\x01"), make([]byte, 22)...), Format{}},
+		{"elf", []byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00"), Format{}},
+		{"riff avi", []byte("RIFF\x00\x00\x00\x00AVI LIST"), Format{}},
+		{"truncated", []byte("RIF"), Format{}},
+		{"empty", nil, Format{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := Detect(bytes.NewReader(tt.data))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, format)
+		})
+	}
+}
+
+// oggPage is the start of a first Ogg page holding packet.
+func oggPage(packet string) []byte {
+	page := append([]byte("OggS\x00\x02"), make([]byte, 20)...)
+	page = append(page, 1, byte(len(packet)))
+	return append(page, packet...)
+}
+
+func cafDesc(formatID string) []byte {
+	return []byte("caff\x00\x01\x00\x00desc\x00\x00\x00\x00\x00\x00\x00\x20" +
+		"\x40\xe5\x88\x80\x00\x00\x00\x00" + formatID + "\x00\x00\x00\x00")
+}
+
+func mp4Box(typ string, body ...[]byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(bytes.Join(body, nil))))
+	b = append(b, typ...)
+	return append(b, bytes.Join(body, nil)...)
+}
+
+// mp4File is an MPEG-4 file of the tracks, the moov box after the mdat as
+// ffmpeg writes it.
+func mp4File(brand, compatible string, traks ...[]byte) []byte {
+	return bytes.Join([][]byte{
+		mp4Box("ftyp", []byte(brand+"\x00\x00\x00\x00"+compatible)),
+		mp4Box("mdat", make([]byte, 32)),
+		mp4Box("moov", append([][]byte{mp4Box("mvhd", make([]byte, 100))}, traks...)...),
+	}, nil)
+}
+
+func mp4Track(handler, sampleEntry string) []byte {
+	hdlr := mp4Box("hdlr", make([]byte, 8), []byte(handler), make([]byte, 13))
+	stsd := mp4Box("stsd", []byte{0, 0, 0, 0, 0, 0, 0, 1}, mp4Box(sampleEntry, make([]byte, 28)))
+	stbl := mp4Box("stbl", stsd)
+	return mp4Box("trak", mp4Box("tkhd", make([]byte, 84)), mp4Box("mdia", hdlr, mp4Box("minf", stbl)))
+}
+
+// ebml is an element with a 1 byte size.
+func ebml(id uint32, body ...[]byte) []byte {
+	var b []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if v := byte(id >> shift); v != 0 || len(b) > 0 {
+			b = append(b, v)
+		}
+	}
+	joined := bytes.Join(body, nil)
+	b = append(b, 0x80|byte(len(joined)))
+	return append(b, joined...)
+}
+
+// webmFile is a WebM file of the tracks, the segment of unknown size as
+// MediaRecorder writes it.
+func webmFile(docType string, tracks ...[]byte) []byte {
+	header := ebml(idEBML, ebml(0x4286, []byte{1}), ebml(idDocType, []byte(docType)))
+	segment := []byte{0x18, 0x53, 0x80, 0x67, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	segment = append(segment, ebml(0x1549A966, ebml(0x2AD7B1, []byte{0x0f, 0x42, 0x40}))...)
+	segment = append(segment, ebml(idTracks, tracks...)...)
+	segment = append(segment, 0x1F, 0x43, 0xB6, 0x75, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	return append(header, segment...)
+}
+
+func webmTrack(trackType byte, codecID string) []byte {
+	return ebml(idTrackEntry, ebml(0xD7, []byte{1}), ebml(idTrackType, []byte{trackType}), ebml(idCodecID, []byte(codecID)))
+}
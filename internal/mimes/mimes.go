@@ -29,20 +29,40 @@ var supportedMimes = []mime{
 		OtherMimetypes: []string{"audio/mpeg3", "audio/x-mpeg-3", "audio/mpeg"},
 	},
 	{
+		// AAC or ALAC
 		Mimetype:       "audio/mp4",
 		Extension:      ".m4a",
-		OtherMimetypes: []string{"audio/m4a"},
+		OtherMimetypes: []string{"audio/m4a", "audio/x-m4a"},
 	},
 	{
-		Mimetype:       "audio/ogg",
-		Extension:      ".ogg",
-		OtherMimetypes: []string{"audio/ogg"},
+		// Vorbis, or Opus which RFC 7845 gives the .opus extension
+		Mimetype:        "audio/ogg",
+		Extension:       ".ogg",
+		OtherMimetypes:  []string{"audio/opus"},
+		OtherExtensions: []string{".oga", ".opus"},
 	},
 	{
 		Mimetype:       "audio/wave",
 		Extension:      ".wav",
 		OtherMimetypes: []string{"audio/wav", "audio/x-wav"},
 	},
+	{
+		// Opus or Vorbis, as browsers record
+		Mimetype:        "audio/webm",
+		Extension:       ".webm",
+		OtherExtensions: []string{".weba"},
+	},
+	{
+		// Apple's Core Audio Format, usually ALAC or AAC
+		Mimetype:       "audio/x-caf",
+		Extension:      ".caf",
+		OtherMimetypes: []string{"audio/caf"},
+	},
+	{
+		Mimetype:       "audio/x-wavpack",
+		Extension:      ".wv",
+		OtherMimetypes: []string{"audio/wavpack"},
+	},
 }
 
 // FileExtension returns a file extension for a mimetype.
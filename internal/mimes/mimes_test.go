@@ -19,10 +19,17 @@ func TestFileExtension(t *testing.T) {
 		{"audio/x-mpeg-3", ".mp3"},
 		{"audio/mpeg", ".mp3"},
 		{"audio/mp4", ".m4a"},
+		{"audio/x-m4a", ".m4a"},
 		{"audio/ogg", ".ogg"},
+		{"audio/opus", ".ogg"},
 		{"audio/wave", ".wav"},
 		{"audio/wav", ".wav"},
 		{"audio/x-wav", ".wav"},
+		{"audio/webm", ".webm"},
+		{"audio/x-caf", ".caf"},
+		{"audio/caf", ".caf"},
+		{"audio/x-wavpack", ".wv"},
+		{"audio/wavpack", ".wv"},
 		{"unsupported", ""},
 	}
 
@@ -46,6 +53,12 @@ func TestFromFilename(t *testing.T) {
 		{"test.m4a", "audio/mp4"},
 		{"test.wav", "audio/wave"},
 		{"test.ogg", "audio/ogg"},
+		{"test.oga", "audio/ogg"},
+		{"test.opus", "audio/ogg"},
+		{"test.webm", "audio/webm"},
+		{"test.weba", "audio/webm"},
+		{"test.caf", "audio/x-caf"},
+		{"test.wv", "audio/x-wavpack"},
 		{"test.wtf", ""},
 	}
 
@@ -0,0 +1,172 @@
+package mimes
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// maxChildren bounds the boxes or elements read in each container, so a
+// crafted file can't keep Detect reading.
+const maxChildren = 64
+
+// box is an ISO base media box, the body of which is size bytes at offset.
+type box struct {
+	typ    string
+	offset int64
+	size   int64
+}
+
+// boxes lists the boxes from offset to end, the end of their parent.
+func boxes(r io.ReaderAt, offset, end int64) ([]box, error) {
+	var children []box
+	for len(children) < maxChildren && offset+8 <= end {
+		h, err := readAt(r, offset, 16)
+		if err != nil {
+			return nil, err
+		}
+		if len(h) < 8 {
+			break
+		}
+
+		b := box{typ: string(h[4:8]), offset: offset + 8}
+		switch size := int64(binary.BigEndian.Uint32(h)); size {
+		case 0:
+			// to the end of the file
+			b.size = end - b.offset
+		case 1:
+			if len(h) < 16 {
+				return children, nil
+			}
+			b.offset += 8
+			b.size = int64(binary.BigEndian.Uint64(h[8:])) - 16
+		default:
+			b.size = size - 8
+		}
+		if b.size < 0 || b.size > end-b.offset {
+			break
+		}
+
+		children = append(children, b)
+		offset = b.offset + b.size
+	}
+	return children, nil
+}
+
+// child finds the first box of typ in parent.
+func child(r io.ReaderAt, parent box, typ string) (box, bool, error) {
+	children, err := boxes(r, parent.offset, parent.offset+parent.size)
+	if err != nil {
+		return box{}, false, err
+	}
+	for _, c := range children {
+		if c.typ == typ {
+			return c, true, nil
+		}
+	}
+	return box{}, false, nil
+}
+
+// path finds the box at the path of types below parent.
+func path(r io.ReaderAt, parent box, types ...string) (box, bool, error) {
+	for _, typ := range types {
+		var (
+			ok  bool
+			err error
+		)
+		if parent, ok, err = child(r, parent, typ); !ok || err != nil {
+			return box{}, ok, err
+		}
+	}
+	return parent, true, nil
+}
+
+// mp4Codecs maps sample entry types to codecs.
+var mp4Codecs = map[string]string{
+	"mp4a": CodecAAC,
+	"alac": CodecALAC,
+	"Opus": CodecOpus,
+	"fLaC": CodecFLAC,
+	".mp3": CodecMP3,
+}
+
+// detectMP4 checks an MPEG-4 file has an audio track and no video, and
+// reads the codec of the first audio track. The brands in the ftyp box are
+// only the writer's claim, so the tracks are checked whatever they say.
+func detectMP4(r io.ReaderAt) (Format, error) {
+	file := box{size: 1<<63 - 1}
+
+	moov, ok, err := child(r, file, "moov")
+	if err != nil || !ok {
+		return Format{}, err
+	}
+
+	traks, err := boxes(r, moov.offset, moov.offset+moov.size)
+	if err != nil {
+		return Format{}, err
+	}
+	var (
+		audio, video bool
+		codec        string
+	)
+	for _, trak := range traks {
+		if trak.typ != "trak" {
+			continue
+		}
+		mdia, ok, err := child(r, trak, "mdia")
+		if err != nil {
+			return Format{}, err
+		}
+		if !ok {
+			continue
+		}
+
+		// hdlr has a version, a predefined field then the handler type.
+		hdlr, ok, err := child(r, mdia, "hdlr")
+		if err != nil {
+			return Format{}, err
+		}
+		if !ok {
+			continue
+		}
+		h, err := readAt(r, hdlr.offset, 12)
+		if err != nil {
+			return Format{}, err
+		}
+		if len(h) < 12 {
+			continue
+		}
+
+		switch string(h[8:12]) {
+		case "vide":
+			video = true
+		case "soun":
+			if audio {
+				continue
+			}
+			audio = true
+			if codec, err = sampleEntry(r, mdia); err != nil {
+				return Format{}, err
+			}
+		}
+	}
+
+	if !audio || video {
+		return Format{}, nil
+	}
+	return Format{Mimetype: "audio/mp4", Codec: codec}, nil
+}
+
+// sampleEntry reads the codec of the first sample entry of a track.
+func sampleEntry(r io.ReaderAt, mdia box) (string, error) {
+	stsd, ok, err := path(r, mdia, "minf", "stbl", "stsd")
+	if err != nil || !ok {
+		return "", err
+	}
+
+	// stsd has a version and an entry count before the entries.
+	h, err := readAt(r, stsd.offset, 16)
+	if err != nil || len(h) < 16 {
+		return "", err
+	}
+	return mp4Codecs[string(h[12:16])], nil
+}
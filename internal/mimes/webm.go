@@ -0,0 +1,209 @@
+package mimes
+
+import (
+	"bytes"
+	"io"
+	"math/bits"
+)
+
+var ebmlMagic = []byte{0x1A, 0x45, 0xDF, 0xA3}
+
+// EBML and Matroska element IDs
+const (
+	idEBML       = 0x1A45DFA3
+	idDocType    = 0x4282
+	idSegment    = 0x18538067
+	idTracks     = 0x1654AE6B
+	idCluster    = 0x1F43B675
+	idTrackEntry = 0xAE
+	idTrackType  = 0x83
+	idCodecID    = 0x86
+)
+
+// Matroska track types
+const (
+	trackVideo = 1
+	trackAudio = 2
+)
+
+// unknownElementSize is the size of elements written before it was known,
+// as live recorders like MediaRecorder do for segments and clusters.
+const unknownElementSize = -1
+
+// element is an EBML element, the body of which is size bytes at offset.
+type element struct {
+	id     uint32
+	offset int64
+	size   int64
+}
+
+// readElement reads the header of the element at offset.
+func readElement(r io.ReaderAt, offset int64) (element, bool, error) {
+	h, err := readAt(r, offset, 12)
+	if err != nil || len(h) == 0 {
+		return element{}, false, err
+	}
+
+	// IDs are 1 to 4 bytes, the length marked by the leading zeros of the
+	// first. The marker is kept as part of the ID.
+	idLen := bits.LeadingZeros8(h[0]) + 1
+	if idLen > 4 || len(h) <= idLen {
+		return element{}, false, nil
+	}
+	var id uint32
+	for _, b := range h[:idLen] {
+		id = id<<8 | uint32(b)
+	}
+
+	// Sizes are 1 to 8 bytes, marked the same way but without the marker.
+	// All ones means unknown.
+	h = h[idLen:]
+	sizeLen := bits.LeadingZeros8(h[0]) + 1
+	if sizeLen > 8 || len(h) < sizeLen {
+		return element{}, false, nil
+	}
+	size := int64(h[0]) & (0xFF >> sizeLen)
+	allOnes := size == 0xFF>>sizeLen
+	for _, b := range h[1:sizeLen] {
+		size = size<<8 | int64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+	if allOnes {
+		size = unknownElementSize
+	}
+
+	return element{id: id, offset: offset + int64(idLen+sizeLen), size: size}, true, nil
+}
+
+// elements lists the children of parent, up to any of unknown size.
+func elements(r io.ReaderAt, parent element) ([]element, error) {
+	end := parent.offset + parent.size
+	if parent.size == unknownElementSize {
+		end = 1<<63 - 1
+	}
+
+	var children []element
+	for offset := parent.offset; len(children) < maxChildren && offset < end; {
+		e, ok, err := readElement(r, offset)
+		if err != nil || !ok {
+			return children, err
+		}
+		children = append(children, e)
+		if e.size == unknownElementSize {
+			break
+		}
+		offset = e.offset + e.size
+	}
+	return children, nil
+}
+
+// readBody reads the body of e if it's no more than n bytes.
+func readBody(r io.ReaderAt, e element, n int) ([]byte, error) {
+	if e.size < 0 || e.size > int64(n) {
+		return nil, nil
+	}
+	return readAt(r, e.offset, int(e.size))
+}
+
+// webmCodecs maps Matroska codec IDs to codecs.
+var webmCodecs = map[string]string{
+	"A_OPUS":   CodecOpus,
+	"A_VORBIS": CodecVorbis,
+}
+
+// detectWebM checks a WebM file has an audio track and no video, and reads
+// the codec of the first audio track. Tracks come before the first
+// cluster, so only the start of the file is read.
+func detectWebM(r io.ReaderAt) (Format, error) {
+	header, ok, err := readElement(r, 0)
+	if err != nil || !ok || header.id != idEBML || header.size == unknownElementSize {
+		return Format{}, err
+	}
+	fields, err := elements(r, header)
+	if err != nil {
+		return Format{}, err
+	}
+	var docType []byte
+	for _, f := range fields {
+		if f.id == idDocType {
+			if docType, err = readBody(r, f, 16); err != nil {
+				return Format{}, err
+			}
+		}
+	}
+	if string(bytes.TrimRight(docType, "\x00")) != "webm" {
+		return Format{}, nil
+	}
+
+	segment, ok, err := readElement(r, header.offset+header.size)
+	if err != nil || !ok || segment.id != idSegment {
+		return Format{}, err
+	}
+	children, err := elements(r, segment)
+	if err != nil {
+		return Format{}, err
+	}
+
+	var tracks []element
+	for _, c := range children {
+		if c.id == idCluster {
+			break
+		}
+		if c.id == idTracks {
+			if tracks, err = elements(r, c); err != nil {
+				return Format{}, err
+			}
+			break
+		}
+	}
+
+	var (
+		audio, video bool
+		codec        string
+	)
+	for _, track := range tracks {
+		if track.id != idTrackEntry {
+			continue
+		}
+		fields, err := elements(r, track)
+		if err != nil {
+			return Format{}, err
+		}
+
+		var (
+			trackType uint64
+			codecID   []byte
+		)
+		for _, f := range fields {
+			switch f.id {
+			case idTrackType:
+				v, err := readBody(r, f, 8)
+				if err != nil {
+					return Format{}, err
+				}
+				for _, b := range v {
+					trackType = trackType<<8 | uint64(b)
+				}
+			case idCodecID:
+				if codecID, err = readBody(r, f, 32); err != nil {
+					return Format{}, err
+				}
+			}
+		}
+
+		switch trackType {
+		case trackVideo:
+			video = true
+		case trackAudio:
+			if !audio {
+				audio = true
+				codec = webmCodecs[string(bytes.TrimRight(codecID, "\x00"))]
+			}
+		}
+	}
+
+	if !audio || video {
+		return Format{}, nil
+	}
+	return Format{Mimetype: "audio/webm", Codec: codec}, nil
+}
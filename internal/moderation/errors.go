@@ -0,0 +1,7 @@
+package moderation
+
+import "errors"
+
+var (
+	ErrBanNotFound = errors.New("ban not found")
+)
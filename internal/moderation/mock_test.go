@@ -0,0 +1,28 @@
+package moderation
+
+import (
+	"context"
+)
+
+type mockBanRepo struct {
+	CreateBanBan *Ban
+	CreateBanErr error
+	GetBanBan    *Ban
+	GetBanErr    error
+	DeleteBanErr error
+	ListBansBans []Ban
+	ListBansErr  error
+}
+
+func (m *mockBanRepo) CreateBan(ctx context.Context, ban Ban) (*Ban, error) {
+	return m.CreateBanBan, m.CreateBanErr
+}
+func (m *mockBanRepo) GetBan(ctx context.Context, pubkey string) (*Ban, error) {
+	return m.GetBanBan, m.GetBanErr
+}
+func (m *mockBanRepo) DeleteBan(ctx context.Context, pubkey string) error {
+	return m.DeleteBanErr
+}
+func (m *mockBanRepo) ListBans(ctx context.Context) ([]Ban, error) {
+	return m.ListBansBans, m.ListBansErr
+}
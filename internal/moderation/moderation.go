@@ -0,0 +1,95 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func New(repo banRepo) (*Service, error) {
+	return &Service{
+		repo: repo,
+	}, nil
+}
+
+type Service struct {
+	repo banRepo
+}
+
+type banRepo interface {
+	CreateBan(ctx context.Context, ban Ban) (*Ban, error)
+	GetBan(ctx context.Context, pubkey string) (*Ban, error)
+	DeleteBan(ctx context.Context, pubkey string) error
+	ListBans(ctx context.Context) ([]Ban, error)
+}
+
+// GetBan fetches the ban for a pubkey. ErrBanNotFound is returned if the
+// pubkey is not banned.
+func (s *Service) GetBan(ctx context.Context, pubkey string) (*Ban, error) {
+	return s.repo.GetBan(ctx, normalizePubkey(pubkey))
+}
+
+// IsBanned reports whether pubkey is on the ban list.
+func (s *Service) IsBanned(ctx context.Context, pubkey string) (bool, error) {
+	_, err := s.GetBan(ctx, pubkey)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, ErrBanNotFound):
+		return false, nil
+	default:
+		return false, fmt.Errorf("repo.GetBan: %w", err)
+	}
+}
+
+// SamplesHidden reports whether samples uploaded by pubkey should no longer
+// be served.
+func (s *Service) SamplesHidden(ctx context.Context, pubkey string) (bool, error) {
+	ban, err := s.GetBan(ctx, pubkey)
+	switch {
+	case err == nil:
+		return ban.HideSamples, nil
+	case errors.Is(err, ErrBanNotFound):
+		return false, nil
+	default:
+		return false, fmt.Errorf("repo.GetBan: %w", err)
+	}
+}
+
+// Ban adds a pubkey to the ban list. Banning an already banned pubkey
+// replaces the existing ban.
+func (s *Service) Ban(ctx context.Context, ban Ban) (*Ban, error) {
+	ban.Pubkey = normalizePubkey(ban.Pubkey)
+	if ban.Pubkey == "" {
+		return nil, fmt.Errorf("pubkey required")
+	}
+
+	newBan, err := s.repo.CreateBan(ctx, ban)
+	if err != nil {
+		return nil, fmt.Errorf("CreateBan: %w", err)
+	}
+
+	return newBan, nil
+}
+
+// Unban removes a pubkey from the ban list.
+func (s *Service) Unban(ctx context.Context, pubkey string) error {
+	return s.repo.DeleteBan(ctx, normalizePubkey(pubkey))
+}
+
+func (s *Service) ListBans(ctx context.Context) ([]Ban, error) {
+	return s.repo.ListBans(ctx)
+}
+
+type Ban struct {
+	Pubkey      string    `json:"pubkey" db:"pubkey"`
+	Reason      string    `json:"reason" db:"reason"`
+	HideSamples bool      `json:"hide_samples" db:"hide_samples"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+func normalizePubkey(pubkey string) string {
+	return strings.ToLower(strings.TrimSpace(pubkey))
+}
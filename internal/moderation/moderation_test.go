@@ -0,0 +1,74 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsBanned(t *testing.T) {
+	var tests = []struct {
+		name        string
+		repo        banRepo
+		banned      bool
+		hideSamples bool
+		err         bool
+	}{
+		{
+			name:   "not banned",
+			repo:   &mockBanRepo{GetBanErr: ErrBanNotFound},
+			banned: false,
+		},
+		{
+			name:   "banned",
+			repo:   &mockBanRepo{GetBanBan: &Ban{Pubkey: "xxx"}},
+			banned: true,
+		},
+		{
+			name:        "banned and hidden",
+			repo:        &mockBanRepo{GetBanBan: &Ban{Pubkey: "xxx", HideSamples: true}},
+			banned:      true,
+			hideSamples: true,
+		},
+		{
+			name: "repo error",
+			repo: &mockBanRepo{GetBanErr: errors.New("boom")},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := New(tt.repo)
+			assert.NoError(t, err)
+
+			ctx := context.Background()
+			banned, err := svc.IsBanned(ctx, "xxx")
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.banned, banned)
+
+			hidden, err := svc.SamplesHidden(ctx, "xxx")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.hideSamples, hidden)
+		})
+	}
+}
+
+func TestBan(t *testing.T) {
+	svc, err := New(&mockBanRepo{CreateBanBan: &Ban{Pubkey: "xxx"}})
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	ban, err := svc.Ban(ctx, Ban{Pubkey: "XXX"})
+	assert.NoError(t, err)
+	assert.Equal(t, "xxx", ban.Pubkey)
+
+	_, err = svc.Ban(ctx, Ban{Pubkey: " "})
+	assert.Error(t, err)
+}
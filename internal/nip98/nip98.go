@@ -0,0 +1,108 @@
+// Package nip98 validates NIP-98 HTTP Auth events.
+//
+// https://github.com/nostr-protocol/nips/blob/master/98.md
+package nip98
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// Kind is the event kind used for HTTP Auth.
+	Kind = 27235
+
+	// MaxClockSkew is how far an auth event's created_at may drift from now.
+	MaxClockSkew = time.Minute
+
+	scheme = "Nostr "
+)
+
+var (
+	ErrMissingAuth = errors.New("missing nostr authorization")
+	ErrInvalidAuth = errors.New("invalid nostr authorization")
+)
+
+// Authenticate validates the NIP-98 Authorization header of r against
+// the absolute URL the client was expected to sign and returns the
+// authenticated pubkey.
+func Authenticate(r *http.Request, url string) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", ErrMissingAuth
+	}
+	if !strings.HasPrefix(header, scheme) {
+		return "", ErrMissingAuth
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(header, scheme)))
+	if err != nil {
+		return "", fmt.Errorf("%w: base64: %v", ErrInvalidAuth, err)
+	}
+
+	var event nostr.Event
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return "", fmt.Errorf("%w: json: %v", ErrInvalidAuth, err)
+	}
+
+	if err := validate(r, url, event, time.Now()); err != nil {
+		return "", err
+	}
+
+	return event.PubKey, nil
+}
+
+func validate(r *http.Request, url string, event nostr.Event, now time.Time) error {
+	if event.Kind != Kind {
+		return fmt.Errorf("%w: kind %d", ErrInvalidAuth, event.Kind)
+	}
+
+	createdAt := event.CreatedAt.Time()
+	if createdAt.Before(now.Add(-MaxClockSkew)) || createdAt.After(now.Add(MaxClockSkew)) {
+		return fmt.Errorf("%w: stale event", ErrInvalidAuth)
+	}
+
+	if tag := event.Tags.GetFirst([]string{"u", ""}); tag == nil || tag.Value() != url {
+		return fmt.Errorf("%w: url mismatch", ErrInvalidAuth)
+	}
+
+	if tag := event.Tags.GetFirst([]string{"method", ""}); tag == nil || !strings.EqualFold(tag.Value(), r.Method) {
+		return fmt.Errorf("%w: method mismatch", ErrInvalidAuth)
+	}
+
+	if tag := event.Tags.GetFirst([]string{"payload", ""}); tag != nil && r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return fmt.Errorf("read body: %w", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if fmt.Sprintf("%x", sha256.Sum256(body)) != tag.Value() {
+			return fmt.Errorf("%w: payload mismatch", ErrInvalidAuth)
+		}
+	}
+
+	if event.ID != event.GetID() {
+		return fmt.Errorf("%w: id mismatch", ErrInvalidAuth)
+	}
+
+	ok, err := event.CheckSignature()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAuth, err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: bad signature", ErrInvalidAuth)
+	}
+
+	return nil
+}
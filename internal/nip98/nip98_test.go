@@ -0,0 +1,91 @@
+package nip98
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+)
+
+const testURL = "http://localhost:9000/admin/bans"
+
+func authHeader(t *testing.T, sk string, event nostr.Event) string {
+	assert.NoError(t, event.Sign(sk))
+	b, err := json.Marshal(event)
+	assert.NoError(t, err)
+	return "Nostr " + base64.StdEncoding.EncodeToString(b)
+}
+
+func TestAuthenticate(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, err := nostr.GetPublicKey(sk)
+	assert.NoError(t, err)
+
+	newEvent := func(createdAt time.Time, kind int, url, method string) nostr.Event {
+		return nostr.Event{
+			Kind:      kind,
+			CreatedAt: nostr.Timestamp(createdAt.Unix()),
+			Tags: nostr.Tags{
+				{"u", url},
+				{"method", method},
+			},
+		}
+	}
+
+	var tests = []struct {
+		name   string
+		header string
+		err    error
+	}{
+		{"valid", authHeader(t, sk, newEvent(time.Now(), Kind, testURL, "GET")), nil},
+		{"missing", "", ErrMissingAuth},
+		{"wrong scheme", "Bearer abc", ErrMissingAuth},
+		{"garbage", "Nostr !!!", ErrInvalidAuth},
+		{"wrong kind", authHeader(t, sk, newEvent(time.Now(), 1, testURL, "GET")), ErrInvalidAuth},
+		{"stale", authHeader(t, sk, newEvent(time.Now().Add(-time.Hour), Kind, testURL, "GET")), ErrInvalidAuth},
+		{"wrong url", authHeader(t, sk, newEvent(time.Now(), Kind, "http://evil.example", "GET")), ErrInvalidAuth},
+		{"wrong method", authHeader(t, sk, newEvent(time.Now(), Kind, testURL, "POST")), ErrInvalidAuth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", testURL, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+
+			pubkey, err := Authenticate(r, testURL)
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err), "got %v", err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, pk, pubkey)
+		})
+	}
+}
+
+func TestAuthenticateTampered(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	event := nostr.Event{
+		Kind:      Kind,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"u", testURL}, {"method", "GET"}},
+	}
+	assert.NoError(t, event.Sign(sk))
+	event.Content = "tampered"
+
+	b, err := json.Marshal(event)
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest("GET", testURL, nil)
+	r.Header.Set("Authorization", "Nostr "+base64.StdEncoding.EncodeToString(b))
+
+	_, err = Authenticate(r, testURL)
+	assert.ErrorIs(t, err, ErrInvalidAuth)
+}
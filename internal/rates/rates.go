@@ -0,0 +1,123 @@
+// Package rates converts fiat prices to sats using BTC exchange rates from
+// pluggable sources.
+package rates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+const satsPerBTC = 100_000_000
+
+var ErrNoRate = errors.New("no exchange rate available")
+
+// Source fetches the price of one BTC in a fiat currency.
+type Source interface {
+	Name() string
+	Rate(ctx context.Context, currency string) (float64, error)
+}
+
+type Options struct {
+	// TTL is how long a fetched rate is used before sources are asked
+	// again.
+	TTL time.Duration
+	// MaxStale is how old a cached rate may be and still be used when
+	// every source is failing.
+	MaxStale time.Duration
+	// Static rates are the last resort when there's no usable cached
+	// rate, keyed by currency.
+	Static map[string]float64
+}
+
+func New(sources []Source, opts Options) *Oracle {
+	static := make(map[string]float64, len(opts.Static))
+	for currency, rate := range opts.Static {
+		static[strings.ToUpper(currency)] = rate
+	}
+
+	return &Oracle{
+		sources: sources,
+		ttl:     opts.TTL,
+		stale:   opts.MaxStale,
+		static:  static,
+		cache:   make(map[string]Quote),
+		now:     time.Now,
+	}
+}
+
+// Oracle serves exchange rates from the first working source, caching them
+// for TTL.
+type Oracle struct {
+	sources []Source
+	ttl     time.Duration
+	stale   time.Duration
+	static  map[string]float64
+
+	mu    sync.Mutex
+	cache map[string]Quote
+	now   func() time.Time
+}
+
+// Quote is the price of one BTC in Currency.
+type Quote struct {
+	Currency string
+	Rate     float64
+	Source   string
+	At       time.Time
+}
+
+// Rate fetches the BTC price in currency.
+func (o *Oracle) Rate(ctx context.Context, currency string) (Quote, error) {
+	currency = strings.ToUpper(currency)
+	now := o.now()
+
+	o.mu.Lock()
+	cached, ok := o.cache[currency]
+	o.mu.Unlock()
+	if ok && now.Sub(cached.At) < o.ttl {
+		return cached, nil
+	}
+
+	for _, source := range o.sources {
+		rate, err := source.Rate(ctx, currency)
+		if err == nil && rate <= 0 {
+			err = fmt.Errorf("non-positive rate %v", rate)
+		}
+		if err != nil {
+			log.Printf("rates: %s %s: %v", source.Name(), currency, err)
+			continue
+		}
+
+		quote := Quote{Currency: currency, Rate: rate, Source: source.Name(), At: now}
+		o.mu.Lock()
+		o.cache[currency] = quote
+		o.mu.Unlock()
+		return quote, nil
+	}
+
+	if ok && now.Sub(cached.At) < o.stale {
+		return cached, nil
+	}
+	if rate, ok := o.static[currency]; ok {
+		return Quote{Currency: currency, Rate: rate, Source: "static", At: now}, nil
+	}
+
+	return Quote{}, fmt.Errorf("%w: %s", ErrNoRate, currency)
+}
+
+// SatsFor converts amount of currency to sats, rounding up. The BTC price
+// used is returned alongside.
+func (o *Oracle) SatsFor(ctx context.Context, amount float64, currency string) (int, float64, error) {
+	quote, err := o.Rate(ctx, currency)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int(math.Ceil(amount / quote.Rate * satsPerBTC)), quote.Rate, nil
+}
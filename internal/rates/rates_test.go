@@ -0,0 +1,87 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSource struct {
+	name  string
+	rate  float64
+	err   error
+	calls int
+}
+
+func (s *fakeSource) Name() string { return s.name }
+func (s *fakeSource) Rate(ctx context.Context, currency string) (float64, error) {
+	s.calls++
+	return s.rate, s.err
+}
+
+func TestOracle(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	primary := &fakeSource{name: "primary", rate: 50000}
+	secondary := &fakeSource{name: "secondary", rate: 51000}
+	o := New([]Source{primary, secondary}, Options{
+		TTL:      time.Minute,
+		MaxStale: time.Hour,
+		Static:   map[string]float64{"usd": 40000},
+	})
+	o.now = func() time.Time { return now }
+
+	// Fetched from the first source
+	quote, err := o.Rate(ctx, "usd")
+	assert.NoError(t, err)
+	assert.Equal(t, Quote{Currency: "USD", Rate: 50000, Source: "primary", At: now}, quote)
+
+	// Cached within TTL
+	primary.rate = 60000
+	quote, err = o.Rate(ctx, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(50000), quote.Rate)
+	assert.Equal(t, 1, primary.calls)
+
+	// Falls through to the next source once the cache expires
+	now = now.Add(2 * time.Minute)
+	primary.err = errors.New("down")
+	quote, err = o.Rate(ctx, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, "secondary", quote.Source)
+
+	// Stale cache is used when every source fails
+	now = now.Add(30 * time.Minute)
+	secondary.err = errors.New("down")
+	quote, err = o.Rate(ctx, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(51000), quote.Rate)
+
+	// Then the static rate
+	now = now.Add(2 * time.Hour)
+	quote, err = o.Rate(ctx, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, Quote{Currency: "USD", Rate: 40000, Source: "static", At: now}, quote)
+
+	// And nothing for currencies without one
+	_, err = o.Rate(ctx, "EUR")
+	assert.ErrorIs(t, err, ErrNoRate)
+}
+
+func TestSatsFor(t *testing.T) {
+	o := New([]Source{&fakeSource{name: "fake", rate: 30000}}, Options{TTL: time.Minute})
+
+	sats, rate, err := o.SatsFor(context.Background(), 5, "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(30000), rate)
+	// 5 / 30000 BTC = 16666.67 sats, rounded up
+	assert.Equal(t, 16667, sats)
+
+	o = New([]Source{&fakeSource{name: "zero"}}, Options{TTL: time.Minute})
+	_, _, err = o.SatsFor(context.Background(), 5, "USD")
+	assert.ErrorIs(t, err, ErrNoRate)
+}
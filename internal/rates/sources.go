@@ -0,0 +1,103 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sourceTimeout = 5 * time.Second
+
+// NewSource creates a source by name: "coingecko" or "coinbase".
+func NewSource(name string) (Source, error) {
+	switch name {
+	case "coingecko":
+		return NewCoinGecko("https://api.coingecko.com"), nil
+	case "coinbase":
+		return NewCoinbase("https://api.coinbase.com"), nil
+	default:
+		return nil, fmt.Errorf("unknown rate source %q", name)
+	}
+}
+
+func getJSON(ctx context.Context, u string, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, sourceTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func NewCoinGecko(baseURL string) *CoinGecko {
+	return &CoinGecko{baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+type CoinGecko struct {
+	baseURL string
+}
+
+func (s *CoinGecko) Name() string { return "coingecko" }
+
+func (s *CoinGecko) Rate(ctx context.Context, currency string) (float64, error) {
+	currency = strings.ToLower(currency)
+	u := s.baseURL + "/api/v3/simple/price?ids=bitcoin&vs_currencies=" + url.QueryEscape(currency)
+
+	var resp map[string]map[string]float64
+	if err := getJSON(ctx, u, &resp); err != nil {
+		return 0, err
+	}
+
+	rate, ok := resp["bitcoin"][currency]
+	if !ok {
+		return 0, fmt.Errorf("no %s rate", currency)
+	}
+	return rate, nil
+}
+
+func NewCoinbase(baseURL string) *Coinbase {
+	return &Coinbase{baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+type Coinbase struct {
+	baseURL string
+}
+
+func (s *Coinbase) Name() string { return "coinbase" }
+
+func (s *Coinbase) Rate(ctx context.Context, currency string) (float64, error) {
+	currency = strings.ToUpper(currency)
+
+	var resp struct {
+		Data struct {
+			Rates map[string]string `json:"rates"`
+		} `json:"data"`
+	}
+	if err := getJSON(ctx, s.baseURL+"/v2/exchange-rates?currency=BTC", &resp); err != nil {
+		return 0, err
+	}
+
+	rate, ok := resp.Data.Rates[currency]
+	if !ok {
+		return 0, fmt.Errorf("no %s rate", currency)
+	}
+	return strconv.ParseFloat(rate, 64)
+}
@@ -0,0 +1,41 @@
+package rates
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSources(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/simple/price":
+			assert.Equal(t, "bitcoin", r.URL.Query().Get("ids"))
+			w.Write([]byte(`{"bitcoin":{"` + r.URL.Query().Get("vs_currencies") + `":43210.5}}`))
+		case "/v2/exchange-rates":
+			assert.Equal(t, "BTC", r.URL.Query().Get("currency"))
+			w.Write([]byte(`{"data":{"currency":"BTC","rates":{"USD":"43210.5","EUR":"40000.25"}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	for _, source := range []Source{NewCoinGecko(srv.URL), NewCoinbase(srv.URL)} {
+		t.Run(source.Name(), func(t *testing.T) {
+			rate, err := source.Rate(ctx, "USD")
+			assert.NoError(t, err)
+			assert.Equal(t, 43210.5, rate)
+		})
+	}
+
+	_, err := NewCoinbase(srv.URL).Rate(ctx, "XYZ")
+	assert.Error(t, err)
+
+	_, err = NewSource("nope")
+	assert.Error(t, err)
+}
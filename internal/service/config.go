@@ -1,7 +1,15 @@
 package service
 
+import "github.com/stemstr/storage/internal/waveform"
+
 type Config struct {
 	OriginalMediaLocalDir string
 	StreamMediaLocalDir   string
 	WAVMediaLocalDir      string
+	// Peaks configures the waveform peaks stored with each sample.
+	Peaks waveform.PeaksOptions
+	// Image and Spectrogram configure the preview images stored with each
+	// sample.
+	Image       waveform.ImageOptions
+	Spectrogram waveform.SpectrogramOptions
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +12,9 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 
 	"github.com/stemstr/storage/internal/encoder"
 	"github.com/stemstr/storage/internal/mimes"
@@ -26,21 +30,46 @@ var (
 type Service struct {
 	cfg Config
 	ls  ls.Filesystem
-	s3  *blob.S3
+	s3  blobStore
 	enc encoder.Encoder
 	viz waveform.Generator
+	db  sampleRepo
 }
 
-func New(cfg Config, ls ls.Filesystem, s3 *blob.S3, enc encoder.Encoder, viz waveform.Generator) (*Service, error) {
+func New(cfg Config, ls ls.Filesystem, s3 blobStore, enc encoder.Encoder, viz waveform.Generator, db sampleRepo) (*Service, error) {
 	return &Service{
 		cfg: cfg,
 		ls:  ls,
 		s3:  s3,
 		enc: enc,
 		viz: viz,
+		db:  db,
 	}, nil
 }
 
+// blobStore is implemented by blob.S3, and blob.Memory for tests.
+type blobStore interface {
+	Get(ctx context.Context, path string) (*s3.GetObjectOutput, error)
+	Put(ctx context.Context, req blob.PutRequest) error
+	List(ctx context.Context, prefix string) ([]string, error)
+	Delete(ctx context.Context, keys ...string) error
+}
+
+type sampleRepo interface {
+	CreateSample(ctx context.Context, sample Sample) error
+	GetSample(ctx context.Context, sum string) (*Sample, error)
+	GetSampleOwners(ctx context.Context, sum string) ([]string, error)
+	DeleteSample(ctx context.Context, sum string) error
+}
+
+// Sample records who first uploaded a piece of media.
+type Sample struct {
+	Sum       string    `json:"sum" db:"sum"`
+	Pubkey    string    `json:"pubkey" db:"pubkey"`
+	Mimetype  string    `json:"mimetype" db:"mimetype"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
 type NewSampleRequest struct {
 	Data     []byte
 	Mimetype string
@@ -55,23 +84,35 @@ type NewSampleResponse struct {
 }
 
 func (s *Service) NewSample(ctx context.Context, r *NewSampleRequest) (*NewSampleResponse, error) {
-	var tmpFiles []string
+	var (
+		mu       sync.Mutex
+		errs     []error
+		tmpFiles []string
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}
+	cleanup := func(paths ...string) {
+		mu.Lock()
+		defer mu.Unlock()
+		tmpFiles = append(tmpFiles, paths...)
+	}
+	defer func() {
+		s.ls.Remove(ctx, tmpFiles...)
+	}()
 
 	// 1. Save original file to disk
 	rawMediaPath := filepath.Join(s.cfg.OriginalMediaLocalDir, localFilename(r.Sum, r.Mimetype))
 	if err := s.ls.Write(ctx, rawMediaPath, r.Data); err != nil {
 		return nil, fmt.Errorf("filesystem.Write: %w", err)
 	}
-	tmpFiles = append(tmpFiles, rawMediaPath)
+	cleanup(rawMediaPath)
 
-	// 2. Transcoding
-	var (
-		wg   sync.WaitGroup
-		errs []error
-	)
-	wg.Add(2)
-
-	var wavHash string
+	// 2. Transcoding and analysis, in parallel from the original
+	var wg sync.WaitGroup
+	wg.Add(3)
 
 	// Encode and upload HLS
 	streamMediaPath := filepath.Join(s.cfg.StreamMediaLocalDir, streamFilename(r.Sum))
@@ -83,21 +124,21 @@ func (s *Service) NewSample(ctx context.Context, r *NewSampleRequest) (*NewSampl
 			InputPath:  rawMediaPath,
 			OutputPath: streamMediaPath,
 		})
+		cleanup(resp.IndexFilepath)
+		cleanup(resp.SegmentFilepaths...)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("encoder.HLS: %q: %w", resp.Output, err))
+			fail(fmt.Errorf("encoder.HLS: %q: %w", resp.Output, err))
+			return
 		}
 
 		// Upload to S3
 		if err := s.uploadHLSToS3(resp); err != nil {
-			errs = append(errs, fmt.Errorf("uploadHLSToS3: %w", err))
+			fail(fmt.Errorf("uploadHLSToS3: %w", err))
 		}
-
-		tmpFiles = append(tmpFiles, resp.IndexFilepath)
-		tmpFiles = append(tmpFiles, resp.SegmentFilepaths...)
-
 	}(r.Mimetype, rawMediaPath, streamMediaPath)
 
 	// Encode and upload WAV
+	var wavHash string
 	wavMediaPath := filepath.Join(s.cfg.WAVMediaLocalDir, wavFilename(r.Sum))
 	go func(mimetype, rawMediaPath, wavMediaPath string) {
 		defer wg.Done()
@@ -108,25 +149,53 @@ func (s *Service) NewSample(ctx context.Context, r *NewSampleRequest) (*NewSampl
 			OutputPath: wavMediaPath,
 		})
 		if err != nil {
-			errs = append(errs, fmt.Errorf("encoder.WAV: %q: %w", resp.Output, err))
+			fail(fmt.Errorf("encoder.WAV: %q: %w", resp.Output, err))
 			return
 		}
+		cleanup(resp.Filepath)
 
 		// Upload to S3
 		if err := s.uploadWAVToS3(resp); err != nil {
-			errs = append(errs, fmt.Errorf("uploadWAVToS3: %w", err))
+			fail(fmt.Errorf("uploadWAVToS3: %w", err))
+			return
 		}
 
 		// Hash the new wav file
 		wavData, err := s.ls.Read(ctx, resp.Filepath)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("could not read downloadfile for hashing: %w", err))
+			fail(fmt.Errorf("could not read downloadfile for hashing: %w", err))
+			return
 		}
 		wavHash = fmt.Sprintf("%x", sha256.Sum256(wavData))
+	}(r.Mimetype, rawMediaPath, wavMediaPath)
 
-		tmpFiles = append(tmpFiles, resp.Filepath)
+	// Generate and upload waveform data and images
+	var analysis *waveform.Analysis
+	go func(mimetype, rawMediaPath string) {
+		defer wg.Done()
 
-	}(r.Mimetype, rawMediaPath, wavMediaPath)
+		a, err := s.viz.Analyze(ctx, encoder.EncodeRequest{
+			Mimetype:  mimetype,
+			InputPath: rawMediaPath,
+		}, waveform.AnalyzeOptions{
+			Peaks:       s.cfg.Peaks,
+			Spectrogram: s.cfg.Spectrogram,
+		})
+		if err != nil {
+			fail(fmt.Errorf("waveform analyze: %w", err))
+			return
+		}
+
+		if err := s.storePeaks(ctx, r.Sum, a.Peaks); err != nil {
+			fail(fmt.Errorf("storePeaks: %w", err))
+			return
+		}
+		if err := s.storeImages(ctx, r.Sum, a); err != nil {
+			fail(fmt.Errorf("storeImages: %w", err))
+			return
+		}
+		analysis = a
+	}(r.Mimetype, rawMediaPath)
 
 	wg.Wait()
 
@@ -134,32 +203,86 @@ func (s *Service) NewSample(ctx context.Context, r *NewSampleRequest) (*NewSampl
 		return nil, errs[0]
 	}
 
-	// 3. Generate waveform data
-	waveform, err := s.viz.Waveform(ctx, wavMediaPath)
-	if err != nil {
-		return nil, fmt.Errorf("waveform generate: %w", err)
+	// 3. Record ownership
+	if err := s.db.CreateSample(ctx, Sample{
+		Sum:      r.Sum,
+		Pubkey:   r.Pubkey,
+		Mimetype: r.Mimetype,
+	}); err != nil {
+		return nil, fmt.Errorf("db.CreateSample: %w", err)
 	}
 
-	s.ls.Remove(ctx, tmpFiles...)
-
 	log.Printf("upload: %v created %v\n", r.Pubkey, r.Mimetype)
 
 	return &NewSampleResponse{
 		DownloadHash: wavHash,
 		MediaID:      r.Sum,
-		Waveform:     waveform,
+		Waveform:     analysis.Waveform,
 	}, nil
 }
 
 func (s *Service) GetSample(ctx context.Context, filename string) (*GetSampleResponse, error) {
-	filePath := filepath.Join("download", filename)
-	resp, err := s.s3.Get(ctx, filePath)
+	return s.get(ctx, filepath.Join("download", filename), filename)
+}
+
+// GetPeaks fetches a sample's waveform peaks by filename, sha.json or
+// sha.dat.
+func (s *Service) GetPeaks(ctx context.Context, filename string) (*GetSampleResponse, error) {
+	return s.get(ctx, filepath.Join("waveform", filename), filename)
+}
+
+// GetImage fetches a sample's preview image by name, one of ImageNames.
+func (s *Service) GetImage(ctx context.Context, sum, name string) (*GetSampleResponse, error) {
+	if _, ok := imageContentTypes[name]; !ok {
+		return nil, ErrNotFound
+	}
+	return s.get(ctx, imageKey(sum, name), name)
+}
+
+// RenderWaveformImage draws a sample's waveform image, WaveformPNG or
+// WaveformSVG, from its stored peaks with the played fraction, from 0 to
+// 1, highlighted.
+func (s *Service) RenderWaveformImage(ctx context.Context, sum, name string, played float64) (*GetSampleResponse, error) {
+	if name != WaveformPNG && name != WaveformSVG {
+		return nil, ErrNotFound
+	}
+
+	resp, err := s.GetPeaks(ctx, sum+peaksJSONExt)
+	if err != nil {
+		return nil, err
+	}
+	var peaks waveform.Peaks
+	if err := json.Unmarshal(resp.Data, &peaks); err != nil {
+		return nil, fmt.Errorf("unmarshal peaks: %w", err)
+	}
+
+	opts := s.cfg.Image
+	opts.Played = played
+	render := waveform.WaveformPNG
+	if name == WaveformSVG {
+		render = waveform.WaveformSVG
+	}
+	data, err := render(&peaks, opts)
+	if err != nil {
+		return nil, fmt.Errorf("render %v: %w", name, err)
+	}
+
+	return &GetSampleResponse{
+		Data:        data,
+		Filename:    name,
+		ContentType: imageContentTypes[name],
+	}, nil
+}
+
+func (s *Service) get(ctx context.Context, key, filename string) (*GetSampleResponse, error) {
+	resp, err := s.s3.Get(ctx, key)
 	if err != nil {
 		if strings.Contains(err.Error(), "NoSuchKey") {
 			return nil, ErrNotFound
 		}
 		return nil, fmt.Errorf("s3.Get: %w", err)
 	}
+	defer resp.Body.Close()
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -178,6 +301,111 @@ func (s *Service) GetSample(ctx context.Context, filename string) (*GetSampleRes
 	}, nil
 }
 
+// LookupSample fetches the upload record for a sample by its sum.
+// ErrNotFound is returned for unknown samples, including those uploaded
+// before uploads were recorded.
+func (s *Service) LookupSample(ctx context.Context, sum string) (*Sample, error) {
+	return s.db.GetSample(ctx, sum)
+}
+
+// SampleOwners lists every pubkey that uploaded the sample with sum. A file
+// uploaded by several pubkeys is stored once, as the first uploader's sample.
+func (s *Service) SampleOwners(ctx context.Context, sum string) ([]string, error) {
+	return s.db.GetSampleOwners(ctx, sum)
+}
+
+// DeleteSample removes a sample's download and stream files along with its
+// upload record.
+func (s *Service) DeleteSample(ctx context.Context, sum string) error {
+	streamKeys, err := s.s3.List(ctx, filepath.Join("stream", streamFilename(sum)))
+	if err != nil {
+		return fmt.Errorf("s3.List: %w", err)
+	}
+
+	keys := append([]string{
+		filepath.Join("download", wavFilename(sum)),
+		peaksKey(sum, peaksJSONExt),
+		peaksKey(sum, peaksDatExt),
+	}, streamKeys...)
+	for _, name := range ImageNames {
+		keys = append(keys, imageKey(sum, name))
+	}
+	if err := s.s3.Delete(ctx, keys...); err != nil {
+		return fmt.Errorf("s3.Delete: %w", err)
+	}
+
+	if err := s.db.DeleteSample(ctx, sum); err != nil {
+		return fmt.Errorf("db.DeleteSample: %w", err)
+	}
+
+	return nil
+}
+
+// Duration reads the length of the audio in r.
+func (s *Service) Duration(ctx context.Context, r *NewSampleRequest) (time.Duration, error) {
+	path := filepath.Join(s.cfg.OriginalMediaLocalDir, "probe-"+localFilename(r.Sum, r.Mimetype))
+	if err := s.ls.Write(ctx, path, r.Data); err != nil {
+		return 0, fmt.Errorf("filesystem.Write: %w", err)
+	}
+	defer s.ls.Remove(ctx, path)
+
+	d, err := s.enc.Duration(ctx, encoder.EncodeRequest{
+		Mimetype:  r.Mimetype,
+		InputPath: path,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("encoder.Duration: %w", err)
+	}
+
+	return d, nil
+}
+
+// HoldSample stores an upload that can't be processed yet, e.g. because it
+// hasn't been paid for. Held samples are kept in blob storage so any
+// replica can process them.
+func (s *Service) HoldSample(ctx context.Context, r *NewSampleRequest) error {
+	return s.s3.Put(ctx, blob.PutRequest{
+		Key:           heldKey(r.Sum, r.Mimetype),
+		Body:          bytes.NewReader(r.Data),
+		ContentLength: int64(len(r.Data)),
+		ContentType:   r.Mimetype,
+	})
+}
+
+// ProcessHeldSample processes a sample stored by HoldSample as NewSample
+// would have. r.Data is read from the held copy, which is then discarded.
+func (s *Service) ProcessHeldSample(ctx context.Context, r NewSampleRequest) (*NewSampleResponse, error) {
+	resp, err := s.s3.Get(ctx, heldKey(r.Sum, r.Mimetype))
+	if err != nil {
+		if strings.Contains(err.Error(), "NoSuchKey") {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("s3.Get: %w", err)
+	}
+	defer resp.Body.Close()
+
+	r.Data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+
+	sample, err := s.NewSample(ctx, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.DiscardHeldSample(ctx, r.Sum, r.Mimetype); err != nil {
+		log.Printf("error: DiscardHeldSample: %v", err)
+	}
+
+	return sample, nil
+}
+
+// DiscardHeldSample deletes a sample stored by HoldSample.
+func (s *Service) DiscardHeldSample(ctx context.Context, sum, mimetype string) error {
+	return s.s3.Delete(ctx, heldKey(sum, mimetype))
+}
+
 type GetSampleResponse struct {
 	ContentType string
 	Filename    string
@@ -207,40 +435,35 @@ func (s *Service) uploadHLSToS3(resp encoder.EncodeHLSResponse) error {
 		}, nil
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(1 + len(resp.SegmentFilepaths))
-
-	// IndexFile
-	var err error
-	go func() {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	upload := func(filePath, contentType string) {
 		defer wg.Done()
 
-		var req blob.PutRequest
-		req, err = newReq(resp.IndexFilepath, "application/x-mpegURL")
+		req, err := newReq(filePath, contentType)
+		if err == nil {
+			err = s.s3.Put(ctx, req)
+		}
 		if err != nil {
-			return
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
 		}
+	}
 
-		err = s.s3.Put(ctx, req)
-	}()
-
-	// Segments
+	wg.Add(1 + len(resp.SegmentFilepaths))
+	go upload(resp.IndexFilepath, "application/x-mpegURL")
 	for _, segmentFilepath := range resp.SegmentFilepaths {
-		go func(segmentFilepath string) {
-			defer wg.Done()
-			var req blob.PutRequest
-			req, err = newReq(segmentFilepath, "video/MP2T")
-			if err != nil {
-				return
-			}
-
-			err = s.s3.Put(ctx, req)
-		}(segmentFilepath)
+		go upload(segmentFilepath, "video/MP2T")
 	}
-
 	wg.Wait()
 
-	return err
+	return firstErr
 }
 
 func (s *Service) uploadWAVToS3(resp encoder.EncodeWAVResponse) error {
@@ -265,17 +488,106 @@ func (s *Service) uploadWAVToS3(resp encoder.EncodeWAVResponse) error {
 	})
 }
 
+// storePeaks stores a sample's peaks in both the audiowaveform JSON and
+// binary formats.
+func (s *Service) storePeaks(ctx context.Context, sum string, peaks *waveform.Peaks) error {
+	jsonData, err := json.Marshal(peaks)
+	if err != nil {
+		return fmt.Errorf("marshal peaks: %w", err)
+	}
+	datData, err := peaks.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("marshal peaks: %w", err)
+	}
+
+	if err := s.put(ctx, peaksKey(sum, peaksJSONExt), "application/json", jsonData); err != nil {
+		return err
+	}
+	return s.put(ctx, peaksKey(sum, peaksDatExt), "application/octet-stream", datData)
+}
+
+// storeImages draws and stores the preview images of a sample, its
+// waveform from its peaks along with its spectrogram.
+func (s *Service) storeImages(ctx context.Context, sum string, a *waveform.Analysis) error {
+	images := map[string][]byte{
+		SpectrogramPNG: a.Spectrogram,
+	}
+
+	var err error
+	if images[WaveformPNG], err = waveform.WaveformPNG(a.Peaks, s.cfg.Image); err != nil {
+		return fmt.Errorf("waveform png: %w", err)
+	}
+	if images[WaveformSVG], err = waveform.WaveformSVG(a.Peaks, s.cfg.Image); err != nil {
+		return fmt.Errorf("waveform svg: %w", err)
+	}
+
+	for _, name := range ImageNames {
+		if err := s.put(ctx, imageKey(sum, name), imageContentTypes[name], images[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) put(ctx context.Context, key, contentType string, data []byte) error {
+	return s.s3.Put(ctx, blob.PutRequest{
+		Key:           key,
+		Body:          bytes.NewReader(data),
+		ContentLength: int64(len(data)),
+		ContentType:   contentType,
+	})
+}
+
 // LocalFilename is the new filename on disk. Sha.ext
 func localFilename(sum, mimetype string) string {
 	ext := mimes.FileExtension(mimetype)
 	return sum + ext
 }
 
+// heldKey is where a held upload is stored. pending/sha.ext
+func heldKey(sum, mimetype string) string {
+	return filepath.Join("pending", localFilename(sum, mimetype))
+}
+
 // streamFilename is the stream filename on disk. sha without ext
 func streamFilename(sum string) string {
 	return sum
 }
 
+const (
+	peaksJSONExt = ".json"
+	peaksDatExt  = ".dat"
+)
+
+// peaksKey is where a sample's peaks are stored. waveform/sha.json or
+// waveform/sha.dat
+func peaksKey(sum, ext string) string {
+	return filepath.Join("waveform", sum+ext)
+}
+
+// Preview images stored with each sample.
+const (
+	WaveformPNG    = "waveform.png"
+	WaveformSVG    = "waveform.svg"
+	SpectrogramPNG = "spectrogram.png"
+)
+
+// ImageNames are the names of the preview images stored with each sample.
+var ImageNames = []string{WaveformPNG, WaveformSVG, SpectrogramPNG}
+
+var imageContentTypes = map[string]string{
+	WaveformPNG:    "image/png",
+	WaveformSVG:    "image/svg+xml",
+	SpectrogramPNG: "image/png",
+}
+
+// imageKey is where a sample's preview images are stored.
+// image/sha/waveform.png
+func imageKey(sum, name string) string {
+	return filepath.Join("image", sum, name)
+}
+
 // wavFilename is the WAV filename on disk. sha.wav
 func wavFilename(sum string) string {
 	ext := mimes.FileExtension("audio/wave")
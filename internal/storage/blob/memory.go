@@ -0,0 +1,97 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// NewMemory returns a Memory store, a stand in for S3 in tests.
+func NewMemory() *Memory {
+	return &Memory{
+		objects: map[string]object{},
+	}
+}
+
+// Memory keeps objects in memory behind the same methods as S3, including
+// its NoSuchKey errors.
+type Memory struct {
+	mu      sync.Mutex
+	objects map[string]object
+}
+
+type object struct {
+	data        []byte
+	contentType string
+	metadata    map[string]string
+}
+
+func (m *Memory) Get(ctx context.Context, path string) (*s3.GetObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[path]
+	if !ok {
+		return nil, fmt.Errorf("s3 get object: %w", &types.NoSuchKey{Message: aws.String(path)})
+	}
+
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(obj.data)),
+		ContentLength: int64(len(obj.data)),
+		ContentType:   aws.String(obj.contentType),
+		Metadata:      obj.metadata,
+	}, nil
+}
+
+func (m *Memory) Put(ctx context.Context, req PutRequest) error {
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[req.Key] = object{
+		data:        data,
+		contentType: req.ContentType,
+		metadata:    req.Metadata,
+	}
+
+	return nil
+}
+
+// List returns the keys of all objects with prefix, sorted.
+func (m *Memory) List(ctx context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []string
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		delete(m.objects, key)
+	}
+
+	return nil
+}
@@ -73,6 +73,41 @@ func (c *S3) Put(ctx context.Context, req PutRequest) error {
 	return nil
 }
 
+// List returns the keys of all objects with prefix.
+func (c *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+
+	p := s3.NewListObjectsV2Paginator(c.s3, &s3.ListObjectsV2Input{
+		Bucket: aws.String(c.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("s3 list objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+	}
+
+	return keys, nil
+}
+
+func (c *S3) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		_, err := c.s3.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(c.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("s3 delete object %q: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
 func (c *S3) ensureBucket(ctx context.Context) error {
 	bucket := aws.String(c.bucket)
 
@@ -6,4 +6,30 @@ var (
 	ErrSubscriptionNotFound = errors.New("subscription not found")
 	ErrSubscriptionExpired  = errors.New("subscription expired")
 	ErrSubscriptionUnpaid   = errors.New("subscription unpaid")
+	ErrInvalidTransition    = errors.New("invalid status transition")
+	// ErrStatusConflict is returned by repos when a subscription's status
+	// changed between being read and being updated.
+	ErrStatusConflict = errors.New("subscription status changed concurrently")
+	// ErrInvoiceExpired is returned by LNProviders when asked about an
+	// invoice that can no longer be paid.
+	ErrInvoiceExpired = errors.New("invoice expired")
+	// ErrInvoiceUnpaid is returned when a payment notification can't be
+	// confirmed with the provider.
+	ErrInvoiceUnpaid = errors.New("invoice unpaid")
+	ErrUnderpaid     = errors.New("payment less than subscription price")
+	// ErrDescriptionHashUnsupported is returned when the LNProvider can't
+	// create invoices committing to a description hash.
+	ErrDescriptionHashUnsupported = errors.New("lightning provider doesn't support description hashes")
+	ErrNoRateOracle               = errors.New("fiat pricing not configured")
+
+	ErrPromoCodeNotFound  = errors.New("promo code not found")
+	ErrPromoCodeExists    = errors.New("promo code already exists")
+	ErrPromoCodeExpired   = errors.New("promo code expired")
+	ErrPromoCodeExhausted = errors.New("promo code fully redeemed")
+	ErrPromoCodeRedeemed  = errors.New("promo code already redeemed by pubkey")
+	ErrInvalidPromoCode   = errors.New("invalid promo code")
+
+	ErrGroupMemberNotFound = errors.New("group member not found")
+	ErrInvalidGroupMember  = errors.New("invalid group member")
+	ErrGroupFull           = errors.New("group has too many members")
 )
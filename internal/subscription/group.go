@@ -0,0 +1,104 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxGroupMembers caps how many pubkeys a subscriber can share with.
+const MaxGroupMembers = 100
+
+// GroupMember is a pubkey sharing Owner's subscription, e.g. the members of
+// a band or the artists on a label. Groups belong to the owner's pubkey
+// rather than a single subscription so they carry over renewals.
+type GroupMember struct {
+	Owner     string    `json:"owner" db:"owner"`
+	Pubkey    string    `json:"pubkey" db:"pubkey"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// AddGroupMember shares owner's subscription with member. The owner must
+// have an active subscription of their own.
+func (s *SubscriptionService) AddGroupMember(ctx context.Context, owner, member string) error {
+	if owner == member {
+		return fmt.Errorf("%w: owner can't be a member", ErrInvalidGroupMember)
+	}
+	if _, err := s.getOwnActiveSubscription(ctx, owner); err != nil {
+		return err
+	}
+
+	members, err := s.repo.GetGroupMembers(ctx, owner)
+	if err != nil {
+		return fmt.Errorf("repo.GetGroupMembers: %w", err)
+	}
+	for _, m := range members {
+		if m.Pubkey == member {
+			return nil
+		}
+	}
+	if len(members) >= MaxGroupMembers {
+		return ErrGroupFull
+	}
+
+	return s.repo.AddGroupMember(ctx, owner, member)
+}
+
+// RemoveGroupMember stops sharing owner's subscription with member.
+func (s *SubscriptionService) RemoveGroupMember(ctx context.Context, owner, member string) error {
+	return s.repo.RemoveGroupMember(ctx, owner, member)
+}
+
+// GetGroupMembers lists the pubkeys sharing owner's subscription.
+func (s *SubscriptionService) GetGroupMembers(ctx context.Context, owner string) ([]GroupMember, error) {
+	return s.repo.GetGroupMembers(ctx, owner)
+}
+
+// SetGroupMembers replaces the members of owner's group, e.g. with those
+// of an imported list. The owner must have an active subscription of their
+// own.
+func (s *SubscriptionService) SetGroupMembers(ctx context.Context, owner string, members []string) error {
+	seen := make(map[string]bool, len(members))
+	unique := make([]string, 0, len(members))
+	for _, m := range members {
+		if m == owner {
+			return fmt.Errorf("%w: owner can't be a member", ErrInvalidGroupMember)
+		}
+		if seen[m] {
+			continue
+		}
+		seen[m] = true
+		unique = append(unique, m)
+	}
+	if len(unique) > MaxGroupMembers {
+		return ErrGroupFull
+	}
+	if _, err := s.getOwnActiveSubscription(ctx, owner); err != nil {
+		return err
+	}
+
+	return s.repo.SetGroupMembers(ctx, owner, unique)
+}
+
+// getGroupSubscription finds an active subscription shared with member by
+// the owner of a group it belongs to. Membership isn't transitive.
+func (s *SubscriptionService) getGroupSubscription(ctx context.Context, member string) (*Subscription, error) {
+	owners, err := s.repo.GetGroupOwners(ctx, member)
+	if err != nil {
+		return nil, fmt.Errorf("repo.GetGroupOwners: %w", err)
+	}
+
+	for _, owner := range owners {
+		sub, err := s.getOwnActiveSubscription(ctx, owner)
+		if errors.Is(err, ErrSubscriptionNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return sub, nil
+	}
+
+	return nil, ErrSubscriptionNotFound
+}
@@ -0,0 +1,118 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetActiveSubscriptionGroup(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		now  = time.Now()
+		paid = Subscription{
+			ID:        1,
+			Pubkey:    "label",
+			Status:    StatusPaid,
+			StartsAt:  now.Add(-time.Hour),
+			ExpiresAt: now.Add(time.Hour),
+		}
+		lapsed = Subscription{
+			ID:        2,
+			Pubkey:    "lapsed",
+			Status:    StatusPaid,
+			StartsAt:  now.Add(-time.Hour * 2),
+			ExpiresAt: now.Add(-time.Hour),
+		}
+	)
+
+	var tests = []struct {
+		name   string
+		owners []string
+		sub    *Subscription
+	}{
+		{"member", []string{"label"}, &paid},
+		{"first active owner", []string{"lapsed", "label"}, &paid},
+		{"owner lapsed", []string{"lapsed"}, nil},
+		{"not a member", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockSubscriptionRepo{
+				GroupOwners: tt.owners,
+				ActiveSubsByPubkey: map[string][]Subscription{
+					"label":  {paid},
+					"lapsed": {lapsed},
+				},
+			}
+			svc, err := New(repo, &mockLNProvider{}, "mock")
+			assert.NoError(t, err)
+
+			sub, err := svc.GetActiveSubscription(ctx, "artist")
+			if tt.sub == nil {
+				assert.ErrorIs(t, err, ErrSubscriptionNotFound)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.sub.ID, sub.ID)
+		})
+	}
+}
+
+func TestAddGroupMember(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		now  = time.Now()
+		paid = Subscription{ID: 1, Pubkey: "label", Status: StatusPaid, StartsAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)}
+	)
+
+	// Owner must be subscribed
+	repo := &mockSubscriptionRepo{}
+	svc, err := New(repo, &mockLNProvider{}, "mock")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, svc.AddGroupMember(ctx, "label", "artist"), ErrSubscriptionNotFound)
+
+	// Not through someone else's group either
+	repo.GroupOwners = []string{"other"}
+	repo.ActiveSubsByPubkey = map[string][]Subscription{"other": {paid}}
+	assert.ErrorIs(t, svc.AddGroupMember(ctx, "label", "artist"), ErrSubscriptionNotFound)
+
+	repo = &mockSubscriptionRepo{GetActiveSubscriptionSubs: []Subscription{paid}}
+	svc, err = New(repo, &mockLNProvider{}, "mock")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, svc.AddGroupMember(ctx, "label", "label"), ErrInvalidGroupMember)
+	assert.NoError(t, svc.AddGroupMember(ctx, "label", "artist"))
+	assert.NoError(t, svc.AddGroupMember(ctx, "label", "artist"))
+	assert.Len(t, repo.GroupMembers, 1)
+
+	for i := len(repo.GroupMembers); i < MaxGroupMembers; i++ {
+		repo.GroupMembers = append(repo.GroupMembers, GroupMember{Owner: "label", Pubkey: fmt.Sprint(i)})
+	}
+	assert.ErrorIs(t, svc.AddGroupMember(ctx, "label", "one-too-many"), ErrGroupFull)
+}
+
+func TestSetGroupMembers(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		now  = time.Now()
+		paid = Subscription{ID: 1, Pubkey: "label", Status: StatusPaid, StartsAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)}
+	)
+
+	repo := &mockSubscriptionRepo{GetActiveSubscriptionSubs: []Subscription{paid}}
+	svc, err := New(repo, &mockLNProvider{}, "mock")
+	assert.NoError(t, err)
+
+	assert.NoError(t, svc.SetGroupMembers(ctx, "label", []string{"a", "b", "a"}))
+	assert.Equal(t, []string{"a", "b"}, repo.SetMembers)
+	assert.ErrorIs(t, svc.SetGroupMembers(ctx, "label", []string{"a", "label"}), ErrInvalidGroupMember)
+
+	tooMany := make([]string, MaxGroupMembers+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprint(i)
+	}
+	assert.ErrorIs(t, svc.SetGroupMembers(ctx, "label", tooMany), ErrGroupFull)
+}
@@ -0,0 +1,252 @@
+// Package cln implements subscription.LNProvider against a Core Lightning
+// node's clnrest API, authenticated with a rune.
+package cln
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+)
+
+const (
+	invoiceExpiry = 5 * time.Minute
+	// retryDelay is how long WatchPayments waits before calling
+	// waitanyinvoice again after it fails.
+	retryDelay = 5 * time.Second
+)
+
+// New creates a client for the clnrest API at baseURL. rune must permit
+// invoice, listinvoices and waitanyinvoice. tlsCertPath may be empty if
+// the node's certificate is signed by a trusted CA.
+func New(baseURL, rune, tlsCertPath string) (*Client, error) {
+	if rune == "" {
+		return nil, fmt.Errorf("rune required")
+	}
+
+	httpClient := &http.Client{}
+	if tlsCertPath != "" {
+		pem, err := os.ReadFile(tlsCertPath)
+		if err != nil {
+			return nil, fmt.Errorf("read tls cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", tlsCertPath)
+		}
+		httpClient.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}
+	}
+
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		rune:    rune,
+		http:    httpClient,
+	}, nil
+}
+
+type Client struct {
+	baseURL string
+	rune    string
+	http    *http.Client
+}
+
+type invoice struct {
+	Label              string `json:"label"`
+	PaymentHash        string `json:"payment_hash"`
+	Status             string `json:"status"` // "unpaid", "paid", "expired"
+	AmountReceivedMsat int64  `json:"amount_received_msat"`
+	PayIndex           int64  `json:"pay_index"`
+	ExpiresAt          int64  `json:"expires_at"`
+}
+
+func (c *Client) CreateInvoice(ctx context.Context, s sub.Subscription) (*sub.Invoice, error) {
+	return c.invoice(ctx, s, map[string]any{
+		"description": s.InvoiceMemo(),
+	})
+}
+
+// CreateInvoiceForDescription creates an invoice committing to the hash of
+// description.
+func (c *Client) CreateInvoiceForDescription(ctx context.Context, s sub.Subscription, description string) (*sub.Invoice, error) {
+	return c.invoice(ctx, s, map[string]any{
+		"description":  description,
+		"deschashonly": true,
+	})
+}
+
+func (c *Client) invoice(ctx context.Context, s sub.Subscription, req map[string]any) (*sub.Invoice, error) {
+	label, err := newLabel()
+	if err != nil {
+		return nil, err
+	}
+
+	req["amount_msat"] = s.Sats * 1000
+	req["label"] = label
+	req["expiry"] = int(invoiceExpiry.Seconds())
+	var resp struct {
+		PaymentHash string `json:"payment_hash"`
+		Bolt11      string `json:"bolt11"`
+		ExpiresAt   int64  `json:"expires_at"`
+	}
+	if err := c.call(ctx, "invoice", req, &resp); err != nil {
+		return nil, fmt.Errorf("invoice: %w", err)
+	}
+
+	return &sub.Invoice{
+		ID:               resp.PaymentHash,
+		LightningInvoice: resp.Bolt11,
+		ExpiresAt:        time.Unix(resp.ExpiresAt, 0),
+	}, nil
+}
+
+func (c *Client) IsInvoicePaid(ctx context.Context, id string) (bool, error) {
+	var resp struct {
+		Invoices []invoice `json:"invoices"`
+	}
+	if err := c.call(ctx, "listinvoices", map[string]any{"payment_hash": id}, &resp); err != nil {
+		return false, fmt.Errorf("listinvoices: %w", err)
+	}
+	if len(resp.Invoices) == 0 {
+		return false, fmt.Errorf("invoice %s not found", id)
+	}
+
+	switch resp.Invoices[0].Status {
+	case "paid":
+		return true, nil
+	case "expired":
+		return false, sub.ErrInvoiceExpired
+	default:
+		return false, nil
+	}
+}
+
+// WatchPayments long-polls waitanyinvoice and calls paid for each invoice
+// paid after the call starts, until ctx is done.
+func (c *Client) WatchPayments(ctx context.Context, paid func(sub.Payment)) {
+	var lastPayIndex int64
+	for {
+		var err error
+		lastPayIndex, err = c.lastPayIndex(ctx)
+		if err == nil {
+			break
+		}
+		log.Printf("cln: listinvoices: %v", err)
+		if !sleep(ctx, retryDelay) {
+			return
+		}
+	}
+
+	for {
+		var inv invoice
+		err := c.call(ctx, "waitanyinvoice", map[string]any{"lastpay_index": lastPayIndex}, &inv)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("cln: waitanyinvoice: %v", err)
+			if !sleep(ctx, retryDelay) {
+				return
+			}
+			continue
+		}
+
+		lastPayIndex = inv.PayIndex
+		if inv.Status != "paid" {
+			continue
+		}
+		paid(sub.Payment{
+			Provider:  "cln",
+			InvoiceID: inv.PaymentHash,
+			WebhookID: inv.PaymentHash,
+			Sats:      int(inv.AmountReceivedMsat / 1000),
+		})
+	}
+}
+
+// lastPayIndex finds the highest pay_index so WatchPayments doesn't replay
+// invoices paid before it started.
+func (c *Client) lastPayIndex(ctx context.Context) (int64, error) {
+	var resp struct {
+		Invoices []invoice `json:"invoices"`
+	}
+	if err := c.call(ctx, "listinvoices", map[string]any{}, &resp); err != nil {
+		return 0, err
+	}
+
+	var last int64
+	for _, inv := range resp.Invoices {
+		if inv.PayIndex > last {
+			last = inv.PayIndex
+		}
+	}
+
+	return last, nil
+}
+
+func (c *Client) call(ctx context.Context, method string, params, out any) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/"+method, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Rune", c.rune)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		var rpcErr struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if json.Unmarshal(body, &rpcErr) == nil && rpcErr.Message != "" {
+			return fmt.Errorf("cln: %s: %s (code %d)", resp.Status, rpcErr.Message, rpcErr.Code)
+		}
+		return fmt.Errorf("cln: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// newLabel makes a unique invoice label. Invoices are looked up by payment
+// hash so the label only has to be unique.
+func newLabel() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("label: %w", err)
+	}
+	return "stemstr-" + hex.EncodeToString(b), nil
+}
+
+// sleep waits for d, returning false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,180 @@
+package cln
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+)
+
+const rune = "test-rune"
+
+// node is an in-process stand-in for clnrest. waitanyinvoice returns paid
+// in order, then blocks.
+func node(t *testing.T, invoices []invoice, paid []invoice) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Rune") != rune {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{"code": 1501, "message": "Not authorized"})
+			return
+		}
+
+		var params map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+
+		switch strings.TrimPrefix(r.URL.Path, "/v1/") {
+		case "invoice":
+			assert.Equal(t, float64(1000000), params["amount_msat"])
+			assert.Equal(t, float64(300), params["expiry"])
+			assert.True(t, strings.HasPrefix(params["label"].(string), "stemstr-"))
+			// Flag description hash invoices so tests can check them
+			bolt11 := "lnbc10u1test"
+			if params["deschashonly"] == true {
+				bolt11 += "-" + params["description"].(string)
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{
+				"payment_hash": "abc123",
+				"bolt11":       bolt11,
+				"expires_at":   1700000300,
+			})
+		case "listinvoices":
+			var matched []invoice
+			for _, inv := range invoices {
+				if hash, ok := params["payment_hash"]; !ok || hash == inv.PaymentHash {
+					matched = append(matched, inv)
+				}
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"invoices": matched})
+		case "waitanyinvoice":
+			last := int64(params["lastpay_index"].(float64))
+			for _, inv := range paid {
+				if inv.PayIndex > last {
+					w.WriteHeader(http.StatusCreated)
+					json.NewEncoder(w).Encode(inv)
+					return
+				}
+			}
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestCreateInvoice(t *testing.T) {
+	srv := node(t, nil, nil)
+	defer srv.Close()
+
+	c, err := New(srv.URL, rune, "")
+	assert.NoError(t, err)
+
+	invoice, err := c.CreateInvoice(context.Background(), sub.Subscription{Days: 30, Sats: 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, &sub.Invoice{
+		ID:               "abc123",
+		LightningInvoice: "lnbc10u1test",
+		ExpiresAt:        time.Unix(1700000300, 0),
+	}, invoice)
+}
+
+func TestCreateInvoiceForDescription(t *testing.T) {
+	srv := node(t, nil, nil)
+	defer srv.Close()
+
+	c, err := New(srv.URL, rune, "")
+	assert.NoError(t, err)
+
+	invoice, err := c.CreateInvoiceForDescription(context.Background(), sub.Subscription{Days: 30, Sats: 1000}, "zap request")
+	assert.NoError(t, err)
+	assert.Equal(t, "lnbc10u1test-zap request", invoice.LightningInvoice)
+}
+
+func TestIsInvoicePaid(t *testing.T) {
+	srv := node(t, []invoice{
+		{PaymentHash: "unpaid", Status: "unpaid"},
+		{PaymentHash: "paid", Status: "paid", PayIndex: 1},
+		{PaymentHash: "expired", Status: "expired"},
+	}, nil)
+	defer srv.Close()
+
+	tests := []struct {
+		id      string
+		paid    bool
+		err     error
+		wantErr bool
+	}{
+		{id: "unpaid", paid: false},
+		{id: "paid", paid: true},
+		{id: "expired", err: sub.ErrInvoiceExpired, wantErr: true},
+		{id: "missing", wantErr: true},
+	}
+
+	c, err := New(srv.URL, rune, "")
+	assert.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			paid, err := c.IsInvoicePaid(context.Background(), tt.id)
+			if tt.wantErr {
+				assert.Error(t, err)
+				if tt.err != nil {
+					assert.ErrorIs(t, err, tt.err)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.paid, paid)
+		})
+	}
+}
+
+func TestBadRune(t *testing.T) {
+	srv := node(t, nil, nil)
+	defer srv.Close()
+
+	c, err := New(srv.URL, "wrong", "")
+	assert.NoError(t, err)
+
+	_, err = c.IsInvoicePaid(context.Background(), "paid")
+	assert.ErrorContains(t, err, "Not authorized")
+}
+
+func TestWatchPayments(t *testing.T) {
+	old := invoice{PaymentHash: "old", Status: "paid", PayIndex: 1, AmountReceivedMsat: 1000000}
+	srv := node(t, []invoice{old}, []invoice{
+		old,
+		{PaymentHash: "new", Status: "paid", PayIndex: 2, AmountReceivedMsat: 2000000},
+	})
+	defer srv.Close()
+
+	c, err := New(srv.URL, rune, "")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	payments := make(chan sub.Payment)
+	done := make(chan struct{})
+	go func() {
+		c.WatchPayments(ctx, func(p sub.Payment) { payments <- p })
+		close(done)
+	}()
+
+	// Invoices paid before WatchPayments started aren't replayed.
+	select {
+	case p := <-payments:
+		assert.Equal(t, sub.Payment{Provider: "cln", InvoiceID: "new", WebhookID: "new", Sats: 2000}, p)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no payment received")
+	}
+
+	cancel()
+	<-done
+}
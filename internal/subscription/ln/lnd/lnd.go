@@ -0,0 +1,243 @@
+// Package lnd implements subscription.LNProvider against an LND node's
+// REST API.
+package lnd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+)
+
+const (
+	invoiceExpiry = 5 * time.Minute
+	// retryDelay is how long WatchPayments waits before resubscribing
+	// after the invoice stream drops.
+	retryDelay = 5 * time.Second
+)
+
+// New creates a client for the LND REST API at baseURL. macaroonHex is an
+// invoice macaroon, hex encoded. tlsCertPath may be empty if the node's
+// certificate is signed by a trusted CA.
+func New(baseURL, macaroonHex, tlsCertPath string) (*Client, error) {
+	if _, err := hex.DecodeString(macaroonHex); err != nil {
+		return nil, fmt.Errorf("macaroon must be hex encoded: %w", err)
+	}
+
+	httpClient := &http.Client{}
+	if tlsCertPath != "" {
+		pem, err := os.ReadFile(tlsCertPath)
+		if err != nil {
+			return nil, fmt.Errorf("read tls cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", tlsCertPath)
+		}
+		httpClient.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}
+	}
+
+	return &Client{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		macaroon: macaroonHex,
+		http:     httpClient,
+	}, nil
+}
+
+type Client struct {
+	baseURL  string
+	macaroon string
+	http     *http.Client
+}
+
+// invoice is the subset of lnrpc.Invoice we use. The REST gateway encodes
+// int64 fields as strings and bytes fields as base64.
+type invoice struct {
+	RHash        []byte `json:"r_hash"`
+	Value        int64  `json:"value,string"`
+	AmtPaidSat   int64  `json:"amt_paid_sat,string"`
+	CreationDate int64  `json:"creation_date,string"`
+	Expiry       int64  `json:"expiry,string"`
+	State        string `json:"state"` // "OPEN", "SETTLED", "CANCELED", "ACCEPTED"
+}
+
+func (i invoice) expiresAt() time.Time {
+	return time.Unix(i.CreationDate+i.Expiry, 0)
+}
+
+func (c *Client) CreateInvoice(ctx context.Context, s sub.Subscription) (*sub.Invoice, error) {
+	return c.addInvoice(ctx, s, nil)
+}
+
+// CreateInvoiceForDescription creates an invoice committing to the hash of
+// description.
+func (c *Client) CreateInvoiceForDescription(ctx context.Context, s sub.Subscription, description string) (*sub.Invoice, error) {
+	hash := sha256.Sum256([]byte(description))
+	return c.addInvoice(ctx, s, hash[:])
+}
+
+func (c *Client) addInvoice(ctx context.Context, s sub.Subscription, descriptionHash []byte) (*sub.Invoice, error) {
+	req := struct {
+		Memo            string `json:"memo,omitempty"`
+		DescriptionHash []byte `json:"description_hash,omitempty"`
+		Value           int64  `json:"value,string"`
+		Expiry          int64  `json:"expiry,string"`
+	}{
+		DescriptionHash: descriptionHash,
+		Value:           int64(s.Sats),
+		Expiry:          int64(invoiceExpiry.Seconds()),
+	}
+	if descriptionHash == nil {
+		req.Memo = s.InvoiceMemo()
+	}
+	var resp struct {
+		RHash          []byte `json:"r_hash"`
+		PaymentRequest string `json:"payment_request"`
+	}
+
+	now := time.Now()
+	if err := c.do(ctx, http.MethodPost, "/v1/invoices", req, &resp); err != nil {
+		return nil, fmt.Errorf("AddInvoice: %w", err)
+	}
+
+	return &sub.Invoice{
+		ID:               hex.EncodeToString(resp.RHash),
+		LightningInvoice: resp.PaymentRequest,
+		ExpiresAt:        now.Add(invoiceExpiry),
+	}, nil
+}
+
+func (c *Client) IsInvoicePaid(ctx context.Context, id string) (bool, error) {
+	var inv invoice
+	if err := c.do(ctx, http.MethodGet, "/v1/invoice/"+id, nil, &inv); err != nil {
+		return false, fmt.Errorf("LookupInvoice: %w", err)
+	}
+
+	switch {
+	case inv.State == "SETTLED":
+		return true, nil
+	case inv.State == "CANCELED", !inv.expiresAt().After(time.Now()):
+		return false, sub.ErrInvoiceExpired
+	default:
+		return false, nil
+	}
+}
+
+// WatchPayments subscribes to the node's invoice updates and calls paid
+// for each settled invoice until ctx is done. Dropped streams are
+// resubscribed; invoices settled in between are left to polling.
+func (c *Client) WatchPayments(ctx context.Context, paid func(sub.Payment)) {
+	for {
+		err := c.subscribeInvoices(ctx, paid)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("lnd: invoice subscription dropped: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+func (c *Client) subscribeInvoices(ctx context.Context, paid func(sub.Payment)) error {
+	req, err := c.newRequest(ctx, http.MethodGet, "/v1/invoices/subscribe", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Result *invoice `json:"result"`
+			Error  *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			return err
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("stream error: %s", msg.Error.Message)
+		}
+		if msg.Result == nil || msg.Result.State != "SETTLED" {
+			continue
+		}
+
+		id := hex.EncodeToString(msg.Result.RHash)
+		paid(sub.Payment{
+			Provider:  "lnd",
+			InvoiceID: id,
+			WebhookID: id,
+			Sats:      int(msg.Result.AmtPaidSat),
+		})
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body any) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Grpc-Metadata-macaroon", c.macaroon)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func statusError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("lnd: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+}
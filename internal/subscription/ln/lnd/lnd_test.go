@@ -0,0 +1,179 @@
+package lnd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+)
+
+const macaroon = "0201036c6e64"
+
+var rHash = []byte{0xde, 0xad, 0xbe, 0xef}
+
+// node is an in-process stand-in for LND's REST API.
+func node(t *testing.T, invoices map[string]invoice, stream []invoice) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/invoices", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Memo            string `json:"memo"`
+			DescriptionHash []byte `json:"description_hash"`
+			Value           int64  `json:"value,string"`
+			Expiry          int64  `json:"expiry,string"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, int64(1000), req.Value)
+		assert.Equal(t, int64(300), req.Expiry)
+		// Echo the description hash back so tests can check it
+		pr := "lnbc10u1test"
+		if req.DescriptionHash != nil {
+			assert.Empty(t, req.Memo)
+			pr += hex.EncodeToString(req.DescriptionHash)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"r_hash":          rHash,
+			"payment_request": pr,
+		})
+	})
+	mux.HandleFunc("/v1/invoice/", func(w http.ResponseWriter, r *http.Request) {
+		inv, ok := invoices[r.URL.Path[len("/v1/invoice/"):]]
+		if !ok {
+			http.Error(w, `{"message":"unable to locate invoice"}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(inv)
+	})
+	mux.HandleFunc("/v1/invoices/subscribe", func(w http.ResponseWriter, r *http.Request) {
+		enc := json.NewEncoder(w)
+		for _, inv := range stream {
+			enc.Encode(map[string]any{"result": inv})
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Grpc-Metadata-macaroon") != macaroon {
+			http.Error(w, "bad macaroon", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+}
+
+func TestCreateInvoice(t *testing.T) {
+	srv := node(t, nil, nil)
+	defer srv.Close()
+
+	c, err := New(srv.URL, macaroon, "")
+	assert.NoError(t, err)
+
+	invoice, err := c.CreateInvoice(context.Background(), sub.Subscription{Days: 30, Sats: 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, "deadbeef", invoice.ID)
+	assert.Equal(t, "lnbc10u1test", invoice.LightningInvoice)
+	assert.WithinDuration(t, time.Now().Add(invoiceExpiry), invoice.ExpiresAt, 5*time.Second)
+}
+
+func TestCreateInvoiceForDescription(t *testing.T) {
+	srv := node(t, nil, nil)
+	defer srv.Close()
+
+	c, err := New(srv.URL, macaroon, "")
+	assert.NoError(t, err)
+
+	invoice, err := c.CreateInvoiceForDescription(context.Background(), sub.Subscription{Days: 30, Sats: 1000}, "zap request")
+	assert.NoError(t, err)
+	hash := sha256.Sum256([]byte("zap request"))
+	assert.Equal(t, "lnbc10u1test"+hex.EncodeToString(hash[:]), invoice.LightningInvoice)
+}
+
+func TestIsInvoicePaid(t *testing.T) {
+	now := time.Now().Unix()
+	invoices := map[string]invoice{
+		"open":     {State: "OPEN", CreationDate: now, Expiry: 300},
+		"settled":  {State: "SETTLED", CreationDate: now, Expiry: 300},
+		"canceled": {State: "CANCELED", CreationDate: now, Expiry: 300},
+		"lapsed":   {State: "OPEN", CreationDate: now - 600, Expiry: 300},
+	}
+	srv := node(t, invoices, nil)
+	defer srv.Close()
+
+	tests := []struct {
+		id   string
+		paid bool
+		err  error
+	}{
+		{id: "open", paid: false},
+		{id: "settled", paid: true},
+		{id: "canceled", err: sub.ErrInvoiceExpired},
+		{id: "lapsed", err: sub.ErrInvoiceExpired},
+	}
+
+	c, err := New(srv.URL, macaroon, "")
+	assert.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			paid, err := c.IsInvoicePaid(context.Background(), tt.id)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.paid, paid)
+		})
+	}
+}
+
+func TestIsInvoicePaidBadMacaroon(t *testing.T) {
+	srv := node(t, nil, nil)
+	defer srv.Close()
+
+	c, err := New(srv.URL, "00", "")
+	assert.NoError(t, err)
+
+	_, err = c.IsInvoicePaid(context.Background(), "open")
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestWatchPayments(t *testing.T) {
+	srv := node(t, nil, []invoice{
+		{RHash: []byte{0x01}, State: "OPEN"},
+		{RHash: rHash, State: "SETTLED", AmtPaidSat: 1000},
+	})
+	defer srv.Close()
+
+	c, err := New(srv.URL, macaroon, "")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	payments := make(chan sub.Payment)
+	done := make(chan struct{})
+	go func() {
+		c.WatchPayments(ctx, func(p sub.Payment) { payments <- p })
+		close(done)
+	}()
+
+	select {
+	case p := <-payments:
+		id := hex.EncodeToString(rHash)
+		assert.Equal(t, sub.Payment{Provider: "lnd", InvoiceID: id, WebhookID: id, Sats: 1000}, p)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no payment received")
+	}
+
+	cancel()
+	<-done
+}
+
+func TestNewRejectsBadMacaroon(t *testing.T) {
+	_, err := New("https://localhost:8080", "not hex", "")
+	assert.Error(t, err)
+	_, err = New("https://localhost:8080", macaroon, "/does/not/exist.cert")
+	assert.Error(t, err)
+}
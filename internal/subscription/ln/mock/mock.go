@@ -1,29 +1,166 @@
+// Package mock is an LNProvider for local development and tests. Nothing is
+// paid until Pay is called, which delivers the payment to watchers like a
+// node would.
 package mock
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	sub "github.com/stemstr/storage/internal/subscription"
 )
 
+const (
+	// invoiceTTL is how long invoices last before they expire.
+	invoiceTTL = time.Hour
+	// invoicePrefix prefixes invoice ids to make their payment request.
+	invoicePrefix = "lnbcfake"
+)
+
 func New() *Client {
-	return &Client{}
+	return &Client{
+		invoices: map[string]*invoice{},
+	}
 }
 
 type Client struct {
+	mu       sync.Mutex
+	lastID   int
+	invoices map[string]*invoice
+	watchers []func(sub.Payment)
+	// unwatched are payments made while nobody was watching, delivered to
+	// the next watcher.
+	unwatched []sub.Payment
+}
+
+type invoice struct {
+	sats    int
+	paid    bool
+	expired bool
 }
 
 func (c *Client) CreateInvoice(ctx context.Context, s sub.Subscription) (*sub.Invoice, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastID++
+	id := fmt.Sprintf("mock-%d", c.lastID)
+	c.invoices[id] = &invoice{sats: s.Sats}
+
 	return &sub.Invoice{
-		ID:               "fake",
-		LightningInvoice: "lnbcfake",
+		ID:               id,
+		LightningInvoice: invoicePrefix + id,
+		ExpiresAt:        time.Now().Add(invoiceTTL),
 	}, nil
 }
 
+func (c *Client) CreateInvoiceForDescription(ctx context.Context, s sub.Subscription, description string) (*sub.Invoice, error) {
+	return c.CreateInvoice(ctx, s)
+}
+
+// IsInvoicePaid reports on invoices created by the client. The ids "paid"
+// and "expired" are always paid and expired respectively.
 func (c *Client) IsInvoicePaid(ctx context.Context, id string) (bool, error) {
-	if id == "paid" {
+	switch id {
+	case "paid":
 		return true, nil
+	case "expired":
+		return false, sub.ErrInvoiceExpired
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	inv, ok := c.invoices[id]
+	switch {
+	case !ok:
+		return false, nil
+	case inv.expired:
+		return false, sub.ErrInvoiceExpired
+	}
+
+	return inv.paid, nil
+}
+
+// WatchPayments calls paid for every invoice paid with Pay until ctx is
+// done, starting with any paid before anyone was watching.
+func (c *Client) WatchPayments(ctx context.Context, paid func(sub.Payment)) {
+	c.mu.Lock()
+	c.watchers = append(c.watchers, paid)
+	i := len(c.watchers) - 1
+	unwatched := c.unwatched
+	c.unwatched = nil
+	c.mu.Unlock()
+
+	for _, p := range unwatched {
+		paid(p)
+	}
+
+	<-ctx.Done()
+
+	c.mu.Lock()
+	c.watchers[i] = nil
+	c.mu.Unlock()
+}
+
+// Pay pays an invoice in full, like a wallet would given its payment
+// request. Its id is accepted too. Watchers have been notified by the time
+// it returns.
+func (c *Client) Pay(invoice string) error {
+	id := strings.TrimPrefix(invoice, invoicePrefix)
+
+	c.mu.Lock()
+	inv, ok := c.invoices[id]
+	switch {
+	case !ok:
+		c.mu.Unlock()
+		return fmt.Errorf("unknown invoice %q", invoice)
+	case inv.expired:
+		c.mu.Unlock()
+		return sub.ErrInvoiceExpired
+	}
+	inv.paid = true
+
+	p := sub.Payment{
+		Provider:  "mock",
+		InvoiceID: id,
+		WebhookID: id,
+		Sats:      inv.sats,
+	}
+	var watchers []func(sub.Payment)
+	for _, paid := range c.watchers {
+		if paid != nil {
+			watchers = append(watchers, paid)
+		}
+	}
+	if len(watchers) == 0 {
+		c.unwatched = append(c.unwatched, p)
+	}
+	c.mu.Unlock()
+
+	for _, paid := range watchers {
+		paid(p)
+	}
+
+	return nil
+}
+
+// Expire expires an invoice unless it's been paid. Like Pay, it takes the
+// payment request or id.
+func (c *Client) Expire(invoice string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	inv, ok := c.invoices[strings.TrimPrefix(invoice, invoicePrefix)]
+	if !ok {
+		return fmt.Errorf("unknown invoice %q", invoice)
+	}
+	if !inv.paid {
+		inv.expired = true
 	}
 
-	return false, nil
+	return nil
 }
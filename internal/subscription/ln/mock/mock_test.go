@@ -0,0 +1,64 @@
+package mock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+)
+
+func TestPay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := New()
+	early, err := c.CreateInvoice(ctx, sub.Subscription{Sats: 100})
+	assert.NoError(t, err)
+	late, err := c.CreateInvoice(ctx, sub.Subscription{Sats: 200})
+	assert.NoError(t, err)
+	assert.NotEqual(t, early.ID, late.ID)
+
+	paid, err := c.IsInvoicePaid(ctx, early.ID)
+	assert.NoError(t, err)
+	assert.False(t, paid)
+
+	// Paid before anyone watches
+	assert.NoError(t, c.Pay(early.LightningInvoice))
+
+	payments := make(chan sub.Payment, 2)
+	go c.WatchPayments(ctx, func(p sub.Payment) {
+		payments <- p
+	})
+	assert.Equal(t, sub.Payment{Provider: "mock", InvoiceID: early.ID, WebhookID: early.ID, Sats: 100}, <-payments)
+
+	assert.NoError(t, c.Pay(late.ID))
+	assert.Equal(t, sub.Payment{Provider: "mock", InvoiceID: late.ID, WebhookID: late.ID, Sats: 200}, <-payments)
+
+	paid, err = c.IsInvoicePaid(ctx, late.ID)
+	assert.NoError(t, err)
+	assert.True(t, paid)
+
+	assert.Error(t, c.Pay("unknown"))
+}
+
+func TestExpire(t *testing.T) {
+	ctx := context.Background()
+
+	c := New()
+	inv, err := c.CreateInvoice(ctx, sub.Subscription{Sats: 100})
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.Expire(inv.ID))
+	_, err = c.IsInvoicePaid(ctx, inv.ID)
+	assert.ErrorIs(t, err, sub.ErrInvoiceExpired)
+	assert.ErrorIs(t, c.Pay(inv.ID), sub.ErrInvoiceExpired)
+
+	// The fixed ids still work
+	paid, err := c.IsInvoicePaid(ctx, "paid")
+	assert.NoError(t, err)
+	assert.True(t, paid)
+	_, err = c.IsInvoicePaid(ctx, "expired")
+	assert.ErrorIs(t, err, sub.ErrInvoiceExpired)
+}
@@ -2,13 +2,16 @@ package nodeless
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/nodeless-io/go-nodeless"
 
 	sub "github.com/stemstr/storage/internal/subscription"
 )
 
-func New(apiKey, storeID string, testnet bool) (*Client, error) {
+// New creates a nodeless client for storeID. webhookSecret signs webhook
+// deliveries and may be empty if webhooks aren't used.
+func New(apiKey, storeID, webhookSecret string, testnet bool) (*Client, error) {
 	c, err := nodeless.New(nodeless.Config{
 		APIKey:     apiKey,
 		UseTestnet: testnet,
@@ -18,14 +21,16 @@ func New(apiKey, storeID string, testnet bool) (*Client, error) {
 	}
 
 	return &Client{
-		Client:  c,
-		storeID: storeID,
+		Client:        c,
+		storeID:       storeID,
+		webhookSecret: webhookSecret,
 	}, nil
 }
 
 type Client struct {
 	*nodeless.Client
-	storeID string
+	storeID       string
+	webhookSecret string
 }
 
 func (c *Client) CreateInvoice(ctx context.Context, s sub.Subscription) (*sub.Invoice, error) {
@@ -50,11 +55,33 @@ func (c *Client) IsInvoicePaid(ctx context.Context, id string) (bool, error) {
 		return false, err
 	}
 
-	if status == nodeless.InvoiceStatusPaid {
+	switch status {
+	case nodeless.InvoiceStatusPaid:
 		return true, nil
+	case nodeless.InvoiceStatusExpired:
+		return false, sub.ErrInvoiceExpired
+	default:
+		return false, nil
+	}
+}
+
+// VerifyPayment re-fetches an invoice from Nodeless and returns the payment
+// if it's been paid. sub.ErrInvoiceUnpaid is returned otherwise.
+func (c *Client) VerifyPayment(ctx context.Context, id string) (*sub.Payment, error) {
+	invoice, err := c.GetStoreInvoice(ctx, c.storeID, id)
+	if err != nil {
+		return nil, fmt.Errorf("GetStoreInvoice: %w", err)
 	}
 
-	// TODO: Determine how to handle expired invoices
+	// Overpaid invoices are still paid.
+	if invoice.Status != nodeless.InvoiceStatusPaid && invoice.Status != "overpaid" {
+		return nil, fmt.Errorf("%w: invoice status %q", sub.ErrInvoiceUnpaid, invoice.Status)
+	}
 
-	return false, nil
+	return &sub.Payment{
+		Provider:  "nodeless",
+		InvoiceID: invoice.ID,
+		WebhookID: invoice.ID,
+		Sats:      int(invoice.SatsAmount),
+	}, nil
 }
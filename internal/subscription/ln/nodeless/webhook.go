@@ -0,0 +1,115 @@
+package nodeless
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nodeless-io/go-nodeless"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of a webhook body, keyed
+// with the webhook secret.
+const SignatureHeader = "nodeless-signature"
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// webhookEvents are the invoice events the store webhook is subscribed to.
+var webhookEvents = []nodeless.WebhookEvent{
+	nodeless.WebhookEventPaid,
+	nodeless.WebhookEventOverpaid,
+	nodeless.WebhookEventUnderpaid,
+	nodeless.WebhookEventExpired,
+}
+
+// WebhookEvent is an invoice status change delivered to the store webhook.
+type WebhookEvent struct {
+	InvoiceID string `json:"uuid"`
+	Status    string `json:"status"` // "paid", "overpaid", "underpaid", "expired"
+}
+
+// EnsureWebhook registers a store webhook delivering invoice events to url.
+// An existing webhook for url is replaced if its secret or events differ.
+func (c *Client) EnsureWebhook(ctx context.Context, url string) error {
+	if c.webhookSecret == "" {
+		return fmt.Errorf("webhook secret not configured")
+	}
+
+	webhooks, err := c.GetStoreWebhooks(ctx, c.storeID)
+	if err != nil {
+		return fmt.Errorf("GetStoreWebhooks: %w", err)
+	}
+
+	for _, webhook := range webhooks {
+		if webhook.URL != url {
+			continue
+		}
+		if webhook.Secret == c.webhookSecret && webhook.Status == nodeless.WebhookStatusActive && hasEvents(webhook.Events) {
+			return nil
+		}
+		// The secret can't be updated in place, so start over.
+		if err := c.DeleteStoreWebhook(ctx, c.storeID, webhook.ID); err != nil {
+			return fmt.Errorf("DeleteStoreWebhook: %w", err)
+		}
+	}
+
+	_, err = c.CreateStoreWebhook(ctx, nodeless.CreateStoreWebhookRequest{
+		StoreID: c.storeID,
+		Type:    nodeless.WebhookTypeStore,
+		URL:     url,
+		Events:  webhookEvents,
+		Secret:  c.webhookSecret,
+		Status:  nodeless.WebhookStatusActive,
+	})
+	if err != nil {
+		return fmt.Errorf("CreateStoreWebhook: %w", err)
+	}
+
+	return nil
+}
+
+func hasEvents(events []nodeless.WebhookEvent) bool {
+	have := make(map[nodeless.WebhookEvent]bool, len(events))
+	for _, event := range events {
+		have[event] = true
+	}
+	for _, event := range webhookEvents {
+		if !have[event] {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseWebhook checks the signature of a webhook body and decodes it.
+// ErrInvalidSignature is returned if the body wasn't signed with the
+// webhook secret.
+func (c *Client) ParseWebhook(body []byte, signature string) (*WebhookEvent, error) {
+	if c.webhookSecret == "" {
+		return nil, fmt.Errorf("webhook secret not configured")
+	}
+
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, []byte(c.webhookSecret))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("decode webhook: %w", err)
+	}
+	if event.InvoiceID == "" {
+		return nil, fmt.Errorf("webhook missing invoice id")
+	}
+
+	return &event, nil
+}
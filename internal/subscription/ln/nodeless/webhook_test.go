@@ -0,0 +1,85 @@
+package nodeless
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestParseWebhook(t *testing.T) {
+	body := []byte(`{"uuid":"inv1","status":"paid","satsAmount":1000}`)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		want      *WebhookEvent
+		err       error
+	}{
+		{
+			name:      "valid",
+			secret:    "s3cret",
+			body:      body,
+			signature: sign("s3cret", body),
+			want:      &WebhookEvent{InvoiceID: "inv1", Status: "paid"},
+		},
+		{
+			name:      "wrong secret",
+			secret:    "s3cret",
+			body:      body,
+			signature: sign("other", body),
+			err:       ErrInvalidSignature,
+		},
+		{
+			name:      "tampered body",
+			secret:    "s3cret",
+			body:      []byte(`{"uuid":"inv2","status":"paid","satsAmount":1000}`),
+			signature: sign("s3cret", body),
+			err:       ErrInvalidSignature,
+		},
+		{
+			name:      "missing signature",
+			secret:    "s3cret",
+			body:      body,
+			signature: "",
+			err:       ErrInvalidSignature,
+		},
+		{
+			name:      "malformed signature",
+			secret:    "s3cret",
+			body:      body,
+			signature: "not hex",
+			err:       ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{webhookSecret: tt.secret}
+			event, err := c.ParseWebhook(tt.body, tt.signature)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, event)
+		})
+	}
+}
+
+func TestParseWebhookNoSecret(t *testing.T) {
+	body := []byte(`{"uuid":"inv1","status":"paid"}`)
+	c := &Client{}
+	_, err := c.ParseWebhook(body, sign("", body))
+	assert.Error(t, err)
+}
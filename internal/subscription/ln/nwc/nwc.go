@@ -0,0 +1,345 @@
+// Package nwc implements subscription.LNProvider with a wallet reached over
+// Nostr Wallet Connect (NIP-47).
+package nwc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+)
+
+const (
+	KindRequest      = 23194
+	KindResponse     = 23195
+	KindNotification = 23196
+
+	invoiceExpiry = 5 * time.Minute
+	// requestTimeout bounds how long the wallet has to respond.
+	requestTimeout = 30 * time.Second
+	// retryDelay is how long WatchPayments waits before resubscribing
+	// after the relay connection drops.
+	retryDelay = 5 * time.Second
+)
+
+var ErrInvalidURI = errors.New("invalid nostr+walletconnect uri")
+
+// New creates a client for the wallet described by a
+// nostr+walletconnect://<wallet pubkey>?relay=<url>&secret=<hex> URI. The
+// relay is connected to on first use.
+func New(uri string) (*Client, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURI, err)
+	}
+	if u.Scheme != "nostr+walletconnect" {
+		return nil, fmt.Errorf("%w: scheme %q", ErrInvalidURI, u.Scheme)
+	}
+
+	walletPubkey := u.Host
+	if walletPubkey == "" {
+		// nostr+walletconnect:<pubkey> is also seen in the wild
+		walletPubkey = u.Opaque
+	}
+	if !isHexKey(walletPubkey) {
+		return nil, fmt.Errorf("%w: wallet pubkey", ErrInvalidURI)
+	}
+
+	relay := u.Query().Get("relay")
+	if relay == "" {
+		return nil, fmt.Errorf("%w: missing relay", ErrInvalidURI)
+	}
+
+	secret := u.Query().Get("secret")
+	if !isHexKey(secret) {
+		return nil, fmt.Errorf("%w: secret", ErrInvalidURI)
+	}
+	pubkey, err := nostr.GetPublicKey(secret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: secret: %v", ErrInvalidURI, err)
+	}
+	sharedSecret, err := nip04.ComputeSharedSecret(walletPubkey, secret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: shared secret: %v", ErrInvalidURI, err)
+	}
+
+	return &Client{
+		relayURL:     relay,
+		walletPubkey: walletPubkey,
+		secret:       secret,
+		pubkey:       pubkey,
+		sharedSecret: sharedSecret,
+	}, nil
+}
+
+func isHexKey(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == 32
+}
+
+type Client struct {
+	relayURL     string
+	walletPubkey string
+	secret       string
+	pubkey       string
+	sharedSecret []byte
+
+	mu    sync.Mutex
+	relay *nostr.Relay
+}
+
+// nwcError is the error object of a NIP-47 response.
+type nwcError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *nwcError) Error() string {
+	return fmt.Sprintf("nwc: %s: %s", e.Code, e.Message)
+}
+
+// transaction is the invoice object returned by make_invoice and
+// lookup_invoice, and carried by payment notifications.
+type transaction struct {
+	Type        string `json:"type"`
+	Invoice     string `json:"invoice"`
+	PaymentHash string `json:"payment_hash"`
+	Amount      int64  `json:"amount"` // msats
+	CreatedAt   int64  `json:"created_at"`
+	ExpiresAt   int64  `json:"expires_at"`
+	SettledAt   int64  `json:"settled_at"`
+}
+
+func (c *Client) CreateInvoice(ctx context.Context, s sub.Subscription) (*sub.Invoice, error) {
+	return c.makeInvoice(ctx, s, map[string]any{
+		"description": s.InvoiceMemo(),
+	})
+}
+
+// CreateInvoiceForDescription creates an invoice committing to the hash of
+// description.
+func (c *Client) CreateInvoiceForDescription(ctx context.Context, s sub.Subscription, description string) (*sub.Invoice, error) {
+	hash := sha256.Sum256([]byte(description))
+	return c.makeInvoice(ctx, s, map[string]any{
+		"description_hash": hex.EncodeToString(hash[:]),
+	})
+}
+
+func (c *Client) makeInvoice(ctx context.Context, s sub.Subscription, params map[string]any) (*sub.Invoice, error) {
+	params["amount"] = s.Sats * 1000
+	params["expiry"] = int(invoiceExpiry.Seconds())
+
+	var tx transaction
+	if err := c.call(ctx, "make_invoice", params, &tx); err != nil {
+		return nil, fmt.Errorf("make_invoice: %w", err)
+	}
+
+	invoice := &sub.Invoice{
+		ID:               tx.PaymentHash,
+		LightningInvoice: tx.Invoice,
+	}
+	if tx.ExpiresAt > 0 {
+		invoice.ExpiresAt = time.Unix(tx.ExpiresAt, 0)
+	}
+
+	return invoice, nil
+}
+
+func (c *Client) IsInvoicePaid(ctx context.Context, id string) (bool, error) {
+	var tx transaction
+	if err := c.call(ctx, "lookup_invoice", map[string]any{"payment_hash": id}, &tx); err != nil {
+		return false, fmt.Errorf("lookup_invoice: %w", err)
+	}
+
+	switch {
+	case tx.SettledAt > 0:
+		return true, nil
+	case tx.ExpiresAt > 0 && time.Unix(tx.ExpiresAt, 0).Before(time.Now()):
+		return false, sub.ErrInvoiceExpired
+	default:
+		return false, nil
+	}
+}
+
+// WatchPayments listens for payment_received notifications from the wallet
+// and calls paid for each until ctx is done. Payments missed while the
+// relay is unreachable are left to polling.
+func (c *Client) WatchPayments(ctx context.Context, paid func(sub.Payment)) {
+	for {
+		err := c.watch(ctx, paid)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("nwc: notification subscription dropped: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+func (c *Client) watch(ctx context.Context, paid func(sub.Payment)) error {
+	relay, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	since := nostr.Now()
+	s, err := relay.Subscribe(ctx, nostr.Filters{{
+		Kinds:   []int{KindNotification},
+		Authors: []string{c.walletPubkey},
+		Tags:    nostr.TagMap{"p": []string{c.pubkey}},
+		Since:   &since,
+	}})
+	if err != nil {
+		return err
+	}
+	defer s.Unsub()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-relay.Context().Done():
+			return fmt.Errorf("relay disconnected")
+		case ev, ok := <-s.Events:
+			if !ok {
+				return fmt.Errorf("subscription closed")
+			}
+
+			var n struct {
+				NotificationType string      `json:"notification_type"`
+				Notification     transaction `json:"notification"`
+			}
+			if err := c.decrypt(ev, &n); err != nil {
+				log.Printf("nwc: bad notification %s: %v", ev.ID, err)
+				continue
+			}
+			if n.NotificationType != "payment_received" {
+				continue
+			}
+
+			paid(sub.Payment{
+				Provider:  "nwc",
+				InvoiceID: n.Notification.PaymentHash,
+				WebhookID: n.Notification.PaymentHash,
+				Sats:      int(n.Notification.Amount / 1000),
+			})
+		}
+	}
+}
+
+// call sends a NIP-47 request to the wallet and decodes its result into out.
+func (c *Client) call(ctx context.Context, method string, params, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	relay, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := json.Marshal(map[string]any{"method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	content, err := nip04.Encrypt(string(req), c.sharedSecret)
+	if err != nil {
+		return fmt.Errorf("encrypt: %w", err)
+	}
+	ev := nostr.Event{
+		Kind:      KindRequest,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"p", c.walletPubkey}},
+		Content:   content,
+	}
+	if err := ev.Sign(c.secret); err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+
+	// Subscribe before publishing so the response can't be missed.
+	s, err := relay.Subscribe(ctx, nostr.Filters{{
+		Kinds:   []int{KindResponse},
+		Authors: []string{c.walletPubkey},
+		Tags:    nostr.TagMap{"e": []string{ev.ID}},
+	}})
+	if err != nil {
+		return err
+	}
+	defer s.Unsub()
+
+	if status, err := relay.Publish(ctx, ev); status != nostr.PublishStatusSucceeded {
+		return fmt.Errorf("publish request: %v %v", status, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for wallet: %w", ctx.Err())
+	case resp, ok := <-s.Events:
+		if !ok {
+			return fmt.Errorf("subscription closed")
+		}
+
+		var r struct {
+			ResultType string          `json:"result_type"`
+			Error      *nwcError       `json:"error"`
+			Result     json.RawMessage `json:"result"`
+		}
+		if err := c.decrypt(resp, &r); err != nil {
+			return err
+		}
+		if r.Error != nil {
+			return r.Error
+		}
+
+		return json.Unmarshal(r.Result, out)
+	}
+}
+
+// decrypt checks ev came from the wallet and decodes its content.
+func (c *Client) decrypt(ev *nostr.Event, out any) error {
+	if ev.PubKey != c.walletPubkey {
+		return fmt.Errorf("event from %s, not wallet", ev.PubKey)
+	}
+	if ok, err := ev.CheckSignature(); !ok {
+		return fmt.Errorf("bad signature: %v", err)
+	}
+
+	plain, err := nip04.Decrypt(ev.Content, c.sharedSecret)
+	if err != nil {
+		return fmt.Errorf("decrypt: %w", err)
+	}
+
+	return json.Unmarshal([]byte(plain), out)
+}
+
+// connect returns the relay connection, dialing it if needed.
+func (c *Client) connect(ctx context.Context) (*nostr.Relay, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.relay != nil && c.relay.IsConnected() {
+		return c.relay, nil
+	}
+
+	relay, err := nostr.RelayConnect(ctx, c.relayURL)
+	if err != nil {
+		return nil, fmt.Errorf("connect %s: %w", c.relayURL, err)
+	}
+	c.relay = relay
+
+	return relay, nil
+}
@@ -0,0 +1,309 @@
+package nwc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+	"github.com/stretchr/testify/assert"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+)
+
+// fakeRelay is an in-process relay with a wallet attached. Requests
+// addressed to the wallet are answered by handle.
+type fakeRelay struct {
+	t            *testing.T
+	walletSecret string
+	walletPubkey string
+	handle       func(method string, params map[string]any) (any, *nwcError)
+
+	mu   sync.Mutex
+	subs map[net.Conn]map[string]nostr.Filters
+	// wmu keeps frames from interleaving on a connection.
+	wmu sync.Mutex
+}
+
+func newFakeRelay(t *testing.T, handle func(string, map[string]any) (any, *nwcError)) (*fakeRelay, *httptest.Server) {
+	secret := nostr.GeneratePrivateKey()
+	pubkey, _ := nostr.GetPublicKey(secret)
+	relay := &fakeRelay{
+		t:            t,
+		walletSecret: secret,
+		walletPubkey: pubkey,
+		handle:       handle,
+		subs:         make(map[net.Conn]map[string]nostr.Filters),
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _, err := ws.UpgradeHTTP(r, w)
+		if err != nil {
+			return
+		}
+		relay.serve(conn)
+	}))
+
+	return relay, srv
+}
+
+func (f *fakeRelay) serve(conn net.Conn) {
+	defer func() {
+		f.mu.Lock()
+		delete(f.subs, conn)
+		f.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		msg, err := wsutil.ReadClientText(conn)
+		if err != nil {
+			return
+		}
+
+		switch env := nostr.ParseMessage(msg).(type) {
+		case *nostr.ReqEnvelope:
+			f.mu.Lock()
+			if f.subs[conn] == nil {
+				f.subs[conn] = make(map[string]nostr.Filters)
+			}
+			f.subs[conn][env.SubscriptionID] = env.Filters
+			f.mu.Unlock()
+			eose := nostr.EOSEEnvelope(env.SubscriptionID)
+			f.write(conn, &eose)
+		case *nostr.CloseEnvelope:
+			f.mu.Lock()
+			delete(f.subs[conn], string(*env))
+			f.mu.Unlock()
+		case *nostr.EventEnvelope:
+			f.write(conn, &nostr.OKEnvelope{EventID: env.ID, OK: true})
+			if env.Kind == KindRequest {
+				go f.respond(env.Event)
+			}
+		}
+	}
+}
+
+func (f *fakeRelay) write(conn net.Conn, env nostr.Envelope) {
+	b, err := env.MarshalJSON()
+	assert.NoError(f.t, err)
+	f.wmu.Lock()
+	defer f.wmu.Unlock()
+	wsutil.WriteServerText(conn, b)
+}
+
+// publish delivers ev to every matching subscription.
+func (f *fakeRelay) publish(ev nostr.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for conn, subs := range f.subs {
+		for id, filters := range subs {
+			if filters.Match(&ev) {
+				id := id
+				f.write(conn, &nostr.EventEnvelope{SubscriptionID: &id, Event: ev})
+			}
+		}
+	}
+}
+
+// sign encrypts content to clientPubkey and signs it as the wallet.
+func (f *fakeRelay) sign(kind int, clientPubkey string, content any, tags nostr.Tags) nostr.Event {
+	key, err := nip04.ComputeSharedSecret(clientPubkey, f.walletSecret)
+	assert.NoError(f.t, err)
+	b, _ := json.Marshal(content)
+	enc, err := nip04.Encrypt(string(b), key)
+	assert.NoError(f.t, err)
+
+	ev := nostr.Event{
+		Kind:      kind,
+		CreatedAt: nostr.Now(),
+		Tags:      append(nostr.Tags{{"p", clientPubkey}}, tags...),
+		Content:   enc,
+	}
+	assert.NoError(f.t, ev.Sign(f.walletSecret))
+	return ev
+}
+
+func (f *fakeRelay) respond(req nostr.Event) {
+	key, err := nip04.ComputeSharedSecret(req.PubKey, f.walletSecret)
+	assert.NoError(f.t, err)
+	plain, err := nip04.Decrypt(req.Content, key)
+	assert.NoError(f.t, err)
+
+	var r struct {
+		Method string         `json:"method"`
+		Params map[string]any `json:"params"`
+	}
+	assert.NoError(f.t, json.Unmarshal([]byte(plain), &r))
+
+	result, nwcErr := f.handle(r.Method, r.Params)
+	resp := map[string]any{"result_type": r.Method}
+	if nwcErr != nil {
+		resp["error"] = nwcErr
+	} else {
+		resp["result"] = result
+	}
+	f.publish(f.sign(KindResponse, req.PubKey, resp, nostr.Tags{{"e", req.ID}}))
+}
+
+func (f *fakeRelay) uri(srv *httptest.Server, secret string) string {
+	relay := "ws" + strings.TrimPrefix(srv.URL, "http")
+	return fmt.Sprintf("nostr+walletconnect://%s?relay=%s&secret=%s", f.walletPubkey, relay, secret)
+}
+
+func TestNew(t *testing.T) {
+	secret := nostr.GeneratePrivateKey()
+	wallet, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+
+	tests := []struct {
+		name string
+		uri  string
+		ok   bool
+	}{
+		{"valid", fmt.Sprintf("nostr+walletconnect://%s?relay=wss://relay.example&secret=%s", wallet, secret), true},
+		{"opaque", fmt.Sprintf("nostr+walletconnect:%s?relay=wss://relay.example&secret=%s", wallet, secret), true},
+		{"wrong scheme", fmt.Sprintf("nostr+foo://%s?relay=wss://relay.example&secret=%s", wallet, secret), false},
+		{"missing relay", fmt.Sprintf("nostr+walletconnect://%s?secret=%s", wallet, secret), false},
+		{"missing secret", fmt.Sprintf("nostr+walletconnect://%s?relay=wss://relay.example", wallet), false},
+		{"bad pubkey", fmt.Sprintf("nostr+walletconnect://abc?relay=wss://relay.example&secret=%s", secret), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.uri)
+			if tt.ok {
+				assert.NoError(t, err)
+				assert.Equal(t, wallet, c.walletPubkey)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidURI)
+			}
+		})
+	}
+}
+
+func TestCreateInvoice(t *testing.T) {
+	relay, srv := newFakeRelay(t, func(method string, params map[string]any) (any, *nwcError) {
+		assert.Equal(t, "make_invoice", method)
+		assert.Equal(t, float64(1000000), params["amount"])
+		assert.Equal(t, float64(300), params["expiry"])
+		return transaction{
+			Type:        "incoming",
+			Invoice:     "lnbc10u1test",
+			PaymentHash: "abc123",
+			ExpiresAt:   1700000300,
+		}, nil
+	})
+	defer srv.Close()
+
+	c, err := New(relay.uri(srv, nostr.GeneratePrivateKey()))
+	assert.NoError(t, err)
+
+	invoice, err := c.CreateInvoice(context.Background(), sub.Subscription{Days: 30, Sats: 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, &sub.Invoice{
+		ID:               "abc123",
+		LightningInvoice: "lnbc10u1test",
+		ExpiresAt:        time.Unix(1700000300, 0),
+	}, invoice)
+}
+
+func TestIsInvoicePaid(t *testing.T) {
+	now := time.Now().Unix()
+	invoices := map[string]transaction{
+		"open":    {ExpiresAt: now + 300},
+		"settled": {ExpiresAt: now + 300, SettledAt: now},
+		"expired": {ExpiresAt: now - 300},
+	}
+	relay, srv := newFakeRelay(t, func(method string, params map[string]any) (any, *nwcError) {
+		assert.Equal(t, "lookup_invoice", method)
+		tx, ok := invoices[params["payment_hash"].(string)]
+		if !ok {
+			return nil, &nwcError{Code: "NOT_FOUND", Message: "invoice not found"}
+		}
+		return tx, nil
+	})
+	defer srv.Close()
+
+	tests := []struct {
+		id      string
+		paid    bool
+		err     error
+		wantErr bool
+	}{
+		{id: "open"},
+		{id: "settled", paid: true},
+		{id: "expired", err: sub.ErrInvoiceExpired, wantErr: true},
+		{id: "missing", wantErr: true},
+	}
+
+	c, err := New(relay.uri(srv, nostr.GeneratePrivateKey()))
+	assert.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			paid, err := c.IsInvoicePaid(context.Background(), tt.id)
+			if tt.wantErr {
+				assert.Error(t, err)
+				if tt.err != nil {
+					assert.ErrorIs(t, err, tt.err)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.paid, paid)
+		})
+	}
+}
+
+func TestWatchPayments(t *testing.T) {
+	relay, srv := newFakeRelay(t, nil)
+	defer srv.Close()
+
+	secret := nostr.GeneratePrivateKey()
+	c, err := New(relay.uri(srv, secret))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	payments := make(chan sub.Payment)
+	done := make(chan struct{})
+	go func() {
+		c.WatchPayments(ctx, func(p sub.Payment) { payments <- p })
+		close(done)
+	}()
+
+	// Wait for the notification subscription to reach the relay.
+	assert.Eventually(t, func() bool {
+		relay.mu.Lock()
+		defer relay.mu.Unlock()
+		return len(relay.subs) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	notify := func(notificationType, hash string) {
+		relay.publish(relay.sign(KindNotification, c.pubkey, map[string]any{
+			"notification_type": notificationType,
+			"notification":      transaction{Type: "incoming", PaymentHash: hash, Amount: 1000000},
+		}, nil))
+	}
+	notify("payment_sent", "ignored")
+	notify("payment_received", "abc123")
+
+	select {
+	case p := <-payments:
+		assert.Equal(t, sub.Payment{Provider: "nwc", InvoiceID: "abc123", WebhookID: "abc123", Sats: 1000}, p)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no payment received")
+	}
+
+	cancel()
+	<-done
+}
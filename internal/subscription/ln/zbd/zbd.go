@@ -27,7 +27,7 @@ func (c *Client) CreateInvoice(ctx context.Context, s sub.Subscription) (*sub.In
 	invoice, err := c.Charge(&zebedee.Charge{
 		InternalID:  strconv.Itoa(int(s.ID)),
 		Amount:      strconv.Itoa(s.Sats * 1000), // millisats
-		Description: fmt.Sprintf("Stemstr %d day subscription", s.Days),
+		Description: s.InvoiceMemo(),
 		ExpiresIn:   int64((time.Minute * 5).Seconds()),
 		CallbackURL: c.chargeCallbackURL,
 	})
@@ -38,6 +38,7 @@ func (c *Client) CreateInvoice(ctx context.Context, s sub.Subscription) (*sub.In
 	return &sub.Invoice{
 		ID:               invoice.ID,
 		LightningInvoice: invoice.Invoice.Request,
+		ExpiresAt:        invoice.ExpiresAt,
 	}, nil
 }
 
@@ -47,9 +48,38 @@ func (c *Client) IsInvoicePaid(ctx context.Context, id string) (bool, error) {
 		return false, fmt.Errorf("GetCharge: %w", err)
 	}
 
-	if invoice.Status == "completed" {
+	switch invoice.Status {
+	case "completed":
 		return true, nil
+	case "expired":
+		return false, sub.ErrInvoiceExpired
+	default:
+		return false, nil
+	}
+}
+
+// VerifyPayment re-fetches a charge from ZBD so callback payloads don't
+// have to be trusted. sub.ErrInvoiceUnpaid is returned if the charge isn't
+// completed.
+func (c *Client) VerifyPayment(ctx context.Context, id string) (*sub.Payment, error) {
+	charge, err := c.GetCharge(id)
+	if err != nil {
+		return nil, fmt.Errorf("GetCharge: %w", err)
+	}
+
+	if charge.Status != "completed" {
+		return nil, fmt.Errorf("%w: charge status %q", sub.ErrInvoiceUnpaid, charge.Status)
 	}
 
-	return false, nil
+	msats, err := strconv.Atoi(charge.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("charge amount %q: %w", charge.Amount, err)
+	}
+
+	return &sub.Payment{
+		Provider:  "zbd",
+		InvoiceID: charge.ID,
+		WebhookID: charge.ID,
+		Sats:      msats / 1000,
+	}, nil
 }
@@ -0,0 +1,25 @@
+package subscription
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	reconciledCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "subscription_reconciler_reconciled",
+		Help: "Payments detected by the reconciler rather than a callback",
+	})
+	missedCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "subscription_reconciler_missed",
+		Help: "Invoices that expired without being paid",
+	})
+	reconcileErrorCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "subscription_reconciler_errors",
+		Help: "Errors checking invoice status",
+	})
+	leaderGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "subscription_reconciler_leader",
+		Help: "1 if this replica holds the reconciler lock",
+	})
+)
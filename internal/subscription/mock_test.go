@@ -2,28 +2,136 @@ package subscription
 
 import (
 	"context"
+	"time"
 )
 
 type mockSubscriptionRepo struct {
 	CreateSubscriptionSub     *Subscription
 	CreateSubscriptionErr     error
+	GetSubscriptionSub        *Subscription
+	GetSubscriptionErr        error
+	SearchSubscriptionsSubs   []Subscription
+	SearchSubscriptionsErr    error
 	GetActiveSubscriptionSubs []Subscription
 	GetActiveSubscriptionErr  error
+	GetHistorySubs            []Subscription
+	GetHistoryErr             error
+	GetByInvoiceIDSub         *Subscription
+	GetByInvoiceIDErr         error
+	GetPendingSubs            []Subscription
+	GetPendingErr             error
 	UpdateSubscriptionErr     error
+	GetStatusHistoryChanges   []StatusChange
+	GetStatusHistoryErr       error
+	WebhookProcessedBool      bool
+	WebhookErr                error
+	GetPromoCodeCode          *PromoCode
+	GetPromoCodeErr           error
+	ListPromoCodesCodes       []PromoCode
+	RedeemPromoCodeErr        error
+	GroupMembers              []GroupMember
+	GroupOwners               []string
+	// ActiveSubsByPubkey overrides GetActiveSubscriptionSubs per pubkey
+	ActiveSubsByPubkey map[string][]Subscription
+
+	// Created records the last subscription passed to CreateSubscription
+	Created Subscription
+	// Updated records successful UpdateStatus calls
+	Updated []StatusChange
+	// CreatedPromo records the last code passed to CreatePromoCode
+	CreatedPromo PromoCode
+	// Redeemed and Released record promo code uses as code:pubkey
+	Redeemed []string
+	Released []string
+	// SetMembers records the last SetGroupMembers call
+	SetMembers []string
 }
 
 func (m *mockSubscriptionRepo) CreateSubscription(ctx context.Context, sub Subscription) (*Subscription, error) {
+	m.Created = sub
 	return m.CreateSubscriptionSub, m.CreateSubscriptionErr
 }
+func (m *mockSubscriptionRepo) GetSubscription(ctx context.Context, id int64) (*Subscription, error) {
+	return m.GetSubscriptionSub, m.GetSubscriptionErr
+}
+func (m *mockSubscriptionRepo) SearchSubscriptions(ctx context.Context, filter SearchFilter) ([]Subscription, error) {
+	return m.SearchSubscriptionsSubs, m.SearchSubscriptionsErr
+}
 func (m *mockSubscriptionRepo) GetActiveSubscriptions(ctx context.Context, pubkey string) ([]Subscription, error) {
+	if m.ActiveSubsByPubkey != nil {
+		return m.ActiveSubsByPubkey[pubkey], m.GetActiveSubscriptionErr
+	}
 	return m.GetActiveSubscriptionSubs, m.GetActiveSubscriptionErr
 }
-func (m *mockSubscriptionRepo) UpdateStatus(ctx context.Context, id int64, status SubscriptionStatus) error {
-	return m.UpdateSubscriptionErr
+func (m *mockSubscriptionRepo) GetSubscriptionHistory(ctx context.Context, pubkey string, limit, offset int) ([]Subscription, error) {
+	return m.GetHistorySubs, m.GetHistoryErr
+}
+func (m *mockSubscriptionRepo) GetSubscriptionByInvoiceID(ctx context.Context, invoiceID string) (*Subscription, error) {
+	return m.GetByInvoiceIDSub, m.GetByInvoiceIDErr
 }
-func (m *mockSubscriptionRepo) UpdateStatusByInvoiceID(ctx context.Context, id string, status SubscriptionStatus) error {
+func (m *mockSubscriptionRepo) GetPendingSubscriptions(ctx context.Context) ([]Subscription, error) {
+	return m.GetPendingSubs, m.GetPendingErr
+}
+func (m *mockSubscriptionRepo) UpdateStatus(ctx context.Context, id int64, from, to SubscriptionStatus) error {
+	if m.UpdateSubscriptionErr == nil {
+		m.Updated = append(m.Updated, StatusChange{SubscriptionID: id, FromStatus: from, ToStatus: to})
+	}
 	return m.UpdateSubscriptionErr
 }
+func (m *mockSubscriptionRepo) MarkPaid(ctx context.Context, id int64, from SubscriptionStatus) (time.Time, time.Time, error) {
+	if err := m.UpdateStatus(ctx, id, from, StatusPaid); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return time.Now(), time.Now(), nil
+}
+func (m *mockSubscriptionRepo) GetStatusHistory(ctx context.Context, id int64) ([]StatusChange, error) {
+	return m.GetStatusHistoryChanges, m.GetStatusHistoryErr
+}
+func (m *mockSubscriptionRepo) WebhookProcessed(ctx context.Context, provider, webhookID string) (bool, error) {
+	return m.WebhookProcessedBool, m.WebhookErr
+}
+func (m *mockSubscriptionRepo) RecordWebhook(ctx context.Context, provider, webhookID string) error {
+	return m.WebhookErr
+}
+
+func (m *mockSubscriptionRepo) CreatePromoCode(ctx context.Context, p PromoCode) (*PromoCode, error) {
+	m.CreatedPromo = p
+	return &p, nil
+}
+func (m *mockSubscriptionRepo) GetPromoCode(ctx context.Context, code string) (*PromoCode, error) {
+	return m.GetPromoCodeCode, m.GetPromoCodeErr
+}
+func (m *mockSubscriptionRepo) ListPromoCodes(ctx context.Context) ([]PromoCode, error) {
+	return m.ListPromoCodesCodes, nil
+}
+func (m *mockSubscriptionRepo) RedeemPromoCode(ctx context.Context, code, pubkey string) error {
+	if m.RedeemPromoCodeErr == nil {
+		m.Redeemed = append(m.Redeemed, code+":"+pubkey)
+	}
+	return m.RedeemPromoCodeErr
+}
+func (m *mockSubscriptionRepo) ReleasePromoCode(ctx context.Context, code, pubkey string) error {
+	m.Released = append(m.Released, code+":"+pubkey)
+	return nil
+}
+
+func (m *mockSubscriptionRepo) AddGroupMember(ctx context.Context, owner, member string) error {
+	m.GroupMembers = append(m.GroupMembers, GroupMember{Owner: owner, Pubkey: member})
+	return nil
+}
+func (m *mockSubscriptionRepo) RemoveGroupMember(ctx context.Context, owner, member string) error {
+	return nil
+}
+func (m *mockSubscriptionRepo) GetGroupMembers(ctx context.Context, owner string) ([]GroupMember, error) {
+	return m.GroupMembers, nil
+}
+func (m *mockSubscriptionRepo) SetGroupMembers(ctx context.Context, owner string, members []string) error {
+	m.SetMembers = members
+	return nil
+}
+func (m *mockSubscriptionRepo) GetGroupOwners(ctx context.Context, member string) ([]string, error) {
+	return m.GroupOwners, nil
+}
 
 type mockLNProvider struct {
 	CreateInvoiceInvoice *Invoice
@@ -38,3 +146,38 @@ func (m *mockLNProvider) CreateInvoice(ctx context.Context, sub Subscription) (*
 func (m *mockLNProvider) IsInvoicePaid(ctx context.Context, id string) (bool, error) {
 	return m.IsInvoicePaidBool, m.IsInvoicePaidErr
 }
+
+// mockDescriptionLNProvider is a mockLNProvider that supports description
+// hashes.
+type mockDescriptionLNProvider struct {
+	mockLNProvider
+
+	// Description records the last description invoiced
+	Description string
+}
+
+func (m *mockDescriptionLNProvider) CreateInvoiceForDescription(ctx context.Context, sub Subscription, description string) (*Invoice, error) {
+	m.Description = description
+	return m.CreateInvoiceInvoice, m.CreateInvoiceErr
+}
+
+type mockRateOracle struct {
+	Rate float64
+	Err  error
+}
+
+func (m *mockRateOracle) SatsFor(ctx context.Context, amount float64, currency string) (int, float64, error) {
+	if m.Err != nil {
+		return 0, 0, m.Err
+	}
+	return int(amount / m.Rate * 1e8), m.Rate, nil
+}
+
+type mockGiftNotifier struct {
+	Notified chan Subscription
+}
+
+func (m *mockGiftNotifier) NotifyGift(ctx context.Context, sub Subscription) error {
+	m.Notified <- sub
+	return nil
+}
@@ -0,0 +1,60 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Payment is a provider confirmed payment of an invoice.
+type Payment struct {
+	Provider  string
+	InvoiceID string
+	// WebhookID identifies the notification that reported the payment so
+	// redeliveries can be ignored. Payments without one aren't deduplicated,
+	// the subscription's status alone guards against paying twice.
+	WebhookID string
+	Sats      int
+}
+
+// ConfirmPayment marks the subscription paying p.InvoiceID as paid once
+// the provider has confirmed payment. It reports whether the subscription
+// was newly paid; redelivered webhooks are no-ops. ErrUnderpaid is returned
+// if p doesn't cover the subscription price.
+func (s *SubscriptionService) ConfirmPayment(ctx context.Context, p Payment) (bool, error) {
+	if p.WebhookID != "" {
+		processed, err := s.repo.WebhookProcessed(ctx, p.Provider, p.WebhookID)
+		if err != nil {
+			return false, fmt.Errorf("repo.WebhookProcessed: %w", err)
+		}
+		if processed {
+			return false, nil
+		}
+	}
+
+	sub, err := s.repo.GetSubscriptionByInvoiceID(ctx, p.InvoiceID)
+	if err != nil {
+		return false, err
+	}
+
+	if p.Sats < sub.Sats {
+		return false, fmt.Errorf("%w: got %d sats, want %d", ErrUnderpaid, p.Sats, sub.Sats)
+	}
+
+	wasPaid := sub.Status == StatusPaid
+	if err := s.transition(ctx, sub, StatusPaid); err != nil {
+		if !errors.Is(err, ErrStatusConflict) {
+			return false, err
+		}
+		// A concurrent delivery or the reconciler got there first.
+		wasPaid = true
+	}
+
+	if p.WebhookID != "" {
+		if err := s.repo.RecordWebhook(ctx, p.Provider, p.WebhookID); err != nil {
+			return false, fmt.Errorf("repo.RecordWebhook: %w", err)
+		}
+	}
+
+	return !wasPaid, nil
+}
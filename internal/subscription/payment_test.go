@@ -0,0 +1,90 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmPayment(t *testing.T) {
+	payment := Payment{Provider: "zbd", InvoiceID: "inv", WebhookID: "inv", Sats: 5000}
+
+	var tests = []struct {
+		name      string
+		repo      *mockSubscriptionRepo
+		payment   Payment
+		newlyPaid bool
+		updated   []StatusChange
+		err       error
+	}{
+		{
+			name: "pending subscription paid",
+			repo: &mockSubscriptionRepo{
+				GetByInvoiceIDSub: &Subscription{ID: 1, Sats: 5000, Status: StatusPending},
+			},
+			payment:   payment,
+			newlyPaid: true,
+			updated:   []StatusChange{{SubscriptionID: 1, FromStatus: StatusPending, ToStatus: StatusPaid}},
+		},
+		{
+			name: "already paid",
+			repo: &mockSubscriptionRepo{
+				GetByInvoiceIDSub: &Subscription{ID: 1, Sats: 5000, Status: StatusPaid},
+			},
+			payment: payment,
+		},
+		{
+			name: "replayed webhook",
+			repo: &mockSubscriptionRepo{
+				WebhookProcessedBool: true,
+				GetByInvoiceIDErr:    errors.New("should not be called"),
+			},
+			payment: payment,
+		},
+		{
+			// An empty id once recorded mustn't block later payments.
+			name: "payment without webhook id",
+			repo: &mockSubscriptionRepo{
+				WebhookProcessedBool: true,
+				GetByInvoiceIDSub:    &Subscription{ID: 1, Sats: 5000, Status: StatusPending},
+			},
+			payment:   Payment{Provider: "zbd", InvoiceID: "inv", Sats: 5000},
+			newlyPaid: true,
+			updated:   []StatusChange{{SubscriptionID: 1, FromStatus: StatusPending, ToStatus: StatusPaid}},
+		},
+		{
+			name: "unknown invoice",
+			repo: &mockSubscriptionRepo{
+				GetByInvoiceIDErr: ErrSubscriptionNotFound,
+			},
+			payment: payment,
+			err:     ErrSubscriptionNotFound,
+		},
+		{
+			name: "underpaid",
+			repo: &mockSubscriptionRepo{
+				GetByInvoiceIDSub: &Subscription{ID: 1, Sats: 10000, Status: StatusPending},
+			},
+			payment: payment,
+			err:     ErrUnderpaid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := New(tt.repo, &mockLNProvider{}, "mock")
+			assert.NoError(t, err)
+
+			newlyPaid, err := svc.ConfirmPayment(context.Background(), tt.payment)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.newlyPaid, newlyPaid)
+			assert.Equal(t, tt.updated, tt.repo.Updated)
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ProviderPromo is the provider of subscriptions fully paid for by a promo
+// code.
+const ProviderPromo = "promo"
+
+// PromoCode discounts a subscription, or with FreeDays grants one outright.
+type PromoCode struct {
+	Code string `json:"code" db:"code"`
+	// Exactly one of PercentOff, SatsOff or FreeDays is set.
+	PercentOff int `json:"percent_off,omitempty" db:"percent_off"`
+	SatsOff    int `json:"sats_off,omitempty" db:"sats_off"`
+	FreeDays   int `json:"free_days,omitempty" db:"free_days"`
+	// MaxRedemptions caps how many times the code can be used. Zero is
+	// unlimited.
+	MaxRedemptions int  `json:"max_redemptions" db:"max_redemptions"`
+	Redemptions    int  `json:"redemptions" db:"redemptions"`
+	OncePerPubkey  bool `json:"once_per_pubkey" db:"once_per_pubkey"`
+	// ExpiresAt is when the code stops being accepted, if ever.
+	ExpiresAt *time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Validate checks a new promo code is well formed.
+func (p PromoCode) Validate() error {
+	if p.Code == "" {
+		return fmt.Errorf("%w: code required", ErrInvalidPromoCode)
+	}
+
+	var kinds int
+	for _, v := range []int{p.PercentOff, p.SatsOff, p.FreeDays} {
+		if v < 0 {
+			return fmt.Errorf("%w: negative value", ErrInvalidPromoCode)
+		}
+		if v > 0 {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("%w: set one of percent_off, sats_off or free_days", ErrInvalidPromoCode)
+	}
+	if p.PercentOff > 100 {
+		return fmt.Errorf("%w: percent_off over 100", ErrInvalidPromoCode)
+	}
+	if p.MaxRedemptions < 0 {
+		return fmt.Errorf("%w: negative max_redemptions", ErrInvalidPromoCode)
+	}
+
+	return nil
+}
+
+// ExpiredAt reports whether the code is no longer accepted at t.
+func (p PromoCode) ExpiredAt(t time.Time) bool {
+	return p.ExpiresAt != nil && !p.ExpiresAt.After(t)
+}
+
+// Apply returns sats with the code's discount taken off.
+func (p PromoCode) Apply(sats int) int {
+	switch {
+	case p.FreeDays > 0:
+		return 0
+	case p.PercentOff > 0:
+		sats -= sats * p.PercentOff / 100
+	case p.SatsOff > 0:
+		sats -= p.SatsOff
+	}
+	if sats < 0 {
+		return 0
+	}
+	return sats
+}
+
+// normalizePromoCode makes codes case insensitive.
+func normalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// GiftNotifier tells pubkeys about subscriptions gifted to them.
+type GiftNotifier interface {
+	NotifyGift(ctx context.Context, sub Subscription) error
+}
+
+// SetGiftNotifier enables notifications for paid gift subscriptions.
+func (s *SubscriptionService) SetGiftNotifier(gifts GiftNotifier) {
+	s.gifts = gifts
+}
+
+// notifyGift lets the recipient of a paid gift subscription know about it.
+// It doesn't block the payment being processed.
+func (s *SubscriptionService) notifyGift(sub Subscription) {
+	if s.gifts == nil || sub.GiftedBy == "" {
+		return
+	}
+
+	go func() {
+		if err := s.gifts.NotifyGift(context.Background(), sub); err != nil {
+			log.Printf("error: NotifyGift: sub=%v err=%v", sub.ID, err)
+		}
+	}()
+}
+
+// CreatePromoCode adds a new promo code.
+func (s *SubscriptionService) CreatePromoCode(ctx context.Context, p PromoCode) (*PromoCode, error) {
+	p.Code = normalizePromoCode(p.Code)
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	_, err := s.repo.GetPromoCode(ctx, p.Code)
+	switch {
+	case err == nil:
+		return nil, ErrPromoCodeExists
+	case !errors.Is(err, ErrPromoCodeNotFound):
+		return nil, fmt.Errorf("repo.GetPromoCode: %w", err)
+	}
+
+	p.Redemptions = 0
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now()
+	}
+
+	return s.repo.CreatePromoCode(ctx, p)
+}
+
+// ListPromoCodes lists promo codes, newest first.
+func (s *SubscriptionService) ListPromoCodes(ctx context.Context) ([]PromoCode, error) {
+	return s.repo.ListPromoCodes(ctx)
+}
+
+// CreateSubscriptionWithCode is CreateSubscription with a promo code
+// applied. Codes with free days ignore sub.Days and sub's price, and along
+// with codes discounting the whole price create a paid subscription without
+// an invoice. Codes used on invoices that are never paid can be used again.
+func (s *SubscriptionService) CreateSubscriptionWithCode(ctx context.Context, sub Subscription, code string) (*Subscription, error) {
+	promo, err := s.repo.GetPromoCode(ctx, normalizePromoCode(code))
+	if err != nil {
+		return nil, err
+	}
+	if promo.ExpiredAt(time.Now()) {
+		return nil, ErrPromoCodeExpired
+	}
+	if promo.FreeDays > 0 {
+		sub.Days = promo.FreeDays
+	}
+	if sub.Days <= 0 {
+		return nil, fmt.Errorf("%w: days required for discount codes", ErrInvalidPromoCode)
+	}
+
+	if err := s.repo.RedeemPromoCode(ctx, promo.Code, sub.Pubkey); err != nil {
+		return nil, err
+	}
+	sub.PromoCode = promo.Code
+
+	newSub, err := s.createSubscriptionWithPromo(ctx, sub, *promo)
+	if err != nil {
+		if err := s.repo.ReleasePromoCode(ctx, promo.Code, sub.Pubkey); err != nil {
+			log.Printf("error: ReleasePromoCode: code=%v pubkey=%v err=%v", promo.Code, sub.Pubkey, err)
+		}
+		return nil, err
+	}
+
+	return newSub, nil
+}
+
+func (s *SubscriptionService) createSubscriptionWithPromo(ctx context.Context, sub Subscription, promo PromoCode) (*Subscription, error) {
+	if promo.FreeDays == 0 {
+		// Discounts come off the quoted price
+		if err := s.quote(ctx, &sub); err != nil {
+			return nil, err
+		}
+	}
+
+	sub.Sats = promo.Apply(sub.Sats)
+	if sub.Sats > 0 {
+		return s.createSubscription(ctx, sub, s.ln.CreateInvoice)
+	}
+
+	// Nothing left to pay
+	now := time.Now()
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = now
+	}
+	start, err := s.nextPeriodStart(ctx, sub.Pubkey, sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	sub.StartsAt = start
+	sub.ExpiresAt = start.Add(time.Hour * 24 * time.Duration(sub.Days))
+	sub.Provider = ProviderPromo
+	sub.Status = StatusPaid
+	sub.InvoiceExpiresAt = now
+
+	newSub, err := s.repo.CreateSubscription(ctx, sub)
+	if err != nil {
+		return nil, fmt.Errorf("CreateSub: %w", err)
+	}
+	s.notifyGift(*newSub)
+
+	return newSub, nil
+}
@@ -0,0 +1,197 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromoCodeValidate(t *testing.T) {
+	var tests = []struct {
+		name  string
+		promo PromoCode
+		valid bool
+	}{
+		{"percent", PromoCode{Code: "A", PercentOff: 50}, true},
+		{"sats", PromoCode{Code: "A", SatsOff: 500}, true},
+		{"free days", PromoCode{Code: "A", FreeDays: 7, MaxRedemptions: 100}, true},
+		{"no code", PromoCode{PercentOff: 50}, false},
+		{"no discount", PromoCode{Code: "A"}, false},
+		{"two discounts", PromoCode{Code: "A", PercentOff: 50, SatsOff: 500}, false},
+		{"over 100 percent", PromoCode{Code: "A", PercentOff: 101}, false},
+		{"negative", PromoCode{Code: "A", SatsOff: -1}, false},
+		{"negative max", PromoCode{Code: "A", SatsOff: 1, MaxRedemptions: -1}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.promo.Validate()
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidPromoCode)
+			}
+		})
+	}
+}
+
+func TestPromoCodeApply(t *testing.T) {
+	assert.Equal(t, 750, PromoCode{PercentOff: 25}.Apply(1000))
+	assert.Equal(t, 0, PromoCode{PercentOff: 100}.Apply(1000))
+	assert.Equal(t, 400, PromoCode{SatsOff: 600}.Apply(1000))
+	assert.Equal(t, 0, PromoCode{SatsOff: 2000}.Apply(1000))
+	assert.Equal(t, 0, PromoCode{FreeDays: 7}.Apply(1000))
+}
+
+func TestCreatePromoCode(t *testing.T) {
+	ctx := context.Background()
+
+	repo := &mockSubscriptionRepo{GetPromoCodeErr: ErrPromoCodeNotFound}
+	svc, err := New(repo, &mockLNProvider{}, "mock")
+	assert.NoError(t, err)
+	_, err = svc.CreatePromoCode(ctx, PromoCode{Code: " nostrica ", FreeDays: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, "NOSTRICA", repo.CreatedPromo.Code)
+
+	repo = &mockSubscriptionRepo{GetPromoCodeCode: &PromoCode{Code: "NOSTRICA"}}
+	svc, err = New(repo, &mockLNProvider{}, "mock")
+	assert.NoError(t, err)
+	_, err = svc.CreatePromoCode(ctx, PromoCode{Code: "nostrica", FreeDays: 7})
+	assert.ErrorIs(t, err, ErrPromoCodeExists)
+}
+
+func TestCreateSubscriptionWithCode(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		invoice = &Invoice{ID: "inv", LightningInvoice: "lnbc"}
+		past    = time.Now().Add(-time.Hour)
+	)
+
+	var tests = []struct {
+		name      string
+		promo     *PromoCode
+		promoErr  error
+		redeemErr error
+		invoiced  bool
+		days      int
+		sats      int
+		err       error
+	}{
+		{
+			name:     "percent off",
+			promo:    &PromoCode{Code: "HALF", PercentOff: 50},
+			invoiced: true,
+			days:     30,
+			sats:     500,
+		},
+		{
+			name:  "whole price off",
+			promo: &PromoCode{Code: "FREE", SatsOff: 1000},
+			days:  30,
+		},
+		{
+			name:  "free days",
+			promo: &PromoCode{Code: "TRIAL", FreeDays: 7},
+			days:  7,
+		},
+		{
+			name:     "not found",
+			promoErr: ErrPromoCodeNotFound,
+			err:      ErrPromoCodeNotFound,
+		},
+		{
+			name:  "expired",
+			promo: &PromoCode{Code: "OLD", PercentOff: 50, ExpiresAt: &past},
+			err:   ErrPromoCodeExpired,
+		},
+		{
+			name:      "exhausted",
+			promo:     &PromoCode{Code: "HALF", PercentOff: 50, MaxRedemptions: 1},
+			redeemErr: ErrPromoCodeExhausted,
+			err:       ErrPromoCodeExhausted,
+		},
+		{
+			name:      "already redeemed",
+			promo:     &PromoCode{Code: "HALF", PercentOff: 50, OncePerPubkey: true},
+			redeemErr: ErrPromoCodeRedeemed,
+			err:       ErrPromoCodeRedeemed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockSubscriptionRepo{
+				CreateSubscriptionSub: &Subscription{ID: 1},
+				GetPromoCodeCode:      tt.promo,
+				GetPromoCodeErr:       tt.promoErr,
+				RedeemPromoCodeErr:    tt.redeemErr,
+			}
+			svc, err := New(repo, &mockLNProvider{CreateInvoiceInvoice: invoice}, "mock")
+			assert.NoError(t, err)
+
+			_, err = svc.CreateSubscriptionWithCode(ctx, Subscription{Pubkey: "xxx", Days: 30, Sats: 1000}, "code")
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Empty(t, repo.Redeemed)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []string{tt.promo.Code + ":xxx"}, repo.Redeemed)
+			assert.Equal(t, tt.promo.Code, repo.Created.PromoCode)
+			assert.Equal(t, tt.days, repo.Created.Days)
+			assert.Equal(t, tt.sats, repo.Created.Sats)
+			if tt.invoiced {
+				assert.Equal(t, StatusPending, repo.Created.Status)
+				assert.Equal(t, "inv", repo.Created.InvoiceID)
+			} else {
+				assert.Equal(t, StatusPaid, repo.Created.Status)
+				assert.Equal(t, ProviderPromo, repo.Created.Provider)
+			}
+		})
+	}
+}
+
+func TestCreateSubscriptionWithCodeReleased(t *testing.T) {
+	ctx := context.Background()
+
+	// Released if the invoice can't be created
+	repo := &mockSubscriptionRepo{GetPromoCodeCode: &PromoCode{Code: "HALF", PercentOff: 50}}
+	svc, err := New(repo, &mockLNProvider{CreateInvoiceErr: errors.New("ln down")}, "mock")
+	assert.NoError(t, err)
+	_, err = svc.CreateSubscriptionWithCode(ctx, Subscription{Pubkey: "xxx", Days: 30, Sats: 1000}, "half")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"HALF:xxx"}, repo.Released)
+
+	// Released if the invoice expires unpaid
+	repo = &mockSubscriptionRepo{}
+	svc, err = New(repo, &mockLNProvider{}, "mock")
+	assert.NoError(t, err)
+	sub := &Subscription{ID: 1, Pubkey: "xxx", Status: StatusPending, PromoCode: "HALF"}
+	assert.NoError(t, svc.transition(ctx, sub, StatusInvoiceExpired))
+	assert.Equal(t, []string{"HALF:xxx"}, repo.Released)
+}
+
+func TestGiftNotification(t *testing.T) {
+	ctx := context.Background()
+	gifts := &mockGiftNotifier{Notified: make(chan Subscription, 1)}
+
+	svc, err := New(&mockSubscriptionRepo{}, &mockLNProvider{}, "mock")
+	assert.NoError(t, err)
+	svc.SetGiftNotifier(gifts)
+
+	// Not a gift
+	assert.NoError(t, svc.transition(ctx, &Subscription{ID: 1, Pubkey: "xxx", Status: StatusPending}, StatusPaid))
+
+	// Gift
+	assert.NoError(t, svc.transition(ctx, &Subscription{ID: 2, Pubkey: "xxx", GiftedBy: "yyy", Status: StatusPending}, StatusPaid))
+
+	select {
+	case sub := <-gifts.Notified:
+		assert.Equal(t, int64(2), sub.ID)
+	case <-time.After(time.Second):
+		t.Fatal("gift not notified")
+	}
+}
@@ -0,0 +1,181 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// LeaderLock elects a single replica to run background work.
+type LeaderLock interface {
+	// TryAcquire attempts to take the lock without blocking and reports
+	// whether it is held. Calling it while holding the lock confirms the
+	// lock is still held.
+	TryAcquire(ctx context.Context) (bool, error)
+	Release(ctx context.Context) error
+}
+
+type ReconcilerOpts struct {
+	// Interval between reconcile passes.
+	Interval time.Duration
+	// MaxBackoff caps the delay between checks of a single invoice.
+	MaxBackoff time.Duration
+}
+
+// NewReconciler returns a Reconciler that polls pending invoices of svc
+// while holding lock.
+func NewReconciler(svc *SubscriptionService, lock LeaderLock, opts ReconcilerOpts) *Reconciler {
+	return &Reconciler{
+		svc:     svc,
+		lock:    lock,
+		opts:    opts,
+		backoff: map[int64]backoff{},
+	}
+}
+
+// Reconciler catches payments whose callback never arrived by polling the
+// LNProvider for pending subscriptions, and expires dead invoices.
+type Reconciler struct {
+	svc     *SubscriptionService
+	lock    LeaderLock
+	opts    ReconcilerOpts
+	backoff map[int64]backoff
+	leader  bool
+}
+
+type backoff struct {
+	attempts int
+	next     time.Time
+}
+
+// Run reconciles every Interval until ctx is done.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+
+	defer func() {
+		if r.leader {
+			r.lock.Release(context.Background())
+			leaderGauge.Set(0)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			held, err := r.lock.TryAcquire(ctx)
+			if err != nil {
+				log.Printf("error: reconciler lock: %v", err)
+				held = false
+			}
+			if held != r.leader {
+				log.Printf("reconciler: leader=%v", held)
+				r.leader = held
+				if held {
+					leaderGauge.Set(1)
+				} else {
+					leaderGauge.Set(0)
+					// Another replica may have polled in the meantime.
+					r.backoff = map[int64]backoff{}
+				}
+			}
+			if !held {
+				continue
+			}
+
+			r.reconcile(ctx, time.Now())
+		}
+	}
+}
+
+// reconcile expires dead invoices, then checks each pending subscription
+// that is due, moving it to paid or invoice_expired as the LNProvider
+// reports.
+func (r *Reconciler) reconcile(ctx context.Context, now time.Time) {
+	expired, err := r.svc.ExpireStaleInvoices(ctx)
+	missedCounter.Add(float64(expired))
+	if err != nil {
+		log.Printf("error: reconciler: ExpireStaleInvoices: %v", err)
+	}
+
+	subs, err := r.svc.repo.GetPendingSubscriptions(ctx)
+	if err != nil {
+		log.Printf("error: reconciler: GetPendingSubscriptions: %v", err)
+		return
+	}
+
+	pending := map[int64]bool{}
+	for i := range subs {
+		sub := &subs[i]
+		pending[sub.ID] = true
+
+		if !sub.InvoiceExpiresAt.After(now) {
+			// Expired since ExpireStaleInvoices ran; next pass gets it.
+			continue
+		}
+
+		b := r.backoff[sub.ID]
+		if now.Before(b.next) {
+			continue
+		}
+
+		paid, err := r.svc.ln.IsInvoicePaid(ctx, sub.InvoiceID)
+		switch {
+		case errors.Is(err, ErrInvoiceExpired):
+			r.transition(ctx, sub, StatusInvoiceExpired)
+		case err != nil:
+			reconcileErrorCounter.Inc()
+			log.Printf("error: reconciler: IsInvoicePaid: sub=%v err=%v", sub.ID, err)
+			r.backoff[sub.ID] = r.nextBackoff(b, now)
+		case paid:
+			r.transition(ctx, sub, StatusPaid)
+		default:
+			r.backoff[sub.ID] = r.nextBackoff(b, now)
+		}
+	}
+
+	// Forget subscriptions that are no longer pending.
+	for id := range r.backoff {
+		if !pending[id] {
+			delete(r.backoff, id)
+		}
+	}
+}
+
+func (r *Reconciler) transition(ctx context.Context, sub *Subscription, to SubscriptionStatus) {
+	if err := r.svc.transition(ctx, sub, to); err != nil {
+		if errors.Is(err, ErrStatusConflict) {
+			// Someone else moved it first, e.g. a payment webhook.
+			return
+		}
+		reconcileErrorCounter.Inc()
+		log.Printf("error: reconciler: transition: sub=%v to=%v err=%v", sub.ID, to, err)
+		return
+	}
+
+	switch to {
+	case StatusPaid:
+		reconciledCounter.Inc()
+		log.Printf("reconciler: sub=%v paid without callback", sub.ID)
+	case StatusInvoiceExpired:
+		missedCounter.Inc()
+	}
+	delete(r.backoff, sub.ID)
+}
+
+// nextBackoff doubles the delay before an invoice is checked again, up
+// to MaxBackoff.
+func (r *Reconciler) nextBackoff(b backoff, now time.Time) backoff {
+	delay := r.opts.Interval << b.attempts
+	if delay <= 0 || delay > r.opts.MaxBackoff {
+		delay = r.opts.MaxBackoff
+	}
+
+	return backoff{
+		attempts: b.attempts + 1,
+		next:     now.Add(delay),
+	}
+}
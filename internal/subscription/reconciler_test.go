@@ -0,0 +1,106 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingLNProvider struct {
+	mockLNProvider
+	calls int
+}
+
+func (m *countingLNProvider) IsInvoicePaid(ctx context.Context, id string) (bool, error) {
+	m.calls++
+	return m.mockLNProvider.IsInvoicePaid(ctx, id)
+}
+
+func TestReconcile(t *testing.T) {
+	now := time.Now()
+
+	var tests = []struct {
+		name    string
+		pending []Subscription
+		ln      *countingLNProvider
+		updated []StatusChange
+	}{
+		{
+			name: "paid invoice",
+			pending: []Subscription{
+				{ID: 1, Status: StatusPending, InvoiceExpiresAt: now.Add(time.Minute)},
+			},
+			ln:      &countingLNProvider{mockLNProvider: mockLNProvider{IsInvoicePaidBool: true}},
+			updated: []StatusChange{{SubscriptionID: 1, FromStatus: StatusPending, ToStatus: StatusPaid}},
+		},
+		{
+			name: "unpaid invoice",
+			pending: []Subscription{
+				{ID: 1, Status: StatusPending, InvoiceExpiresAt: now.Add(time.Minute)},
+			},
+			ln: &countingLNProvider{},
+		},
+		{
+			name: "provider reports expired",
+			pending: []Subscription{
+				{ID: 1, Status: StatusPending, InvoiceExpiresAt: now.Add(time.Minute)},
+			},
+			ln:      &countingLNProvider{mockLNProvider: mockLNProvider{IsInvoicePaidErr: ErrInvoiceExpired}},
+			updated: []StatusChange{{SubscriptionID: 1, FromStatus: StatusPending, ToStatus: StatusInvoiceExpired}},
+		},
+		{
+			name: "stale invoice expired without polling",
+			pending: []Subscription{
+				{ID: 1, Status: StatusPending, InvoiceExpiresAt: now.Add(-time.Minute)},
+			},
+			ln:      &countingLNProvider{mockLNProvider: mockLNProvider{IsInvoicePaidErr: errors.New("should not be called")}},
+			updated: []StatusChange{{SubscriptionID: 1, FromStatus: StatusPending, ToStatus: StatusInvoiceExpired}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockSubscriptionRepo{GetPendingSubs: tt.pending}
+			svc, err := New(repo, tt.ln, "mock")
+			assert.NoError(t, err)
+
+			r := NewReconciler(svc, nil, ReconcilerOpts{Interval: time.Second, MaxBackoff: time.Minute})
+			r.reconcile(context.Background(), now)
+			assert.Equal(t, tt.updated, repo.Updated)
+		})
+	}
+}
+
+func TestReconcileBackoff(t *testing.T) {
+	now := time.Now()
+	repo := &mockSubscriptionRepo{
+		GetPendingSubs: []Subscription{
+			{ID: 1, Status: StatusPending, InvoiceExpiresAt: now.Add(time.Hour)},
+		},
+	}
+	ln := &countingLNProvider{}
+	svc, err := New(repo, ln, "mock")
+	assert.NoError(t, err)
+
+	r := NewReconciler(svc, nil, ReconcilerOpts{Interval: time.Second, MaxBackoff: 4 * time.Second})
+	ctx := context.Background()
+
+	// Checks at 0s, then backs off 1s, 2s, 4s, 4s
+	var checkedAt []int
+	for sec := 0; sec <= 12; sec++ {
+		before := ln.calls
+		r.reconcile(ctx, now.Add(time.Duration(sec)*time.Second))
+		if ln.calls > before {
+			checkedAt = append(checkedAt, sec)
+		}
+	}
+	assert.Equal(t, []int{0, 1, 3, 7, 11}, checkedAt)
+
+	// Forgotten once no longer pending
+	repo.GetPendingSubs = nil
+	r.reconcile(ctx, now)
+	assert.Empty(t, r.backoff)
+}
@@ -0,0 +1,32 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/stemstr/storage/internal/audit"
+)
+
+func (r *Repo) CreateAuditEntry(ctx context.Context, e audit.Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastAuditID++
+	e.ID = r.lastAuditID
+	e.CreatedAt = time.Now()
+	r.audit = append(r.audit, e)
+
+	return nil
+}
+
+func (r *Repo) ListAuditEntries(ctx context.Context, limit, offset int) ([]audit.Entry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := make([]audit.Entry, 0, len(r.audit))
+	for i := len(r.audit) - 1; i >= 0; i-- {
+		entries = append(entries, r.audit[i])
+	}
+
+	return page(entries, limit, offset), nil
+}
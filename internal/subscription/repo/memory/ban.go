@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/stemstr/storage/internal/moderation"
+)
+
+func (r *Repo) CreateBan(ctx context.Context, b moderation.Ban) (*moderation.Ban, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.bans[b.Pubkey]; ok {
+		b.CreatedAt = existing.CreatedAt
+	} else {
+		b.CreatedAt = time.Now()
+	}
+	r.bans[b.Pubkey] = &b
+
+	ban := b
+	return &ban, nil
+}
+
+func (r *Repo) GetBan(ctx context.Context, pubkey string) (*moderation.Ban, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.bans[pubkey]
+	if !ok {
+		return nil, moderation.ErrBanNotFound
+	}
+
+	ban := *b
+	return &ban, nil
+}
+
+func (r *Repo) DeleteBan(ctx context.Context, pubkey string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.bans[pubkey]; !ok {
+		return moderation.ErrBanNotFound
+	}
+	delete(r.bans, pubkey)
+
+	return nil
+}
+
+func (r *Repo) ListBans(ctx context.Context) ([]moderation.Ban, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var bans []moderation.Ban
+	for _, b := range r.bans {
+		bans = append(bans, *b)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].CreatedAt.After(bans[j].CreatedAt)
+	})
+
+	return bans, nil
+}
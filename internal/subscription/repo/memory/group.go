@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+)
+
+func (r *Repo) AddGroupMember(ctx context.Context, owner, member string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.addGroupMember(owner, member)
+
+	return nil
+}
+
+func (r *Repo) RemoveGroupMember(ctx context.Context, owner, member string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, m := range r.members {
+		if m.Owner == owner && m.Pubkey == member {
+			r.members = append(r.members[:i], r.members[i+1:]...)
+			return nil
+		}
+	}
+
+	return sub.ErrGroupMemberNotFound
+}
+
+func (r *Repo) GetGroupMembers(ctx context.Context, owner string) ([]sub.GroupMember, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var members []sub.GroupMember
+	for _, m := range r.members {
+		if m.Owner == owner {
+			members = append(members, m)
+		}
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		if !members[i].CreatedAt.Equal(members[j].CreatedAt) {
+			return members[i].CreatedAt.Before(members[j].CreatedAt)
+		}
+		return members[i].Pubkey < members[j].Pubkey
+	})
+
+	return members, nil
+}
+
+func (r *Repo) SetGroupMembers(ctx context.Context, owner string, members []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.members[:0]
+	for _, m := range r.members {
+		if m.Owner != owner {
+			kept = append(kept, m)
+		}
+	}
+	r.members = kept
+
+	for _, member := range members {
+		r.addGroupMember(owner, member)
+	}
+
+	return nil
+}
+
+func (r *Repo) GetGroupOwners(ctx context.Context, member string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var owners []string
+	for _, m := range r.members {
+		if m.Pubkey == member {
+			owners = append(owners, m.Owner)
+		}
+	}
+
+	return owners, nil
+}
+
+// addGroupMember appends member to owner's group, in the order members were
+// added, unless it's already there.
+func (r *Repo) addGroupMember(owner, member string) {
+	for _, m := range r.members {
+		if m.Owner == owner && m.Pubkey == member {
+			return
+		}
+	}
+
+	r.members = append(r.members, sub.GroupMember{
+		Owner:     owner,
+		Pubkey:    member,
+		CreatedAt: time.Now(),
+	})
+}
@@ -0,0 +1,303 @@
+// Package memory keeps everything the API stores in memory. It's for tests
+// and behaves like pg and sqlite, which the repo conformance tests check.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stemstr/storage/internal/audit"
+	"github.com/stemstr/storage/internal/moderation"
+	"github.com/stemstr/storage/internal/service"
+	sub "github.com/stemstr/storage/internal/subscription"
+	"github.com/stemstr/storage/internal/subscription/repo/migrate"
+	"github.com/stemstr/storage/internal/upload"
+	"github.com/stemstr/storage/internal/zap"
+)
+
+func New() *Repo {
+	return &Repo{
+		subs:       map[int64]*sub.Subscription{},
+		webhooks:   map[webhookKey]bool{},
+		promoCodes: map[string]*sub.PromoCode{},
+		bans:       map[string]*moderation.Ban{},
+		samples:    map[string]*service.Sample{},
+		owners:     map[string][]string{},
+		zaps:       map[string]*zap.Zap{},
+		uploads:    map[string]*upload.Upload{},
+	}
+}
+
+// Repo is safe for concurrent use. A single mutex guards everything, which
+// also makes every method atomic like a database transaction.
+type Repo struct {
+	mu sync.Mutex
+
+	lastSubID   int64
+	subs        map[int64]*sub.Subscription
+	history     []sub.StatusChange
+	webhooks    map[webhookKey]bool
+	promoCodes  map[string]*sub.PromoCode
+	redemptions []redemption
+	members     []sub.GroupMember
+	bans        map[string]*moderation.Ban
+	lastAuditID int64
+	audit       []audit.Entry
+	samples     map[string]*service.Sample
+	owners      map[string][]string
+	zaps        map[string]*zap.Zap
+	uploads     map[string]*upload.Upload
+}
+
+func (r *Repo) CreateSubscription(ctx context.Context, s sub.Subscription) (*sub.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastSubID++
+	s.ID = r.lastSubID
+	now := time.Now()
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = now
+	}
+	if s.StartsAt.IsZero() {
+		s.StartsAt = now
+	}
+	s.UpdatedAt = nil
+	s.Memo = ""
+	r.subs[s.ID] = &s
+
+	return copySub(s), nil
+}
+
+func (r *Repo) GetSubscription(ctx context.Context, id int64) (*sub.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.subs[id]
+	if !ok {
+		return nil, sub.ErrSubscriptionNotFound
+	}
+
+	return copySub(*s), nil
+}
+
+func (r *Repo) GetSubscriptionByInvoiceID(ctx context.Context, invoiceID string) (*sub.Subscription, error) {
+	if invoiceID == "" {
+		return nil, sub.ErrSubscriptionNotFound
+	}
+
+	subs := r.filterSubs(func(s *sub.Subscription) bool {
+		return s.InvoiceID == invoiceID
+	})
+
+	switch {
+	case len(subs) == 0:
+		return nil, sub.ErrSubscriptionNotFound
+	case len(subs) == 1:
+		return &subs[0], nil
+	default:
+		return nil, fmt.Errorf("expected one invoice, found multiple")
+	}
+}
+
+func (r *Repo) GetActiveSubscriptions(ctx context.Context, pubkey string) ([]sub.Subscription, error) {
+	// Keep current periods and those queued to start later. Callers use
+	// Subscription.ActiveAt to tell them apart.
+	now := time.Now()
+	subs := r.filterSubs(func(s *sub.Subscription) bool {
+		return s.Pubkey == pubkey && s.ExpiresAt.After(now) &&
+			(s.Status == sub.StatusPaid || s.Status == sub.StatusPending)
+	})
+	sort.SliceStable(subs, func(i, j int) bool {
+		if !subs[i].StartsAt.Equal(subs[j].StartsAt) {
+			return subs[i].StartsAt.Before(subs[j].StartsAt)
+		}
+		return subs[i].CreatedAt.After(subs[j].CreatedAt)
+	})
+
+	return subs, nil
+}
+
+func (r *Repo) GetSubscriptionHistory(ctx context.Context, pubkey string, limit, offset int) ([]sub.Subscription, error) {
+	subs := r.filterSubs(func(s *sub.Subscription) bool {
+		return s.Pubkey == pubkey
+	})
+	sortNewestFirst(subs)
+
+	return page(subs, limit, offset), nil
+}
+
+func (r *Repo) GetPendingSubscriptions(ctx context.Context) ([]sub.Subscription, error) {
+	subs := r.filterSubs(func(s *sub.Subscription) bool {
+		return s.Status == sub.StatusPending
+	})
+	sort.SliceStable(subs, func(i, j int) bool {
+		return subs[i].InvoiceExpiresAt.Before(subs[j].InvoiceExpiresAt)
+	})
+
+	return subs, nil
+}
+
+func (r *Repo) SearchSubscriptions(ctx context.Context, filter sub.SearchFilter) ([]sub.Subscription, error) {
+	subs := r.filterSubs(func(s *sub.Subscription) bool {
+		return (filter.Pubkey == "" || s.Pubkey == filter.Pubkey) &&
+			(filter.Status == "" || s.Status == filter.Status) &&
+			(filter.Provider == "" || s.Provider == filter.Provider)
+	})
+	sortNewestFirst(subs)
+
+	return page(subs, filter.Limit, filter.Offset), nil
+}
+
+func (r *Repo) UpdateStatus(ctx context.Context, id int64, from, to sub.SubscriptionStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.subs[id]
+	if !ok || s.Status != from {
+		return sub.ErrStatusConflict
+	}
+	now := time.Now()
+	s.Status = to
+	s.UpdatedAt = &now
+
+	r.history = append(r.history, sub.StatusChange{
+		ID:             int64(len(r.history) + 1),
+		SubscriptionID: id,
+		FromStatus:     from,
+		ToStatus:       to,
+		CreatedAt:      now,
+	})
+
+	return nil
+}
+
+func (r *Repo) MarkPaid(ctx context.Context, id int64, from sub.SubscriptionStatus) (time.Time, time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.subs[id]
+	if !ok || s.Status != from {
+		return time.Time{}, time.Time{}, sub.ErrStatusConflict
+	}
+
+	// The period follows pubkey's last paid one
+	now := time.Now()
+	start := now
+	for _, other := range r.subs {
+		if other.Pubkey == s.Pubkey && other.Status == sub.StatusPaid && other.ExpiresAt.After(start) {
+			start = other.ExpiresAt
+		}
+	}
+	s.Status = sub.StatusPaid
+	s.StartsAt = start
+	s.ExpiresAt = start.Add(time.Hour * 24 * time.Duration(s.Days))
+	s.UpdatedAt = &now
+
+	r.history = append(r.history, sub.StatusChange{
+		ID:             int64(len(r.history) + 1),
+		SubscriptionID: id,
+		FromStatus:     from,
+		ToStatus:       sub.StatusPaid,
+		CreatedAt:      now,
+	})
+
+	return s.StartsAt, s.ExpiresAt, nil
+}
+
+func (r *Repo) GetStatusHistory(ctx context.Context, id int64) ([]sub.StatusChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var changes []sub.StatusChange
+	for _, change := range r.history {
+		if change.SubscriptionID == id {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+// LeaderLock returns a lock that is always held, as nothing else shares
+// the repo.
+func (r *Repo) LeaderLock(key int64) sub.LeaderLock {
+	return leaderLock{}
+}
+
+type leaderLock struct{}
+
+func (leaderLock) TryAcquire(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (leaderLock) Release(ctx context.Context) error {
+	return nil
+}
+
+// MigrateUp is a no-op; there's no schema to migrate.
+func (r *Repo) MigrateUp(ctx context.Context) ([]migrate.Migration, error) {
+	return nil, nil
+}
+
+func (r *Repo) MigrateDown(ctx context.Context) (*migrate.Migration, error) {
+	return nil, migrate.ErrNoMigrations
+}
+
+func (r *Repo) MigrationStatus(ctx context.Context) ([]migrate.Status, error) {
+	return nil, nil
+}
+
+func (r *Repo) Close() error {
+	return nil
+}
+
+// filterSubs copies the subscriptions matching keep, in id order.
+func (r *Repo) filterSubs(keep func(s *sub.Subscription) bool) []sub.Subscription {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var subs []sub.Subscription
+	for _, s := range r.subs {
+		if keep(s) {
+			subs = append(subs, *copySub(*s))
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].ID < subs[j].ID
+	})
+
+	return subs
+}
+
+func sortNewestFirst(subs []sub.Subscription) {
+	sort.Slice(subs, func(i, j int) bool {
+		if !subs[i].CreatedAt.Equal(subs[j].CreatedAt) {
+			return subs[i].CreatedAt.After(subs[j].CreatedAt)
+		}
+		return subs[i].ID > subs[j].ID
+	})
+}
+
+func copySub(s sub.Subscription) *sub.Subscription {
+	if s.UpdatedAt != nil {
+		updatedAt := *s.UpdatedAt
+		s.UpdatedAt = &updatedAt
+	}
+	return &s
+}
+
+// page applies LIMIT and OFFSET to items.
+func page[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
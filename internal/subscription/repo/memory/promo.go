@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+)
+
+type redemption struct {
+	code   string
+	pubkey string
+}
+
+func (r *Repo) CreatePromoCode(ctx context.Context, p sub.PromoCode) (*sub.PromoCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.promoCodes[p.Code]; ok {
+		return nil, fmt.Errorf("promo code %q exists", p.Code)
+	}
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now()
+	}
+	p.Redemptions = 0
+	r.promoCodes[p.Code] = &p
+
+	return copyPromoCode(p), nil
+}
+
+func (r *Repo) GetPromoCode(ctx context.Context, code string) (*sub.PromoCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.promoCodes[code]
+	if !ok {
+		return nil, sub.ErrPromoCodeNotFound
+	}
+
+	return copyPromoCode(*p), nil
+}
+
+func (r *Repo) ListPromoCodes(ctx context.Context) ([]sub.PromoCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var codes []sub.PromoCode
+	for _, p := range r.promoCodes {
+		codes = append(codes, *copyPromoCode(*p))
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].CreatedAt.After(codes[j].CreatedAt)
+	})
+
+	return codes, nil
+}
+
+func (r *Repo) RedeemPromoCode(ctx context.Context, code, pubkey string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.promoCodes[code]
+	if !ok {
+		return sub.ErrPromoCodeNotFound
+	}
+	if p.MaxRedemptions > 0 && p.Redemptions >= p.MaxRedemptions {
+		return sub.ErrPromoCodeExhausted
+	}
+	if p.OncePerPubkey {
+		for _, red := range r.redemptions {
+			if red.code == code && red.pubkey == pubkey {
+				return sub.ErrPromoCodeRedeemed
+			}
+		}
+	}
+
+	p.Redemptions++
+	r.redemptions = append(r.redemptions, redemption{code: code, pubkey: pubkey})
+
+	return nil
+}
+
+func (r *Repo) ReleasePromoCode(ctx context.Context, code, pubkey string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := len(r.redemptions) - 1; i >= 0; i-- {
+		red := r.redemptions[i]
+		if red.code != code || red.pubkey != pubkey {
+			continue
+		}
+		r.redemptions = append(r.redemptions[:i], r.redemptions[i+1:]...)
+		if p, ok := r.promoCodes[code]; ok && p.Redemptions > 0 {
+			p.Redemptions--
+		}
+		return nil
+	}
+
+	return nil
+}
+
+func copyPromoCode(p sub.PromoCode) *sub.PromoCode {
+	if p.ExpiresAt != nil {
+		expiresAt := *p.ExpiresAt
+		p.ExpiresAt = &expiresAt
+	}
+	return &p
+}
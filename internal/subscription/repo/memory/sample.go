@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/stemstr/storage/internal/service"
+)
+
+func (r *Repo) CreateSample(ctx context.Context, s service.Sample) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The first uploader of a given file is its sample's pubkey, but everyone
+	// who uploads it owns it.
+	if _, ok := r.samples[s.Sum]; !ok {
+		s.CreatedAt = time.Now()
+		r.samples[s.Sum] = &s
+	}
+	for _, owner := range r.owners[s.Sum] {
+		if owner == s.Pubkey {
+			return nil
+		}
+	}
+	r.owners[s.Sum] = append(r.owners[s.Sum], s.Pubkey)
+
+	return nil
+}
+
+func (r *Repo) GetSample(ctx context.Context, sum string) (*service.Sample, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.samples[sum]
+	if !ok {
+		return nil, service.ErrNotFound
+	}
+
+	sample := *s
+	return &sample, nil
+}
+
+func (r *Repo) GetSampleOwners(ctx context.Context, sum string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.owners[sum]...), nil
+}
+
+func (r *Repo) DeleteSample(ctx context.Context, sum string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.samples, sum)
+	delete(r.owners, sum)
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/stemstr/storage/internal/upload"
+)
+
+func (r *Repo) CreateUpload(ctx context.Context, u upload.Upload) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.uploads[u.InvoiceID]; ok {
+		return fmt.Errorf("upload %q exists", u.InvoiceID)
+	}
+	u.DownloadHash = ""
+	u.Waveform = json.RawMessage("null")
+	u.UpdatedAt = nil
+	r.uploads[u.InvoiceID] = &u
+
+	return nil
+}
+
+func (r *Repo) GetUpload(ctx context.Context, invoiceID string) (*upload.Upload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.uploads[invoiceID]
+	if !ok {
+		return nil, upload.ErrUploadNotFound
+	}
+
+	return copyUpload(*u), nil
+}
+
+func (r *Repo) GetPendingUploads(ctx context.Context) ([]upload.Upload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var uploads []upload.Upload
+	for _, u := range r.uploads {
+		if u.Status == upload.StatusPending {
+			uploads = append(uploads, *copyUpload(*u))
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		return uploads[i].InvoiceExpiresAt.Before(uploads[j].InvoiceExpiresAt)
+	})
+
+	return uploads, nil
+}
+
+func (r *Repo) GetProcessingUploads(ctx context.Context, updatedBefore time.Time) ([]upload.Upload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var uploads []upload.Upload
+	for _, u := range r.uploads {
+		if u.Status == upload.StatusProcessing && u.UpdatedAt != nil && u.UpdatedAt.Before(updatedBefore) {
+			uploads = append(uploads, *copyUpload(*u))
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		return uploads[i].UpdatedAt.Before(*uploads[j].UpdatedAt)
+	})
+
+	return uploads, nil
+}
+
+func (r *Repo) UpdateUploadStatus(ctx context.Context, invoiceID string, from, to upload.Status) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.uploads[invoiceID]
+	if !ok || u.Status != from {
+		return upload.ErrStatusConflict
+	}
+	now := time.Now()
+	u.Status = to
+	u.UpdatedAt = &now
+
+	return nil
+}
+
+func (r *Repo) SetUploadResult(ctx context.Context, invoiceID, downloadHash string, waveform json.RawMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.uploads[invoiceID]
+	if !ok || u.Status != upload.StatusProcessing {
+		return upload.ErrStatusConflict
+	}
+	now := time.Now()
+	u.Status = upload.StatusProcessed
+	u.DownloadHash = downloadHash
+	u.Waveform = append(json.RawMessage(nil), waveform...)
+	u.UpdatedAt = &now
+
+	return nil
+}
+
+func copyUpload(u upload.Upload) *upload.Upload {
+	u.Waveform = append(json.RawMessage(nil), u.Waveform...)
+	if u.UpdatedAt != nil {
+		updatedAt := *u.UpdatedAt
+		u.UpdatedAt = &updatedAt
+	}
+	return &u
+}
@@ -0,0 +1,26 @@
+package memory
+
+import (
+	"context"
+)
+
+type webhookKey struct {
+	provider  string
+	webhookID string
+}
+
+func (r *Repo) WebhookProcessed(ctx context.Context, provider, webhookID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.webhooks[webhookKey{provider, webhookID}], nil
+}
+
+func (r *Repo) RecordWebhook(ctx context.Context, provider, webhookID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.webhooks[webhookKey{provider, webhookID}] = true
+
+	return nil
+}
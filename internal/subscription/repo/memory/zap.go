@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+	"github.com/stemstr/storage/internal/zap"
+)
+
+func (r *Repo) CreateZap(ctx context.Context, z zap.Zap) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.zaps[z.InvoiceID]; ok {
+		return fmt.Errorf("zap %q exists", z.InvoiceID)
+	}
+	if _, ok := r.subs[z.SubscriptionID]; !ok {
+		return fmt.Errorf("subscription %d not found", z.SubscriptionID)
+	}
+	z.ReceiptSentAt = nil
+	z.CreatedAt = time.Now()
+	r.zaps[z.InvoiceID] = &z
+
+	return nil
+}
+
+func (r *Repo) GetUnsentZaps(ctx context.Context, limit int) ([]zap.Zap, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var zaps []zap.Zap
+	for _, z := range r.zaps {
+		if z.ReceiptSentAt == nil && r.subs[z.SubscriptionID].Status == sub.StatusPaid {
+			zaps = append(zaps, *z)
+		}
+	}
+	sort.Slice(zaps, func(i, j int) bool {
+		return zaps[i].CreatedAt.Before(zaps[j].CreatedAt)
+	})
+
+	return page(zaps, limit, 0), nil
+}
+
+func (r *Repo) ClaimZapReceipt(ctx context.Context, invoiceID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	z, ok := r.zaps[invoiceID]
+	if !ok || z.ReceiptSentAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	z.ReceiptSentAt = &now
+
+	return true, nil
+}
+
+func (r *Repo) ReleaseZapReceipt(ctx context.Context, invoiceID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if z, ok := r.zaps[invoiceID]; ok {
+		z.ReceiptSentAt = nil
+	}
+
+	return nil
+}
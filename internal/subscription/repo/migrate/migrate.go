@@ -0,0 +1,263 @@
+// Package migrate applies versioned schema migrations embedded in a repo
+// package. Migrations live in a directory as NNNN_name.up.sql and
+// NNNN_name.down.sql pairs and are applied in version order, each in its
+// own transaction, recording applied versions in schema_migrations.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNoMigrations is returned by Down when nothing has been applied.
+var ErrNoMigrations = errors.New("no migrations applied")
+
+// Migration is a versioned schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a known migration and when it was applied, if it has been.
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Lock serializes migrations between processes sharing a database. It's
+// taken on conn and held until unlock is called.
+type Lock func(ctx context.Context, conn *sqlx.Conn) (unlock func(), err error)
+
+// New returns a Migrator for the migrations in dir of fsys. lock may be nil
+// for databases only one process opens.
+func New(db *sqlx.DB, fsys fs.FS, dir string, lock Lock) (*Migrator, error) {
+	migrations, err := Parse(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		lock:       lock,
+	}, nil
+}
+
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+	lock       Lock
+}
+
+var filename = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Parse reads the migrations in dir of fsys, sorted by version. Every
+// version must have both an up and a down file.
+func Parse(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("fs.ReadDir: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		m := filename.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file %q", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("fs.ReadFile: %w", err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %q and %q", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrations lists every known migration in version order.
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Up applies every migration not yet applied, returning those it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+			if err := run(ctx, conn, migration.Up, func(tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx, tx.Rebind("INSERT INTO schema_migrations (version, name) VALUES (?, ?);"), migration.Version, migration.Name)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the most recently applied migration, returning it.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var reverted *Migration
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+			if err := run(ctx, conn, migration.Down, func(tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx, tx.Rebind("DELETE FROM schema_migrations WHERE version=?;"), migration.Version)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+			}
+			reverted = &migration
+			return nil
+		}
+
+		return ErrNoMigrations
+	})
+
+	return reverted, err
+}
+
+// Status lists every known migration in version order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if appliedAt, ok := versions[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// withLock runs fn holding the migration lock on a dedicated connection,
+// creating the schema_migrations table if needed.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("db.Conn: %w", err)
+	}
+	defer conn.Close()
+
+	if m.lock != nil {
+		unlock, err := m.lock(ctx, conn)
+		if err != nil {
+			return fmt.Errorf("lock: %w", err)
+		}
+		defer unlock()
+	}
+
+	if _, err := conn.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);`); err != nil {
+		return fmt.Errorf("db.Exec schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sqlx.Conn) (map[int]time.Time, error) {
+	var rows []struct {
+		Version   int       `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}
+	if err := conn.SelectContext(ctx, &rows, "SELECT version, applied_at FROM schema_migrations;"); err != nil {
+		return nil, fmt.Errorf("db.Select schema_migrations: %w", err)
+	}
+
+	versions := make(map[int]time.Time, len(rows))
+	for _, row := range rows {
+		versions[row.Version] = row.AppliedAt
+	}
+
+	return versions, nil
+}
+
+// run executes sql and records it with record in one transaction.
+func run(ctx context.Context, conn *sqlx.Conn, sql string, record func(tx *sqlx.Tx) error) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.Begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, sql); err != nil {
+		return fmt.Errorf("db.Exec: %w", err)
+	}
+	if err := record(tx); err != nil {
+		return fmt.Errorf("record migration: %w", err)
+	}
+
+	return tx.Commit()
+}
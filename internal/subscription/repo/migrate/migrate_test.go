@@ -0,0 +1,69 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMigrations(t *testing.T) {
+	var tests = []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int
+		wantErr  bool
+	}{
+		{
+			name: "sorted",
+			files: fstest.MapFS{
+				"m/0010_later.up.sql":   {Data: []byte("up 10")},
+				"m/0010_later.down.sql": {Data: []byte("down 10")},
+				"m/0002_next.up.sql":    {Data: []byte("up 2")},
+				"m/0002_next.down.sql":  {Data: []byte("down 2")},
+				"m/0001_init.up.sql":    {Data: []byte("up 1")},
+				"m/0001_init.down.sql":  {Data: []byte("down 1")},
+			},
+			versions: []int{1, 2, 10},
+		},
+		{
+			name: "missing down",
+			files: fstest.MapFS{
+				"m/0001_init.up.sql": {Data: []byte("up 1")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "mismatched names",
+			files: fstest.MapFS{
+				"m/0001_init.up.sql":    {Data: []byte("up 1")},
+				"m/0001_other.down.sql": {Data: []byte("down 1")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unexpected file",
+			files: fstest.MapFS{
+				"m/README.md": {Data: []byte("hi")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := Parse(tt.files, "m")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			var versions []int
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+			}
+			assert.Equal(t, tt.versions, versions)
+		})
+	}
+}
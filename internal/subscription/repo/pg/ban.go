@@ -0,0 +1,65 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/stemstr/storage/internal/moderation"
+)
+
+func (r *Repo) CreateBan(ctx context.Context, b moderation.Ban) (*moderation.Ban, error) {
+	const query = `INSERT INTO ban (pubkey, reason, hide_samples) VALUES ($1, $2, $3)
+ON CONFLICT (pubkey) DO UPDATE SET reason=EXCLUDED.reason, hide_samples=EXCLUDED.hide_samples;`
+
+	if _, err := r.db.ExecContext(ctx, query, b.Pubkey, b.Reason, b.HideSamples); err != nil {
+		return nil, fmt.Errorf("db.Exec createBan: %w", err)
+	}
+
+	return r.GetBan(ctx, b.Pubkey)
+}
+
+func (r *Repo) GetBan(ctx context.Context, pubkey string) (*moderation.Ban, error) {
+	const query = "SELECT pubkey, reason, hide_samples, created_at FROM ban WHERE pubkey=$1;"
+
+	var b moderation.Ban
+	if err := r.db.GetContext(ctx, &b, query, pubkey); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, moderation.ErrBanNotFound
+		}
+		return nil, fmt.Errorf("db.Get ban: %w", err)
+	}
+
+	return &b, nil
+}
+
+func (r *Repo) DeleteBan(ctx context.Context, pubkey string) error {
+	const query = "DELETE FROM ban WHERE pubkey=$1;"
+
+	resp, err := r.db.ExecContext(ctx, query, pubkey)
+	if err != nil {
+		return fmt.Errorf("db.Exec delete ban: %w", err)
+	}
+
+	n, err := resp.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("dbResp.RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return moderation.ErrBanNotFound
+	}
+
+	return nil
+}
+
+func (r *Repo) ListBans(ctx context.Context) ([]moderation.Ban, error) {
+	const query = "SELECT pubkey, reason, hide_samples, created_at FROM ban ORDER BY created_at DESC;"
+
+	var bans []moderation.Ban
+	if err := r.db.SelectContext(ctx, &bans, query); err != nil {
+		return nil, fmt.Errorf("db.Select bans: %w", err)
+	}
+
+	return bans, nil
+}
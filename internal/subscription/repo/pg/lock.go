@@ -0,0 +1,81 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+)
+
+// Advisory lock keys. Each background job that must only run on one
+// replica gets its own key.
+const (
+	ReconcilerLockKey int64 = 0x5354454d01 // "STEM" 01
+	MigrationLockKey  int64 = 0x5354454d02 // "STEM" 02
+	// UploadReconcilerLockKey is held by the replica reconciling
+	// pay-per-uploads.
+	UploadReconcilerLockKey int64 = 0x5354454d03 // "STEM" 03
+)
+
+// LeaderLock returns a session level Postgres advisory lock for key.
+func (r *Repo) LeaderLock(key int64) sub.LeaderLock {
+	return &AdvisoryLock{
+		db:  r.db,
+		key: key,
+	}
+}
+
+// AdvisoryLock is held for as long as the connection that took it stays
+// open, so it is released automatically if the holding replica dies.
+type AdvisoryLock struct {
+	db   *sqlx.DB
+	key  int64
+	conn *sqlx.Conn
+}
+
+func (l *AdvisoryLock) TryAcquire(ctx context.Context) (bool, error) {
+	if l.conn != nil {
+		// Confirm the session holding the lock is still alive.
+		if err := l.conn.PingContext(ctx); err == nil {
+			return true, nil
+		}
+		l.conn.Close()
+		l.conn = nil
+	}
+
+	conn, err := l.db.Connx(ctx)
+	if err != nil {
+		return false, fmt.Errorf("db.Conn: %w", err)
+	}
+
+	var locked bool
+	if err := conn.GetContext(ctx, &locked, "SELECT pg_try_advisory_lock($1);", l.key); err != nil {
+		conn.Close()
+		return false, fmt.Errorf("pg_try_advisory_lock: %w", err)
+	}
+	if !locked {
+		conn.Close()
+		return false, nil
+	}
+
+	l.conn = conn
+	return true, nil
+}
+
+func (l *AdvisoryLock) Release(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+	defer func() {
+		l.conn.Close()
+		l.conn = nil
+	}()
+
+	if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1);", l.key); err != nil {
+		return fmt.Errorf("pg_advisory_unlock: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package pg
+
+import (
+	"context"
+	"embed"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/stemstr/storage/internal/subscription/repo/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// Migrations lists the schema migrations in version order.
+func Migrations() ([]migrate.Migration, error) {
+	return migrate.Parse(migrationFS, "migrations")
+}
+
+// MigrateUp applies every migration not yet applied, returning those it
+// applied. Replicas starting together wait on each other rather than
+// racing.
+func (r *Repo) MigrateUp(ctx context.Context) ([]migrate.Migration, error) {
+	m, err := r.migrator()
+	if err != nil {
+		return nil, err
+	}
+	return m.Up(ctx)
+}
+
+// MigrateDown reverts the most recently applied migration, returning it.
+func (r *Repo) MigrateDown(ctx context.Context) (*migrate.Migration, error) {
+	m, err := r.migrator()
+	if err != nil {
+		return nil, err
+	}
+	return m.Down(ctx)
+}
+
+// MigrationStatus lists every known migration in version order.
+func (r *Repo) MigrationStatus(ctx context.Context) ([]migrate.Status, error) {
+	m, err := r.migrator()
+	if err != nil {
+		return nil, err
+	}
+	return m.Status(ctx)
+}
+
+func (r *Repo) migrator() (*migrate.Migrator, error) {
+	return migrate.New(r.db, migrationFS, "migrations", lockMigrations)
+}
+
+// lockMigrations takes the migration advisory lock, waiting for any other
+// replica migrating.
+func lockMigrations(ctx context.Context, conn *sqlx.Conn) (func(), error) {
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", MigrationLockKey); err != nil {
+		return nil, fmt.Errorf("pg_advisory_lock: %w", err)
+	}
+
+	return func() {
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1);", MigrationLockKey)
+	}, nil
+}
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS upload;
+DROP TABLE IF EXISTS group_member;
+DROP TABLE IF EXISTS promo_redemption;
+DROP TABLE IF EXISTS promo_code;
+DROP TABLE IF EXISTS zap;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS sample;
+DROP TABLE IF EXISTS ban;
+DROP TABLE IF EXISTS processed_webhook;
+DROP TABLE IF EXISTS subscription_status_history;
+DROP TABLE IF EXISTS subscription;
@@ -0,0 +1,138 @@
+-- The schema as created by pg.New before migrations. Statements are
+-- idempotent so databases created back then are adopted as they are.
+
+CREATE TABLE IF NOT EXISTS subscription (
+	id SERIAL PRIMARY KEY,
+	pubkey TEXT NOT NULL,
+	days INTEGER NOT NULL,
+	sats INTEGER NOT NULL,
+	invoice_id TEXT NOT NULL,
+	provider TEXT NOT NULL,
+	status TEXT NOT NULL,
+	lightning_invoice TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS pubkeyidx ON subscription(pubkey);
+CREATE INDEX IF NOT EXISTS provideridx ON subscription(provider);
+
+ALTER TABLE subscription ADD COLUMN IF NOT EXISTS starts_at TIMESTAMP;
+UPDATE subscription SET starts_at=created_at WHERE starts_at IS NULL;
+ALTER TABLE subscription ALTER COLUMN starts_at SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE subscription ALTER COLUMN starts_at SET NOT NULL;
+
+UPDATE subscription SET status='pending' WHERE status='unpaid';
+ALTER TABLE subscription ADD COLUMN IF NOT EXISTS invoice_expires_at TIMESTAMP;
+UPDATE subscription SET invoice_expires_at=created_at + INTERVAL '1 day' WHERE invoice_expires_at IS NULL;
+ALTER TABLE subscription ALTER COLUMN invoice_expires_at SET NOT NULL;
+CREATE INDEX IF NOT EXISTS statusidx ON subscription(status);
+ALTER TABLE subscription ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT '';
+ALTER TABLE subscription ADD COLUMN IF NOT EXISTS fiat_price DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE subscription ADD COLUMN IF NOT EXISTS exchange_rate DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE subscription ADD COLUMN IF NOT EXISTS promo_code TEXT NOT NULL DEFAULT '';
+ALTER TABLE subscription ADD COLUMN IF NOT EXISTS gifted_by TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS subscription_status_history (
+	id SERIAL PRIMARY KEY,
+	subscription_id INTEGER NOT NULL REFERENCES subscription(id),
+	from_status TEXT NOT NULL,
+	to_status TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS statushistorysubidx ON subscription_status_history(subscription_id);
+
+CREATE TABLE IF NOT EXISTS processed_webhook (
+	provider TEXT NOT NULL,
+	webhook_id TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	PRIMARY KEY (provider, webhook_id)
+);
+
+CREATE TABLE IF NOT EXISTS ban (
+	pubkey TEXT PRIMARY KEY,
+	reason TEXT NOT NULL DEFAULT '',
+	hide_samples BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sample (
+	sum TEXT PRIMARY KEY,
+	pubkey TEXT NOT NULL,
+	mimetype TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS samplepubkeyidx ON sample(pubkey);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	id SERIAL PRIMARY KEY,
+	actor TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target TEXT NOT NULL,
+	before JSONB NOT NULL DEFAULT 'null',
+	after JSONB NOT NULL DEFAULT 'null',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS zap (
+	invoice_id TEXT PRIMARY KEY,
+	subscription_id INTEGER NOT NULL REFERENCES subscription(id),
+	request TEXT NOT NULL,
+	receipt_sent_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS zapunsentidx ON zap(created_at) WHERE receipt_sent_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS promo_code (
+	code TEXT PRIMARY KEY,
+	percent_off INTEGER NOT NULL DEFAULT 0,
+	sats_off INTEGER NOT NULL DEFAULT 0,
+	free_days INTEGER NOT NULL DEFAULT 0,
+	max_redemptions INTEGER NOT NULL DEFAULT 0,
+	redemptions INTEGER NOT NULL DEFAULT 0,
+	once_per_pubkey BOOLEAN NOT NULL DEFAULT FALSE,
+	expires_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS promo_redemption (
+	id SERIAL PRIMARY KEY,
+	code TEXT NOT NULL REFERENCES promo_code(code),
+	pubkey TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS promoredemptionidx ON promo_redemption(code, pubkey);
+
+CREATE TABLE IF NOT EXISTS group_member (
+	owner TEXT NOT NULL,
+	pubkey TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	PRIMARY KEY (owner, pubkey)
+);
+
+CREATE INDEX IF NOT EXISTS groupmemberpubkeyidx ON group_member(pubkey);
+
+CREATE TABLE IF NOT EXISTS upload (
+	invoice_id TEXT PRIMARY KEY,
+	provider TEXT NOT NULL,
+	pubkey TEXT NOT NULL,
+	sum TEXT NOT NULL,
+	mimetype TEXT NOT NULL,
+	size BIGINT NOT NULL,
+	duration_seconds DOUBLE PRECISION NOT NULL,
+	sats INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	lightning_invoice TEXT NOT NULL,
+	invoice_expires_at TIMESTAMP NOT NULL,
+	download_hash TEXT NOT NULL DEFAULT '',
+	waveform JSONB NOT NULL DEFAULT 'null',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS uploadstatusidx ON upload(status);
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS pubkeyidx ON subscription(pubkey);
+DROP INDEX IF EXISTS subscriptionpubkeyexpiresidx;
@@ -0,0 +1,5 @@
+-- Active subscription lookups filter on pubkey and expires_at. The composite
+-- index also serves pubkey lookups, replacing pubkeyidx.
+
+CREATE INDEX IF NOT EXISTS subscriptionpubkeyexpiresidx ON subscription(pubkey, expires_at);
+DROP INDEX IF EXISTS pubkeyidx;
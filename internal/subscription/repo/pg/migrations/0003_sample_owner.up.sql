@@ -0,0 +1,22 @@
+-- A file uploaded by several pubkeys is stored once, but each of them owns
+-- it, so a ban that hides samples hides it too. Owners are backfilled from
+-- the first uploader of each sample and from paid uploads of the same file.
+
+CREATE TABLE IF NOT EXISTS sample_owner (
+	sum TEXT NOT NULL,
+	pubkey TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	PRIMARY KEY (sum, pubkey)
+);
+
+CREATE INDEX IF NOT EXISTS sampleownerpubkeyidx ON sample_owner(pubkey);
+
+INSERT INTO sample_owner (sum, pubkey, created_at)
+SELECT sum, pubkey, created_at FROM sample
+ON CONFLICT DO NOTHING;
+
+INSERT INTO sample_owner (sum, pubkey, created_at)
+SELECT upload.sum, upload.pubkey, upload.created_at FROM upload
+JOIN sample ON sample.sum = upload.sum
+WHERE upload.status = 'processed'
+ON CONFLICT DO NOTHING;
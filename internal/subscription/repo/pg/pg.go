@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -13,7 +14,23 @@ import (
 	sub "github.com/stemstr/storage/internal/subscription"
 )
 
+// New connects to the database and brings its schema up to date.
 func New(dbConnStr string) (*Repo, error) {
+	r, err := Open(dbConnStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.MigrateUp(context.Background()); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("MigrateUp: %w", err)
+	}
+
+	return r, nil
+}
+
+// Open connects to the database without migrating it.
+func Open(dbConnStr string) (*Repo, error) {
 	db, err := sqlx.Connect("postgres", dbConnStr)
 	if err != nil {
 		return nil, fmt.Errorf("sqlx.Connect: %w", err)
@@ -22,29 +39,6 @@ func New(dbConnStr string) (*Repo, error) {
 	// sqlx default is 0 (unlimited), while postgresql by default accepts up to 100 connections
 	db.SetMaxOpenConns(80)
 
-	// TODO: migrations
-	_, err = db.Exec(`
-CREATE TABLE IF NOT EXISTS subscription (
-	id SERIAL PRIMARY KEY,
-	pubkey TEXT NOT NULL,
-	days INTEGER NOT NULL,
-	sats INTEGER NOT NULL,
-	invoice_id TEXT NOT NULL,
-	provider TEXT NOT NULL,
-	status TEXT NOT NULL,
-	lightning_invoice TEXT NOT NULL,
-	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
-	expires_at TIMESTAMP NOT NULL,
-	updated_at TIMESTAMP
-);
-
-CREATE INDEX IF NOT EXISTS pubkeyidx ON subscription(pubkey);
-CREATE INDEX IF NOT EXISTS provideridx ON subscription(provider);
-    `)
-	if err != nil {
-		return nil, fmt.Errorf("db.Exec schema: %w", err)
-	}
-
 	return &Repo{
 		db: db,
 	}, nil
@@ -54,85 +48,241 @@ type Repo struct {
 	db *sqlx.DB
 }
 
+// subscriptionColumns are selected rather than * so queries keep working
+// while a migration adds a column.
+const subscriptionColumns = `id, pubkey, days, sats, currency, fiat_price, exchange_rate, promo_code, gifted_by,
+invoice_id, provider, status, lightning_invoice, invoice_expires_at, created_at, starts_at, expires_at, updated_at`
+
+func (r *Repo) Close() error {
+	return r.db.Close()
+}
+
 func (r *Repo) CreateSubscription(ctx context.Context, s sub.Subscription) (*sub.Subscription, error) {
-	query, args, err := sqlx.Named(`INSERT INTO subscription (pubkey, days, sats, invoice_id, provider, status, lightning_invoice, expires_at) 
-VALUES (:pubkey, :days, :sats, :invoice_id, :provider, :status, :lightning_invoice, :expires_at) RETURNING id;`, s)
+	query, args, err := sqlx.Named(`INSERT INTO subscription (pubkey, days, sats, currency, fiat_price, exchange_rate, promo_code, gifted_by, invoice_id, provider, status, lightning_invoice, invoice_expires_at, starts_at, expires_at) 
+VALUES (:pubkey, :days, :sats, :currency, :fiat_price, :exchange_rate, :promo_code, :gifted_by, :invoice_id, :provider, :status, :lightning_invoice, :invoice_expires_at, :starts_at, :expires_at) RETURNING id;`, s)
 	if err != nil {
 		return nil, fmt.Errorf("sqlx.Named createSub: %w", err)
 	}
 	query = r.db.Rebind(query)
 	var id int
-	if err := r.db.Get(&id, query, args...); err != nil {
+	if err := r.db.GetContext(ctx, &id, query, args...); err != nil {
 		return nil, fmt.Errorf("db.Get createSub: %w", err)
 	}
 
-	return r.getSubscription(ctx, int64(id))
+	return r.GetSubscription(ctx, int64(id))
 }
 
 func (r *Repo) GetActiveSubscriptions(ctx context.Context, pubkey string) ([]sub.Subscription, error) {
-	const query = "SELECT * FROM subscription WHERE pubkey=$1 ORDER BY created_at DESC;"
+	// Current periods and those queued to start later. Callers use
+	// Subscription.ActiveAt to tell them apart.
+	const query = "SELECT " + subscriptionColumns + ` FROM subscription
+WHERE pubkey=$1 AND expires_at>$2 AND status IN ($3, $4)
+ORDER BY starts_at ASC, created_at DESC;`
 
 	var subs []sub.Subscription
-	if err := r.db.Select(&subs, query, pubkey); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("db.Get active sub: %w", err)
+	if err := r.db.SelectContext(ctx, &subs, query, pubkey, time.Now(), sub.StatusPaid, sub.StatusPending); err != nil {
+		return nil, fmt.Errorf("db.Select active subs: %w", err)
 	}
 
-	now := time.Now()
-	var notExpired []sub.Subscription
-	for _, s := range subs {
-		if s.ExpiresAt.After(now) {
-			notExpired = append(notExpired, s)
-		}
+	return subs, nil
+}
+
+func (r *Repo) GetSubscriptionHistory(ctx context.Context, pubkey string, limit, offset int) ([]sub.Subscription, error) {
+	const query = "SELECT " + subscriptionColumns + ` FROM subscription
+WHERE pubkey=$1 ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3;`
+
+	var subs []sub.Subscription
+	if err := r.db.SelectContext(ctx, &subs, query, pubkey, limit, offset); err != nil {
+		return nil, fmt.Errorf("db.Select sub history: %w", err)
 	}
 
-	return notExpired, nil
+	return subs, nil
 }
 
-func (r *Repo) UpdateStatus(ctx context.Context, id int64, status sub.SubscriptionStatus) error {
-	const query = `UPDATE subscription SET status=$2, updated_at=NOW() WHERE id=$1`
-	params := []any{id, status}
+func (r *Repo) UpdateStatus(ctx context.Context, id int64, from, to sub.SubscriptionStatus) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.Begin: %w", err)
+	}
+	defer tx.Rollback()
 
-	_, err := r.db.ExecContext(ctx, query, params...)
+	const updateQuery = `UPDATE subscription SET status=$3, updated_at=NOW() WHERE id=$1 AND status=$2`
+	resp, err := tx.ExecContext(ctx, updateQuery, id, from, to)
 	if err != nil {
 		return fmt.Errorf("db.Exec update sub: %w", err)
 	}
 
+	n, err := resp.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("dbResp.RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return sub.ErrStatusConflict
+	}
+
+	const historyQuery = `INSERT INTO subscription_status_history (subscription_id, from_status, to_status) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, historyQuery, id, from, to); err != nil {
+		return fmt.Errorf("db.Exec insert status history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("db.Commit: %w", err)
+	}
+
 	return nil
 }
 
-func (r *Repo) UpdateStatusByInvoiceID(ctx context.Context, invoiceID string, status sub.SubscriptionStatus) error {
-	const query = `UPDATE subscription SET status=$2, updated_at=NOW() WHERE invoice_id=$1`
-	params := []any{invoiceID, status}
+func (r *Repo) MarkPaid(ctx context.Context, id int64, from sub.SubscriptionStatus) (time.Time, time.Time, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("db.Begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var s sub.Subscription
+	if err := tx.GetContext(ctx, &s, "SELECT pubkey, days FROM subscription WHERE id=$1;", id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, time.Time{}, sub.ErrStatusConflict
+		}
+		return time.Time{}, time.Time{}, fmt.Errorf("db.Get sub: %w", err)
+	}
+
+	// Concurrent payments for pubkey wait here, so each sees the periods
+	// paid before it.
+	if _, err := tx.ExecContext(ctx, "SELECT id FROM subscription WHERE pubkey=$1 ORDER BY id FOR UPDATE;", s.Pubkey); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("db.Exec lock subs: %w", err)
+	}
 
-	resp, err := r.db.ExecContext(ctx, query, params...)
+	// The period follows pubkey's last paid one
+	var (
+		now      = time.Now()
+		expiries []time.Time
+	)
+	const expiriesQuery = "SELECT expires_at FROM subscription WHERE pubkey=$1 AND status=$2 AND expires_at>$3;"
+	if err := tx.SelectContext(ctx, &expiries, expiriesQuery, s.Pubkey, sub.StatusPaid, now); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("db.Select paid expiries: %w", err)
+	}
+	start := now
+	for _, expiresAt := range expiries {
+		if expiresAt.After(start) {
+			start = expiresAt
+		}
+	}
+	expires := start.Add(time.Hour * 24 * time.Duration(s.Days))
+
+	const updateQuery = `UPDATE subscription SET status=$1, starts_at=$2, expires_at=$3, updated_at=NOW() WHERE id=$4 AND status=$5`
+	resp, err := tx.ExecContext(ctx, updateQuery, sub.StatusPaid, start, expires, id, from)
 	if err != nil {
-		return fmt.Errorf("db.Exec update sub: %w", err)
+		return time.Time{}, time.Time{}, fmt.Errorf("db.Exec update sub: %w", err)
 	}
 
 	n, err := resp.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("dbResp.RowsAffected: %w", err)
+		return time.Time{}, time.Time{}, fmt.Errorf("dbResp.RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return time.Time{}, time.Time{}, sub.ErrStatusConflict
+	}
+
+	const historyQuery = `INSERT INTO subscription_status_history (subscription_id, from_status, to_status) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, historyQuery, id, from, sub.StatusPaid); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("db.Exec insert status history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("db.Commit: %w", err)
+	}
+
+	return start, expires, nil
+}
+
+func (r *Repo) GetStatusHistory(ctx context.Context, id int64) ([]sub.StatusChange, error) {
+	const query = "SELECT id, subscription_id, from_status, to_status, created_at FROM subscription_status_history WHERE subscription_id=$1 ORDER BY id ASC;"
+
+	var changes []sub.StatusChange
+	if err := r.db.SelectContext(ctx, &changes, query, id); err != nil {
+		return nil, fmt.Errorf("db.Select status history: %w", err)
+	}
+
+	return changes, nil
+}
+
+func (r *Repo) GetPendingSubscriptions(ctx context.Context) ([]sub.Subscription, error) {
+	const query = "SELECT " + subscriptionColumns + " FROM subscription WHERE status=$1 ORDER BY invoice_expires_at ASC;"
+
+	var subs []sub.Subscription
+	if err := r.db.SelectContext(ctx, &subs, query, sub.StatusPending); err != nil {
+		return nil, fmt.Errorf("db.Select pending subs: %w", err)
+	}
+
+	return subs, nil
+}
+
+func (r *Repo) GetSubscriptionByInvoiceID(ctx context.Context, invoiceID string) (*sub.Subscription, error) {
+	const query = "SELECT " + subscriptionColumns + " FROM subscription WHERE invoice_id=$1;"
+
+	if invoiceID == "" {
+		return nil, sub.ErrSubscriptionNotFound
 	}
+
+	var subs []sub.Subscription
+	if err := r.db.SelectContext(ctx, &subs, query, invoiceID); err != nil {
+		return nil, fmt.Errorf("db.Select sub by invoice: %w", err)
+	}
+
 	switch {
-	case n == 0:
-		return fmt.Errorf("invoice not found")
-	case n == 1:
-		return nil
+	case len(subs) == 0:
+		return nil, sub.ErrSubscriptionNotFound
+	case len(subs) == 1:
+		return &subs[0], nil
 	default:
-		return fmt.Errorf("expected one invoice, found multiple")
+		return nil, fmt.Errorf("expected one invoice, found multiple")
 	}
 }
 
-func (r *Repo) getSubscription(ctx context.Context, id int64) (*sub.Subscription, error) {
-	const sql = "SELECT * FROM subscription WHERE id=$1;"
+func (r *Repo) GetSubscription(ctx context.Context, id int64) (*sub.Subscription, error) {
+	const query = "SELECT " + subscriptionColumns + " FROM subscription WHERE id=$1;"
 
 	var s sub.Subscription
-	if err := r.db.Get(&s, sql, id); err != nil {
+	if err := r.db.GetContext(ctx, &s, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sub.ErrSubscriptionNotFound
+		}
 		return nil, fmt.Errorf("db.Get sub: %w", err)
 	}
 
 	return &s, nil
 }
+
+func (r *Repo) SearchSubscriptions(ctx context.Context, filter sub.SearchFilter) ([]sub.Subscription, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if filter.Pubkey != "" {
+		args = append(args, filter.Pubkey)
+		where = append(where, fmt.Sprintf("pubkey=$%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where = append(where, fmt.Sprintf("status=$%d", len(args)))
+	}
+	if filter.Provider != "" {
+		args = append(args, filter.Provider)
+		where = append(where, fmt.Sprintf("provider=$%d", len(args)))
+	}
+
+	query := "SELECT " + subscriptionColumns + " FROM subscription"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d;", len(args)-1, len(args))
+
+	var subs []sub.Subscription
+	if err := r.db.SelectContext(ctx, &subs, query, args...); err != nil {
+		return nil, fmt.Errorf("db.Select search subs: %w", err)
+	}
+
+	return subs, nil
+}
@@ -0,0 +1,122 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+)
+
+func (r *Repo) CreatePromoCode(ctx context.Context, p sub.PromoCode) (*sub.PromoCode, error) {
+	const query = `INSERT INTO promo_code (code, percent_off, sats_off, free_days, max_redemptions, once_per_pubkey, expires_at, created_at)
+VALUES (:code, :percent_off, :sats_off, :free_days, :max_redemptions, :once_per_pubkey, :expires_at, :created_at);`
+
+	if _, err := r.db.NamedExecContext(ctx, query, p); err != nil {
+		return nil, fmt.Errorf("db.Exec createPromoCode: %w", err)
+	}
+
+	return r.GetPromoCode(ctx, p.Code)
+}
+
+func (r *Repo) GetPromoCode(ctx context.Context, code string) (*sub.PromoCode, error) {
+	const query = "SELECT code, percent_off, sats_off, free_days, max_redemptions, redemptions, once_per_pubkey, expires_at, created_at FROM promo_code WHERE code=$1;"
+
+	var p sub.PromoCode
+	if err := r.db.GetContext(ctx, &p, query, code); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sub.ErrPromoCodeNotFound
+		}
+		return nil, fmt.Errorf("db.Get promoCode: %w", err)
+	}
+
+	return &p, nil
+}
+
+func (r *Repo) ListPromoCodes(ctx context.Context) ([]sub.PromoCode, error) {
+	const query = "SELECT code, percent_off, sats_off, free_days, max_redemptions, redemptions, once_per_pubkey, expires_at, created_at FROM promo_code ORDER BY created_at DESC;"
+
+	var codes []sub.PromoCode
+	if err := r.db.SelectContext(ctx, &codes, query); err != nil {
+		return nil, fmt.Errorf("db.Select promoCodes: %w", err)
+	}
+
+	return codes, nil
+}
+
+func (r *Repo) RedeemPromoCode(ctx context.Context, code, pubkey string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.Begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the code so concurrent redemptions are counted one at a time
+	var p sub.PromoCode
+	if err := tx.GetContext(ctx, &p, "SELECT code, percent_off, sats_off, free_days, max_redemptions, redemptions, once_per_pubkey, expires_at, created_at FROM promo_code WHERE code=$1 FOR UPDATE;", code); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sub.ErrPromoCodeNotFound
+		}
+		return fmt.Errorf("db.Get promoCode: %w", err)
+	}
+	if p.MaxRedemptions > 0 && p.Redemptions >= p.MaxRedemptions {
+		return sub.ErrPromoCodeExhausted
+	}
+	if p.OncePerPubkey {
+		var used bool
+		const usedQuery = "SELECT EXISTS (SELECT 1 FROM promo_redemption WHERE code=$1 AND pubkey=$2);"
+		if err := tx.GetContext(ctx, &used, usedQuery, code, pubkey); err != nil {
+			return fmt.Errorf("db.Get promoRedemption: %w", err)
+		}
+		if used {
+			return sub.ErrPromoCodeRedeemed
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE promo_code SET redemptions=redemptions+1 WHERE code=$1;", code); err != nil {
+		return fmt.Errorf("db.Exec update promoCode: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO promo_redemption (code, pubkey) VALUES ($1, $2);", code, pubkey); err != nil {
+		return fmt.Errorf("db.Exec insert promoRedemption: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("db.Commit: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repo) ReleasePromoCode(ctx context.Context, code, pubkey string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.Begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	const deleteQuery = `DELETE FROM promo_redemption WHERE id=(
+	SELECT id FROM promo_redemption WHERE code=$1 AND pubkey=$2 ORDER BY id DESC LIMIT 1
+);`
+	resp, err := tx.ExecContext(ctx, deleteQuery, code, pubkey)
+	if err != nil {
+		return fmt.Errorf("db.Exec delete promoRedemption: %w", err)
+	}
+	n, err := resp.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("dbResp.RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE promo_code SET redemptions=redemptions-1 WHERE code=$1 AND redemptions>0;", code); err != nil {
+		return fmt.Errorf("db.Exec update promoCode: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("db.Commit: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/stemstr/storage/internal/upload"
+)
+
+func (r *Repo) CreateUpload(ctx context.Context, u upload.Upload) error {
+	const query = `INSERT INTO upload (invoice_id, provider, pubkey, sum, mimetype, size, duration_seconds, sats, status, lightning_invoice, invoice_expires_at, created_at)
+VALUES (:invoice_id, :provider, :pubkey, :sum, :mimetype, :size, :duration_seconds, :sats, :status, :lightning_invoice, :invoice_expires_at, :created_at);`
+
+	if _, err := r.db.NamedExecContext(ctx, query, u); err != nil {
+		return fmt.Errorf("db.Exec createUpload: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repo) GetUpload(ctx context.Context, invoiceID string) (*upload.Upload, error) {
+	const query = "SELECT invoice_id, provider, pubkey, sum, mimetype, size, duration_seconds, sats, status, lightning_invoice, invoice_expires_at, download_hash, waveform, created_at, updated_at FROM upload WHERE invoice_id=$1;"
+
+	var u upload.Upload
+	if err := r.db.GetContext(ctx, &u, query, invoiceID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, upload.ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("db.Get upload: %w", err)
+	}
+
+	return &u, nil
+}
+
+func (r *Repo) GetPendingUploads(ctx context.Context) ([]upload.Upload, error) {
+	const query = "SELECT invoice_id, provider, pubkey, sum, mimetype, size, duration_seconds, sats, status, lightning_invoice, invoice_expires_at, download_hash, waveform, created_at, updated_at FROM upload WHERE status=$1 ORDER BY invoice_expires_at ASC;"
+
+	var uploads []upload.Upload
+	if err := r.db.SelectContext(ctx, &uploads, query, upload.StatusPending); err != nil {
+		return nil, fmt.Errorf("db.Select pending uploads: %w", err)
+	}
+
+	return uploads, nil
+}
+
+func (r *Repo) GetProcessingUploads(ctx context.Context, updatedBefore time.Time) ([]upload.Upload, error) {
+	const query = "SELECT invoice_id, provider, pubkey, sum, mimetype, size, duration_seconds, sats, status, lightning_invoice, invoice_expires_at, download_hash, waveform, created_at, updated_at FROM upload WHERE status=$1 AND updated_at<$2 ORDER BY updated_at ASC;"
+
+	var uploads []upload.Upload
+	if err := r.db.SelectContext(ctx, &uploads, query, upload.StatusProcessing, updatedBefore); err != nil {
+		return nil, fmt.Errorf("db.Select processing uploads: %w", err)
+	}
+
+	return uploads, nil
+}
+
+func (r *Repo) UpdateUploadStatus(ctx context.Context, invoiceID string, from, to upload.Status) error {
+	const query = "UPDATE upload SET status=$3, updated_at=NOW() WHERE invoice_id=$1 AND status=$2;"
+
+	resp, err := r.db.ExecContext(ctx, query, invoiceID, from, to)
+	if err != nil {
+		return fmt.Errorf("db.Exec update upload: %w", err)
+	}
+
+	n, err := resp.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("dbResp.RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return upload.ErrStatusConflict
+	}
+
+	return nil
+}
+
+func (r *Repo) SetUploadResult(ctx context.Context, invoiceID, downloadHash string, waveform json.RawMessage) error {
+	const query = `UPDATE upload SET status=$4, download_hash=$2, waveform=$3, updated_at=NOW() WHERE invoice_id=$1 AND status=$5;`
+
+	resp, err := r.db.ExecContext(ctx, query, invoiceID, downloadHash, string(waveform), upload.StatusProcessed, upload.StatusProcessing)
+	if err != nil {
+		return fmt.Errorf("db.Exec upload result: %w", err)
+	}
+
+	n, err := resp.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("dbResp.RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return upload.ErrStatusConflict
+	}
+
+	return nil
+}
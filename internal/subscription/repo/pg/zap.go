@@ -0,0 +1,56 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+	"github.com/stemstr/storage/internal/zap"
+)
+
+func (r *Repo) CreateZap(ctx context.Context, z zap.Zap) error {
+	const query = "INSERT INTO zap (invoice_id, subscription_id, request) VALUES ($1, $2, $3);"
+
+	if _, err := r.db.ExecContext(ctx, query, z.InvoiceID, z.SubscriptionID, z.Request); err != nil {
+		return fmt.Errorf("db.Exec createZap: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repo) GetUnsentZaps(ctx context.Context, limit int) ([]zap.Zap, error) {
+	const query = `SELECT z.invoice_id, z.subscription_id, z.request, z.receipt_sent_at, z.created_at FROM zap z JOIN subscription s ON s.id=z.subscription_id
+WHERE z.receipt_sent_at IS NULL AND s.status=$1 ORDER BY z.created_at ASC LIMIT $2;`
+
+	var zaps []zap.Zap
+	if err := r.db.SelectContext(ctx, &zaps, query, sub.StatusPaid, limit); err != nil {
+		return nil, fmt.Errorf("db.Select unsent zaps: %w", err)
+	}
+
+	return zaps, nil
+}
+
+func (r *Repo) ClaimZapReceipt(ctx context.Context, invoiceID string) (bool, error) {
+	const query = "UPDATE zap SET receipt_sent_at=CURRENT_TIMESTAMP WHERE invoice_id=$1 AND receipt_sent_at IS NULL;"
+
+	resp, err := r.db.ExecContext(ctx, query, invoiceID)
+	if err != nil {
+		return false, fmt.Errorf("db.Exec claimZapReceipt: %w", err)
+	}
+	n, err := resp.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("RowsAffected: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+func (r *Repo) ReleaseZapReceipt(ctx context.Context, invoiceID string) error {
+	const query = "UPDATE zap SET receipt_sent_at=NULL WHERE invoice_id=$1;"
+
+	if _, err := r.db.ExecContext(ctx, query, invoiceID); err != nil {
+		return fmt.Errorf("db.Exec releaseZapReceipt: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+// Package repo opens the database backing the API, choosing between pg and
+// sqlite by the scheme of the connection string.
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/stemstr/storage/internal/audit"
+	"github.com/stemstr/storage/internal/moderation"
+	"github.com/stemstr/storage/internal/service"
+	sub "github.com/stemstr/storage/internal/subscription"
+	"github.com/stemstr/storage/internal/subscription/repo/migrate"
+	"github.com/stemstr/storage/internal/subscription/repo/pg"
+	"github.com/stemstr/storage/internal/subscription/repo/sqlite"
+	"github.com/stemstr/storage/internal/upload"
+	"github.com/stemstr/storage/internal/zap"
+)
+
+// LeaderLock keys of the background jobs.
+const (
+	// ReconcilerLockKey is the LeaderLock key of the subscription
+	// reconciler.
+	ReconcilerLockKey = pg.ReconcilerLockKey
+	// UploadReconcilerLockKey is the LeaderLock key of the pay-per-upload
+	// reconciler.
+	UploadReconcilerLockKey = pg.UploadReconcilerLockKey
+)
+
+// Repo is everything the API stores. It's satisfied by every backend so
+// services can be handed whichever was configured.
+type Repo interface {
+	// Subscriptions
+	CreateSubscription(ctx context.Context, s sub.Subscription) (*sub.Subscription, error)
+	GetSubscription(ctx context.Context, id int64) (*sub.Subscription, error)
+	GetSubscriptionByInvoiceID(ctx context.Context, invoiceID string) (*sub.Subscription, error)
+	GetActiveSubscriptions(ctx context.Context, pubkey string) ([]sub.Subscription, error)
+	GetSubscriptionHistory(ctx context.Context, pubkey string, limit, offset int) ([]sub.Subscription, error)
+	GetPendingSubscriptions(ctx context.Context) ([]sub.Subscription, error)
+	SearchSubscriptions(ctx context.Context, filter sub.SearchFilter) ([]sub.Subscription, error)
+	UpdateStatus(ctx context.Context, id int64, from, to sub.SubscriptionStatus) error
+	MarkPaid(ctx context.Context, id int64, from sub.SubscriptionStatus) (time.Time, time.Time, error)
+	GetStatusHistory(ctx context.Context, id int64) ([]sub.StatusChange, error)
+	WebhookProcessed(ctx context.Context, provider, webhookID string) (bool, error)
+	RecordWebhook(ctx context.Context, provider, webhookID string) error
+
+	// Promo codes
+	CreatePromoCode(ctx context.Context, p sub.PromoCode) (*sub.PromoCode, error)
+	GetPromoCode(ctx context.Context, code string) (*sub.PromoCode, error)
+	ListPromoCodes(ctx context.Context) ([]sub.PromoCode, error)
+	RedeemPromoCode(ctx context.Context, code, pubkey string) error
+	ReleasePromoCode(ctx context.Context, code, pubkey string) error
+
+	// Groups
+	AddGroupMember(ctx context.Context, owner, member string) error
+	RemoveGroupMember(ctx context.Context, owner, member string) error
+	GetGroupMembers(ctx context.Context, owner string) ([]sub.GroupMember, error)
+	SetGroupMembers(ctx context.Context, owner string, members []string) error
+	GetGroupOwners(ctx context.Context, member string) ([]string, error)
+
+	// Bans
+	CreateBan(ctx context.Context, b moderation.Ban) (*moderation.Ban, error)
+	GetBan(ctx context.Context, pubkey string) (*moderation.Ban, error)
+	DeleteBan(ctx context.Context, pubkey string) error
+	ListBans(ctx context.Context) ([]moderation.Ban, error)
+
+	// Audit log
+	CreateAuditEntry(ctx context.Context, e audit.Entry) error
+	ListAuditEntries(ctx context.Context, limit, offset int) ([]audit.Entry, error)
+
+	// Samples
+	CreateSample(ctx context.Context, s service.Sample) error
+	GetSample(ctx context.Context, sum string) (*service.Sample, error)
+	GetSampleOwners(ctx context.Context, sum string) ([]string, error)
+	DeleteSample(ctx context.Context, sum string) error
+
+	// Zaps
+	CreateZap(ctx context.Context, z zap.Zap) error
+	GetUnsentZaps(ctx context.Context, limit int) ([]zap.Zap, error)
+	ClaimZapReceipt(ctx context.Context, invoiceID string) (bool, error)
+	ReleaseZapReceipt(ctx context.Context, invoiceID string) error
+
+	// Pay-per-uploads
+	CreateUpload(ctx context.Context, u upload.Upload) error
+	GetUpload(ctx context.Context, invoiceID string) (*upload.Upload, error)
+	GetPendingUploads(ctx context.Context) ([]upload.Upload, error)
+	GetProcessingUploads(ctx context.Context, updatedBefore time.Time) ([]upload.Upload, error)
+	UpdateUploadStatus(ctx context.Context, invoiceID string, from, to upload.Status) error
+	SetUploadResult(ctx context.Context, invoiceID, downloadHash string, waveform json.RawMessage) error
+
+	// LeaderLock elects a single replica to run the background job key.
+	LeaderLock(key int64) sub.LeaderLock
+
+	MigrateUp(ctx context.Context) ([]migrate.Migration, error)
+	MigrateDown(ctx context.Context) (*migrate.Migration, error)
+	MigrationStatus(ctx context.Context) ([]migrate.Status, error)
+	Close() error
+}
+
+var (
+	_ Repo = (*pg.Repo)(nil)
+	_ Repo = (*sqlite.Repo)(nil)
+)
+
+// New opens the database at dsn and brings its schema up to date.
+func New(dsn string) (Repo, error) {
+	if path, ok := sqlitePath(dsn); ok {
+		return sqlite.New(path)
+	}
+	return pg.New(dsn)
+}
+
+// Open opens the database at dsn without migrating it. DSNs starting
+// sqlite: name a SQLite database file, e.g. sqlite:///var/lib/stemstr.db or
+// sqlite::memory:. Anything else is a Postgres connection string.
+func Open(dsn string) (Repo, error) {
+	if path, ok := sqlitePath(dsn); ok {
+		return sqlite.Open(path)
+	}
+	return pg.Open(dsn)
+}
+
+func sqlitePath(dsn string) (string, bool) {
+	path, ok := strings.CutPrefix(dsn, "sqlite:")
+	if !ok {
+		return "", false
+	}
+	return strings.TrimPrefix(path, "//"), true
+}
@@ -0,0 +1,29 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stemstr/storage/internal/audit"
+)
+
+func (r *Repo) CreateAuditEntry(ctx context.Context, e audit.Entry) error {
+	const query = `INSERT INTO audit_log (actor, action, target, before, after) VALUES (?, ?, ?, ?, ?);`
+
+	if _, err := r.db.ExecContext(ctx, query, e.Actor, e.Action, e.Target, []byte(e.Before), []byte(e.After)); err != nil {
+		return fmt.Errorf("db.Exec createAuditEntry: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repo) ListAuditEntries(ctx context.Context, limit, offset int) ([]audit.Entry, error) {
+	const query = "SELECT id, actor, action, target, before, after, created_at FROM audit_log ORDER BY id DESC LIMIT ? OFFSET ?;"
+
+	var entries []audit.Entry
+	if err := r.db.SelectContext(ctx, &entries, query, limit, offset); err != nil {
+		return nil, fmt.Errorf("db.Select audit: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+)
+
+func (r *Repo) AddGroupMember(ctx context.Context, owner, member string) error {
+	const query = "INSERT INTO group_member (owner, pubkey) VALUES (?, ?) ON CONFLICT DO NOTHING;"
+
+	if _, err := r.db.ExecContext(ctx, query, owner, member); err != nil {
+		return fmt.Errorf("db.Exec addGroupMember: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repo) RemoveGroupMember(ctx context.Context, owner, member string) error {
+	const query = "DELETE FROM group_member WHERE owner=? AND pubkey=?;"
+
+	resp, err := r.db.ExecContext(ctx, query, owner, member)
+	if err != nil {
+		return fmt.Errorf("db.Exec removeGroupMember: %w", err)
+	}
+
+	n, err := resp.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("dbResp.RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return sub.ErrGroupMemberNotFound
+	}
+
+	return nil
+}
+
+func (r *Repo) GetGroupMembers(ctx context.Context, owner string) ([]sub.GroupMember, error) {
+	const query = "SELECT owner, pubkey, created_at FROM group_member WHERE owner=? ORDER BY created_at ASC, pubkey ASC;"
+
+	var members []sub.GroupMember
+	if err := r.db.SelectContext(ctx, &members, query, owner); err != nil {
+		return nil, fmt.Errorf("db.Select groupMembers: %w", err)
+	}
+
+	return members, nil
+}
+
+func (r *Repo) SetGroupMembers(ctx context.Context, owner string, members []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.Begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM group_member WHERE owner=?;", owner); err != nil {
+		return fmt.Errorf("db.Exec delete groupMembers: %w", err)
+	}
+	for _, member := range members {
+		const query = "INSERT INTO group_member (owner, pubkey) VALUES (?, ?) ON CONFLICT DO NOTHING;"
+		if _, err := tx.ExecContext(ctx, query, owner, member); err != nil {
+			return fmt.Errorf("db.Exec insert groupMember: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("db.Commit: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repo) GetGroupOwners(ctx context.Context, member string) ([]string, error) {
+	const query = "SELECT owner FROM group_member WHERE pubkey=? ORDER BY created_at ASC;"
+
+	var owners []string
+	if err := r.db.SelectContext(ctx, &owners, query, member); err != nil {
+		return nil, fmt.Errorf("db.Select groupOwners: %w", err)
+	}
+
+	return owners, nil
+}
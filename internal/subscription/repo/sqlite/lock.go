@@ -0,0 +1,23 @@
+package sqlite
+
+import (
+	"context"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+)
+
+// LeaderLock returns a lock that is always held. A SQLite database belongs
+// to a single process, so there are no other replicas to elect between.
+func (r *Repo) LeaderLock(key int64) sub.LeaderLock {
+	return leaderLock{}
+}
+
+type leaderLock struct{}
+
+func (leaderLock) TryAcquire(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (leaderLock) Release(ctx context.Context) error {
+	return nil
+}
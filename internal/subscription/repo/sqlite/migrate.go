@@ -0,0 +1,49 @@
+package sqlite
+
+import (
+	"context"
+	"embed"
+
+	"github.com/stemstr/storage/internal/subscription/repo/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// Migrations lists the schema migrations in version order.
+func Migrations() ([]migrate.Migration, error) {
+	return migrate.Parse(migrationFS, "migrations")
+}
+
+// MigrateUp applies every migration not yet applied, returning those it
+// applied.
+func (r *Repo) MigrateUp(ctx context.Context) ([]migrate.Migration, error) {
+	m, err := r.migrator()
+	if err != nil {
+		return nil, err
+	}
+	return m.Up(ctx)
+}
+
+// MigrateDown reverts the most recently applied migration, returning it.
+func (r *Repo) MigrateDown(ctx context.Context) (*migrate.Migration, error) {
+	m, err := r.migrator()
+	if err != nil {
+		return nil, err
+	}
+	return m.Down(ctx)
+}
+
+// MigrationStatus lists every known migration in version order.
+func (r *Repo) MigrationStatus(ctx context.Context) ([]migrate.Status, error) {
+	m, err := r.migrator()
+	if err != nil {
+		return nil, err
+	}
+	return m.Status(ctx)
+}
+
+// migrator needs no lock as the single connection serializes migrations.
+func (r *Repo) migrator() (*migrate.Migrator, error) {
+	return migrate.New(r.db, migrationFS, "migrations", nil)
+}
@@ -0,0 +1,130 @@
+-- pg's 0001_init for SQLite. JSON columns are BLOBs so they scan back into
+-- json.RawMessage.
+
+CREATE TABLE subscription (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	pubkey TEXT NOT NULL,
+	days INTEGER NOT NULL,
+	sats INTEGER NOT NULL,
+	currency TEXT NOT NULL DEFAULT '',
+	fiat_price REAL NOT NULL DEFAULT 0,
+	exchange_rate REAL NOT NULL DEFAULT 0,
+	promo_code TEXT NOT NULL DEFAULT '',
+	gifted_by TEXT NOT NULL DEFAULT '',
+	invoice_id TEXT NOT NULL,
+	provider TEXT NOT NULL,
+	status TEXT NOT NULL,
+	lightning_invoice TEXT NOT NULL,
+	invoice_expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	starts_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP
+);
+
+CREATE INDEX pubkeyidx ON subscription(pubkey);
+CREATE INDEX provideridx ON subscription(provider);
+CREATE INDEX statusidx ON subscription(status);
+
+CREATE TABLE subscription_status_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	subscription_id INTEGER NOT NULL REFERENCES subscription(id),
+	from_status TEXT NOT NULL,
+	to_status TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX statushistorysubidx ON subscription_status_history(subscription_id);
+
+CREATE TABLE processed_webhook (
+	provider TEXT NOT NULL,
+	webhook_id TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	PRIMARY KEY (provider, webhook_id)
+);
+
+CREATE TABLE ban (
+	pubkey TEXT PRIMARY KEY,
+	reason TEXT NOT NULL DEFAULT '',
+	hide_samples BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE TABLE sample (
+	sum TEXT PRIMARY KEY,
+	pubkey TEXT NOT NULL,
+	mimetype TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX samplepubkeyidx ON sample(pubkey);
+
+CREATE TABLE audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	actor TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target TEXT NOT NULL,
+	before BLOB NOT NULL DEFAULT (CAST('null' AS BLOB)),
+	after BLOB NOT NULL DEFAULT (CAST('null' AS BLOB)),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE TABLE zap (
+	invoice_id TEXT PRIMARY KEY,
+	subscription_id INTEGER NOT NULL REFERENCES subscription(id),
+	request TEXT NOT NULL,
+	receipt_sent_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX zapunsentidx ON zap(created_at) WHERE receipt_sent_at IS NULL;
+
+CREATE TABLE promo_code (
+	code TEXT PRIMARY KEY,
+	percent_off INTEGER NOT NULL DEFAULT 0,
+	sats_off INTEGER NOT NULL DEFAULT 0,
+	free_days INTEGER NOT NULL DEFAULT 0,
+	max_redemptions INTEGER NOT NULL DEFAULT 0,
+	redemptions INTEGER NOT NULL DEFAULT 0,
+	once_per_pubkey BOOLEAN NOT NULL DEFAULT FALSE,
+	expires_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE TABLE promo_redemption (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	code TEXT NOT NULL REFERENCES promo_code(code),
+	pubkey TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX promoredemptionidx ON promo_redemption(code, pubkey);
+
+CREATE TABLE group_member (
+	owner TEXT NOT NULL,
+	pubkey TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	PRIMARY KEY (owner, pubkey)
+);
+
+CREATE INDEX groupmemberpubkeyidx ON group_member(pubkey);
+
+CREATE TABLE upload (
+	invoice_id TEXT PRIMARY KEY,
+	provider TEXT NOT NULL,
+	pubkey TEXT NOT NULL,
+	sum TEXT NOT NULL,
+	mimetype TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	duration_seconds REAL NOT NULL,
+	sats INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	lightning_invoice TEXT NOT NULL,
+	invoice_expires_at TIMESTAMP NOT NULL,
+	download_hash TEXT NOT NULL DEFAULT '',
+	waveform BLOB NOT NULL DEFAULT (CAST('null' AS BLOB)),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP
+);
+
+CREATE INDEX uploadstatusidx ON upload(status);
@@ -0,0 +1,2 @@
+CREATE INDEX pubkeyidx ON subscription(pubkey);
+DROP INDEX subscriptionpubkeyexpiresidx;
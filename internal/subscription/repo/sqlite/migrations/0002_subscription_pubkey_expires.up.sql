@@ -0,0 +1,4 @@
+-- pg's 0002_subscription_pubkey_expires for SQLite.
+
+CREATE INDEX subscriptionpubkeyexpiresidx ON subscription(pubkey, expires_at);
+DROP INDEX pubkeyidx;
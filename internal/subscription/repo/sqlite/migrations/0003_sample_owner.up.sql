@@ -0,0 +1,21 @@
+-- pg's 0003_sample_owner for SQLite. The first backfill needs a WHERE clause
+-- for SQLite to parse ON CONFLICT after INSERT ... SELECT.
+
+CREATE TABLE sample_owner (
+	sum TEXT NOT NULL,
+	pubkey TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	PRIMARY KEY (sum, pubkey)
+);
+
+CREATE INDEX sampleownerpubkeyidx ON sample_owner(pubkey);
+
+INSERT INTO sample_owner (sum, pubkey, created_at)
+SELECT sum, pubkey, created_at FROM sample WHERE true
+ON CONFLICT DO NOTHING;
+
+INSERT INTO sample_owner (sum, pubkey, created_at)
+SELECT upload.sum, upload.pubkey, upload.created_at FROM upload
+JOIN sample ON sample.sum = upload.sum
+WHERE upload.status = 'processed'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/stemstr/storage/internal/service"
+)
+
+func (r *Repo) CreateSample(ctx context.Context, s service.Sample) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.Begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The first uploader of a given file is its sample's pubkey, but everyone
+	// who uploads it owns it.
+	const query = `INSERT INTO sample (sum, pubkey, mimetype) VALUES (?, ?, ?)
+ON CONFLICT (sum) DO NOTHING;`
+	if _, err := tx.ExecContext(ctx, query, s.Sum, s.Pubkey, s.Mimetype); err != nil {
+		return fmt.Errorf("db.Exec createSample: %w", err)
+	}
+
+	const ownerQuery = "INSERT INTO sample_owner (sum, pubkey) VALUES (?, ?) ON CONFLICT DO NOTHING;"
+	if _, err := tx.ExecContext(ctx, ownerQuery, s.Sum, s.Pubkey); err != nil {
+		return fmt.Errorf("db.Exec insert sampleOwner: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("db.Commit: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repo) GetSample(ctx context.Context, sum string) (*service.Sample, error) {
+	const query = "SELECT sum, pubkey, mimetype, created_at FROM sample WHERE sum=?;"
+
+	var s service.Sample
+	if err := r.db.GetContext(ctx, &s, query, sum); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrNotFound
+		}
+		return nil, fmt.Errorf("db.Get sample: %w", err)
+	}
+
+	return &s, nil
+}
+
+func (r *Repo) GetSampleOwners(ctx context.Context, sum string) ([]string, error) {
+	const query = "SELECT pubkey FROM sample_owner WHERE sum=? ORDER BY created_at ASC, pubkey ASC;"
+
+	var owners []string
+	if err := r.db.SelectContext(ctx, &owners, query, sum); err != nil {
+		return nil, fmt.Errorf("db.Select sampleOwners: %w", err)
+	}
+
+	return owners, nil
+}
+
+func (r *Repo) DeleteSample(ctx context.Context, sum string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.Begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM sample_owner WHERE sum=?;", sum); err != nil {
+		return fmt.Errorf("db.Exec delete sampleOwners: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM sample WHERE sum=?;", sum); err != nil {
+		return fmt.Errorf("db.Exec delete sample: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("db.Commit: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,297 @@
+// Package sqlite stores subscriptions and samples in a SQLite database for
+// single node deployments and local development. It mirrors pg, with its
+// own migrations of the same versions.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+
+	sub "github.com/stemstr/storage/internal/subscription"
+)
+
+// New opens the database file at path and brings its schema up to date.
+func New(path string) (*Repo, error) {
+	r, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.MigrateUp(context.Background()); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("MigrateUp: %w", err)
+	}
+
+	return r, nil
+}
+
+// Open opens the database file at path, or an in-memory database for
+// ":memory:", without migrating it.
+func Open(path string) (*Repo, error) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	db, err := sqlx.Connect("sqlite3", path+sep+"_foreign_keys=on&_txlock=immediate&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("sqlx.Connect: %w", err)
+	}
+
+	// SQLite serializes writers anyway, and a single connection keeps an
+	// in-memory database alive and shared.
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+
+	return &Repo{
+		db: db,
+	}, nil
+}
+
+type Repo struct {
+	db *sqlx.DB
+}
+
+// subscriptionColumns are selected rather than * so queries keep working
+// while a migration adds a column.
+const subscriptionColumns = `id, pubkey, days, sats, currency, fiat_price, exchange_rate, promo_code, gifted_by,
+invoice_id, provider, status, lightning_invoice, invoice_expires_at, created_at, starts_at, expires_at, updated_at`
+
+func (r *Repo) Close() error {
+	return r.db.Close()
+}
+
+func (r *Repo) CreateSubscription(ctx context.Context, s sub.Subscription) (*sub.Subscription, error) {
+	const query = `INSERT INTO subscription (pubkey, days, sats, currency, fiat_price, exchange_rate, promo_code, gifted_by, invoice_id, provider, status, lightning_invoice, invoice_expires_at, starts_at, expires_at)
+VALUES (:pubkey, :days, :sats, :currency, :fiat_price, :exchange_rate, :promo_code, :gifted_by, :invoice_id, :provider, :status, :lightning_invoice, :invoice_expires_at, :starts_at, :expires_at);`
+
+	resp, err := r.db.NamedExecContext(ctx, query, s)
+	if err != nil {
+		return nil, fmt.Errorf("db.Exec createSub: %w", err)
+	}
+	id, err := resp.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("dbResp.LastInsertId: %w", err)
+	}
+
+	return r.GetSubscription(ctx, id)
+}
+
+func (r *Repo) GetActiveSubscriptions(ctx context.Context, pubkey string) ([]sub.Subscription, error) {
+	// Current periods and those queued to start later. Callers use
+	// Subscription.ActiveAt to tell them apart.
+	const query = "SELECT " + subscriptionColumns + ` FROM subscription
+WHERE pubkey=? AND expires_at>? AND status IN (?, ?)
+ORDER BY starts_at ASC, created_at DESC;`
+
+	var subs []sub.Subscription
+	if err := r.db.SelectContext(ctx, &subs, query, pubkey, time.Now(), sub.StatusPaid, sub.StatusPending); err != nil {
+		return nil, fmt.Errorf("db.Select active subs: %w", err)
+	}
+
+	return subs, nil
+}
+
+func (r *Repo) GetSubscriptionHistory(ctx context.Context, pubkey string, limit, offset int) ([]sub.Subscription, error) {
+	const query = "SELECT " + subscriptionColumns + ` FROM subscription
+WHERE pubkey=? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?;`
+
+	var subs []sub.Subscription
+	if err := r.db.SelectContext(ctx, &subs, query, pubkey, limit, offset); err != nil {
+		return nil, fmt.Errorf("db.Select sub history: %w", err)
+	}
+
+	return subs, nil
+}
+
+func (r *Repo) UpdateStatus(ctx context.Context, id int64, from, to sub.SubscriptionStatus) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.Begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	const updateQuery = `UPDATE subscription SET status=?, updated_at=CURRENT_TIMESTAMP WHERE id=? AND status=?`
+	resp, err := tx.ExecContext(ctx, updateQuery, to, id, from)
+	if err != nil {
+		return fmt.Errorf("db.Exec update sub: %w", err)
+	}
+
+	n, err := resp.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("dbResp.RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return sub.ErrStatusConflict
+	}
+
+	const historyQuery = `INSERT INTO subscription_status_history (subscription_id, from_status, to_status) VALUES (?, ?, ?)`
+	if _, err := tx.ExecContext(ctx, historyQuery, id, from, to); err != nil {
+		return fmt.Errorf("db.Exec insert status history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("db.Commit: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repo) MarkPaid(ctx context.Context, id int64, from sub.SubscriptionStatus) (time.Time, time.Time, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("db.Begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	var s sub.Subscription
+	if err := tx.GetContext(ctx, &s, "SELECT pubkey, days FROM subscription WHERE id=?;", id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, time.Time{}, sub.ErrStatusConflict
+		}
+		return time.Time{}, time.Time{}, fmt.Errorf("db.Get sub: %w", err)
+	}
+
+	// Transactions are immediate and there's a single connection, so
+	// concurrent payments for pubkey already see the periods paid before
+	// them.
+
+	// The period follows pubkey's last paid one
+	var (
+		now      = time.Now()
+		expiries []time.Time
+	)
+	const expiriesQuery = "SELECT expires_at FROM subscription WHERE pubkey=? AND status=? AND expires_at>?;"
+	if err := tx.SelectContext(ctx, &expiries, expiriesQuery, s.Pubkey, sub.StatusPaid, now); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("db.Select paid expiries: %w", err)
+	}
+	start := now
+	for _, expiresAt := range expiries {
+		if expiresAt.After(start) {
+			start = expiresAt
+		}
+	}
+	expires := start.Add(time.Hour * 24 * time.Duration(s.Days))
+
+	const updateQuery = `UPDATE subscription SET status=?, starts_at=?, expires_at=?, updated_at=CURRENT_TIMESTAMP WHERE id=? AND status=?`
+	resp, err := tx.ExecContext(ctx, updateQuery, sub.StatusPaid, start, expires, id, from)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("db.Exec update sub: %w", err)
+	}
+
+	n, err := resp.RowsAffected()
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("dbResp.RowsAffected: %w", err)
+	}
+	if n == 0 {
+		return time.Time{}, time.Time{}, sub.ErrStatusConflict
+	}
+
+	const historyQuery = `INSERT INTO subscription_status_history (subscription_id, from_status, to_status) VALUES (?, ?, ?)`
+	if _, err := tx.ExecContext(ctx, historyQuery, id, from, sub.StatusPaid); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("db.Exec insert status history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("db.Commit: %w", err)
+	}
+
+	return start, expires, nil
+}
+
+func (r *Repo) GetStatusHistory(ctx context.Context, id int64) ([]sub.StatusChange, error) {
+	const query = "SELECT id, subscription_id, from_status, to_status, created_at FROM subscription_status_history WHERE subscription_id=? ORDER BY id ASC;"
+
+	var changes []sub.StatusChange
+	if err := r.db.SelectContext(ctx, &changes, query, id); err != nil {
+		return nil, fmt.Errorf("db.Select status history: %w", err)
+	}
+
+	return changes, nil
+}
+
+func (r *Repo) GetPendingSubscriptions(ctx context.Context) ([]sub.Subscription, error) {
+	const query = "SELECT " + subscriptionColumns + " FROM subscription WHERE status=? ORDER BY invoice_expires_at ASC;"
+
+	var subs []sub.Subscription
+	if err := r.db.SelectContext(ctx, &subs, query, sub.StatusPending); err != nil {
+		return nil, fmt.Errorf("db.Select pending subs: %w", err)
+	}
+
+	return subs, nil
+}
+
+func (r *Repo) GetSubscriptionByInvoiceID(ctx context.Context, invoiceID string) (*sub.Subscription, error) {
+	const query = "SELECT " + subscriptionColumns + " FROM subscription WHERE invoice_id=?;"
+
+	if invoiceID == "" {
+		return nil, sub.ErrSubscriptionNotFound
+	}
+
+	var subs []sub.Subscription
+	if err := r.db.SelectContext(ctx, &subs, query, invoiceID); err != nil {
+		return nil, fmt.Errorf("db.Select sub by invoice: %w", err)
+	}
+
+	switch {
+	case len(subs) == 0:
+		return nil, sub.ErrSubscriptionNotFound
+	case len(subs) == 1:
+		return &subs[0], nil
+	default:
+		return nil, fmt.Errorf("expected one invoice, found multiple")
+	}
+}
+
+func (r *Repo) GetSubscription(ctx context.Context, id int64) (*sub.Subscription, error) {
+	const query = "SELECT " + subscriptionColumns + " FROM subscription WHERE id=?;"
+
+	var s sub.Subscription
+	if err := r.db.GetContext(ctx, &s, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sub.ErrSubscriptionNotFound
+		}
+		return nil, fmt.Errorf("db.Get sub: %w", err)
+	}
+
+	return &s, nil
+}
+
+func (r *Repo) SearchSubscriptions(ctx context.Context, filter sub.SearchFilter) ([]sub.Subscription, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if filter.Pubkey != "" {
+		args = append(args, filter.Pubkey)
+		where = append(where, "pubkey=?")
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where = append(where, "status=?")
+	}
+	if filter.Provider != "" {
+		args = append(args, filter.Provider)
+		where = append(where, "provider=?")
+	}
+
+	query := "SELECT " + subscriptionColumns + " FROM subscription"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += " ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?;"
+
+	var subs []sub.Subscription
+	if err := r.db.SelectContext(ctx, &subs, query, args...); err != nil {
+		return nil, fmt.Errorf("db.Select search subs: %w", err)
+	}
+
+	return subs, nil
+}
@@ -0,0 +1,28 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+)
+
+func (r *Repo) WebhookProcessed(ctx context.Context, provider, webhookID string) (bool, error) {
+	const query = "SELECT EXISTS(SELECT 1 FROM processed_webhook WHERE provider=? AND webhook_id=?);"
+
+	var exists bool
+	if err := r.db.GetContext(ctx, &exists, query, provider, webhookID); err != nil {
+		return false, fmt.Errorf("db.Get webhook processed: %w", err)
+	}
+
+	return exists, nil
+}
+
+func (r *Repo) RecordWebhook(ctx context.Context, provider, webhookID string) error {
+	const query = `INSERT INTO processed_webhook (provider, webhook_id) VALUES (?, ?)
+ON CONFLICT (provider, webhook_id) DO NOTHING;`
+
+	if _, err := r.db.ExecContext(ctx, query, provider, webhookID); err != nil {
+		return fmt.Errorf("db.Exec record webhook: %w", err)
+	}
+
+	return nil
+}
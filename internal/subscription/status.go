@@ -0,0 +1,163 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+type SubscriptionStatus string
+
+const (
+	// StatusPending subscriptions are waiting on their invoice to be paid.
+	StatusPending SubscriptionStatus = "pending"
+	// StatusPaid subscriptions grant access for their period.
+	StatusPaid SubscriptionStatus = "paid"
+	// StatusInvoiceExpired subscriptions were never paid before their
+	// invoice expired.
+	StatusInvoiceExpired SubscriptionStatus = "invoice_expired"
+	// StatusCancelled subscriptions were abandoned before payment.
+	StatusCancelled SubscriptionStatus = "cancelled"
+	// StatusRefunded subscriptions were paid and later refunded.
+	StatusRefunded SubscriptionStatus = "refunded"
+)
+
+// transitions lists the statuses each status may move to.
+var transitions = map[SubscriptionStatus][]SubscriptionStatus{
+	StatusPending: {StatusPaid, StatusInvoiceExpired, StatusCancelled},
+	// A payment can land after we've given up on the invoice, e.g. a
+	// delayed webhook. Payment evidence wins.
+	StatusInvoiceExpired: {StatusPaid},
+	StatusPaid:           {StatusRefunded},
+}
+
+// CanTransition reports whether a subscription may move from one status
+// to another.
+func CanTransition(from, to SubscriptionStatus) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether status is a known status.
+func (s SubscriptionStatus) Valid() bool {
+	switch s {
+	case StatusPending, StatusPaid, StatusInvoiceExpired, StatusCancelled, StatusRefunded:
+		return true
+	default:
+		return false
+	}
+}
+
+// StatusChange is a recorded status transition.
+type StatusChange struct {
+	ID             int64              `json:"id" db:"id"`
+	SubscriptionID int64              `json:"subscription_id" db:"subscription_id"`
+	FromStatus     SubscriptionStatus `json:"from_status" db:"from_status"`
+	ToStatus       SubscriptionStatus `json:"to_status" db:"to_status"`
+	CreatedAt      time.Time          `json:"created_at" db:"created_at"`
+}
+
+// transition moves sub to status. Moving to the current status is a no-op.
+//
+// A subscription's period is only an estimate until it's paid: renewals can
+// be paid in any order, or not at all, so the period is fixed on payment to
+// follow the last paid one, atomically with the status change.
+func (s *SubscriptionService) transition(ctx context.Context, sub *Subscription, to SubscriptionStatus) error {
+	if sub.Status == to {
+		return nil
+	}
+	if !CanTransition(sub.Status, to) {
+		return fmt.Errorf("%w: %v -> %v", ErrInvalidTransition, sub.Status, to)
+	}
+
+	if to == StatusPaid {
+		start, expires, err := s.repo.MarkPaid(ctx, sub.ID, sub.Status)
+		if err != nil {
+			return fmt.Errorf("repo.MarkPaid: %w", err)
+		}
+		sub.StartsAt = start
+		sub.ExpiresAt = expires
+	} else if err := s.repo.UpdateStatus(ctx, sub.ID, sub.Status, to); err != nil {
+		return fmt.Errorf("repo.UpdateStatus: %w", err)
+	}
+	sub.Status = to
+
+	switch to {
+	case StatusPaid:
+		s.notifyGift(*sub)
+	case StatusInvoiceExpired, StatusCancelled:
+		// The code wasn't used after all. If the invoice is paid late
+		// anyway the code is over-redeemed by one, which is preferable to
+		// refusing the payment.
+		if sub.PromoCode != "" {
+			if err := s.repo.ReleasePromoCode(ctx, sub.PromoCode, sub.Pubkey); err != nil {
+				log.Printf("error: ReleasePromoCode: sub=%v err=%v", sub.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Transition moves the subscription with id to status.
+func (s *SubscriptionService) Transition(ctx context.Context, id int64, to SubscriptionStatus) (*Subscription, error) {
+	sub, err := s.repo.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.transition(ctx, sub, to); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetSubscription(ctx, id)
+}
+
+// Cancel abandons a pending subscription.
+func (s *SubscriptionService) Cancel(ctx context.Context, id int64) (*Subscription, error) {
+	return s.Transition(ctx, id, StatusCancelled)
+}
+
+// GetStatusHistory lists the status transitions of a subscription, oldest
+// first.
+func (s *SubscriptionService) GetStatusHistory(ctx context.Context, id int64) ([]StatusChange, error) {
+	return s.repo.GetStatusHistory(ctx, id)
+}
+
+// ExpireStaleInvoices marks pending subscriptions whose invoice has expired
+// as invoice_expired so they are no longer polled. It returns the number of
+// subscriptions expired.
+func (s *SubscriptionService) ExpireStaleInvoices(ctx context.Context) (int, error) {
+	subs, err := s.repo.GetPendingSubscriptions(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("repo.GetPendingSubscriptions: %w", err)
+	}
+
+	var (
+		now     = time.Now()
+		expired int
+	)
+	for i := range subs {
+		sub := &subs[i]
+		if sub.InvoiceExpiresAt.After(now) {
+			continue
+		}
+
+		if err := s.transition(ctx, sub, StatusInvoiceExpired); err != nil {
+			if errors.Is(err, ErrStatusConflict) {
+				// Someone else moved it first, e.g. a payment webhook.
+				continue
+			}
+			return expired, err
+		}
+		expired++
+	}
+
+	return expired, nil
+}
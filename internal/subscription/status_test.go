@@ -0,0 +1,110 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanTransition(t *testing.T) {
+	var tests = []struct {
+		from, to SubscriptionStatus
+		expected bool
+	}{
+		{StatusPending, StatusPaid, true},
+		{StatusPending, StatusInvoiceExpired, true},
+		{StatusPending, StatusCancelled, true},
+		{StatusPending, StatusRefunded, false},
+		{StatusInvoiceExpired, StatusPaid, true},
+		{StatusInvoiceExpired, StatusPending, false},
+		{StatusPaid, StatusRefunded, true},
+		{StatusPaid, StatusPending, false},
+		{StatusPaid, StatusCancelled, false},
+		{StatusCancelled, StatusPaid, false},
+		{StatusRefunded, StatusPaid, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			assert.Equal(t, tt.expected, CanTransition(tt.from, tt.to))
+		})
+	}
+}
+
+func TestTransition(t *testing.T) {
+	repo := &mockSubscriptionRepo{
+		GetSubscriptionSub: &Subscription{ID: 1, Status: StatusPaid},
+	}
+	svc, err := New(repo, &mockLNProvider{}, "mock")
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+
+	_, err = svc.Transition(ctx, 1, StatusPending)
+	assert.True(t, errors.Is(err, ErrInvalidTransition))
+	assert.Empty(t, repo.Updated)
+
+	// Same status is a no-op
+	_, err = svc.Transition(ctx, 1, StatusPaid)
+	assert.NoError(t, err)
+	assert.Empty(t, repo.Updated)
+
+	_, err = svc.Transition(ctx, 1, StatusRefunded)
+	assert.NoError(t, err)
+	assert.Equal(t, []StatusChange{{SubscriptionID: 1, FromStatus: StatusPaid, ToStatus: StatusRefunded}}, repo.Updated)
+}
+
+func TestExpireStaleInvoices(t *testing.T) {
+	now := time.Now()
+	repo := &mockSubscriptionRepo{
+		GetPendingSubs: []Subscription{
+			{ID: 1, Status: StatusPending, InvoiceExpiresAt: now.Add(-time.Minute)},
+			{ID: 2, Status: StatusPending, InvoiceExpiresAt: now.Add(time.Minute)},
+		},
+	}
+	svc, err := New(repo, &mockLNProvider{}, "mock")
+	assert.NoError(t, err)
+
+	n, err := svc.ExpireStaleInvoices(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []StatusChange{{SubscriptionID: 1, FromStatus: StatusPending, ToStatus: StatusInvoiceExpired}}, repo.Updated)
+}
+
+func TestGetActiveSubscriptionExpiredInvoice(t *testing.T) {
+	now := time.Now()
+
+	var tests = []struct {
+		name string
+		sub  Subscription
+		ln   *mockLNProvider
+	}{
+		{
+			name: "invoice past expiry is not polled",
+			sub:  Subscription{ID: 1, Status: StatusPending, InvoiceExpiresAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Hour)},
+			ln:   &mockLNProvider{IsInvoicePaidErr: errors.New("should not be called")},
+		},
+		{
+			name: "provider reports expiry",
+			sub:  Subscription{ID: 1, Status: StatusPending, InvoiceExpiresAt: now.Add(time.Minute), ExpiresAt: now.Add(time.Hour)},
+			ln:   &mockLNProvider{IsInvoicePaidErr: ErrInvoiceExpired},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockSubscriptionRepo{
+				GetActiveSubscriptionSubs: []Subscription{tt.sub},
+			}
+			svc, err := New(repo, tt.ln, "mock")
+			assert.NoError(t, err)
+
+			_, err = svc.GetActiveSubscription(context.Background(), "xxx")
+			assert.Equal(t, ErrSubscriptionNotFound, err)
+			assert.Equal(t, []StatusChange{{SubscriptionID: 1, FromStatus: StatusPending, ToStatus: StatusInvoiceExpired}}, repo.Updated)
+		})
+	}
+}
@@ -2,7 +2,9 @@ package subscription
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 )
 
@@ -18,23 +20,103 @@ type SubscriptionService struct {
 	repo           subscriptionRepo
 	ln             LNProvider
 	lnProviderType string
+	rates          RateOracle
+	gifts          GiftNotifier
+}
+
+// RateOracle converts fiat prices to sats.
+type RateOracle interface {
+	// SatsFor converts amount of currency to sats, also returning the
+	// BTC price used.
+	SatsFor(ctx context.Context, amount float64, currency string) (int, float64, error)
+}
+
+// SetRateOracle enables fiat priced subscriptions.
+func (s *SubscriptionService) SetRateOracle(rates RateOracle) {
+	s.rates = rates
 }
 
 type subscriptionRepo interface {
 	CreateSubscription(ctx context.Context, sub Subscription) (*Subscription, error)
+	GetSubscription(ctx context.Context, id int64) (*Subscription, error)
+	GetSubscriptionByInvoiceID(ctx context.Context, invoiceID string) (*Subscription, error)
+	// GetActiveSubscriptions lists pubkey's paid and pending subscriptions
+	// that haven't expired, including those yet to start.
 	GetActiveSubscriptions(ctx context.Context, pubkey string) ([]Subscription, error)
-	UpdateStatus(ctx context.Context, id int64, status SubscriptionStatus) error
-	UpdateStatusByInvoiceID(ctx context.Context, invoiceID string, status SubscriptionStatus) error
+	// GetSubscriptionHistory lists all of pubkey's subscriptions, newest
+	// first.
+	GetSubscriptionHistory(ctx context.Context, pubkey string, limit, offset int) ([]Subscription, error)
+	GetPendingSubscriptions(ctx context.Context) ([]Subscription, error)
+	SearchSubscriptions(ctx context.Context, filter SearchFilter) ([]Subscription, error)
+	// UpdateStatus moves a subscription from one status to another and
+	// records the change. ErrStatusConflict is returned if the
+	// subscription is no longer in the from status.
+	UpdateStatus(ctx context.Context, id int64, from, to SubscriptionStatus) error
+	// MarkPaid is UpdateStatus to StatusPaid that also sets the period the
+	// subscription covers, returned as its start and expiry. In the same
+	// transaction, the period is set to start when pubkey's last paid
+	// period ends, or now, and concurrent payments for pubkey are
+	// serialized so their periods don't overlap.
+	MarkPaid(ctx context.Context, id int64, from SubscriptionStatus) (time.Time, time.Time, error)
+	GetStatusHistory(ctx context.Context, id int64) ([]StatusChange, error)
+	WebhookProcessed(ctx context.Context, provider, webhookID string) (bool, error)
+	RecordWebhook(ctx context.Context, provider, webhookID string) error
+	CreatePromoCode(ctx context.Context, p PromoCode) (*PromoCode, error)
+	// GetPromoCode returns ErrPromoCodeNotFound for unknown codes.
+	GetPromoCode(ctx context.Context, code string) (*PromoCode, error)
+	ListPromoCodes(ctx context.Context) ([]PromoCode, error)
+	// RedeemPromoCode records a use of code by pubkey. ErrPromoCodeExhausted
+	// is returned once MaxRedemptions is reached and ErrPromoCodeRedeemed
+	// if a OncePerPubkey code has already been used by pubkey.
+	RedeemPromoCode(ctx context.Context, code, pubkey string) error
+	// ReleasePromoCode undoes a RedeemPromoCode.
+	ReleasePromoCode(ctx context.Context, code, pubkey string) error
+	// AddGroupMember is a no-op if member is already in owner's group.
+	AddGroupMember(ctx context.Context, owner, member string) error
+	// RemoveGroupMember returns ErrGroupMemberNotFound if member isn't in
+	// owner's group.
+	RemoveGroupMember(ctx context.Context, owner, member string) error
+	GetGroupMembers(ctx context.Context, owner string) ([]GroupMember, error)
+	SetGroupMembers(ctx context.Context, owner string, members []string) error
+	// GetGroupOwners lists the owners of groups member belongs to.
+	GetGroupOwners(ctx context.Context, member string) ([]string, error)
 }
 
 type LNProvider interface {
+	// CreateInvoice creates an invoice for sub. Providers that know when
+	// the invoice expires set Invoice.ExpiresAt.
 	CreateInvoice(ctx context.Context, sub Subscription) (*Invoice, error)
+	// IsInvoicePaid reports whether an invoice has been paid.
+	// ErrInvoiceExpired is returned if it expired unpaid.
 	IsInvoicePaid(ctx context.Context, id string) (bool, error)
 }
 
-// GetActiveSubscription fetches the active subscription for a pubkey.
-// An error is returned if the subscription is not found, unpaid, or expired.
+// DescriptionHashInvoicer is implemented by LNProviders that can create
+// invoices committing to the SHA-256 of a description rather than the
+// description itself, as LNURL-pay requires.
+type DescriptionHashInvoicer interface {
+	CreateInvoiceForDescription(ctx context.Context, sub Subscription, description string) (*Invoice, error)
+}
+
+// defaultInvoiceTTL is how long an invoice is polled for when the
+// LNProvider doesn't report an expiry.
+const defaultInvoiceTTL = time.Hour
+
+// GetActiveSubscription fetches the subscription currently covering a
+// pubkey, either its own or one shared with it by a group owner. Paid
+// periods queued to start in the future are not returned. An error is
+// returned if the subscription is not found, unpaid, or expired.
 func (s *SubscriptionService) GetActiveSubscription(ctx context.Context, pubkey string) (*Subscription, error) {
+	sub, err := s.getOwnActiveSubscription(ctx, pubkey)
+	if !errors.Is(err, ErrSubscriptionNotFound) {
+		return sub, err
+	}
+
+	return s.getGroupSubscription(ctx, pubkey)
+}
+
+// getOwnActiveSubscription is GetActiveSubscription ignoring groups.
+func (s *SubscriptionService) getOwnActiveSubscription(ctx context.Context, pubkey string) (*Subscription, error) {
 	subs, err := s.repo.GetActiveSubscriptions(ctx, pubkey)
 	if err != nil {
 		return nil, fmt.Errorf("repo.GetActiveSubs: %w", err)
@@ -44,48 +126,192 @@ func (s *SubscriptionService) GetActiveSubscription(ctx context.Context, pubkey
 		return nil, ErrSubscriptionNotFound
 	}
 
-	// If any non-expired subscription is paid, return it
+	now := time.Now()
+
+	// If any current subscription is paid, return it
 	for _, sub := range subs {
-		if sub.Status == StatusPaid {
+		if sub.Status == StatusPaid && sub.ActiveAt(now) {
 			return &sub, nil
 		}
 	}
 
-	// Otherwise check each non-expired subscription to see if it's
-	// since been paid.
-	for _, sub := range subs {
-		if sub.Status == StatusUnpaid {
-			paid, err := s.ln.IsInvoicePaid(ctx, sub.InvoiceID)
-			if err != nil {
-				return nil, fmt.Errorf("GetLatestSub.IsInvoicePaid: %w", err)
-			}
-			if !paid {
-				continue
+	// Otherwise check each current subscription with a live invoice to see
+	// if it's since been paid.
+	for i := range subs {
+		sub := &subs[i]
+		if sub.Status != StatusPending || !sub.ActiveAt(now) {
+			continue
+		}
+
+		if !sub.InvoiceExpiresAt.After(now) {
+			if err := s.transition(ctx, sub, StatusInvoiceExpired); err != nil && !errors.Is(err, ErrStatusConflict) {
+				return nil, fmt.Errorf("expire invoice: %w", err)
 			}
+			continue
+		}
 
-			// It's been paid!
-			sub.Status = StatusPaid
-			if err := s.repo.UpdateStatus(ctx, sub.ID, StatusPaid); err != nil {
-				return nil, fmt.Errorf("UpdateSub status: %w", err)
+		paid, err := s.ln.IsInvoicePaid(ctx, sub.InvoiceID)
+		if err != nil {
+			if errors.Is(err, ErrInvoiceExpired) {
+				if err := s.transition(ctx, sub, StatusInvoiceExpired); err != nil && !errors.Is(err, ErrStatusConflict) {
+					return nil, fmt.Errorf("expire invoice: %w", err)
+				}
+				continue
 			}
+			return nil, fmt.Errorf("GetLatestSub.IsInvoicePaid: %w", err)
+		}
+		if !paid {
+			continue
+		}
 
-			return &sub, nil
+		// It's been paid!
+		if err := s.transition(ctx, sub, StatusPaid); err != nil {
+			return nil, fmt.Errorf("UpdateSub status: %w", err)
 		}
+
+		return sub, nil
 	}
 
 	return nil, ErrSubscriptionNotFound
 }
 
+// GetSubscriptionPeriods fetches the paid subscription covering pubkey now,
+// if any, along with paid periods queued to start after it.
+func (s *SubscriptionService) GetSubscriptionPeriods(ctx context.Context, pubkey string) (*Subscription, []Subscription, error) {
+	current, err := s.GetActiveSubscription(ctx, pubkey)
+	if err != nil && !errors.Is(err, ErrSubscriptionNotFound) {
+		return nil, nil, err
+	}
+
+	subs, err := s.repo.GetActiveSubscriptions(ctx, pubkey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("repo.GetActiveSubs: %w", err)
+	}
+
+	now := time.Now()
+	var queued []Subscription
+	for _, sub := range subs {
+		if sub.Status == StatusPaid && sub.StartsAt.After(now) {
+			queued = append(queued, sub)
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		return queued[i].StartsAt.Before(queued[j].StartsAt)
+	})
+
+	return current, queued, nil
+}
+
+// nextPeriodStart is when a new subscription for pubkey should start:
+// immediately, or when the last paid period ends if pubkey is already
+// subscribed.
+func (s *SubscriptionService) nextPeriodStart(ctx context.Context, pubkey string, now time.Time) (time.Time, error) {
+	subs, err := s.repo.GetActiveSubscriptions(ctx, pubkey)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("repo.GetActiveSubs: %w", err)
+	}
+
+	start := now
+	for _, sub := range subs {
+		if sub.Status == StatusPaid && sub.ExpiresAt.After(start) {
+			start = sub.ExpiresAt
+		}
+	}
+
+	return start, nil
+}
+
+// CreateSubscription requests an invoice for a new subscription period. If
+// pubkey already has paid time remaining, the new period is queued to start
+// when it ends.
 func (s *SubscriptionService) CreateSubscription(ctx context.Context, sub Subscription) (*Subscription, error) {
-	invoice, err := s.ln.CreateInvoice(ctx, sub)
+	if err := s.quote(ctx, &sub); err != nil {
+		return nil, err
+	}
+
+	return s.createSubscription(ctx, sub, s.ln.CreateInvoice)
+}
+
+// SupportsDescriptionHash reports whether CreateSubscriptionWithDescription
+// can be used with the configured LNProvider.
+func (s *SubscriptionService) SupportsDescriptionHash() bool {
+	_, ok := s.ln.(DescriptionHashInvoicer)
+	return ok
+}
+
+// CreateSubscriptionWithDescription is CreateSubscription with an invoice
+// committing to the hash of description. ErrDescriptionHashUnsupported is
+// returned if the LNProvider can't create such invoices.
+func (s *SubscriptionService) CreateSubscriptionWithDescription(ctx context.Context, sub Subscription, description string) (*Subscription, error) {
+	ln, ok := s.ln.(DescriptionHashInvoicer)
+	if !ok {
+		return nil, ErrDescriptionHashUnsupported
+	}
+	if err := s.quote(ctx, &sub); err != nil {
+		return nil, err
+	}
+
+	return s.createSubscription(ctx, sub, func(ctx context.Context, sub Subscription) (*Invoice, error) {
+		return ln.CreateInvoiceForDescription(ctx, sub, description)
+	})
+}
+
+// PriceInSats is what sub costs now. Fiat priced subscriptions are
+// converted at the current exchange rate, which is also returned.
+func (s *SubscriptionService) PriceInSats(ctx context.Context, sub Subscription) (int, float64, error) {
+	if sub.Currency == "" {
+		return sub.Sats, 0, nil
+	}
+	if s.rates == nil {
+		return 0, 0, ErrNoRateOracle
+	}
+
+	sats, rate, err := s.rates.SatsFor(ctx, sub.FiatPrice, sub.Currency)
+	if err != nil {
+		return 0, 0, fmt.Errorf("SatsFor: %w", err)
+	}
+
+	return sats, rate, nil
+}
+
+// quote sets the sats price of sub, converting fiat prices at the current
+// exchange rate so they're fixed when the invoice is created.
+func (s *SubscriptionService) quote(ctx context.Context, sub *Subscription) error {
+	sats, rate, err := s.PriceInSats(ctx, *sub)
+	if err != nil {
+		return err
+	}
+	sub.Sats = sats
+	sub.ExchangeRate = rate
+
+	return nil
+}
+
+func (s *SubscriptionService) createSubscription(ctx context.Context, sub Subscription, createInvoice func(context.Context, Subscription) (*Invoice, error)) (*Subscription, error) {
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = time.Now()
+	}
+
+	start, err := s.nextPeriodStart(ctx, sub.Pubkey, sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	sub.StartsAt = start
+	sub.ExpiresAt = start.Add(time.Hour * 24 * time.Duration(sub.Days))
+
+	invoice, err := createInvoice(ctx, sub)
 	if err != nil {
 		return nil, fmt.Errorf("CreateInvoice: %w", err)
 	}
 
 	sub.Provider = s.lnProviderType
 	sub.InvoiceID = invoice.ID
-	sub.Status = StatusUnpaid
+	sub.Status = StatusPending
 	sub.LightningInvoice = invoice.LightningInvoice
+	sub.InvoiceExpiresAt = invoice.ExpiresAt
+	if sub.InvoiceExpiresAt.IsZero() {
+		sub.InvoiceExpiresAt = time.Now().Add(defaultInvoiceTTL)
+	}
 
 	newSub, err := s.repo.CreateSubscription(ctx, sub)
 	if err != nil {
@@ -95,32 +321,133 @@ func (s *SubscriptionService) CreateSubscription(ctx context.Context, sub Subscr
 	return newSub, nil
 }
 
+// GrantSubscription creates a paid subscription for pubkey without
+// requesting payment.
+func (s *SubscriptionService) GrantSubscription(ctx context.Context, pubkey string, days int) (*Subscription, error) {
+	if days <= 0 {
+		return nil, fmt.Errorf("days must be positive")
+	}
+
+	now := time.Now()
+	start, err := s.nextPeriodStart(ctx, pubkey, now)
+	if err != nil {
+		return nil, err
+	}
+
+	newSub, err := s.repo.CreateSubscription(ctx, Subscription{
+		Pubkey:    pubkey,
+		Days:      days,
+		Provider:  ProviderGrant,
+		Status:    StatusPaid,
+		CreatedAt: now,
+		StartsAt:  start,
+		ExpiresAt: start.Add(time.Hour * 24 * time.Duration(days)),
+		// Nothing to pay
+		InvoiceExpiresAt: now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("CreateSub: %w", err)
+	}
+
+	return newSub, nil
+}
+
+// GetSubscription fetches a subscription by id.
+func (s *SubscriptionService) GetSubscription(ctx context.Context, id int64) (*Subscription, error) {
+	return s.repo.GetSubscription(ctx, id)
+}
+
+// SearchSubscriptions lists subscriptions matching filter, newest first.
+func (s *SubscriptionService) SearchSubscriptions(ctx context.Context, filter SearchFilter) ([]Subscription, error) {
+	if filter.Limit <= 0 || filter.Limit > maxSearchLimit {
+		filter.Limit = maxSearchLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	return s.repo.SearchSubscriptions(ctx, filter)
+}
+
+// GetSubscriptionHistory lists every subscription pubkey has bought or been
+// given, newest first, whatever its status.
+func (s *SubscriptionService) GetSubscriptionHistory(ctx context.Context, pubkey string, limit, offset int) ([]Subscription, error) {
+	if limit <= 0 || limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	return s.repo.GetSubscriptionHistory(ctx, pubkey, limit, offset)
+}
+
+// UpdateInvoiceStatus moves the subscription paying invoiceID to status.
 func (s *SubscriptionService) UpdateInvoiceStatus(ctx context.Context, invoiceID string, status SubscriptionStatus) error {
-	return s.repo.UpdateStatusByInvoiceID(ctx, invoiceID, status)
+	sub, err := s.repo.GetSubscriptionByInvoiceID(ctx, invoiceID)
+	if err != nil {
+		return err
+	}
+
+	return s.transition(ctx, sub, status)
 }
 
 type Subscription struct {
-	ID               int64              `json:"id" db:"id"`
-	Pubkey           string             `json:"pubkey" db:"pubkey"`
-	Days             int                `json:"days" db:"days"`
-	Sats             int                `json:"sats" db:"sats"`
+	ID     int64  `json:"id" db:"id"`
+	Pubkey string `json:"pubkey" db:"pubkey"`
+	Days   int    `json:"days" db:"days"`
+	Sats   int    `json:"sats" db:"sats"`
+	// Currency and FiatPrice are set for fiat priced subscriptions, and
+	// ExchangeRate is the BTC price in Currency that Sats was quoted at.
+	Currency     string  `json:"currency,omitempty" db:"currency"`
+	FiatPrice    float64 `json:"fiat_price,omitempty" db:"fiat_price"`
+	ExchangeRate float64 `json:"exchange_rate,omitempty" db:"exchange_rate"`
+	PromoCode    string  `json:"promo_code,omitempty" db:"promo_code"`
+	// GiftedBy is the pubkey that paid for someone else's subscription.
+	GiftedBy         string             `json:"gifted_by,omitempty" db:"gifted_by"`
 	InvoiceID        string             `json:"invoice_id" db:"invoice_id"`
 	Provider         string             `json:"provider" db:"provider"`
 	Status           SubscriptionStatus `json:"status" db:"status"`
 	LightningInvoice string             `json:"lightning_invoice" db:"lightning_invoice"`
+	InvoiceExpiresAt time.Time          `json:"invoice_expires_at" db:"invoice_expires_at"`
 	CreatedAt        time.Time          `json:"created_at" db:"created_at"`
+	StartsAt         time.Time          `json:"starts_at" db:"starts_at"`
 	ExpiresAt        time.Time          `json:"expires_at" db:"expires_at"`
 	UpdatedAt        *time.Time         `json:"updated_at" db:"updated_at"`
+
+	// Memo overrides the default invoice description. It isn't stored.
+	Memo string `json:"-" db:"-"`
 }
 
-type SubscriptionStatus string
+// InvoiceMemo describes the subscription on its invoice.
+func (s Subscription) InvoiceMemo() string {
+	if s.Memo != "" {
+		return s.Memo
+	}
+	return fmt.Sprintf("Stemstr %d day subscription", s.Days)
+}
 
-const (
-	StatusPaid   SubscriptionStatus = "paid"
-	StatusUnpaid SubscriptionStatus = "unpaid"
-)
+// ActiveAt reports whether t falls within the subscription period.
+func (s Subscription) ActiveAt(t time.Time) bool {
+	return !s.StartsAt.After(t) && s.ExpiresAt.After(t)
+}
+
+// ProviderGrant is the provider of subscriptions granted by an admin.
+const ProviderGrant = "grant"
+
+const maxSearchLimit = 100
+
+// SearchFilter narrows SearchSubscriptions. Empty fields match everything.
+type SearchFilter struct {
+	Pubkey   string
+	Status   SubscriptionStatus
+	Provider string
+	Limit    int
+	Offset   int
+}
 
 type Invoice struct {
-	ID               string `json:"id"`
-	LightningInvoice string `json:"lightning_invoice"`
+	ID               string    `json:"id"`
+	LightningInvoice string    `json:"lightning_invoice"`
+	ExpiresAt        time.Time `json:"expires_at"`
 }
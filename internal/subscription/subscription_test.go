@@ -2,6 +2,7 @@ package subscription
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -56,8 +57,9 @@ func TestGetActiveSubscriptions(t *testing.T) {
 						Days:             30,
 						Sats:             5000,
 						InvoiceID:        "uuid",
-						Status:           StatusUnpaid,
+						Status:           StatusPending,
 						LightningInvoice: "lnbc123",
+						InvoiceExpiresAt: time.Now().Add(time.Minute),
 						CreatedAt:        time.Now(),
 						ExpiresAt:        time.Now().Add(time.Hour * 24),
 					},
@@ -73,7 +75,7 @@ func TestGetActiveSubscriptions(t *testing.T) {
 				Days:             30,
 				Sats:             5000,
 				InvoiceID:        "uuid",
-				Status:           StatusUnpaid,
+				Status:           StatusPending,
 				LightningInvoice: "lnbc123",
 				CreatedAt:        time.Now(),
 				ExpiresAt:        time.Now().Add(time.Hour * 24),
@@ -90,8 +92,9 @@ func TestGetActiveSubscriptions(t *testing.T) {
 						Days:             30,
 						Sats:             5000,
 						InvoiceID:        "uuid",
-						Status:           StatusUnpaid,
+						Status:           StatusPending,
 						LightningInvoice: "lnbc123",
+						InvoiceExpiresAt: time.Now().Add(time.Minute),
 						CreatedAt:        time.Now(),
 						ExpiresAt:        time.Now().Add(time.Hour * 24),
 					},
@@ -151,7 +154,7 @@ func TestCreateSubscription(t *testing.T) {
 					Days:             30,
 					Sats:             5000,
 					InvoiceID:        "lnxxx",
-					Status:           StatusUnpaid,
+					Status:           StatusPending,
 					LightningInvoice: "lnbc123",
 					CreatedAt:        time.Now(),
 					ExpiresAt:        time.Now().Add(time.Hour * 24),
@@ -169,7 +172,7 @@ func TestCreateSubscription(t *testing.T) {
 				Pubkey:    "xxx",
 				Days:      30,
 				Sats:      5000,
-				Status:    StatusUnpaid,
+				Status:    StatusPending,
 				CreatedAt: time.Now(),
 				ExpiresAt: time.Now().Add(time.Hour * 24),
 			},
@@ -196,3 +199,182 @@ func TestCreateSubscription(t *testing.T) {
 		})
 	}
 }
+
+func TestGrantSubscription(t *testing.T) {
+	repo := &mockSubscriptionRepo{
+		CreateSubscriptionSub: &Subscription{
+			ID:       123,
+			Pubkey:   "xxx",
+			Days:     30,
+			Provider: ProviderGrant,
+			Status:   StatusPaid,
+		},
+	}
+	svc, err := New(repo, &mockLNProvider{}, "mock")
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	sub, err := svc.GrantSubscription(ctx, "xxx", 30)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusPaid, sub.Status)
+	assert.Equal(t, ProviderGrant, sub.Provider)
+
+	_, err = svc.GrantSubscription(ctx, "xxx", 0)
+	assert.Error(t, err)
+}
+
+func TestGetActiveSubscriptionQueued(t *testing.T) {
+	now := time.Now()
+	repo := &mockSubscriptionRepo{
+		GetActiveSubscriptionSubs: []Subscription{
+			{
+				ID:        1,
+				Days:      30,
+				Status:    StatusPaid,
+				StartsAt:  now.Add(-time.Hour * 24),
+				ExpiresAt: now.Add(time.Hour * 24),
+			},
+			{
+				ID:        2,
+				Days:      30,
+				Status:    StatusPaid,
+				StartsAt:  now.Add(time.Hour * 24),
+				ExpiresAt: now.Add(time.Hour * 24 * 31),
+			},
+		},
+	}
+	svc, err := New(repo, &mockLNProvider{}, "mock")
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	sub, err := svc.GetActiveSubscription(ctx, "xxx")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), sub.ID)
+
+	current, queued, err := svc.GetSubscriptionPeriods(ctx, "xxx")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), current.ID)
+	assert.Len(t, queued, 1)
+	assert.Equal(t, int64(2), queued[0].ID)
+
+	// Only a queued period
+	repo.GetActiveSubscriptionSubs = repo.GetActiveSubscriptionSubs[1:]
+	_, err = svc.GetActiveSubscription(ctx, "xxx")
+	assert.Equal(t, ErrSubscriptionNotFound, err)
+}
+
+func TestCreateSubscriptionRenewal(t *testing.T) {
+	var (
+		now        = time.Now()
+		paidExpiry = now.Add(time.Hour * 24 * 3)
+	)
+
+	var tests = []struct {
+		name     string
+		existing []Subscription
+		start    time.Time
+	}{
+		{
+			name:  "new subscription starts now",
+			start: now,
+		},
+		{
+			name: "unpaid subscription is ignored",
+			existing: []Subscription{
+				{Status: StatusPending, StartsAt: now, ExpiresAt: paidExpiry},
+			},
+			start: now,
+		},
+		{
+			name: "renewal starts when paid time runs out",
+			existing: []Subscription{
+				{Status: StatusPaid, StartsAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)},
+				{Status: StatusPaid, StartsAt: now.Add(time.Hour), ExpiresAt: paidExpiry},
+			},
+			start: paidExpiry,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockSubscriptionRepo{
+				GetActiveSubscriptionSubs: tt.existing,
+				CreateSubscriptionSub:     &Subscription{},
+			}
+			ln := &mockLNProvider{
+				CreateInvoiceInvoice: &Invoice{ID: "lnxxx"},
+			}
+			svc, err := New(repo, ln, "mock")
+			assert.NoError(t, err)
+
+			_, err = svc.CreateSubscription(context.Background(), Subscription{
+				Pubkey:    "xxx",
+				Days:      30,
+				CreatedAt: now,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.start, repo.Created.StartsAt)
+			assert.Equal(t, tt.start.Add(time.Hour*24*30), repo.Created.ExpiresAt)
+		})
+	}
+}
+
+func TestCreateSubscriptionWithDescription(t *testing.T) {
+	invoice := &Invoice{ID: "inv", LightningInvoice: "lnbc"}
+	ctx := context.Background()
+
+	// Unsupported provider
+	svc, err := New(&mockSubscriptionRepo{}, &mockLNProvider{CreateInvoiceInvoice: invoice}, "mock")
+	assert.NoError(t, err)
+	assert.False(t, svc.SupportsDescriptionHash())
+	_, err = svc.CreateSubscriptionWithDescription(ctx, Subscription{Pubkey: "xxx", Days: 30, Sats: 1000}, "zap")
+	assert.ErrorIs(t, err, ErrDescriptionHashUnsupported)
+
+	// Supported provider
+	repo := &mockSubscriptionRepo{CreateSubscriptionSub: &Subscription{ID: 1}}
+	ln := &mockDescriptionLNProvider{mockLNProvider: mockLNProvider{CreateInvoiceInvoice: invoice}}
+	svc, err = New(repo, ln, "mock")
+	assert.NoError(t, err)
+	assert.True(t, svc.SupportsDescriptionHash())
+	_, err = svc.CreateSubscriptionWithDescription(ctx, Subscription{Pubkey: "xxx", Days: 30, Sats: 1000}, "zap")
+	assert.NoError(t, err)
+	assert.Equal(t, "zap", ln.Description)
+	assert.Equal(t, "inv", repo.Created.InvoiceID)
+	assert.Equal(t, StatusPending, repo.Created.Status)
+}
+
+func TestCreateSubscriptionFiat(t *testing.T) {
+	invoice := &Invoice{ID: "inv", LightningInvoice: "lnbc"}
+	ctx := context.Background()
+	sub := Subscription{Pubkey: "xxx", Days: 30, Currency: "USD", FiatPrice: 5}
+
+	// No oracle
+	svc, err := New(&mockSubscriptionRepo{}, &mockLNProvider{CreateInvoiceInvoice: invoice}, "mock")
+	assert.NoError(t, err)
+	_, err = svc.CreateSubscription(ctx, sub)
+	assert.ErrorIs(t, err, ErrNoRateOracle)
+
+	// Rate unavailable
+	errNoRate := errors.New("no rate")
+	svc.SetRateOracle(&mockRateOracle{Err: errNoRate})
+	_, err = svc.CreateSubscription(ctx, sub)
+	assert.ErrorIs(t, err, errNoRate)
+
+	// Converted at invoice time
+	repo := &mockSubscriptionRepo{CreateSubscriptionSub: &Subscription{ID: 1}}
+	svc, err = New(repo, &mockLNProvider{CreateInvoiceInvoice: invoice}, "mock")
+	assert.NoError(t, err)
+	svc.SetRateOracle(&mockRateOracle{Rate: 50000})
+	_, err = svc.CreateSubscription(ctx, sub)
+	assert.NoError(t, err)
+	assert.Equal(t, 10000, repo.Created.Sats)
+	assert.Equal(t, 50000.0, repo.Created.ExchangeRate)
+	assert.Equal(t, "USD", repo.Created.Currency)
+	assert.Equal(t, 5.0, repo.Created.FiatPrice)
+
+	// Sats prices are untouched
+	sats, rate, err := svc.PriceInSats(ctx, Subscription{Sats: 1000})
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, sats)
+	assert.Zero(t, rate)
+}
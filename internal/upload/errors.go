@@ -0,0 +1,10 @@
+package upload
+
+import "errors"
+
+var (
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrStatusConflict is returned by repos when an upload's status
+	// changed between being read and being updated.
+	ErrStatusConflict = errors.New("upload status changed concurrently")
+)
@@ -0,0 +1,156 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/stemstr/storage/internal/service"
+	"github.com/stemstr/storage/internal/subscription"
+)
+
+type mockUploadRepo struct {
+	mu      sync.Mutex
+	uploads map[string]*Upload
+}
+
+func newMockUploadRepo(uploads ...Upload) *mockUploadRepo {
+	m := &mockUploadRepo{uploads: map[string]*Upload{}}
+	for i := range uploads {
+		m.uploads[uploads[i].InvoiceID] = &uploads[i]
+	}
+	return m
+}
+
+func (m *mockUploadRepo) get(invoiceID string) Upload {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.uploads[invoiceID]
+}
+
+func (m *mockUploadRepo) CreateUpload(ctx context.Context, u Upload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uploads[u.InvoiceID] = &u
+	return nil
+}
+func (m *mockUploadRepo) GetUpload(ctx context.Context, invoiceID string) (*Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.uploads[invoiceID]
+	if !ok {
+		return nil, ErrUploadNotFound
+	}
+	copy := *u
+	return &copy, nil
+}
+func (m *mockUploadRepo) GetPendingUploads(ctx context.Context) ([]Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var uploads []Upload
+	for _, u := range m.uploads {
+		if u.Status == StatusPending {
+			uploads = append(uploads, *u)
+		}
+	}
+	return uploads, nil
+}
+func (m *mockUploadRepo) GetProcessingUploads(ctx context.Context, updatedBefore time.Time) ([]Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var uploads []Upload
+	for _, u := range m.uploads {
+		if u.Status == StatusProcessing && u.UpdatedAt != nil && u.UpdatedAt.Before(updatedBefore) {
+			uploads = append(uploads, *u)
+		}
+	}
+	return uploads, nil
+}
+func (m *mockUploadRepo) UpdateUploadStatus(ctx context.Context, invoiceID string, from, to Status) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.uploads[invoiceID]
+	if u.Status != from {
+		return ErrStatusConflict
+	}
+	now := time.Now()
+	u.Status = to
+	u.UpdatedAt = &now
+	return nil
+}
+func (m *mockUploadRepo) SetUploadResult(ctx context.Context, invoiceID, downloadHash string, waveform json.RawMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.uploads[invoiceID]
+	u.Status = StatusProcessed
+	u.DownloadHash = downloadHash
+	u.Waveform = waveform
+	return nil
+}
+
+type mockSampleService struct {
+	Duration_  time.Duration
+	ProcessErr error
+
+	mu        sync.Mutex
+	Held      []string
+	Discarded []string
+	Processed chan string
+}
+
+func (m *mockSampleService) Duration(ctx context.Context, r *service.NewSampleRequest) (time.Duration, error) {
+	return m.Duration_, nil
+}
+func (m *mockSampleService) HoldSample(ctx context.Context, r *service.NewSampleRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Held = append(m.Held, r.Sum)
+	return nil
+}
+func (m *mockSampleService) ProcessHeldSample(ctx context.Context, r service.NewSampleRequest) (*service.NewSampleResponse, error) {
+	defer func() { m.Processed <- r.Sum }()
+	if m.ProcessErr != nil {
+		return nil, m.ProcessErr
+	}
+	return &service.NewSampleResponse{MediaID: r.Sum, DownloadHash: "hash", Waveform: []int{1, 2, 3}}, nil
+}
+func (m *mockSampleService) DiscardHeldSample(ctx context.Context, sum, mimetype string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Discarded = append(m.Discarded, sum)
+	return nil
+}
+
+type mockLNProvider struct {
+	CreateInvoiceInvoice *subscription.Invoice
+	CreateInvoiceErr     error
+	IsInvoicePaidBool    bool
+	IsInvoicePaidErr     error
+
+	// Invoiced records the last subscription invoiced
+	Invoiced subscription.Subscription
+}
+
+func (m *mockLNProvider) CreateInvoice(ctx context.Context, sub subscription.Subscription) (*subscription.Invoice, error) {
+	m.Invoiced = sub
+	return m.CreateInvoiceInvoice, m.CreateInvoiceErr
+}
+func (m *mockLNProvider) IsInvoicePaid(ctx context.Context, id string) (bool, error) {
+	return m.IsInvoicePaidBool, m.IsInvoicePaidErr
+}
+
+type mockLeaderLock struct {
+	Held bool
+
+	// Released records whether Release was called
+	Released bool
+}
+
+func (m *mockLeaderLock) TryAcquire(ctx context.Context) (bool, error) {
+	return m.Held, nil
+}
+func (m *mockLeaderLock) Release(ctx context.Context) error {
+	m.Released = true
+	return nil
+}
@@ -0,0 +1,383 @@
+// Package upload sells single uploads to users without a subscription.
+// Uploads are held until their invoice is paid and then processed.
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/stemstr/storage/internal/service"
+	"github.com/stemstr/storage/internal/subscription"
+)
+
+type Status string
+
+const (
+	// StatusPending uploads are held waiting on their invoice to be paid.
+	StatusPending Status = "pending"
+	// StatusProcessing uploads have been paid and are being processed.
+	StatusProcessing Status = "processing"
+	// StatusProcessed uploads are available like any other sample.
+	StatusProcessed Status = "processed"
+	// StatusExpired uploads were never paid and have been discarded.
+	StatusExpired Status = "expired"
+	// StatusFailed uploads were paid but couldn't be processed. The held
+	// upload is kept.
+	StatusFailed Status = "failed"
+)
+
+func New(repo uploadRepo, samples sampleService, ln subscription.LNProvider, lnProviderType string, pricing Pricing) (*Service, error) {
+	if !pricing.Enabled() {
+		return nil, fmt.Errorf("pricing required")
+	}
+
+	return &Service{
+		repo:           repo,
+		samples:        samples,
+		ln:             ln,
+		lnProviderType: lnProviderType,
+		pricing:        pricing,
+		processing:     map[string]bool{},
+	}, nil
+}
+
+type Service struct {
+	repo           uploadRepo
+	samples        sampleService
+	ln             subscription.LNProvider
+	lnProviderType string
+	pricing        Pricing
+
+	// processing is the invoice ids of uploads being processed by this
+	// replica.
+	mu         sync.Mutex
+	processing map[string]bool
+}
+
+type uploadRepo interface {
+	CreateUpload(ctx context.Context, u Upload) error
+	// GetUpload returns ErrUploadNotFound for unknown invoices.
+	GetUpload(ctx context.Context, invoiceID string) (*Upload, error)
+	GetPendingUploads(ctx context.Context) ([]Upload, error)
+	// GetProcessingUploads lists uploads that have been processing since
+	// before updatedBefore.
+	GetProcessingUploads(ctx context.Context, updatedBefore time.Time) ([]Upload, error)
+	// UpdateUploadStatus moves an upload from one status to another.
+	// ErrStatusConflict is returned if the upload is no longer in the from
+	// status.
+	UpdateUploadStatus(ctx context.Context, invoiceID string, from, to Status) error
+	// SetUploadResult marks a processing upload processed.
+	SetUploadResult(ctx context.Context, invoiceID, downloadHash string, waveform json.RawMessage) error
+}
+
+type sampleService interface {
+	Duration(ctx context.Context, r *service.NewSampleRequest) (time.Duration, error)
+	HoldSample(ctx context.Context, r *service.NewSampleRequest) error
+	ProcessHeldSample(ctx context.Context, r service.NewSampleRequest) (*service.NewSampleResponse, error)
+	DiscardHeldSample(ctx context.Context, sum, mimetype string) error
+}
+
+// Pricing is the price of an upload by size and length, in sats.
+type Pricing struct {
+	SatsPerMB     float64
+	SatsPerMinute float64
+}
+
+// Enabled reports whether uploads have a price.
+func (p Pricing) Enabled() bool {
+	return p.SatsPerMB > 0 || p.SatsPerMinute > 0
+}
+
+// Price of an upload of size bytes and duration, rounded up to at least a
+// sat.
+func (p Pricing) Price(size int64, duration time.Duration) int {
+	sats := p.SatsPerMB*float64(size)/(1024*1024) + p.SatsPerMinute*duration.Minutes()
+	return int(math.Max(1, math.Ceil(sats)))
+}
+
+// Upload is a single upload paid for with its own invoice.
+type Upload struct {
+	InvoiceID        string    `json:"invoice_id" db:"invoice_id"`
+	Provider         string    `json:"provider" db:"provider"`
+	Pubkey           string    `json:"pubkey" db:"pubkey"`
+	Sum              string    `json:"sum" db:"sum"`
+	Mimetype         string    `json:"mimetype" db:"mimetype"`
+	Size             int64     `json:"size" db:"size"`
+	DurationSeconds  float64   `json:"duration_seconds" db:"duration_seconds"`
+	Sats             int       `json:"sats" db:"sats"`
+	Status           Status    `json:"status" db:"status"`
+	LightningInvoice string    `json:"lightning_invoice" db:"lightning_invoice"`
+	InvoiceExpiresAt time.Time `json:"invoice_expires_at" db:"invoice_expires_at"`
+	// DownloadHash and Waveform are set once processed.
+	DownloadHash string          `json:"download_hash" db:"download_hash"`
+	Waveform     json.RawMessage `json:"waveform" db:"waveform"`
+	CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt    *time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// defaultInvoiceTTL is how long an upload is held when the LNProvider
+// doesn't report an invoice expiry.
+const defaultInvoiceTTL = time.Hour
+
+// Create holds r and requests an invoice for it priced by its size and
+// length.
+func (s *Service) Create(ctx context.Context, r *service.NewSampleRequest) (*Upload, error) {
+	duration, err := s.samples.Duration(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	u := Upload{
+		Provider:        s.lnProviderType,
+		Pubkey:          r.Pubkey,
+		Sum:             r.Sum,
+		Mimetype:        r.Mimetype,
+		Size:            int64(len(r.Data)),
+		DurationSeconds: duration.Seconds(),
+		Sats:            s.pricing.Price(int64(len(r.Data)), duration),
+		Status:          StatusPending,
+		CreatedAt:       time.Now(),
+	}
+
+	if err := s.samples.HoldSample(ctx, r); err != nil {
+		return nil, fmt.Errorf("HoldSample: %w", err)
+	}
+	// Nothing refers to the held copy until the upload is stored.
+	discard := func() {
+		if err := s.samples.DiscardHeldSample(ctx, u.Sum, u.Mimetype); err != nil {
+			log.Printf("error: upload: DiscardHeldSample %v: %v", u.Sum, err)
+		}
+	}
+
+	invoice, err := s.ln.CreateInvoice(ctx, subscription.Subscription{
+		Pubkey:    u.Pubkey,
+		Sats:      u.Sats,
+		CreatedAt: u.CreatedAt,
+		Memo:      "Stemstr upload",
+	})
+	if err != nil {
+		discard()
+		return nil, fmt.Errorf("CreateInvoice: %w", err)
+	}
+	u.InvoiceID = invoice.ID
+	u.LightningInvoice = invoice.LightningInvoice
+	u.InvoiceExpiresAt = invoice.ExpiresAt
+	if u.InvoiceExpiresAt.IsZero() {
+		u.InvoiceExpiresAt = u.CreatedAt.Add(defaultInvoiceTTL)
+	}
+
+	if err := s.repo.CreateUpload(ctx, u); err != nil {
+		discard()
+		return nil, fmt.Errorf("repo.CreateUpload: %w", err)
+	}
+
+	return &u, nil
+}
+
+// Get fetches an upload by its invoice id. Pending uploads are checked with
+// the LNProvider first so clients can poll for completion.
+func (s *Service) Get(ctx context.Context, invoiceID string) (*Upload, error) {
+	u, err := s.repo.GetUpload(ctx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Status != StatusPending {
+		return u, nil
+	}
+
+	if err := s.check(ctx, u); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// ConfirmPayment starts processing the upload paid for by p once the
+// provider has confirmed payment. It reports whether the upload was newly
+// paid. subscription.ErrUnderpaid is returned if p doesn't cover the price.
+func (s *Service) ConfirmPayment(ctx context.Context, p subscription.Payment) (bool, error) {
+	u, err := s.repo.GetUpload(ctx, p.InvoiceID)
+	if err != nil {
+		return false, err
+	}
+
+	if p.Sats < u.Sats {
+		return false, fmt.Errorf("%w: got %d sats, want %d", subscription.ErrUnderpaid, p.Sats, u.Sats)
+	}
+
+	return s.paid(ctx, u)
+}
+
+// staleProcessing is how long an upload can be processing before it's
+// assumed its processing was interrupted, e.g. by a restart.
+const staleProcessing = 15 * time.Minute
+
+// Reconcile catches payments for uploads nobody is polling, discards
+// uploads whose invoice expired unpaid and retries processing that was
+// interrupted.
+func (s *Service) Reconcile(ctx context.Context) error {
+	uploads, err := s.repo.GetPendingUploads(ctx)
+	if err != nil {
+		return fmt.Errorf("repo.GetPendingUploads: %w", err)
+	}
+
+	for i := range uploads {
+		if err := s.check(ctx, &uploads[i]); err != nil {
+			log.Printf("error: upload: check %v: %v", uploads[i].InvoiceID, err)
+		}
+	}
+
+	stale, err := s.repo.GetProcessingUploads(ctx, time.Now().Add(-staleProcessing))
+	if err != nil {
+		return fmt.Errorf("repo.GetProcessingUploads: %w", err)
+	}
+
+	// One at a time, so a backlog doesn't swamp the encoder.
+	for _, u := range stale {
+		log.Printf("upload: retrying processing %v", u.InvoiceID)
+		s.process(u)
+	}
+
+	return nil
+}
+
+// Run reconciles every interval while holding lock, until ctx is done.
+// Only one replica reconciles so interrupted processing isn't retried twice.
+func (s *Service) Run(ctx context.Context, lock subscription.LeaderLock, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var leader bool
+	defer func() {
+		if leader {
+			lock.Release(context.Background())
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			held, err := lock.TryAcquire(ctx)
+			if err != nil {
+				log.Printf("error: upload reconciler lock: %v", err)
+				held = false
+			}
+			if held != leader {
+				log.Printf("upload reconciler: leader=%v", held)
+				leader = held
+			}
+			if !held {
+				continue
+			}
+
+			if err := s.Reconcile(ctx); err != nil {
+				log.Printf("upload: %v", err)
+			}
+		}
+	}
+}
+
+// check asks the LNProvider about a pending upload's invoice, updating u.
+func (s *Service) check(ctx context.Context, u *Upload) error {
+	paid, err := s.ln.IsInvoicePaid(ctx, u.InvoiceID)
+	if err != nil && !errors.Is(err, subscription.ErrInvoiceExpired) {
+		return fmt.Errorf("IsInvoicePaid: %w", err)
+	}
+	if paid {
+		_, err := s.paid(ctx, u)
+		return err
+	}
+	if err == nil && u.InvoiceExpiresAt.After(time.Now()) {
+		return nil
+	}
+
+	// Expired unpaid
+	if err := s.transition(ctx, u, StatusExpired); err != nil {
+		if errors.Is(err, ErrStatusConflict) {
+			return nil
+		}
+		return err
+	}
+	if err := s.samples.DiscardHeldSample(ctx, u.Sum, u.Mimetype); err != nil {
+		return fmt.Errorf("DiscardHeldSample: %w", err)
+	}
+
+	return nil
+}
+
+// paid claims u for processing, reporting false if it was already claimed.
+// Processing continues in the background.
+func (s *Service) paid(ctx context.Context, u *Upload) (bool, error) {
+	if u.Status != StatusPending {
+		return false, nil
+	}
+	if err := s.transition(ctx, u, StatusProcessing); err != nil {
+		if errors.Is(err, ErrStatusConflict) {
+			// A concurrent delivery or poll got there first.
+			return false, nil
+		}
+		return false, err
+	}
+
+	go s.process(*u)
+
+	return true, nil
+}
+
+// process processes a paid upload unless this replica already is.
+func (s *Service) process(u Upload) {
+	s.mu.Lock()
+	if s.processing[u.InvoiceID] {
+		s.mu.Unlock()
+		return
+	}
+	s.processing[u.InvoiceID] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.processing, u.InvoiceID)
+		s.mu.Unlock()
+	}()
+
+	ctx := context.Background()
+
+	sample, err := s.samples.ProcessHeldSample(ctx, service.NewSampleRequest{
+		Mimetype: u.Mimetype,
+		Pubkey:   u.Pubkey,
+		Sum:      u.Sum,
+	})
+	if err != nil {
+		log.Printf("error: upload: ProcessHeldSample %v: %v", u.InvoiceID, err)
+		if err := s.transition(ctx, &u, StatusFailed); err != nil {
+			log.Printf("error: upload: %v: %v", u.InvoiceID, err)
+		}
+		return
+	}
+
+	waveform, err := json.Marshal(sample.Waveform)
+	if err != nil {
+		log.Printf("error: upload: marshal waveform %v: %v", u.InvoiceID, err)
+		return
+	}
+	if err := s.repo.SetUploadResult(ctx, u.InvoiceID, sample.DownloadHash, waveform); err != nil {
+		log.Printf("error: upload: SetUploadResult %v: %v", u.InvoiceID, err)
+	}
+}
+
+func (s *Service) transition(ctx context.Context, u *Upload, to Status) error {
+	if err := s.repo.UpdateUploadStatus(ctx, u.InvoiceID, u.Status, to); err != nil {
+		return fmt.Errorf("repo.UpdateUploadStatus: %w", err)
+	}
+	u.Status = to
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stemstr/storage/internal/service"
+	"github.com/stemstr/storage/internal/subscription"
+)
+
+func TestPricing(t *testing.T) {
+	p := Pricing{SatsPerMB: 100, SatsPerMinute: 50}
+	assert.True(t, p.Enabled())
+	assert.False(t, Pricing{}.Enabled())
+
+	assert.Equal(t, 200, p.Price(1024*1024, 2*time.Minute))
+	assert.Equal(t, 76, p.Price(1024*1024/2+1, 30*time.Second))
+	assert.Equal(t, 1, Pricing{SatsPerMB: 0.001}.Price(1, 0))
+}
+
+func TestCreate(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		repo    = newMockUploadRepo()
+		samples = &mockSampleService{Duration_: time.Minute}
+		ln      = &mockLNProvider{CreateInvoiceInvoice: &subscription.Invoice{ID: "inv", LightningInvoice: "lnbc"}}
+	)
+
+	svc, err := New(repo, samples, ln, "mock", Pricing{SatsPerMB: 100, SatsPerMinute: 50})
+	assert.NoError(t, err)
+
+	u, err := svc.Create(ctx, &service.NewSampleRequest{
+		Data:     make([]byte, 1024*1024),
+		Mimetype: "audio/wav",
+		Pubkey:   "xxx",
+		Sum:      "sum",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 150, u.Sats)
+	assert.Equal(t, StatusPending, u.Status)
+	assert.Equal(t, "inv", u.InvoiceID)
+	assert.False(t, u.InvoiceExpiresAt.IsZero())
+	assert.Equal(t, []string{"sum"}, samples.Held)
+	assert.Equal(t, 150, ln.Invoiced.Sats)
+	assert.Equal(t, "Stemstr upload", ln.Invoiced.InvoiceMemo())
+	assert.Equal(t, StatusPending, repo.get("inv").Status)
+	assert.Empty(t, samples.Discarded)
+
+	// The held copy isn't kept without an invoice to pay for it
+	ln.CreateInvoiceErr = errors.New("node offline")
+	_, err = svc.Create(ctx, &service.NewSampleRequest{
+		Data:     make([]byte, 1024),
+		Mimetype: "audio/wav",
+		Pubkey:   "xxx",
+		Sum:      "sum2",
+	})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"sum", "sum2"}, samples.Held)
+	assert.Equal(t, []string{"sum2"}, samples.Discarded)
+}
+
+func TestConfirmPayment(t *testing.T) {
+	ctx := context.Background()
+	pending := Upload{InvoiceID: "inv", Sum: "sum", Sats: 100, Status: StatusPending, InvoiceExpiresAt: time.Now().Add(time.Hour)}
+
+	var tests = []struct {
+		name       string
+		upload     Upload
+		sats       int
+		processErr error
+		newlyPaid  bool
+		err        error
+		status     Status
+	}{
+		{"paid", pending, 100, nil, true, nil, StatusProcessed},
+		{"underpaid", pending, 99, nil, false, subscription.ErrUnderpaid, StatusPending},
+		{"already processing", Upload{InvoiceID: "inv", Sats: 100, Status: StatusProcessing}, 100, nil, false, nil, StatusProcessing},
+		{"processing fails", pending, 100, errors.New("bad file"), true, nil, StatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockUploadRepo(tt.upload)
+			samples := &mockSampleService{ProcessErr: tt.processErr, Processed: make(chan string, 1)}
+			svc, err := New(repo, samples, &mockLNProvider{}, "mock", Pricing{SatsPerMB: 1})
+			assert.NoError(t, err)
+
+			newlyPaid, err := svc.ConfirmPayment(ctx, subscription.Payment{InvoiceID: "inv", Sats: tt.sats})
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.newlyPaid, newlyPaid)
+
+			if tt.newlyPaid {
+				select {
+				case <-samples.Processed:
+				case <-time.After(time.Second):
+					t.Fatal("not processed")
+				}
+				assert.Eventually(t, func() bool {
+					return repo.get("inv").Status == tt.status
+				}, time.Second, time.Millisecond)
+			} else {
+				assert.Equal(t, tt.status, repo.get("inv").Status)
+			}
+		})
+	}
+
+	_, err := (&Service{repo: newMockUploadRepo()}).ConfirmPayment(ctx, subscription.Payment{InvoiceID: "unknown"})
+	assert.ErrorIs(t, err, ErrUploadNotFound)
+}
+
+func TestReconcile(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		future = time.Now().Add(time.Hour)
+		past   = time.Now().Add(-time.Hour)
+	)
+
+	var tests = []struct {
+		name      string
+		expiresAt time.Time
+		paid      bool
+		paidErr   error
+		status    Status
+		discarded bool
+	}{
+		{"unpaid", future, false, nil, StatusPending, false},
+		{"paid", future, true, nil, StatusProcessed, false},
+		{"expired", past, false, nil, StatusExpired, true},
+		{"provider expired", future, false, subscription.ErrInvoiceExpired, StatusExpired, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockUploadRepo(Upload{InvoiceID: "inv", Sum: "sum", Status: StatusPending, InvoiceExpiresAt: tt.expiresAt})
+			samples := &mockSampleService{Processed: make(chan string, 1)}
+			ln := &mockLNProvider{IsInvoicePaidBool: tt.paid, IsInvoicePaidErr: tt.paidErr}
+			svc, err := New(repo, samples, ln, "mock", Pricing{SatsPerMB: 1})
+			assert.NoError(t, err)
+
+			assert.NoError(t, svc.Reconcile(ctx))
+			assert.Eventually(t, func() bool {
+				return repo.get("inv").Status == tt.status
+			}, time.Second, time.Millisecond)
+			if tt.discarded {
+				assert.Equal(t, []string{"sum"}, samples.Discarded)
+			} else {
+				assert.Empty(t, samples.Discarded)
+			}
+		})
+	}
+}
+
+func TestReconcileInterruptedProcessing(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		now    = time.Now()
+		before = now.Add(-time.Hour)
+	)
+
+	// Both processing when the service starts, as after a restart. Only the
+	// one that's been processing for a while is assumed interrupted.
+	repo := newMockUploadRepo(
+		Upload{InvoiceID: "stale", Sum: "stale", Status: StatusProcessing, UpdatedAt: &before},
+		Upload{InvoiceID: "recent", Sum: "recent", Status: StatusProcessing, UpdatedAt: &now},
+	)
+	samples := &mockSampleService{Processed: make(chan string, 2)}
+	svc, err := New(repo, samples, &mockLNProvider{}, "mock", Pricing{SatsPerMB: 1})
+	assert.NoError(t, err)
+
+	assert.NoError(t, svc.Reconcile(ctx))
+	assert.Equal(t, StatusProcessed, repo.get("stale").Status)
+	assert.Equal(t, "hash", repo.get("stale").DownloadHash)
+	assert.Equal(t, StatusProcessing, repo.get("recent").Status)
+	assert.Equal(t, "stale", <-samples.Processed)
+	assert.Empty(t, samples.Processed)
+}
+
+func TestRunNeedsLeaderLock(t *testing.T) {
+	for _, held := range []bool{false, true} {
+		before := time.Now().Add(-time.Hour)
+		repo := newMockUploadRepo(Upload{InvoiceID: "stale", Sum: "stale", Status: StatusProcessing, UpdatedAt: &before})
+		samples := &mockSampleService{Processed: make(chan string, 1)}
+		svc, err := New(repo, samples, &mockLNProvider{}, "mock", Pricing{SatsPerMB: 1})
+		assert.NoError(t, err)
+
+		// Run returns once ctx is done
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		lock := &mockLeaderLock{Held: held}
+		svc.Run(ctx, lock, time.Millisecond)
+		cancel()
+
+		if held {
+			assert.Equal(t, StatusProcessed, repo.get("stale").Status)
+			assert.True(t, lock.Released)
+		} else {
+			assert.Equal(t, StatusProcessing, repo.get("stale").Status)
+			assert.False(t, lock.Released)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package waveform
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var (
+	ErrNotWAV            = errors.New("not a WAV file")
+	ErrUnsupportedFormat = errors.New("unsupported WAV format")
+	// ErrNoAudio is returned for WAVs without any audio frames.
+	ErrNoAudio = errors.New("no audio")
+	// ErrTooShort is returned for audio with fewer frames than points.
+	ErrTooShort = errors.New("audio too short")
+)
+
+const (
+	formatPCM        = 1
+	formatFloat      = 3
+	formatExtensible = 0xFFFE
+
+	// maxChannels bounds the frame buffer for malformed headers.
+	maxChannels = 64
+	// chunkFrames is the number of frames decoded at a time.
+	chunkFrames = 4096
+	// unknownSize is the data chunk size written by streaming encoders
+	// that don't know the length up front.
+	unknownSize = 0xFFFFFFFF
+)
+
+// format is the layout of a WAV's samples.
+type format struct {
+	Channels   int
+	SampleRate int
+	Bits       int
+	Float      bool
+}
+
+func (f format) blockAlign() int {
+	return f.Channels * f.Bits / 8
+}
+
+// pcmReader decodes a WAV's samples chunk by chunk, normalized to [-1, 1]
+// by the format's full scale.
+type pcmReader struct {
+	format
+	// Frames is the number of frames the data chunk holds, or -1 if it
+	// isn't known.
+	Frames int64
+
+	r      io.Reader
+	buf    []byte
+	decode func([]byte) float64
+}
+
+// newPCMReader reads the WAV headers from r, leaving it at the start of the
+// samples.
+func newPCMReader(r io.Reader) (*pcmReader, error) {
+	br := bufio.NewReader(r)
+
+	var riff struct {
+		ID   [4]byte
+		Size uint32
+		Wave [4]byte
+	}
+	if err := binary.Read(br, binary.LittleEndian, &riff); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotWAV, err)
+	}
+	if string(riff.ID[:]) != "RIFF" || string(riff.Wave[:]) != "WAVE" {
+		return nil, ErrNotWAV
+	}
+
+	var (
+		f      format
+		hasFmt bool
+	)
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(br, binary.LittleEndian, &chunk); err != nil {
+			return nil, fmt.Errorf("%w: data chunk not found: %v", ErrNotWAV, err)
+		}
+
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			var err error
+			if f, err = readFormat(br, chunk.Size); err != nil {
+				return nil, err
+			}
+			hasFmt = true
+		case "data":
+			if !hasFmt {
+				return nil, fmt.Errorf("%w: data before fmt chunk", ErrNotWAV)
+			}
+			return f.reader(br, chunk.Size), nil
+		default:
+			if err := skip(br, chunk.Size); err != nil {
+				return nil, fmt.Errorf("%w: skip %q chunk: %v", ErrNotWAV, chunk.ID, err)
+			}
+		}
+	}
+}
+
+func readFormat(r io.Reader, size uint32) (format, error) {
+	if size < 16 {
+		return format{}, fmt.Errorf("%w: fmt chunk too small", ErrNotWAV)
+	}
+
+	var fmtChunk struct {
+		AudioFormat   uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+	}
+	if err := binary.Read(r, binary.LittleEndian, &fmtChunk); err != nil {
+		return format{}, fmt.Errorf("%w: read fmt chunk: %v", ErrNotWAV, err)
+	}
+	rest := size - 16
+
+	audioFormat := fmtChunk.AudioFormat
+	if audioFormat == formatExtensible && rest >= 10 {
+		// cbSize, valid bits and channel mask precede the sub format,
+		// whose first two bytes are the format code.
+		var ext struct {
+			Size        uint16
+			ValidBits   uint16
+			ChannelMask uint32
+			SubFormat   uint16
+		}
+		if err := binary.Read(r, binary.LittleEndian, &ext); err != nil {
+			return format{}, fmt.Errorf("%w: read fmt extension: %v", ErrNotWAV, err)
+		}
+		audioFormat = ext.SubFormat
+		rest -= 10
+	}
+	if err := skip(r, rest); err != nil {
+		return format{}, fmt.Errorf("%w: read fmt chunk: %v", ErrNotWAV, err)
+	}
+
+	f := format{
+		Channels:   int(fmtChunk.Channels),
+		SampleRate: int(fmtChunk.SampleRate),
+		Bits:       int(fmtChunk.BitsPerSample),
+		Float:      audioFormat == formatFloat,
+	}
+
+	switch {
+	case audioFormat != formatPCM && audioFormat != formatFloat:
+		return f, fmt.Errorf("%w: format code %#x", ErrUnsupportedFormat, audioFormat)
+	case f.Channels < 1 || f.Channels > maxChannels:
+		return f, fmt.Errorf("%w: %d channels", ErrUnsupportedFormat, f.Channels)
+	case f.SampleRate < 1:
+		return f, fmt.Errorf("%w: sample rate %d", ErrUnsupportedFormat, f.SampleRate)
+	case f.Float && f.Bits != 32 && f.Bits != 64:
+		return f, fmt.Errorf("%w: %d bit float", ErrUnsupportedFormat, f.Bits)
+	case !f.Float && f.Bits != 8 && f.Bits != 16 && f.Bits != 24 && f.Bits != 32:
+		return f, fmt.Errorf("%w: %d bit PCM", ErrUnsupportedFormat, f.Bits)
+	}
+
+	return f, nil
+}
+
+// reader reads the size bytes of samples from r.
+func (f format) reader(r io.Reader, size uint32) *pcmReader {
+	p := &pcmReader{
+		format: f,
+		Frames: int64(size) / int64(f.blockAlign()),
+		r:      r,
+		buf:    make([]byte, chunkFrames*f.blockAlign()),
+		decode: sampleDecoder(f),
+	}
+	if size == unknownSize {
+		p.Frames = -1
+	} else {
+		p.r = io.LimitReader(r, int64(size))
+	}
+
+	return p
+}
+
+// sampleDecoder returns a func normalizing one little endian sample of f.
+func sampleDecoder(f format) func([]byte) float64 {
+	switch {
+	case f.Float && f.Bits == 32:
+		return func(b []byte) float64 {
+			return clamp(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+		}
+	case f.Float:
+		return func(b []byte) float64 {
+			return clamp(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+		}
+	case f.Bits == 8:
+		// 8 bit samples are unsigned
+		return func(b []byte) float64 {
+			return float64(int(b[0])-128) / 128
+		}
+	case f.Bits == 16:
+		return func(b []byte) float64 {
+			return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+		}
+	case f.Bits == 24:
+		return func(b []byte) float64 {
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+			return float64(v) / (1 << 23)
+		}
+	default:
+		return func(b []byte) float64 {
+			return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+		}
+	}
+}
+
+// clamp keeps float samples, which may exceed full scale or not be numbers
+// at all, within [-1, 1].
+func clamp(v float64) float64 {
+	switch {
+	case math.IsNaN(v):
+		return 0
+	case v > 1:
+		return 1
+	case v < -1:
+		return -1
+	}
+	return v
+}
+
+// ReadFrames decodes up to len(dst)/Channels frames into dst, interleaved
+// by channel, returning the number of frames read. io.EOF is returned once
+// every frame has been read. A trailing partial frame is dropped.
+func (p *pcmReader) ReadFrames(dst []float64) (int, error) {
+	frames := len(dst) / p.Channels
+	if max := len(p.buf) / p.blockAlign(); frames > max {
+		frames = max
+	}
+	if frames == 0 {
+		return 0, nil
+	}
+
+	buf := p.buf[:frames*p.blockAlign()]
+	n, err := io.ReadFull(p.r, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	frames = n / p.blockAlign()
+	if frames == 0 && err == nil {
+		err = io.EOF
+	}
+
+	size := p.Bits / 8
+	for i := 0; i < frames*p.Channels; i++ {
+		dst[i] = p.decode(buf[i*size : (i+1)*size])
+	}
+
+	return frames, err
+}
+
+// eachFrame calls fn with every frame of p, interleaved by channel, holding
+// only chunkFrames in memory at a time.
+func (p *pcmReader) eachFrame(fn func(frame []float64)) error {
+	samples := make([]float64, chunkFrames*p.Channels)
+	for {
+		n, err := p.ReadFrames(samples)
+		for i := 0; i < n; i++ {
+			fn(samples[i*p.Channels : (i+1)*p.Channels])
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read samples: %w", err)
+		}
+	}
+}
+
+func skip(r io.Reader, size uint32) error {
+	// Chunks are padded to an even size
+	n := int64(size) + int64(size%2)
+	_, err := io.CopyN(io.Discard, r, n)
+	return err
+}
@@ -0,0 +1,266 @@
+package waveform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// wavFile builds a WAV of audioFormat holding the raw sample data.
+func wavFile(audioFormat uint16, channels, sampleRate, bits int, data []byte) []byte {
+	var buf bytes.Buffer
+	w := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+
+	blockAlign := channels * bits / 8
+	buf.WriteString("RIFF")
+	w(uint32(4 + 8 + 16 + 8 + len(data)))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	w(uint32(16))
+	w(audioFormat)
+	w(uint16(channels))
+	w(uint32(sampleRate))
+	w(uint32(sampleRate * blockAlign))
+	w(uint16(blockAlign))
+	w(uint16(bits))
+	buf.WriteString("data")
+	w(uint32(len(data)))
+	buf.Write(data)
+
+	return buf.Bytes()
+}
+
+// writeWAV writes wav to a temporary file, returning its path.
+func writeWAV(t *testing.T, wav []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.wav")
+	if err := os.WriteFile(path, wav, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func pcm8(samples ...int) []byte {
+	b := make([]byte, len(samples))
+	for i, v := range samples {
+		b[i] = byte(v)
+	}
+	return b
+}
+
+func pcm16(samples ...int) []byte {
+	b := make([]byte, 2*len(samples))
+	for i, v := range samples {
+		binary.LittleEndian.PutUint16(b[2*i:], uint16(int16(v)))
+	}
+	return b
+}
+
+func pcm24(samples ...int) []byte {
+	b := make([]byte, 3*len(samples))
+	for i, v := range samples {
+		b[3*i], b[3*i+1], b[3*i+2] = byte(v), byte(v>>8), byte(v>>16)
+	}
+	return b
+}
+
+func pcm32(samples ...int) []byte {
+	b := make([]byte, 4*len(samples))
+	for i, v := range samples {
+		binary.LittleEndian.PutUint32(b[4*i:], uint32(int32(v)))
+	}
+	return b
+}
+
+func float32s(samples ...float32) []byte {
+	b := make([]byte, 4*len(samples))
+	for i, v := range samples {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(v))
+	}
+	return b
+}
+
+func readAll(t *testing.T, data []byte) (*pcmReader, []float64) {
+	t.Helper()
+
+	p, err := newPCMReader(bytes.NewReader(data))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	var samples []float64
+	assert.NoError(t, p.eachFrame(func(frame []float64) {
+		samples = append(samples, frame...)
+	}))
+	return p, samples
+}
+
+func TestDecode(t *testing.T) {
+	var tests = []struct {
+		name string
+		wav  []byte
+		bits int
+		want []float64
+	}{
+		{
+			name: "8 bit",
+			wav:  wavFile(formatPCM, 1, 8000, 8, pcm8(0, 64, 128, 192, 255)),
+			bits: 8,
+			want: []float64{-1, -0.5, 0, 0.5, 127.0 / 128},
+		},
+		{
+			name: "16 bit",
+			wav:  wavFile(formatPCM, 2, 44100, 16, pcm16(-32768, 16384, 0, 32767)),
+			bits: 16,
+			want: []float64{-1, 0.5, 0, 32767.0 / 32768},
+		},
+		{
+			name: "24 bit",
+			wav:  wavFile(formatPCM, 2, 48000, 24, pcm24(-1<<23, 1<<22, -1, 1<<23-1)),
+			bits: 24,
+			want: []float64{-1, 0.5, -1.0 / (1 << 23), float64(1<<23-1) / (1 << 23)},
+		},
+		{
+			name: "32 bit",
+			wav:  wavFile(formatPCM, 1, 48000, 32, pcm32(math.MinInt32, 1<<30)),
+			bits: 32,
+			want: []float64{-1, 0.5},
+		},
+		{
+			name: "float",
+			wav:  wavFile(formatFloat, 2, 48000, 32, float32s(-1, 0.5, 2, float32(math.NaN()))),
+			bits: 32,
+			want: []float64{-1, 0.5, 1, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, samples := readAll(t, tt.wav)
+			assert.Equal(t, tt.bits, p.Bits)
+			assert.Equal(t, int64(len(tt.want)/p.Channels), p.Frames)
+			assert.Equal(t, tt.want, samples)
+		})
+	}
+}
+
+func TestDecodeChunks(t *testing.T) {
+	// Unknown chunks, odd sized ones padded, are skipped
+	var buf bytes.Buffer
+	buf.WriteString("RIFF\x00\x00\x00\x00WAVE")
+	buf.WriteString("LIST\x03\x00\x00\x00abc\x00")
+	wav := wavFile(formatPCM, 1, 8000, 16, pcm16(16384))
+	buf.Write(wav[12:])
+
+	_, samples := readAll(t, buf.Bytes())
+	assert.Equal(t, []float64{0.5}, samples)
+
+	// WAVE_FORMAT_EXTENSIBLE names the format in its sub format
+	ext := wavFile(formatExtensible, 1, 8000, 32, float32s(0.25))
+	extFmt := []byte{22, 0, 32, 0, 4, 0, 0, 0, formatFloat, 0, 0, 0, 0, 0, 0x10, 0, 0x80, 0, 0, 0xAA, 0, 0x38, 0x9B, 0x71}
+	ext = append(append(append([]byte{}, ext[:36]...), extFmt...), ext[36:]...)
+	binary.LittleEndian.PutUint32(ext[16:], 16+uint32(len(extFmt)))
+	_, samples = readAll(t, ext)
+	assert.Equal(t, []float64{0.25}, samples)
+
+	// Streamed WAVs don't know the data size
+	wav = wavFile(formatPCM, 1, 8000, 16, pcm16(16384, -16384))
+	binary.LittleEndian.PutUint32(wav[40:], unknownSize)
+	p, samples := readAll(t, wav)
+	assert.Equal(t, int64(-1), p.Frames)
+	assert.Equal(t, []float64{0.5, -0.5}, samples)
+
+	// A truncated data chunk is read up to its last whole frame
+	wav = wavFile(formatPCM, 2, 8000, 16, pcm16(16384, -16384, 16384))
+	_, samples = readAll(t, wav)
+	assert.Equal(t, []float64{0.5, -0.5}, samples)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid := wavFile(formatPCM, 1, 8000, 16, pcm16(0))
+	with := func(offset int, v any) []byte {
+		b := append([]byte{}, valid...)
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, v)
+		copy(b[offset:], buf.Bytes())
+		return b
+	}
+
+	var tests = []struct {
+		name string
+		wav  []byte
+		err  error
+	}{
+		{name: "empty", wav: nil, err: ErrNotWAV},
+		{name: "not riff", wav: with(0, []byte("RIFX")), err: ErrNotWAV},
+		{name: "not wave", wav: with(8, []byte("AVI ")), err: ErrNotWAV},
+		{name: "no data", wav: valid[:36], err: ErrNotWAV},
+		{name: "data before fmt", wav: with(12, []byte("data")), err: ErrNotWAV},
+		{name: "small fmt", wav: with(16, uint32(8)), err: ErrNotWAV},
+		{name: "truncated fmt", wav: valid[:30], err: ErrNotWAV},
+		{name: "compressed", wav: with(20, uint16(2)), err: ErrUnsupportedFormat},
+		{name: "no channels", wav: with(22, uint16(0)), err: ErrUnsupportedFormat},
+		{name: "too many channels", wav: with(22, uint16(1000)), err: ErrUnsupportedFormat},
+		{name: "no sample rate", wav: with(24, uint32(0)), err: ErrUnsupportedFormat},
+		{name: "12 bit", wav: with(34, uint16(12)), err: ErrUnsupportedFormat},
+		{name: "16 bit float", wav: with(20, []uint16{formatFloat}), err: ErrUnsupportedFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newPCMReader(bytes.NewReader(tt.wav))
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add(wavFile(formatPCM, 1, 8000, 8, pcm8(0, 128, 255)))
+	f.Add(wavFile(formatPCM, 2, 44100, 16, pcm16(-32768, 32767, 0)))
+	f.Add(wavFile(formatPCM, 2, 48000, 24, pcm24(1, 2, 3, 4)))
+	f.Add(wavFile(formatFloat, 1, 48000, 32, float32s(0.5, -2)))
+	f.Add(wavFile(formatPCM, 0, 0, 0, nil))
+	f.Add([]byte("RIFF\xff\xff\xff\xffWAVEdata\xff\xff\xff\xff"))
+	if wav, err := os.ReadFile("../encoder/testdata/test.wav"); err == nil {
+		f.Add(wav[:1024])
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := newPCMReader(bytes.NewReader(data))
+		if err != nil {
+			if !errors.Is(err, ErrNotWAV) && !errors.Is(err, ErrUnsupportedFormat) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			return
+		}
+
+		var frames int64
+		err = p.eachFrame(func(frame []float64) {
+			if len(frame) != p.Channels {
+				t.Fatalf("frame of %d samples, want %d", len(frame), p.Channels)
+			}
+			for _, v := range frame {
+				if v < -1 || v > 1 || math.IsNaN(v) {
+					t.Fatalf("sample %v out of range", v)
+				}
+			}
+			frames++
+		})
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("read samples: %v", err)
+		}
+		if p.Frames >= 0 && frames > p.Frames {
+			t.Errorf("read %d frames, want at most %d", frames, p.Frames)
+		}
+
+		_, _ = PeaksFromReader(bytes.NewReader(data), PeaksOptions{SamplesPerPixel: 3, RMS: true})
+	})
+}
@@ -0,0 +1,249 @@
+package waveform
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultImageWidth  = 1200
+	DefaultImageHeight = 300
+	DefaultColor       = "#a0a0a0"
+	DefaultPlayedColor = "#9747ff"
+
+	// maxImageSize bounds image dimensions.
+	maxImageSize = 8192
+)
+
+// ImageOptions configures waveform images.
+type ImageOptions struct {
+	Width  int
+	Height int
+	// Colors are #rgb, #rrggbb or #rrggbbaa. The background is transparent
+	// if empty.
+	Color       string
+	PlayedColor string
+	Background  string
+	// Played is the fraction of the waveform, from 0 to 1, drawn in
+	// PlayedColor to show playback progress.
+	Played float64
+}
+
+func (o ImageOptions) withDefaults() ImageOptions {
+	if o.Width <= 0 {
+		o.Width = DefaultImageWidth
+	}
+	if o.Height <= 0 {
+		o.Height = DefaultImageHeight
+	}
+	if o.Color == "" {
+		o.Color = DefaultColor
+	}
+	if o.PlayedColor == "" {
+		o.PlayedColor = DefaultPlayedColor
+	}
+	return o
+}
+
+// imageStyle is ImageOptions with colors parsed.
+type imageStyle struct {
+	ImageOptions
+	color, played, background color.RGBA
+}
+
+func (o ImageOptions) style() (*imageStyle, error) {
+	o = o.withDefaults()
+	if o.Width > maxImageSize || o.Height > maxImageSize {
+		return nil, fmt.Errorf("image size %dx%d exceeds %d", o.Width, o.Height, maxImageSize)
+	}
+
+	s := &imageStyle{ImageOptions: o}
+	for _, c := range []struct {
+		dst *color.RGBA
+		hex string
+	}{
+		{&s.color, o.Color},
+		{&s.played, o.PlayedColor},
+		{&s.background, o.Background},
+	} {
+		if c.hex == "" {
+			continue
+		}
+		var err error
+		if *c.dst, err = ParseColor(c.hex); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// playedColumns is the number of columns drawn in the played color.
+func (s *imageStyle) playedColumns() int {
+	switch {
+	case s.Played <= 0:
+		return 0
+	case s.Played >= 1:
+		return s.Width
+	}
+	return int(s.Played * float64(s.Width))
+}
+
+// ParseColor parses a #rgb, #rrggbb or #rrggbbaa hex color.
+func ParseColor(s string) (color.RGBA, error) {
+	hex, ok := strings.CutPrefix(s, "#")
+	if ok && len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if ok && len(hex) == 6 {
+		hex += "ff"
+	}
+	if !ok || len(hex) != 8 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+
+	// image/color wants alpha premultiplied
+	c := color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+	return color.RGBAModel.Convert(c).(color.RGBA), nil
+}
+
+// column is the lowest and highest amplitude, from -1 to 1, across the
+// channels of the points drawn in a column of a waveform image.
+type column struct {
+	min, max float64
+}
+
+// columns resamples the peaks of p to width columns.
+func columns(p *Peaks, width int) ([]column, error) {
+	if p.Length == 0 || p.Channels <= 0 || len(p.Data) < p.Length*p.Channels*2 {
+		return nil, ErrNoAudio
+	}
+	if p.Bits != 8 && p.Bits != 16 {
+		return nil, fmt.Errorf("unsupported bits %d", p.Bits)
+	}
+
+	fullScale := float64(int(1) << (p.Bits - 1))
+	cols := make([]column, width)
+	for x := range cols {
+		start := x * p.Length / width
+		end := (x + 1) * p.Length / width
+		if end <= start {
+			end = start + 1
+		}
+
+		col := column{min: 1, max: -1}
+		for _, v := range p.Data[start*p.Channels*2 : end*p.Channels*2] {
+			f := float64(v) / fullScale
+			if f < col.min {
+				col.min = f
+			}
+			if f > col.max {
+				col.max = f
+			}
+		}
+		cols[x] = col
+	}
+
+	return cols, nil
+}
+
+// bar is the top and height in pixels of a column drawn in an image of
+// height, 0 being the top. Bars are at least a pixel high so silence is
+// drawn as a line.
+func (c column) bar(height int) (int, int) {
+	mid := float64(height) / 2
+	top := int(mid - c.max*mid)
+	bottom := int(mid - c.min*mid + 0.5)
+	if bottom > height {
+		bottom = height
+	}
+	if top < 0 {
+		top = 0
+	}
+	if bottom <= top {
+		if top >= height {
+			top = height - 1
+		}
+		bottom = top + 1
+	}
+	return top, bottom - top
+}
+
+// WaveformPNG draws the peaks of p as a PNG image.
+func WaveformPNG(p *Peaks, opts ImageOptions) ([]byte, error) {
+	s, err := opts.style()
+	if err != nil {
+		return nil, err
+	}
+	cols, err := columns(p, s.Width)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, s.Width, s.Height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(s.background), image.Point{}, draw.Src)
+
+	played := s.playedColumns()
+	for x, col := range cols {
+		c := s.color
+		if x < played {
+			c = s.played
+		}
+		top, height := col.bar(s.Height)
+		draw.Draw(img, image.Rect(x, top, x+1, top+height), image.NewUniform(c), image.Point{}, draw.Over)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// WaveformSVG draws the peaks of p as an SVG image, a path of the played
+// columns and another of the rest.
+func WaveformSVG(p *Peaks, opts ImageOptions) ([]byte, error) {
+	s, err := opts.style()
+	if err != nil {
+		return nil, err
+	}
+	cols, err := columns(p, s.Width)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, s.Width, s.Height, s.Width, s.Height)
+	if s.Background != "" {
+		fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%s"/>`, s.Background)
+	}
+
+	played := s.playedColumns()
+	path := func(fill string, cols []column, offset int) {
+		if len(cols) == 0 {
+			return
+		}
+		fmt.Fprintf(&buf, `<path fill="%s" d="`, fill)
+		for i, col := range cols {
+			top, height := col.bar(s.Height)
+			fmt.Fprintf(&buf, "M%d %dh1v%dh-1z", offset+i, top, height)
+		}
+		buf.WriteString(`"/>`)
+	}
+	path(s.PlayedColor, cols[:played], 0)
+	path(s.Color, cols[played:], played)
+	buf.WriteString("</svg>")
+
+	return buf.Bytes(), nil
+}
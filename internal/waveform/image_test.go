@@ -0,0 +1,144 @@
+package waveform
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseColor(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want color.RGBA
+		err  bool
+	}{
+		{in: "#fff", want: color.RGBA{255, 255, 255, 255}},
+		{in: "#9747ff", want: color.RGBA{0x97, 0x47, 0xff, 255}},
+		{in: "#ff000080", want: color.RGBA{128, 0, 0, 128}},
+		{in: "#00000000", want: color.RGBA{}},
+		{in: "fff", err: true},
+		{in: "#ffff", err: true},
+		{in: "#gggggg", err: true},
+		{in: "red", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			c, err := ParseColor(tt.in)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, c)
+		})
+	}
+}
+
+// testPeaks is mono 8 bit peaks, silent for the first half and full scale
+// for the second.
+func testPeaks() *Peaks {
+	p := &Peaks{Version: 2, Channels: 1, SampleRate: 44100, SamplesPerPixel: 256, Bits: 8, Length: 100}
+	for i := 0; i < p.Length; i++ {
+		if i < p.Length/2 {
+			p.Data = append(p.Data, 0, 0)
+		} else {
+			p.Data = append(p.Data, -128, 127)
+		}
+	}
+	return p
+}
+
+func TestWaveformPNG(t *testing.T) {
+	opts := ImageOptions{
+		Width:       50,
+		Height:      20,
+		Color:       "#ff0000",
+		PlayedColor: "#00ff00",
+		Background:  "#000000",
+		Played:      0.8,
+	}
+
+	data, err := WaveformPNG(testPeaks(), opts)
+	assert.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 50, img.Bounds().Dx())
+	assert.Equal(t, 20, img.Bounds().Dy())
+
+	var (
+		red   = color.RGBA{255, 0, 0, 255}
+		green = color.RGBA{0, 255, 0, 255}
+		black = color.RGBA{0, 0, 0, 255}
+		at    = func(x, y int) color.RGBA { return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA) }
+	)
+
+	// Silence is a line through the middle
+	assert.Equal(t, green, at(10, 10))
+	assert.Equal(t, black, at(10, 0))
+	assert.Equal(t, black, at(10, 19))
+
+	// Full scale fills the column, played up to 80%
+	assert.Equal(t, green, at(30, 0))
+	assert.Equal(t, green, at(39, 19))
+	assert.Equal(t, red, at(40, 0))
+	assert.Equal(t, red, at(49, 19))
+
+	// Transparent by default
+	data, err = WaveformPNG(testPeaks(), ImageOptions{Width: 10, Height: 10})
+	assert.NoError(t, err)
+	img, _ = png.Decode(bytes.NewReader(data))
+	assert.Equal(t, color.RGBA{}, at(0, 0))
+}
+
+func TestWaveformSVG(t *testing.T) {
+	data, err := WaveformSVG(testPeaks(), ImageOptions{Width: 50, Height: 20, Background: "#000", Played: 0.5})
+	assert.NoError(t, err)
+
+	var svg struct {
+		Width  int `xml:"width,attr"`
+		Height int `xml:"height,attr"`
+		Rect   struct {
+			Fill string `xml:"fill,attr"`
+		} `xml:"rect"`
+		Paths []struct {
+			Fill string `xml:"fill,attr"`
+			D    string `xml:"d,attr"`
+		} `xml:"path"`
+	}
+	assert.NoError(t, xml.Unmarshal(data, &svg))
+	assert.Equal(t, 50, svg.Width)
+	assert.Equal(t, 20, svg.Height)
+	assert.Equal(t, "#000", svg.Rect.Fill)
+	if assert.Len(t, svg.Paths, 2) {
+		assert.Equal(t, DefaultPlayedColor, svg.Paths[0].Fill)
+		assert.Equal(t, DefaultColor, svg.Paths[1].Fill)
+		assert.Equal(t, 25, strings.Count(svg.Paths[0].D, "M"))
+		assert.True(t, strings.HasPrefix(svg.Paths[0].D, "M0 10h1v1h-1z"))
+		assert.True(t, strings.HasPrefix(svg.Paths[1].D, "M25 0h1v20h-1z"))
+	}
+}
+
+func TestWaveformImageErrors(t *testing.T) {
+	_, err := WaveformPNG(&Peaks{Bits: 8, Channels: 1}, ImageOptions{})
+	assert.ErrorIs(t, err, ErrNoAudio)
+
+	_, err = WaveformSVG(testPeaks(), ImageOptions{Color: "red"})
+	assert.Error(t, err)
+
+	_, err = WaveformPNG(testPeaks(), ImageOptions{Width: maxImageSize + 1})
+	assert.Error(t, err)
+
+	p := testPeaks()
+	p.Bits = 0
+	_, err = WaveformPNG(p, ImageOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,293 @@
+package waveform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	// peaksVersion is the audiowaveform format version written, the first
+	// with multiple channels.
+	peaksVersion = 2
+
+	DefaultSamplesPerPixel = 256
+	DefaultBits            = 8
+)
+
+// PeaksOptions configures peaks generation.
+type PeaksOptions struct {
+	// SamplesPerPixel is the number of audio frames summarized by each
+	// point.
+	SamplesPerPixel int
+	// Bits is the resolution of each point, 8 or 16.
+	Bits int
+	// RMS adds the root mean square of each point to the JSON format.
+	RMS bool
+}
+
+func (o PeaksOptions) withDefaults() PeaksOptions {
+	if o.SamplesPerPixel <= 0 {
+		o.SamplesPerPixel = DefaultSamplesPerPixel
+	}
+	if o.Bits == 0 {
+		o.Bits = DefaultBits
+	}
+	return o
+}
+
+// Peaks is the min and max of each channel for every SamplesPerPixel
+// frames of audio, in the format of BBC's audiowaveform as read by players
+// like peaks.js. See
+// https://github.com/bbc/audiowaveform/blob/master/doc/DataFormat.md
+type Peaks struct {
+	Version         int `json:"version"`
+	Channels        int `json:"channels"`
+	SampleRate      int `json:"sample_rate"`
+	SamplesPerPixel int `json:"samples_per_pixel"`
+	Bits            int `json:"bits"`
+	// Length is the number of points.
+	Length int `json:"length"`
+	// Data is min and max pairs for each channel, interleaved by point.
+	Data []int `json:"data"`
+	// RMS is the root mean square of each channel, interleaved by point.
+	// It isn't part of the binary format.
+	RMS []int `json:"rms,omitempty"`
+}
+
+// PeaksFromFile generates the peaks of a WAV file.
+func PeaksFromFile(wavFilepath string, opts PeaksOptions) (*Peaks, error) {
+	f, err := os.Open(wavFilepath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return PeaksFromReader(f, opts)
+}
+
+// PeaksFromReader generates the peaks of the WAV read from r, decoding it a
+// chunk at a time. Samples are scaled from the WAV's full scale to that of
+// opts.Bits, so WAVs of any bit depth or float samples give the same peaks.
+func PeaksFromReader(r io.Reader, opts PeaksOptions) (*Peaks, error) {
+	pcm, err := newPCMReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("decode wav: %w", err)
+	}
+
+	b, err := newPeaksBuilder(pcm.format, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := pcm.eachFrame(b.add); err != nil {
+		return nil, err
+	}
+
+	return b.peaks()
+}
+
+// peaksBuilder accumulates Peaks a frame at a time.
+type peaksBuilder struct {
+	p       *Peaks
+	opts    PeaksOptions
+	scale   func(float64) int
+	fullMax float64
+
+	// The point being accumulated, per channel
+	mins, maxs []int
+	sumSquares []float64
+	frames     int
+}
+
+func newPeaksBuilder(f format, opts PeaksOptions) (*peaksBuilder, error) {
+	opts = opts.withDefaults()
+	if opts.Bits != 8 && opts.Bits != 16 {
+		return nil, fmt.Errorf("unsupported bits %d: must be 8 or 16", opts.Bits)
+	}
+
+	b := &peaksBuilder{
+		p: &Peaks{
+			Version:         peaksVersion,
+			Channels:        f.Channels,
+			SampleRate:      f.SampleRate,
+			SamplesPerPixel: opts.SamplesPerPixel,
+			Bits:            opts.Bits,
+		},
+		opts:       opts,
+		scale:      newScaler(opts.Bits),
+		fullMax:    float64(int(1) << (opts.Bits - 1)),
+		mins:       make([]int, f.Channels),
+		maxs:       make([]int, f.Channels),
+		sumSquares: make([]float64, f.Channels),
+	}
+	b.reset()
+
+	return b, nil
+}
+
+func (b *peaksBuilder) add(frame []float64) {
+	for ch, v := range frame {
+		sample := b.scale(v)
+		if sample < b.mins[ch] {
+			b.mins[ch] = sample
+		}
+		if sample > b.maxs[ch] {
+			b.maxs[ch] = sample
+		}
+		b.sumSquares[ch] += v * v
+	}
+	if b.frames++; b.frames == b.opts.SamplesPerPixel {
+		b.flush()
+	}
+}
+
+// flush adds the point being accumulated.
+func (b *peaksBuilder) flush() {
+	for ch := range b.mins {
+		b.p.Data = append(b.p.Data, b.mins[ch], b.maxs[ch])
+		if b.opts.RMS {
+			rms := math.Sqrt(b.sumSquares[ch]/float64(b.frames)) * b.fullMax
+			b.p.RMS = append(b.p.RMS, int(math.Round(rms)))
+		}
+	}
+	b.p.Length++
+	b.reset()
+}
+
+func (b *peaksBuilder) reset() {
+	for ch := range b.mins {
+		b.mins[ch], b.maxs[ch], b.sumSquares[ch] = math.MaxInt, math.MinInt, 0
+	}
+	b.frames = 0
+}
+
+// peaks is the peaks of every frame added.
+func (b *peaksBuilder) peaks() (*Peaks, error) {
+	if b.frames > 0 {
+		b.flush()
+	}
+	if b.p.Length == 0 {
+		return nil, ErrNoAudio
+	}
+	return b.p, nil
+}
+
+// newScaler returns a func converting normalized samples to signed samples
+// of bits.
+func newScaler(bits int) func(float64) int {
+	var (
+		max   = 1<<(bits-1) - 1
+		min   = -1 << (bits - 1)
+		scale = float64(int(1) << (bits - 1))
+	)
+
+	return func(v float64) int {
+		sample := int(math.Floor(v * scale))
+		switch {
+		case sample > max:
+			return max
+		case sample < min:
+			return min
+		}
+		return sample
+	}
+}
+
+// MarshalBinary encodes p in the audiowaveform .dat format. RMS isn't
+// included.
+func (p *Peaks) MarshalBinary() ([]byte, error) {
+	var flags uint32
+	switch p.Bits {
+	case 8:
+		flags = 1
+	case 16:
+	default:
+		return nil, fmt.Errorf("unsupported bits %d", p.Bits)
+	}
+
+	var buf bytes.Buffer
+	header := []any{
+		int32(p.Version),
+		flags,
+		int32(p.SampleRate),
+		int32(p.SamplesPerPixel),
+		uint32(p.Length),
+		int32(p.Channels),
+	}
+	for _, v := range header {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+
+	for _, v := range p.Data {
+		if p.Bits == 8 {
+			buf.WriteByte(byte(int8(v)))
+		} else {
+			binary.Write(&buf, binary.LittleEndian, int16(v))
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the audiowaveform .dat format, versions 1 and 2.
+func (p *Peaks) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	var header struct {
+		Version         int32
+		Flags           uint32
+		SampleRate      int32
+		SamplesPerPixel int32
+		Length          uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+
+	channels := int32(1)
+	switch header.Version {
+	case 1:
+	case 2:
+		if err := binary.Read(r, binary.LittleEndian, &channels); err != nil {
+			return fmt.Errorf("read channels: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported version %d", header.Version)
+	}
+
+	bits := 16
+	if header.Flags&1 == 1 {
+		bits = 8
+	}
+
+	points := int(header.Length) * int(channels) * 2
+	if points < 0 || points*bits/8 > r.Len() {
+		return fmt.Errorf("data truncated: want %d points", points)
+	}
+	values := make([]int, points)
+	for i := range values {
+		if bits == 8 {
+			b, _ := r.ReadByte()
+			values[i] = int(int8(b))
+		} else {
+			var v int16
+			binary.Read(r, binary.LittleEndian, &v)
+			values[i] = int(v)
+		}
+	}
+
+	*p = Peaks{
+		Version:         int(header.Version),
+		Channels:        int(channels),
+		SampleRate:      int(header.SampleRate),
+		SamplesPerPixel: int(header.SamplesPerPixel),
+		Bits:            bits,
+		Length:          int(header.Length),
+		Data:            values,
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package waveform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeaksFromReader(t *testing.T) {
+	// Stereo, the right channel inverted
+	samples := []int{
+		1000, -1000,
+		-2000, 2000,
+		32767, -32768,
+		0, 0,
+		256, -256,
+	}
+	wavs := map[string][]byte{
+		"16 bit": wavFile(formatPCM, 2, 44100, 16, pcm16(samples...)),
+		"24 bit": wavFile(formatPCM, 2, 44100, 24, pcm24(scaleInts(samples, 1<<8)...)),
+		"32 bit": wavFile(formatPCM, 2, 44100, 32, pcm32(scaleInts(samples, 1<<16)...)),
+	}
+	floats := make([]float32, len(samples))
+	for i, v := range samples {
+		floats[i] = float32(v) / (1 << 15)
+	}
+	wavs["float"] = wavFile(formatFloat, 2, 44100, 32, float32s(floats...))
+
+	var tests = []struct {
+		name string
+		opts PeaksOptions
+		data []int
+		rms  []int
+	}{
+		{
+			name: "16 bit",
+			opts: PeaksOptions{SamplesPerPixel: 2, Bits: 16},
+			data: []int{-2000, 1000, -1000, 2000, 0, 32767, -32768, 0, 256, 256, -256, -256},
+		},
+		{
+			name: "8 bit",
+			opts: PeaksOptions{SamplesPerPixel: 2, Bits: 8},
+			data: []int{-8, 3, -4, 7, 0, 127, -128, 0, 1, 1, -1, -1},
+		},
+		{
+			name: "rms",
+			opts: PeaksOptions{SamplesPerPixel: 4, Bits: 16, RMS: true},
+			data: []int{-2000, 32767, -32768, 2000, 256, 256, -256, -256},
+			rms:  []int{16422, 16422, 256, 256},
+		},
+	}
+
+	// Every source format gives the same peaks
+	for format, wav := range wavs {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				p, err := PeaksFromReader(bytes.NewReader(wav), tt.opts)
+				assert.NoError(t, err)
+				assert.Equal(t, 2, p.Version)
+				assert.Equal(t, 2, p.Channels)
+				assert.Equal(t, 44100, p.SampleRate)
+				assert.Equal(t, tt.opts.SamplesPerPixel, p.SamplesPerPixel)
+				assert.Equal(t, tt.opts.Bits, p.Bits)
+				assert.Equal(t, len(tt.data)/4, p.Length)
+				assert.Equal(t, tt.data, p.Data)
+				assert.Equal(t, tt.rms, p.RMS)
+			})
+		}
+	}
+
+	_, err := PeaksFromReader(bytes.NewReader(wavs["16 bit"]), PeaksOptions{Bits: 24})
+	assert.Error(t, err)
+}
+
+func scaleInts(samples []int, scale int) []int {
+	scaled := make([]int, len(samples))
+	for i, v := range samples {
+		scaled[i] = v * scale
+	}
+	return scaled
+}
+
+func TestPeaksFromReader8Bit(t *testing.T) {
+	// 8 bit WAVs are unsigned, centered on 128
+	wav := wavFile(formatPCM, 1, 8000, 8, pcm8(128, 255, 0, 128))
+
+	p, err := PeaksFromReader(bytes.NewReader(wav), PeaksOptions{SamplesPerPixel: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultBits, p.Bits)
+	assert.Equal(t, []int{-128, 127}, p.Data)
+
+	p, err = PeaksFromReader(bytes.NewReader(wav), PeaksOptions{SamplesPerPixel: 4, Bits: 16})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{-32768, 32512}, p.Data)
+}
+
+func TestPeaksFromReaderErrors(t *testing.T) {
+	_, err := PeaksFromReader(bytes.NewReader(wavFile(formatPCM, 1, 8000, 16, nil)), PeaksOptions{})
+	assert.ErrorIs(t, err, ErrNoAudio)
+
+	_, err = PeaksFromReader(bytes.NewReader([]byte("RIFF")), PeaksOptions{})
+	assert.ErrorIs(t, err, ErrNotWAV)
+
+	// A single frame is enough for a point
+	p, err := PeaksFromReader(bytes.NewReader(wavFile(formatPCM, 1, 8000, 16, pcm16(256))), PeaksOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p.Length)
+	assert.Equal(t, []int{1, 1}, p.Data)
+}
+
+func TestPeaksFromFile(t *testing.T) {
+	p, err := PeaksFromFile("../encoder/testdata/test.wav", PeaksOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultSamplesPerPixel, p.SamplesPerPixel)
+	assert.NotZero(t, p.Length)
+	assert.Len(t, p.Data, p.Length*p.Channels*2)
+	for i := 0; i < len(p.Data); i += 2 {
+		assert.LessOrEqual(t, p.Data[i], p.Data[i+1])
+	}
+}
+
+func TestPeaksFormats(t *testing.T) {
+	for _, bits := range []int{8, 16} {
+		p := &Peaks{
+			Version:         2,
+			Channels:        2,
+			SampleRate:      48000,
+			SamplesPerPixel: 512,
+			Bits:            bits,
+			Length:          2,
+			Data:            []int{-10, 10, -20, 20, -128, 127, 0, 0},
+			RMS:             []int{5, 10, 60, 0},
+		}
+
+		data, err := p.MarshalBinary()
+		assert.NoError(t, err)
+
+		// Header
+		assert.Equal(t, uint32(2), binary.LittleEndian.Uint32(data[0:]))
+		assert.Equal(t, uint32(map[int]uint32{8: 1, 16: 0}[bits]), binary.LittleEndian.Uint32(data[4:]))
+		assert.Equal(t, uint32(48000), binary.LittleEndian.Uint32(data[8:]))
+		assert.Equal(t, uint32(512), binary.LittleEndian.Uint32(data[12:]))
+		assert.Equal(t, uint32(2), binary.LittleEndian.Uint32(data[16:]))
+		assert.Equal(t, uint32(2), binary.LittleEndian.Uint32(data[20:]))
+		assert.Len(t, data, 24+len(p.Data)*bits/8)
+
+		var decoded Peaks
+		assert.NoError(t, decoded.UnmarshalBinary(data))
+		want := *p
+		want.RMS = nil
+		assert.Equal(t, want, decoded)
+
+		assert.Error(t, decoded.UnmarshalBinary(data[:len(data)-1]))
+	}
+
+	p := &Peaks{Version: 2, Channels: 1, SampleRate: 44100, SamplesPerPixel: 256, Bits: 8, Length: 1, Data: []int{-1, 1}}
+	data, err := json.Marshal(p)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"version":2,"channels":1,"sample_rate":44100,"samples_per_pixel":256,"bits":8,"length":1,"data":[-1,1]}`, string(data))
+}
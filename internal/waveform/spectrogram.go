@@ -0,0 +1,354 @@
+package waveform
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+const (
+	DefaultSpectrogramBands   = 128
+	DefaultSpectrogramFFTSize = 2048
+
+	// spectrogramRange is the dynamic range in dB drawn, below the loudest
+	// band.
+	spectrogramRange = 80
+)
+
+// SpectrogramOptions configures mel spectrogram images.
+type SpectrogramOptions struct {
+	Width  int
+	Height int
+	// Bands is the number of mel frequency bands, drawn bottom to top.
+	Bands int
+	// FFTSize is the number of frames in each FFT window, a power of two.
+	FFTSize int
+}
+
+func (o SpectrogramOptions) withDefaults() SpectrogramOptions {
+	if o.Width <= 0 {
+		o.Width = DefaultImageWidth
+	}
+	if o.Height <= 0 {
+		o.Height = DefaultImageHeight
+	}
+	if o.Bands <= 0 {
+		o.Bands = DefaultSpectrogramBands
+	}
+	if o.FFTSize <= 0 {
+		o.FFTSize = DefaultSpectrogramFFTSize
+	}
+	return o
+}
+
+func (o SpectrogramOptions) validate() error {
+	switch {
+	case o.Width > maxImageSize || o.Height > maxImageSize:
+		return fmt.Errorf("image size %dx%d exceeds %d", o.Width, o.Height, maxImageSize)
+	case o.FFTSize < 16 || o.FFTSize > 1<<16 || bits.OnesCount(uint(o.FFTSize)) != 1:
+		return fmt.Errorf("fft size %d: must be a power of two from 16 to 65536", o.FFTSize)
+	case o.Bands > o.FFTSize/2:
+		return fmt.Errorf("%d bands: must be at most half the fft size", o.Bands)
+	}
+	return nil
+}
+
+// spectrogramBuilder accumulates the mel band energies of FFT windows, half
+// overlapping, of frames mixed to mono. Window energies are summed into up
+// to 2*Width slots, pairs of which are merged as the audio grows, so it
+// needn't be known up front and memory is constant.
+type spectrogramBuilder struct {
+	opts    SpectrogramOptions
+	window  []float64
+	filters []melFilter
+	fft     []complex128
+
+	// samples buffers pos samples of the next window.
+	samples []float64
+	pos     int
+	windows int
+
+	slots  [][]float64
+	counts []int
+	// span is the number of windows in each slot.
+	span int
+}
+
+func newSpectrogramBuilder(f format, opts SpectrogramOptions) (*spectrogramBuilder, error) {
+	opts = opts.withDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return &spectrogramBuilder{
+		opts:    opts,
+		window:  hann(opts.FFTSize),
+		filters: melFilters(opts.Bands, opts.FFTSize, f.SampleRate),
+		fft:     make([]complex128, opts.FFTSize),
+		samples: make([]float64, opts.FFTSize),
+		span:    1,
+	}, nil
+}
+
+func (b *spectrogramBuilder) add(frame []float64) {
+	var mono float64
+	for _, v := range frame {
+		mono += v
+	}
+	b.samples[b.pos] = mono / float64(len(frame))
+
+	if b.pos++; b.pos == len(b.samples) {
+		b.transform()
+		hop := len(b.samples) / 2
+		copy(b.samples, b.samples[hop:])
+		b.pos -= hop
+	}
+}
+
+// transform adds the mel band energies of the buffered window.
+func (b *spectrogramBuilder) transform() {
+	for i, v := range b.samples {
+		b.fft[i] = complex(v*b.window[i], 0)
+	}
+	fftInPlace(b.fft)
+
+	if len(b.slots) == 0 || b.counts[len(b.slots)-1] == b.span {
+		if len(b.slots) == 2*b.opts.Width {
+			for i := 0; i < b.opts.Width; i++ {
+				for band, energy := range b.slots[2*i+1] {
+					b.slots[2*i][band] += energy
+				}
+				b.slots[i] = b.slots[2*i]
+				b.counts[i] = b.counts[2*i] + b.counts[2*i+1]
+			}
+			b.slots = b.slots[:b.opts.Width]
+			b.counts = b.counts[:b.opts.Width]
+			b.span *= 2
+		}
+		b.slots = append(b.slots, make([]float64, b.opts.Bands))
+		b.counts = append(b.counts, 0)
+	}
+
+	slot := b.slots[len(b.slots)-1]
+	for band, filter := range b.filters {
+		for i, w := range filter.weights {
+			v := b.fft[filter.start+i]
+			slot[band] += w * (real(v)*real(v) + imag(v)*imag(v))
+		}
+	}
+	b.counts[len(b.slots)-1]++
+	b.windows++
+}
+
+// png draws the spectrogram of every frame added as a PNG image.
+func (b *spectrogramBuilder) png() ([]byte, error) {
+	// Audio shorter than a window is zero padded.
+	if b.windows == 0 && b.pos > 0 {
+		for i := b.pos; i < len(b.samples); i++ {
+			b.samples[i] = 0
+		}
+		b.transform()
+	}
+	if b.windows == 0 {
+		return nil, ErrNoAudio
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, drawSpectrogram(b.columns(), b.opts)); err != nil {
+		return nil, fmt.Errorf("encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// columns resamples the slots to the mean band energies of each of Width
+// columns. With fewer slots than columns, slots span several columns.
+func (b *spectrogramBuilder) columns() [][]float64 {
+	var (
+		n    = len(b.slots)
+		cols = make([][]float64, b.opts.Width)
+	)
+	for x := range cols {
+		start := x * n / b.opts.Width
+		end := (x + 1) * n / b.opts.Width
+		if end <= start {
+			end = start + 1
+		}
+
+		col := make([]float64, b.opts.Bands)
+		var count int
+		for i := start; i < end; i++ {
+			for band, energy := range b.slots[i] {
+				col[band] += energy
+			}
+			count += b.counts[i]
+		}
+		for band := range col {
+			col[band] /= float64(count)
+		}
+		cols[x] = col
+	}
+
+	return cols
+}
+
+// drawSpectrogram draws band energies in dB from the loudest down by
+// spectrogramRange.
+func drawSpectrogram(cols [][]float64, opts SpectrogramOptions) *image.RGBA {
+	loudest := math.Inf(-1)
+	db := make([][]float64, len(cols))
+	for x, col := range cols {
+		db[x] = make([]float64, len(col))
+		for band, energy := range col {
+			db[x][band] = 10 * math.Log10(energy+1e-12)
+			if db[x][band] > loudest {
+				loudest = db[x][band]
+			}
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	for y := 0; y < opts.Height; y++ {
+		band := (opts.Height - 1 - y) * opts.Bands / opts.Height
+		for x := 0; x < opts.Width; x++ {
+			level := 1 - (loudest-db[x][band])/spectrogramRange
+			img.SetRGBA(x, y, colormap(level))
+		}
+	}
+
+	return img
+}
+
+// spectrogramColors are evenly spaced stops of the colormap, from silence
+// to the loudest band.
+var spectrogramColors = []color.RGBA{
+	{0, 0, 4, 255},
+	{81, 18, 124, 255},
+	{183, 55, 121, 255},
+	{252, 137, 97, 255},
+	{252, 253, 191, 255},
+}
+
+// colormap interpolates spectrogramColors at level, from 0 to 1.
+func colormap(level float64) color.RGBA {
+	switch {
+	case level <= 0 || math.IsNaN(level):
+		return spectrogramColors[0]
+	case level >= 1:
+		return spectrogramColors[len(spectrogramColors)-1]
+	}
+
+	pos := level * float64(len(spectrogramColors)-1)
+	i := int(pos)
+	t := pos - float64(i)
+	from, to := spectrogramColors[i], spectrogramColors[i+1]
+	lerp := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + t*(float64(b)-float64(a))))
+	}
+
+	return color.RGBA{lerp(from.R, to.R), lerp(from.G, to.G), lerp(from.B, to.B), 255}
+}
+
+// melFilter is a triangular filter over the FFT bins from start.
+type melFilter struct {
+	start   int
+	weights []float64
+}
+
+func hzToMel(hz float64) float64 {
+	return 2595 * math.Log10(1+hz/700)
+}
+
+func melToHz(mel float64) float64 {
+	return 700 * (math.Pow(10, mel/2595) - 1)
+}
+
+// melFilters is bands triangular filters evenly spaced on the mel scale up
+// to the Nyquist frequency, over the bins of an FFT of size n.
+func melFilters(bands, n, sampleRate int) []melFilter {
+	var (
+		maxMel = hzToMel(float64(sampleRate) / 2)
+		// edges are the filters' edges and centers in bins
+		edges = make([]float64, bands+2)
+	)
+	for i := range edges {
+		hz := melToHz(maxMel * float64(i) / float64(bands+1))
+		edges[i] = hz * float64(n) / float64(sampleRate)
+	}
+
+	filters := make([]melFilter, bands)
+	for band := range filters {
+		lo, center, hi := edges[band], edges[band+1], edges[band+2]
+		start := int(math.Ceil(lo))
+		end := int(math.Floor(hi))
+		if end > n/2 {
+			end = n / 2
+		}
+
+		var weights []float64
+		for bin := start; bin <= end; bin++ {
+			b := float64(bin)
+			switch {
+			case b <= center && center > lo:
+				weights = append(weights, (b-lo)/(center-lo))
+			case b > center && hi > center:
+				weights = append(weights, (hi-b)/(hi-center))
+			default:
+				weights = append(weights, 0)
+			}
+		}
+
+		// Low bands can be narrower than a bin, so take the nearest.
+		var sum float64
+		for _, w := range weights {
+			sum += w
+		}
+		if sum == 0 {
+			start = int(math.Round(center))
+			if start > n/2 {
+				start = n / 2
+			}
+			weights = []float64{1}
+		}
+
+		filters[band] = melFilter{start: start, weights: weights}
+	}
+
+	return filters
+}
+
+// hann is a Hann window of n samples.
+func hann(n int) []float64 {
+	w := make([]float64, n)
+	for i := range w {
+		w[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n))
+	}
+	return w
+}
+
+// fftInPlace is an iterative radix-2 FFT. len(x) must be a power of two.
+func fftInPlace(x []complex128) {
+	n := len(x)
+	shift := 64 - bits.TrailingZeros(uint(n))
+	for i := range x {
+		if j := int(bits.Reverse64(uint64(i)) >> shift); j > i {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], w*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+}
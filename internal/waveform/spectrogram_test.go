@@ -0,0 +1,128 @@
+package waveform
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFFT(t *testing.T) {
+	x := make([]complex128, 64)
+	for i := range x {
+		x[i] = complex(math.Sin(float64(i)*0.3)+float64(i%5), math.Cos(float64(i)))
+	}
+
+	// The naive DFT
+	want := make([]complex128, len(x))
+	for k := range want {
+		for n, v := range x {
+			want[k] += v * cmplx.Exp(complex(0, -2*math.Pi*float64(k*n)/float64(len(x))))
+		}
+	}
+
+	fftInPlace(x)
+	for k := range x {
+		assert.InDelta(t, real(want[k]), real(x[k]), 1e-9)
+		assert.InDelta(t, imag(want[k]), imag(x[k]), 1e-9)
+	}
+}
+
+func TestMelFilters(t *testing.T) {
+	filters := melFilters(128, 2048, 44100)
+	assert.Len(t, filters, 128)
+	for i, f := range filters {
+		assert.NotEmpty(t, f.weights, "band %d", i)
+		assert.LessOrEqual(t, f.start+len(f.weights)-1, 1024, "band %d", i)
+		if i > 0 {
+			assert.GreaterOrEqual(t, f.start, filters[i-1].start, "band %d", i)
+		}
+	}
+}
+
+// sine is 16 bit mono audio of a tone at hz.
+func sine(hz float64, frames, sampleRate int) []byte {
+	samples := make([]int, frames)
+	for i := range samples {
+		samples[i] = int(16000 * math.Sin(2*math.Pi*hz*float64(i)/float64(sampleRate)))
+	}
+	return wavFile(formatPCM, 1, sampleRate, 16, pcm16(samples...))
+}
+
+// loudestRow is the row of the brightest pixel in column x of img.
+func loudestRow(img image.Image, x int) int {
+	var (
+		row  int
+		best uint32
+	)
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		r, g, b, _ := img.At(x, y).RGBA()
+		if sum := r + g + b; sum > best {
+			row, best = y, sum
+		}
+	}
+	return row
+}
+
+// spectrogramFromWAV draws the spectrogram of a WAV.
+func spectrogramFromWAV(wav []byte, opts SpectrogramOptions) ([]byte, error) {
+	p, err := newPCMReader(bytes.NewReader(wav))
+	if err != nil {
+		return nil, err
+	}
+	b, err := newSpectrogramBuilder(p.format, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.eachFrame(b.add); err != nil {
+		return nil, err
+	}
+	return b.png()
+}
+
+func TestSpectrogram(t *testing.T) {
+	decode := func(data []byte, err error) image.Image {
+		t.Helper()
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return img
+	}
+
+	// Narrow images merge windows as the audio is read
+	for _, width := range []int{40, 4} {
+		opts := SpectrogramOptions{Width: width, Height: 64, Bands: 64, FFTSize: 1024}
+
+		low := decode(spectrogramFromWAV(sine(500, 22050, 22050), opts))
+		high := decode(spectrogramFromWAV(sine(4000, 22050, 22050), opts))
+		assert.Equal(t, width, low.Bounds().Dx())
+		assert.Equal(t, 64, low.Bounds().Dy())
+
+		// Higher tones are drawn higher up, everywhere
+		for _, x := range []int{0, width / 2, width - 1} {
+			assert.Less(t, loudestRow(high, x), loudestRow(low, x))
+		}
+	}
+
+	// Audio shorter than a window or with fewer windows than columns
+	opts := SpectrogramOptions{Width: 40, Height: 64, Bands: 64, FFTSize: 1024}
+	decode(spectrogramFromWAV(sine(500, 100, 22050), opts))
+	decode(spectrogramFromWAV(sine(500, 5000, 22050), opts))
+
+	_, err := spectrogramFromWAV(wavFile(formatPCM, 1, 8000, 16, nil), opts)
+	assert.ErrorIs(t, err, ErrNoAudio)
+
+	_, err = spectrogramFromWAV(sine(500, 100, 22050), SpectrogramOptions{FFTSize: 1000})
+	assert.Error(t, err)
+
+	_, err = spectrogramFromWAV(sine(500, 100, 22050), SpectrogramOptions{FFTSize: 64, Bands: 64})
+	assert.Error(t, err)
+}
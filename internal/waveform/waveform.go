@@ -2,14 +2,46 @@ package waveform
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"os"
 
-	"github.com/go-audio/wav"
 	"github.com/stemstr/storage/internal/encoder"
+	"github.com/stemstr/storage/internal/mimes"
 )
 
+const (
+	// waveformPoints is the number of points in a Waveform.
+	waveformPoints = 64
+	// waveformHeight is the range of each point above the minimum of 1.
+	waveformHeight = 64
+)
+
+// Generator summarizes audio in any format the encoder decodes. WAVs are
+// read directly.
 type Generator interface {
-	Waveform(context.Context, string) ([]int, error)
+	// Waveform summarizes the audio at req.InputPath as waveformPoints
+	// peaks from 1 for silence to 1+waveformHeight for full scale.
+	Waveform(context.Context, encoder.EncodeRequest) ([]int, error)
+	// Analyze generates the waveform, peaks and spectrogram of the audio
+	// at req.InputPath, decoding it once.
+	Analyze(ctx context.Context, req encoder.EncodeRequest, opts AnalyzeOptions) (*Analysis, error)
+}
+
+// AnalyzeOptions configures Analyze.
+type AnalyzeOptions struct {
+	Peaks       PeaksOptions
+	Spectrogram SpectrogramOptions
+}
+
+// Analysis is everything generated from a piece of audio.
+type Analysis struct {
+	Waveform []int
+	Peaks    *Peaks
+	// Spectrogram is a PNG image.
+	Spectrogram []byte
 }
 
 func New(enc encoder.Encoder) Generator {
@@ -20,67 +52,167 @@ type generator struct {
 	enc encoder.Encoder
 }
 
-func (g *generator) Waveform(ctx context.Context, wavFile string) ([]int, error) {
-	return getWaveformData(wavFile)
+func (g *generator) Waveform(ctx context.Context, req encoder.EncodeRequest) ([]int, error) {
+	var w *waveformSummary
+	err := g.decode(ctx, req, func(p *pcmReader) error {
+		w = &waveformSummary{}
+		return p.eachFrame(w.add)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return w.waveform()
+}
+
+func (g *generator) Analyze(ctx context.Context, req encoder.EncodeRequest, opts AnalyzeOptions) (*Analysis, error) {
+	var a *Analysis
+	err := g.decode(ctx, req, func(p *pcmReader) error {
+		var err error
+		a, err = analyze(p, opts)
+		return err
+	})
+	return a, err
+}
+
+// decode calls fn with the decoded audio at req.InputPath. WAVs in formats
+// pcmReader supports are read from the file, anything else is decoded by
+// the encoder.
+func (g *generator) decode(ctx context.Context, req encoder.EncodeRequest, fn func(*pcmReader) error) error {
+	if mimes.FileExtension(req.Mimetype) == ".wav" {
+		f, err := os.Open(req.InputPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		p, err := newPCMReader(f)
+		if err == nil {
+			return fn(p)
+		}
+		if !errors.Is(err, ErrUnsupportedFormat) {
+			return err
+		}
+	}
+
+	stream, err := g.enc.PCM(ctx, req)
+	if err != nil {
+		return fmt.Errorf("encoder.PCM: %w", err)
+	}
+	f := format{
+		Channels:   encoder.PCMChannels,
+		SampleRate: encoder.PCMSampleRate,
+		Bits:       encoder.PCMBits,
+	}
+	err = fn(f.reader(stream, unknownSize))
+
+	// Decoding errors, reported on Close, explain any others.
+	if closeErr := stream.Close(); closeErr != nil {
+		return fmt.Errorf("encoder.PCM: %w", closeErr)
+	}
+	return err
+}
+
+// AnalyzeReader generates the waveform, peaks and spectrogram of the WAV
+// read from r.
+func AnalyzeReader(r io.Reader, opts AnalyzeOptions) (*Analysis, error) {
+	p, err := newPCMReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("decode wav: %w", err)
+	}
+	return analyze(p, opts)
 }
 
-func getWaveformData(wavFilepath string) ([]int, error) {
-	f, err := os.Open(wavFilepath)
+func analyze(p *pcmReader, opts AnalyzeOptions) (*Analysis, error) {
+	peaks, err := newPeaksBuilder(p.format, opts.Peaks)
+	if err != nil {
+		return nil, err
+	}
+	spectrogram, err := newSpectrogramBuilder(p.format, opts.Spectrogram)
 	if err != nil {
 		return nil, err
 	}
+	w := &waveformSummary{}
 
-	d := wav.NewDecoder(f)
-	b, err := d.FullPCMBuffer()
+	err = p.eachFrame(func(frame []float64) {
+		w.add(frame)
+		peaks.add(frame)
+		spectrogram.add(frame)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	chunkSize := len(b.Data) / 64
-	pcmMin, pcmMax := 0, 0
-	var samples []int
-	var bucketData []int
-	bucket := chunkSize
-	for i, sample := range b.Data {
-		if sample < pcmMin {
-			pcmMin = sample
-		}
-		if sample > pcmMax {
-			pcmMax = sample
-		}
+	var a Analysis
+	if a.Waveform, err = w.waveform(); err != nil {
+		return nil, err
+	}
+	if a.Peaks, err = peaks.peaks(); err != nil {
+		return nil, err
+	}
+	if a.Spectrogram, err = spectrogram.png(); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// waveformSummary accumulates the peak amplitude, across channels, of up
+// to 2*waveformPoints slots of frames. Pairs of slots are merged as the
+// audio grows, so it needn't be known up front and memory is constant.
+type waveformSummary struct {
+	slots []float64
+	// span is the number of frames in each slot, filled the number in the
+	// last.
+	span   int64
+	filled int64
+	frames int64
+}
 
-		if i < bucket {
-			bucketData = append(bucketData, sample)
-		} else {
-			// Average the bucketData, add to samples, reset
-			n := 0
-			for _, v := range bucketData {
-				n += v
+func (w *waveformSummary) add(frame []float64) {
+	switch {
+	case len(w.slots) == 0:
+		w.span = 1
+		w.slots = append(w.slots, 0)
+	case w.filled == w.span:
+		if len(w.slots) == 2*waveformPoints {
+			for i := 0; i < waveformPoints; i++ {
+				w.slots[i] = math.Max(w.slots[2*i], w.slots[2*i+1])
 			}
-			avg := int(n / len(bucketData))
-			samples = append(samples, avg)
-			bucketData = []int{}
-			bucket += chunkSize
+			w.slots = w.slots[:waveformPoints]
+			w.span *= 2
 		}
+		w.slots = append(w.slots, 0)
+		w.filled = 0
 	}
 
-	min, max := 0, 0
-	for _, x := range samples {
-		if x < min {
-			min = x
-		}
-		if x > max {
-			max = x
-		}
+	last := &w.slots[len(w.slots)-1]
+	for _, v := range frame {
+		*last = math.Max(*last, math.Abs(v))
+	}
+	w.filled++
+	w.frames++
+}
+
+func (w *waveformSummary) waveform() ([]int, error) {
+	switch {
+	case w.frames == 0:
+		return nil, ErrNoAudio
+	case w.frames < waveformPoints:
+		return nil, fmt.Errorf("%w: %d frames", ErrTooShort, w.frames)
 	}
 
-	var normalizedSamples []int
-	for _, x := range samples {
-		// Now normalize the values between 1-100
-		//sample := int(1 + ((x-(min))*(100-1))/(max-(min)))
-		sample := int(1 + ((x-(min))*(80-16))/(max-(min)))
-		normalizedSamples = append(normalizedSamples, sample)
+	var (
+		n       = len(w.slots)
+		samples = make([]int, waveformPoints)
+	)
+	for i := range samples {
+		var peak float64
+		for _, v := range w.slots[i*n/waveformPoints : (i+1)*n/waveformPoints] {
+			peak = math.Max(peak, v)
+		}
+		samples[i] = 1 + int(math.Round(peak*waveformHeight))
 	}
 
-	return normalizedSamples, nil
+	return samples, nil
 }
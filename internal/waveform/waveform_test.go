@@ -1,7 +1,13 @@
 package waveform
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
+	"image/png"
+	"io"
+	"math"
 	"testing"
 
 	"github.com/stemstr/storage/internal/encoder"
@@ -20,7 +26,154 @@ func TestWaveformGenerator(t *testing.T) {
 		Bitrate:          "128k",
 	})
 
-	data, err := New(enc).Waveform(context.Background(), audioFile)
+	data, err := New(enc).Waveform(context.Background(), encoder.EncodeRequest{
+		Mimetype:  "audio/wave",
+		InputPath: audioFile,
+	})
 	assert.NoError(t, err)
 	assert.NotEmpty(t, data)
 }
+
+// fakeEncoder decodes to pcm, or fails with err when it's closed.
+type fakeEncoder struct {
+	encoder.Encoder
+	pcm []byte
+	err error
+}
+
+func (e *fakeEncoder) PCM(ctx context.Context, req encoder.EncodeRequest) (io.ReadCloser, error) {
+	return &fakeStream{Reader: bytes.NewReader(e.pcm), err: e.err}, nil
+}
+
+type fakeStream struct {
+	io.Reader
+	err error
+}
+
+func (s *fakeStream) Close() error { return s.err }
+
+func TestAnalyze(t *testing.T) {
+	// A second of a tone at 16 bit, the encoder's stereo
+	frames := encoder.PCMSampleRate
+	samples := make([]int, 2*frames)
+	for i := 0; i < frames; i++ {
+		v := int(16384 * math.Sin(2*math.Pi*440*float64(i)/encoder.PCMSampleRate))
+		samples[2*i], samples[2*i+1] = v, v
+	}
+	pcm := pcm16(samples...)
+
+	var (
+		ctx  = context.Background()
+		opts = AnalyzeOptions{
+			Peaks:       PeaksOptions{SamplesPerPixel: 441},
+			Spectrogram: SpectrogramOptions{Width: 20, Height: 10},
+		}
+		wav = writeWAV(t, wavFile(formatPCM, 2, encoder.PCMSampleRate, 16, pcm))
+		mp3 = writeWAV(t, []byte("not decoded"))
+	)
+
+	// WAVs are read directly, anything else is decoded by the encoder, to
+	// the same analysis.
+	fromWAV, err := New(&fakeEncoder{}).Analyze(ctx, encoder.EncodeRequest{Mimetype: "audio/wav", InputPath: wav}, opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	fromPCM, err := New(&fakeEncoder{pcm: pcm}).Analyze(ctx, encoder.EncodeRequest{Mimetype: "audio/mp3", InputPath: mp3}, opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, fromWAV, fromPCM)
+
+	assert.Len(t, fromWAV.Waveform, waveformPoints)
+	for _, v := range fromWAV.Waveform {
+		assert.Equal(t, 1+waveformHeight/2, v)
+	}
+	assert.Equal(t, 100, fromWAV.Peaks.Length)
+	assert.Equal(t, encoder.PCMSampleRate, fromWAV.Peaks.SampleRate)
+	img, err := png.Decode(bytes.NewReader(fromWAV.Spectrogram))
+	assert.NoError(t, err)
+	assert.Equal(t, 20, img.Bounds().Dx())
+
+	waveform, err := New(&fakeEncoder{pcm: pcm}).Waveform(ctx, encoder.EncodeRequest{Mimetype: "audio/mp3", InputPath: mp3})
+	assert.NoError(t, err)
+	assert.Equal(t, fromWAV.Waveform, waveform)
+
+	// WAVs we can't read are decoded by the encoder
+	alaw := writeWAV(t, wavFile(6, 2, encoder.PCMSampleRate, 8, make([]byte, 100)))
+	fromALaw, err := New(&fakeEncoder{pcm: pcm}).Analyze(ctx, encoder.EncodeRequest{Mimetype: "audio/wav", InputPath: alaw}, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, fromWAV, fromALaw)
+
+	// Decoding errors explain the lack of audio
+	decodeErr := errors.New("invalid data found when processing input")
+	_, err = New(&fakeEncoder{err: decodeErr}).Analyze(ctx, encoder.EncodeRequest{Mimetype: "audio/mp3", InputPath: mp3}, opts)
+	assert.ErrorIs(t, err, decodeErr)
+
+	_, err = New(&fakeEncoder{}).Analyze(ctx, encoder.EncodeRequest{Mimetype: "audio/mp3", InputPath: mp3}, opts)
+	assert.ErrorIs(t, err, ErrNoAudio)
+
+	_, err = New(&fakeEncoder{}).Analyze(ctx, encoder.EncodeRequest{Mimetype: "audio/wav", InputPath: mp3}, opts)
+	assert.ErrorIs(t, err, ErrNotWAV)
+}
+
+// waveformFromWAV summarizes a WAV as Generator.Waveform.
+func waveformFromWAV(wav []byte) ([]int, error) {
+	p, err := newPCMReader(bytes.NewReader(wav))
+	if err != nil {
+		return nil, err
+	}
+	w := &waveformSummary{}
+	if err := p.eachFrame(w.add); err != nil {
+		return nil, err
+	}
+	return w.waveform()
+}
+
+func TestWaveform(t *testing.T) {
+	// A ramp from silence to full scale, the same in every format
+	ramp := make([]int, 64*100)
+	for i := range ramp {
+		ramp[i] = i * 32767 / (len(ramp) - 1)
+	}
+	floats := make([]float32, len(ramp))
+	for i, v := range ramp {
+		floats[i] = float32(v) / (1 << 15)
+	}
+
+	wavs := map[string][]byte{
+		"16 bit": wavFile(formatPCM, 1, 8000, 16, pcm16(ramp...)),
+		"24 bit": wavFile(formatPCM, 1, 8000, 24, pcm24(scaleInts(ramp, 1<<8)...)),
+		"float":  wavFile(formatFloat, 1, 8000, 32, float32s(floats...)),
+	}
+	streamed := wavFile(formatPCM, 1, 8000, 16, pcm16(ramp...))
+	binary.LittleEndian.PutUint32(streamed[40:], unknownSize)
+	wavs["streamed"] = streamed
+
+	var want []int
+	for format, wav := range wavs {
+		data, err := waveformFromWAV(wav)
+		assert.NoError(t, err, format)
+		assert.Len(t, data, waveformPoints, format)
+		assert.Equal(t, 2, data[0], format)
+		assert.Equal(t, 1+waveformHeight, data[len(data)-1], format)
+		assert.IsNonDecreasing(t, data, format)
+		if want == nil {
+			want = data
+		}
+		assert.Equal(t, want, data, format)
+	}
+
+	_, err := waveformFromWAV(wavFile(formatPCM, 1, 8000, 16, nil))
+	assert.ErrorIs(t, err, ErrNoAudio)
+
+	_, err = waveformFromWAV(wavFile(formatPCM, 1, 8000, 16, pcm16(ramp[:63]...)))
+	assert.ErrorIs(t, err, ErrTooShort)
+
+	// The data chunk claims more frames than the file holds
+	truncated := wavFile(formatPCM, 1, 8000, 16, pcm16(ramp...))
+	_, err = waveformFromWAV(truncated[:44+2*10])
+	assert.ErrorIs(t, err, ErrTooShort)
+
+	_, err = waveformFromWAV([]byte("not a wav"))
+	assert.ErrorIs(t, err, ErrNotWAV)
+}
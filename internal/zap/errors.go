@@ -0,0 +1,8 @@
+package zap
+
+import "errors"
+
+var (
+	ErrInvalidRequest = errors.New("invalid zap request")
+	ErrNoTier         = errors.New("amount doesn't match a subscription option")
+)
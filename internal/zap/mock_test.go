@@ -0,0 +1,57 @@
+package zap
+
+import (
+	"context"
+
+	"github.com/stemstr/storage/internal/subscription"
+)
+
+type mockSubscriptionService struct {
+	CreateSub          *subscription.Subscription
+	CreateErr          error
+	GetSubscriptionSub *subscription.Subscription
+	GetSubscriptionErr error
+
+	// Created records the last subscription and description passed to
+	// CreateSubscriptionWithDescription
+	Created     subscription.Subscription
+	Description string
+}
+
+func (m *mockSubscriptionService) CreateSubscriptionWithDescription(ctx context.Context, sub subscription.Subscription, description string) (*subscription.Subscription, error) {
+	m.Created = sub
+	m.Description = description
+	return m.CreateSub, m.CreateErr
+}
+func (m *mockSubscriptionService) GetSubscription(ctx context.Context, id int64) (*subscription.Subscription, error) {
+	return m.GetSubscriptionSub, m.GetSubscriptionErr
+}
+
+type mockZapRepo struct {
+	CreateZapErr error
+	UnsentZaps   []Zap
+	GetUnsentErr error
+	ClaimBool    bool
+	ClaimErr     error
+	ReleaseErr   error
+
+	// Created records the last zap passed to CreateZap
+	Created Zap
+	// Released records invoice IDs passed to ReleaseZapReceipt
+	Released []string
+}
+
+func (m *mockZapRepo) CreateZap(ctx context.Context, zap Zap) error {
+	m.Created = zap
+	return m.CreateZapErr
+}
+func (m *mockZapRepo) GetUnsentZaps(ctx context.Context, limit int) ([]Zap, error) {
+	return m.UnsentZaps, m.GetUnsentErr
+}
+func (m *mockZapRepo) ClaimZapReceipt(ctx context.Context, invoiceID string) (bool, error) {
+	return m.ClaimBool, m.ClaimErr
+}
+func (m *mockZapRepo) ReleaseZapReceipt(ctx context.Context, invoiceID string) error {
+	m.Released = append(m.Released, invoiceID)
+	return m.ReleaseErr
+}
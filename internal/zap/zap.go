@@ -0,0 +1,290 @@
+// Package zap credits subscriptions paid with NIP-57 zaps and publishes the
+// zap receipts.
+package zap
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+
+	"github.com/stemstr/storage/internal/subscription"
+)
+
+const (
+	KindRequest = 9734
+	KindReceipt = 9735
+
+	// receiptBatch caps how many receipts SendReceipts publishes per call.
+	receiptBatch = 100
+)
+
+// Publisher publishes ev to relays, signing it with the key advertised as
+// the LNURL nostrPubkey.
+type Publisher func(ctx context.Context, ev nostr.Event, relays []string) error
+
+func New(subs subscriptionService, repo zapRepo, publish Publisher, pubkey string, tiers []Tier) (*Service, error) {
+	if pubkey == "" {
+		return nil, fmt.Errorf("pubkey required")
+	}
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("at least one tier required")
+	}
+
+	return &Service{
+		subs:    subs,
+		repo:    repo,
+		publish: publish,
+		pubkey:  pubkey,
+		tiers:   tiers,
+	}, nil
+}
+
+type Service struct {
+	subs    subscriptionService
+	repo    zapRepo
+	publish Publisher
+	pubkey  string
+	tiers   []Tier
+}
+
+type subscriptionService interface {
+	CreateSubscriptionWithDescription(ctx context.Context, sub subscription.Subscription, description string) (*subscription.Subscription, error)
+	GetSubscription(ctx context.Context, id int64) (*subscription.Subscription, error)
+}
+
+type zapRepo interface {
+	CreateZap(ctx context.Context, zap Zap) error
+	// GetUnsentZaps lists zaps whose subscription is paid but whose
+	// receipt hasn't been sent, oldest first.
+	GetUnsentZaps(ctx context.Context, limit int) ([]Zap, error)
+	// ClaimZapReceipt marks a zap's receipt as sent, reporting false if
+	// it already was.
+	ClaimZapReceipt(ctx context.Context, invoiceID string) (bool, error)
+	// ReleaseZapReceipt undoes ClaimZapReceipt after a failed publish.
+	ReleaseZapReceipt(ctx context.Context, invoiceID string) error
+}
+
+// Tier is a subscription option that can be bought with a zap of exactly
+// Sats.
+type Tier struct {
+	Days int
+	Sats int
+}
+
+// Zap links a zap request to the subscription it pays for.
+type Zap struct {
+	InvoiceID      string     `db:"invoice_id"`
+	SubscriptionID int64      `db:"subscription_id"`
+	Request        string     `db:"request"`
+	ReceiptSentAt  *time.Time `db:"receipt_sent_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
+
+// Request is a validated zap request.
+type Request struct {
+	Event nostr.Event
+	// Raw is the request as sent by the wallet. The invoice commits to
+	// its hash.
+	Raw string
+	// Amount in millisats
+	Amount int64
+}
+
+// Pubkey is the key zap receipts are signed with.
+func (s *Service) Pubkey() string {
+	return s.pubkey
+}
+
+// Sendable is the range of zap amounts, in millisats, that buy a tier.
+func (s *Service) Sendable() (min, max int64) {
+	for i, tier := range s.tiers {
+		msats := int64(tier.Sats) * 1000
+		if i == 0 || msats < min {
+			min = msats
+		}
+		if msats > max {
+			max = msats
+		}
+	}
+	return min, max
+}
+
+// TierFor finds the tier bought by a zap of amount millisats.
+func (s *Service) TierFor(amount int64) (Tier, error) {
+	for _, tier := range s.tiers {
+		if int64(tier.Sats)*1000 == amount {
+			return tier, nil
+		}
+	}
+	return Tier{}, fmt.Errorf("%w: %d msats", ErrNoTier, amount)
+}
+
+// ParseRequest decodes and validates a zap request sent to the LNURL
+// callback for amount millisats, per NIP-57 appendix D.
+func (s *Service) ParseRequest(raw string, amount int64) (*Request, error) {
+	var ev nostr.Event
+	if err := ev.UnmarshalJSON([]byte(raw)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+
+	if ev.Kind != KindRequest {
+		return nil, fmt.Errorf("%w: kind %d", ErrInvalidRequest, ev.Kind)
+	}
+	if ok, err := ev.CheckSignature(); !ok {
+		return nil, fmt.Errorf("%w: bad signature: %v", ErrInvalidRequest, err)
+	}
+	if len(ev.Tags) == 0 {
+		return nil, fmt.Errorf("%w: no tags", ErrInvalidRequest)
+	}
+	// Tag lookups end in "" so names match exactly rather than as prefixes
+	if n := len(ev.Tags.GetAll([]string{"p", ""})); n != 1 {
+		return nil, fmt.Errorf("%w: %d p tags", ErrInvalidRequest, n)
+	}
+	if n := len(ev.Tags.GetAll([]string{"e", ""})); n > 1 {
+		return nil, fmt.Errorf("%w: %d e tags", ErrInvalidRequest, n)
+	}
+	if len(relays(ev)) == 0 {
+		return nil, fmt.Errorf("%w: no relays", ErrInvalidRequest)
+	}
+	if tag := ev.Tags.GetFirst([]string{"amount", ""}); tag != nil {
+		tagged, err := strconv.ParseInt(tag.Value(), 10, 64)
+		if err != nil || tagged != amount {
+			return nil, fmt.Errorf("%w: amount tag %q doesn't match %d", ErrInvalidRequest, tag.Value(), amount)
+		}
+	}
+
+	return &Request{
+		Event:  ev,
+		Raw:    raw,
+		Amount: amount,
+	}, nil
+}
+
+// CreateInvoice creates a pending subscription for the zapper, paid by an
+// invoice committing to the zap request.
+func (s *Service) CreateInvoice(ctx context.Context, req Request) (*subscription.Subscription, error) {
+	tier, err := s.TierFor(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := s.subs.CreateSubscriptionWithDescription(ctx, subscription.Subscription{
+		Pubkey: req.Event.PubKey,
+		Days:   tier.Days,
+		Sats:   tier.Sats,
+	}, req.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("CreateSubscription: %w", err)
+	}
+
+	if err := s.repo.CreateZap(ctx, Zap{
+		InvoiceID:      sub.InvoiceID,
+		SubscriptionID: sub.ID,
+		Request:        req.Raw,
+	}); err != nil {
+		return nil, fmt.Errorf("repo.CreateZap: %w", err)
+	}
+
+	return sub, nil
+}
+
+// SendReceipts publishes receipts for zaps that have been paid. It returns
+// the number published.
+func (s *Service) SendReceipts(ctx context.Context) (int, error) {
+	zaps, err := s.repo.GetUnsentZaps(ctx, receiptBatch)
+	if err != nil {
+		return 0, fmt.Errorf("repo.GetUnsentZaps: %w", err)
+	}
+
+	var sent int
+	for _, zap := range zaps {
+		claimed, err := s.repo.ClaimZapReceipt(ctx, zap.InvoiceID)
+		if err != nil {
+			return sent, fmt.Errorf("repo.ClaimZapReceipt: %w", err)
+		}
+		if !claimed {
+			// Another instance got there first
+			continue
+		}
+
+		if err := s.sendReceipt(ctx, zap); err != nil {
+			if err := s.repo.ReleaseZapReceipt(ctx, zap.InvoiceID); err != nil {
+				log.Printf("zap: release receipt %s: %v", zap.InvoiceID, err)
+			}
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+func (s *Service) sendReceipt(ctx context.Context, zap Zap) error {
+	var req nostr.Event
+	if err := req.UnmarshalJSON([]byte(zap.Request)); err != nil {
+		return fmt.Errorf("decode zap request %s: %w", zap.InvoiceID, err)
+	}
+
+	sub, err := s.subs.GetSubscription(ctx, zap.SubscriptionID)
+	if err != nil {
+		return fmt.Errorf("GetSubscription: %w", err)
+	}
+
+	if err := s.publish(ctx, receipt(req, zap.Request, sub.LightningInvoice), relays(req)); err != nil {
+		return fmt.Errorf("publish receipt %s: %w", zap.InvoiceID, err)
+	}
+
+	return nil
+}
+
+// Run sends zap receipts every interval until ctx is done.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.SendReceipts(ctx); err != nil {
+				log.Printf("zap: %v", err)
+			}
+		}
+	}
+}
+
+// receipt builds the unsigned kind 9735 receipt for a paid zap request.
+func receipt(req nostr.Event, raw, bolt11 string) nostr.Event {
+	tags := nostr.Tags{}
+	for _, name := range []string{"p", "e", "a"} {
+		if tag := req.Tags.GetFirst([]string{name, ""}); tag != nil {
+			tags = append(tags, nostr.Tag{name, tag.Value()})
+		}
+	}
+	tags = append(tags,
+		nostr.Tag{"P", req.PubKey},
+		nostr.Tag{"bolt11", bolt11},
+		nostr.Tag{"description", raw},
+	)
+
+	return nostr.Event{
+		Kind:      KindReceipt,
+		CreatedAt: nostr.Now(),
+		Tags:      tags,
+	}
+}
+
+// relays lists the relays a zap request asks for its receipt to be
+// published to.
+func relays(req nostr.Event) []string {
+	tag := req.Tags.GetFirst([]string{"relays", ""})
+	if tag == nil || len(*tag) < 2 {
+		return nil
+	}
+	return (*tag)[1:]
+}
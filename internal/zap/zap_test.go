@@ -0,0 +1,246 @@
+package zap
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stemstr/storage/internal/subscription"
+)
+
+var tiers = []Tier{{Days: 30, Sats: 1000}, {Days: 365, Sats: 10000}}
+
+func zapRequest(t *testing.T, tags nostr.Tags, mutate func(*nostr.Event)) string {
+	t.Helper()
+	ev := nostr.Event{
+		Kind:      KindRequest,
+		CreatedAt: nostr.Now(),
+		Tags:      tags,
+	}
+	assert.NoError(t, ev.Sign(nostr.GeneratePrivateKey()))
+	if mutate != nil {
+		mutate(&ev)
+	}
+	b, err := ev.MarshalJSON()
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestParseRequest(t *testing.T) {
+	svc, err := New(&mockSubscriptionService{}, &mockZapRepo{}, nil, "pub", tiers)
+	assert.NoError(t, err)
+
+	valid := nostr.Tags{
+		{"p", "recipient"},
+		{"relays", "wss://relay.example"},
+		{"amount", "1000000"},
+	}
+
+	tests := []struct {
+		name    string
+		raw     string
+		amount  int64
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			raw:    zapRequest(t, valid, nil),
+			amount: 1000000,
+		},
+		{
+			name:   "no amount tag",
+			raw:    zapRequest(t, nostr.Tags{{"p", "recipient"}, {"relays", "wss://relay.example"}}, nil),
+			amount: 1000000,
+		},
+		{
+			name:    "amount mismatch",
+			raw:     zapRequest(t, valid, nil),
+			amount:  2000000,
+			wantErr: true,
+		},
+		{
+			name:    "not json",
+			raw:     "zap",
+			amount:  1000000,
+			wantErr: true,
+		},
+		{
+			name:    "wrong kind",
+			raw:     zapRequest(t, valid, func(ev *nostr.Event) { ev.Kind = 1 }),
+			amount:  1000000,
+			wantErr: true,
+		},
+		{
+			name:    "bad signature",
+			raw:     zapRequest(t, valid, func(ev *nostr.Event) { ev.Content = "tampered" }),
+			amount:  1000000,
+			wantErr: true,
+		},
+		{
+			name:    "no p tag",
+			raw:     zapRequest(t, nostr.Tags{{"relays", "wss://relay.example"}}, nil),
+			amount:  1000000,
+			wantErr: true,
+		},
+		{
+			name:    "two p tags",
+			raw:     zapRequest(t, nostr.Tags{{"p", "a"}, {"p", "b"}, {"relays", "wss://relay.example"}}, nil),
+			amount:  1000000,
+			wantErr: true,
+		},
+		{
+			name:    "two e tags",
+			raw:     zapRequest(t, nostr.Tags{{"p", "a"}, {"e", "a"}, {"e", "b"}, {"relays", "wss://relay.example"}}, nil),
+			amount:  1000000,
+			wantErr: true,
+		},
+		{
+			name:    "no relays",
+			raw:     zapRequest(t, nostr.Tags{{"p", "a"}}, nil),
+			amount:  1000000,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := svc.ParseRequest(tt.raw, tt.amount)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidRequest)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.raw, req.Raw)
+			assert.Equal(t, tt.amount, req.Amount)
+		})
+	}
+}
+
+func TestTiers(t *testing.T) {
+	svc, err := New(&mockSubscriptionService{}, &mockZapRepo{}, nil, "pub", tiers)
+	assert.NoError(t, err)
+
+	min, max := svc.Sendable()
+	assert.Equal(t, int64(1000000), min)
+	assert.Equal(t, int64(10000000), max)
+
+	tier, err := svc.TierFor(10000000)
+	assert.NoError(t, err)
+	assert.Equal(t, 365, tier.Days)
+
+	_, err = svc.TierFor(1000001)
+	assert.ErrorIs(t, err, ErrNoTier)
+
+	_, err = New(&mockSubscriptionService{}, &mockZapRepo{}, nil, "pub", nil)
+	assert.Error(t, err)
+}
+
+func TestCreateInvoice(t *testing.T) {
+	subs := &mockSubscriptionService{
+		CreateSub: &subscription.Subscription{ID: 7, InvoiceID: "inv"},
+	}
+	repo := &mockZapRepo{}
+	svc, err := New(subs, repo, nil, "pub", tiers)
+	assert.NoError(t, err)
+
+	raw := zapRequest(t, nostr.Tags{{"p", "recipient"}, {"relays", "wss://relay.example"}}, nil)
+	req, err := svc.ParseRequest(raw, 1000000)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	sub, err := svc.CreateInvoice(ctx, *req)
+	assert.NoError(t, err)
+	assert.Equal(t, "inv", sub.InvoiceID)
+	assert.Equal(t, req.Event.PubKey, subs.Created.Pubkey)
+	assert.Equal(t, 30, subs.Created.Days)
+	assert.Equal(t, 1000, subs.Created.Sats)
+	assert.Equal(t, raw, subs.Description)
+	assert.Equal(t, Zap{InvoiceID: "inv", SubscriptionID: 7, Request: raw}, repo.Created)
+
+	// Amount not matching a tier
+	req.Amount = 5
+	_, err = svc.CreateInvoice(ctx, *req)
+	assert.ErrorIs(t, err, ErrNoTier)
+}
+
+func TestSendReceipts(t *testing.T) {
+	raw := zapRequest(t, nostr.Tags{
+		{"p", "recipient"},
+		{"e", "note"},
+		{"relays", "wss://a.example", "wss://b.example"},
+	}, nil)
+	var req nostr.Event
+	assert.NoError(t, req.UnmarshalJSON([]byte(raw)))
+
+	subs := &mockSubscriptionService{
+		GetSubscriptionSub: &subscription.Subscription{ID: 7, LightningInvoice: "lnbc"},
+	}
+
+	tests := []struct {
+		name       string
+		repo       *mockZapRepo
+		publishErr error
+		sent       int
+		wantErr    bool
+		released   []string
+	}{
+		{
+			name: "sent",
+			repo: &mockZapRepo{UnsentZaps: []Zap{{InvoiceID: "inv", SubscriptionID: 7, Request: raw}}, ClaimBool: true},
+			sent: 1,
+		},
+		{
+			name: "claimed elsewhere",
+			repo: &mockZapRepo{UnsentZaps: []Zap{{InvoiceID: "inv", SubscriptionID: 7, Request: raw}}, ClaimBool: false},
+			sent: 0,
+		},
+		{
+			name:       "publish failed",
+			repo:       &mockZapRepo{UnsentZaps: []Zap{{InvoiceID: "inv", SubscriptionID: 7, Request: raw}}, ClaimBool: true},
+			publishErr: errors.New("relay down"),
+			wantErr:    true,
+			released:   []string{"inv"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var published []nostr.Event
+			var publishedTo []string
+			publish := func(ctx context.Context, ev nostr.Event, relays []string) error {
+				published = append(published, ev)
+				publishedTo = relays
+				return tt.publishErr
+			}
+
+			svc, err := New(subs, tt.repo, publish, "pub", tiers)
+			assert.NoError(t, err)
+
+			sent, err := svc.SendReceipts(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.sent, sent)
+			assert.Equal(t, tt.released, tt.repo.Released)
+
+			if tt.sent == 0 {
+				return
+			}
+			ev := published[0]
+			assert.Equal(t, KindReceipt, ev.Kind)
+			assert.Equal(t, []string{"wss://a.example", "wss://b.example"}, publishedTo)
+			assert.Equal(t, nostr.Tags{
+				{"p", "recipient"},
+				{"e", "note"},
+				{"P", req.PubKey},
+				{"bolt11", "lnbc"},
+				{"description", raw},
+			}, ev.Tags)
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -16,16 +17,25 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/stemstr/blastr"
+	"github.com/stemstr/storage/internal/audit"
+	"github.com/stemstr/storage/internal/cashu"
 	"github.com/stemstr/storage/internal/encoder"
+	"github.com/stemstr/storage/internal/moderation"
+	"github.com/stemstr/storage/internal/rates"
 	"github.com/stemstr/storage/internal/service"
 	blob "github.com/stemstr/storage/internal/storage/blob"
 	ls "github.com/stemstr/storage/internal/storage/filesystem"
 	"github.com/stemstr/storage/internal/subscription"
+	"github.com/stemstr/storage/internal/subscription/ln/cln"
+	"github.com/stemstr/storage/internal/subscription/ln/lnd"
 	mockln "github.com/stemstr/storage/internal/subscription/ln/mock"
 	"github.com/stemstr/storage/internal/subscription/ln/nodeless"
+	"github.com/stemstr/storage/internal/subscription/ln/nwc"
 	"github.com/stemstr/storage/internal/subscription/ln/zbd"
-	"github.com/stemstr/storage/internal/subscription/repo/pg"
+	"github.com/stemstr/storage/internal/subscription/repo"
+	"github.com/stemstr/storage/internal/upload"
 	"github.com/stemstr/storage/internal/waveform"
+	"github.com/stemstr/storage/internal/zap"
 )
 
 var (
@@ -57,6 +67,18 @@ func main() {
 		os.Exit(1)
 	}
 
+	if args := flag.Args(); len(args) > 0 {
+		if args[0] != "migrate" {
+			log.Printf("unknown command %q. %v", args[0], migrateUsage)
+			os.Exit(1)
+		}
+		if err := runMigrate(ctx, cfg, args[1:], os.Stdout); err != nil {
+			log.Printf("migrate err: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Ensure the local directories exist
 	if err := createDirIfNotExists(cfg.MediaStorageDir); err != nil {
 		log.Println(err)
@@ -85,14 +107,35 @@ func main() {
 	}
 
 	// Subscriptions setup
-	var lnProvider subscription.LNProvider
+	var (
+		lnProvider       subscription.LNProvider
+		zbdVerifier      paymentVerifier
+		nodelessWebhooks nodelessWebhooks
+		watcher          paymentWatcher
+	)
 	switch cfg.LightningProvider {
 	case "nodeless":
-		lnProvider, err = nodeless.New(cfg.NodelessAPIKey, cfg.NodelessStoreID, cfg.NodelessTestnet)
+		nodelessClient, err := nodeless.New(cfg.NodelessAPIKey, cfg.NodelessStoreID, cfg.NodelessWebhookSecret, cfg.NodelessTestnet)
 		if err != nil {
 			log.Printf("nodeless err: %v\n", err)
 			os.Exit(1)
 		}
+		lnProvider = nodelessClient
+
+		if cfg.NodelessWebhookSecret == "" {
+			log.Printf("nodeless webhooks disabled: nodeless_webhook_secret not set\n")
+			break
+		}
+		webhookURL, err := url.JoinPath(cfg.APIBase, "/callback/nodeless")
+		if err != nil {
+			log.Printf("nodeless webhookURL: %v\n", err)
+			os.Exit(1)
+		}
+		if err := nodelessClient.EnsureWebhook(ctx, webhookURL); err != nil {
+			log.Printf("nodeless webhook err: %v\n", err)
+			os.Exit(1)
+		}
+		nodelessWebhooks = nodelessClient
 	case "zbd":
 		chargeCallbackURL, err := url.JoinPath(cfg.APIBase, "/callback/zbd-charge")
 		if err != nil {
@@ -100,19 +143,47 @@ func main() {
 			os.Exit(1)
 		}
 
-		lnProvider, err = zbd.New(cfg.ZBDAPIKey, chargeCallbackURL)
+		zbdClient, err := zbd.New(cfg.ZBDAPIKey, chargeCallbackURL)
 		if err != nil {
 			log.Printf("zbd err: %v\n", err)
 			os.Exit(1)
 		}
+		lnProvider = zbdClient
+		zbdVerifier = zbdClient
+	case "lnd":
+		lndClient, err := lnd.New(cfg.LNDRestURL, cfg.LNDMacaroon, cfg.LNDTLSCert)
+		if err != nil {
+			log.Printf("lnd err: %v\n", err)
+			os.Exit(1)
+		}
+		lnProvider = lndClient
+		watcher = lndClient
+	case "cln":
+		clnClient, err := cln.New(cfg.CLNRestURL, cfg.CLNRune, cfg.CLNTLSCert)
+		if err != nil {
+			log.Printf("cln err: %v\n", err)
+			os.Exit(1)
+		}
+		lnProvider = clnClient
+		watcher = clnClient
+	case "nwc":
+		nwcClient, err := nwc.New(cfg.NWCURI)
+		if err != nil {
+			log.Printf("nwc err: %v\n", err)
+			os.Exit(1)
+		}
+		lnProvider = nwcClient
+		watcher = nwcClient
 	case "mock":
-		lnProvider = mockln.New()
+		mockClient := mockln.New()
+		lnProvider = mockClient
+		watcher = mockClient
 	default:
-		log.Printf("unknown lightning_provider %q. must be 'nodeless' or 'zbd'", cfg.LightningProvider)
+		log.Printf("unknown lightning_provider %q. must be 'nodeless', 'zbd', 'lnd', 'cln' or 'nwc'", cfg.LightningProvider)
 		os.Exit(1)
 	}
 
-	subRepo, err := pg.New(cfg.SubscriptionDB)
+	subRepo, err := repo.New(cfg.SubscriptionDB)
 	if err != nil {
 		log.Printf("subRepo err: %v\n", err)
 		os.Exit(1)
@@ -122,6 +193,30 @@ func main() {
 		log.Printf("subRepo err: %v\n", err)
 		os.Exit(1)
 	}
+	if cfg.hasFiatPricing() {
+		oracle, err := newRateOracle(cfg)
+		if err != nil {
+			log.Printf("rates err: %v\n", err)
+			os.Exit(1)
+		}
+		subService.SetRateOracle(oracle)
+	}
+	reconciler := subscription.NewReconciler(subService, subRepo.LeaderLock(repo.ReconcilerLockKey), subscription.ReconcilerOpts{
+		Interval:   time.Duration(cfg.ReconcileIntervalSeconds) * time.Second,
+		MaxBackoff: time.Duration(cfg.ReconcileMaxBackoffSeconds) * time.Second,
+	})
+	go reconciler.Run(ctx)
+
+	banService, err := moderation.New(subRepo)
+	if err != nil {
+		log.Printf("moderation err: %v\n", err)
+		os.Exit(1)
+	}
+	auditLog, err := audit.New(subRepo)
+	if err != nil {
+		log.Printf("audit err: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Service setup
 	var (
@@ -129,26 +224,106 @@ func main() {
 			OriginalMediaLocalDir: cfg.MediaStorageDir,
 			StreamMediaLocalDir:   cfg.StreamStorageDir,
 			WAVMediaLocalDir:      cfg.WavStorageDir,
+			Peaks: waveform.PeaksOptions{
+				SamplesPerPixel: cfg.WaveformSamplesPerPixel,
+				Bits:            cfg.WaveformBits,
+				RMS:             cfg.WaveformRMS,
+			},
+			Image: waveform.ImageOptions{
+				Width:       cfg.WaveformImageWidth,
+				Height:      cfg.WaveformImageHeight,
+				Color:       cfg.WaveformColor,
+				PlayedColor: cfg.WaveformPlayedColor,
+				Background:  cfg.WaveformBackground,
+			},
+			Spectrogram: waveform.SpectrogramOptions{
+				Width:  cfg.WaveformImageWidth,
+				Height: cfg.WaveformImageHeight,
+				Bands:  cfg.SpectrogramBands,
+			},
 		}
 		ls  = ls.New()
 		viz = waveform.New(enc)
 	)
 
-	svc, err := service.New(svcConfig, ls, s3, enc, viz)
+	svc, err := service.New(svcConfig, ls, s3, enc, viz, subRepo)
 	if err != nil {
 		log.Printf("service err: %v\n", err)
 		os.Exit(1)
 	}
 
-	noteBlastr, _ := blastr.New(cfg.BlastrNsec)
+	var noteBlastr blastrIface
+	if b, err := blastr.New(cfg.BlastrNsec); err != nil {
+		log.Printf("blastr disabled: %v\n", err)
+	} else {
+		noteBlastr = b
+
+		gifts, err := newGiftNotifier(cfg.BlastrNsec, b.Send)
+		if err != nil {
+			log.Printf("gifts err: %v\n", err)
+			os.Exit(1)
+		}
+		subService.SetGiftNotifier(gifts)
+	}
+
+	var zapService *zap.Service
+	if cfg.ZapName != "" {
+		zapService, err = newZapService(cfg, subService, subRepo)
+		if err != nil {
+			log.Printf("zap err: %v\n", err)
+			os.Exit(1)
+		}
+		go zapService.Run(ctx, time.Duration(cfg.ReconcileIntervalSeconds)*time.Second)
+	}
+
+	var cashuService *cashu.Service
+	if len(cfg.CashuMints) > 0 {
+		cashuService, err = cashu.New(subService, cashu.NewHTTPMint(), cfg.CashuMints)
+		if err != nil {
+			log.Printf("cashu err: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var uploadService *upload.Service
+	if pricing := (upload.Pricing{SatsPerMB: cfg.UploadSatsPerMB, SatsPerMinute: cfg.UploadSatsPerMinute}); pricing.Enabled() {
+		uploadService, err = upload.New(subRepo, svc, lnProvider, cfg.LightningProvider, pricing)
+		if err != nil {
+			log.Printf("upload err: %v\n", err)
+			os.Exit(1)
+		}
+		go uploadService.Run(ctx, subRepo.LeaderLock(repo.UploadReconcilerLockKey), time.Duration(cfg.ReconcileIntervalSeconds)*time.Second)
+	}
 
 	h := handlers{
-		config: cfg,
-		svc:    svc,
-		subs:   subService,
-		blastr: noteBlastr,
+		config:   cfg,
+		svc:      svc,
+		subs:     subService,
+		bans:     banService,
+		audit:    auditLog,
+		blastr:   noteBlastr,
+		zbd:      zbdVerifier,
+		nodeless: nodelessWebhooks,
+		zaps:     zapService,
+		cashu:    cashuService,
+		uploads:  uploadService,
+	}
+
+	if watcher != nil {
+		go watcher.WatchPayments(ctx, func(p subscription.Payment) {
+			h.confirmPayment(ctx, p)
+		})
 	}
 
+	port := fmt.Sprintf(":%d", cfg.Port)
+
+	log.Printf("api listening on %v\n", port)
+
+	http.ListenAndServe(port, newRouter(&h))
+}
+
+// newRouter routes every endpoint to h.
+func newRouter(h *handlers) http.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(cors.Handler(cors.Options{
@@ -162,20 +337,60 @@ func main() {
 	r.Use(metricsMiddleware)
 
 	r.Post("/upload", h.handleUpload)
+	r.Get("/upload/{invoice_id}", h.handleGetUpload)
 	r.Get("/download/{filename}", h.handleDownloadMedia)
 	r.Get("/stream/{filename}", h.handleGetStream)
+	r.Get("/waveform/{filename}", h.handleGetPeaks)
+	r.Get("/image/{sum}/{name}", h.handleGetImage)
 	r.Get("/subscription", h.handleGetSubscriptionOptions)
 	r.Get("/subscription/{pubkey}", h.handleGetSubscription)
+	r.Get("/subscription/{pubkey}/history", h.handleGetSubscriptionHistory)
 	r.Post("/subscription/{pubkey}", h.handleCreateSubscription)
+	r.Post("/subscription/{pubkey}/cashu", h.handleCreateSubscriptionCashu)
+	r.Get("/subscription/{pubkey}/members", h.handleGetGroupMembers)
+	r.Put("/subscription/{pubkey}/members", h.handleImportGroupMembers)
+	r.Put("/subscription/{pubkey}/members/{member}", h.handleAddGroupMember)
+	r.Delete("/subscription/{pubkey}/members/{member}", h.handleRemoveGroupMember)
 	r.Post("/callback/zbd-charge", h.handleCallbackZBDCharge)
+	r.Post("/callback/nodeless", h.handleCallbackNodeless)
+	r.Get("/.well-known/lnurlp/{name}", h.handleLNURLPay)
+	r.Get("/lnurlp/{name}/callback", h.handleLNURLCallback)
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(h.requireAdmin)
+		r.Get("/audit", h.handleAdminListAudit)
+		r.Get("/subscriptions", h.handleAdminSearchSubscriptions)
+		r.Post("/subscriptions", h.handleAdminGrantSubscription)
+		r.Get("/subscriptions/{id}", h.handleAdminGetSubscription)
+		r.Put("/subscriptions/{id}/status", h.handleAdminSetSubscriptionStatus)
+		r.Get("/subscriptions/{id}/history", h.handleAdminGetSubscriptionHistory)
+		r.Get("/promo-codes", h.handleAdminListPromoCodes)
+		r.Post("/promo-codes", h.handleAdminCreatePromoCode)
+		r.Delete("/samples/{sum}", h.handleAdminDeleteSample)
+		r.Get("/bans", h.handleAdminListBans)
+		r.Put("/bans/{pubkey}", h.handleAdminBan)
+		r.Delete("/bans/{pubkey}", h.handleAdminUnban)
+	})
 	r.Method(http.MethodGet, "/metrics", promhttp.Handler())
 	r.Get("/debug/stream", h.handleDebugStream)
 
-	port := fmt.Sprintf(":%d", cfg.Port)
+	return r
+}
 
-	log.Printf("api listening on %v\n", port)
+func newRateOracle(cfg Config) (*rates.Oracle, error) {
+	var sources []rates.Source
+	for _, name := range cfg.RateSources {
+		source, err := rates.NewSource(name)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
 
-	http.ListenAndServe(port, r)
+	return rates.New(sources, rates.Options{
+		TTL:      time.Duration(cfg.RateCacheSeconds) * time.Second,
+		MaxStale: time.Duration(cfg.RateMaxStaleSeconds) * time.Second,
+		Static:   cfg.StaticRates,
+	}), nil
 }
 
 func createDirIfNotExists(path string) error {
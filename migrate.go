@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/stemstr/storage/internal/subscription/repo"
+)
+
+const migrateUsage = "usage: api [-config path] migrate up|down|status"
+
+// runMigrate runs the migrate subcommand against the subscription database.
+// up applies all pending migrations, down reverts the latest one and status
+// lists them.
+func runMigrate(ctx context.Context, cfg Config, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	db, err := repo.Open(cfg.SubscriptionDB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp(ctx)
+		for _, m := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "up to date")
+		}
+	case "down":
+		m, err := db.MigrateDown(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "reverted %04d_%s\n", m.Version, m.Name)
+	case "status":
+		statuses, err := db.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
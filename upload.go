@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/stemstr/storage/internal/service"
+	"github.com/stemstr/storage/internal/upload"
+)
+
+// handlePayPerUpload holds an upload from a pubkey without a subscription
+// and responds with an invoice for it. It's processed once paid, which
+// clients can poll for at GET /upload/{invoice_id}.
+func (h *handlers) handlePayPerUpload(w http.ResponseWriter, r *http.Request, req *service.NewSampleRequest) {
+	u, err := h.uploads.Create(r.Context(), req)
+	if err != nil {
+		log.Printf("err: uploads.Create: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusPaymentRequired, h.uploadResponse(u))
+}
+
+// handleGetUpload reports the status of a pay-per-upload, including the
+// sample once processed.
+func (h *handlers) handleGetUpload(w http.ResponseWriter, r *http.Request) {
+	if h.uploads == nil {
+		http.Error(w, "pay-per-upload disabled", http.StatusNotFound)
+		return
+	}
+
+	u, err := h.uploads.Get(r.Context(), chi.URLParam(r, "invoice_id"))
+	if errors.Is(err, upload.ErrUploadNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("err: uploads.Get: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.uploadResponse(u))
+}
+
+func (h *handlers) uploadResponse(u *upload.Upload) map[string]any {
+	resp := map[string]any{
+		"invoice_id": u.InvoiceID,
+		"status":     u.Status,
+		"sats":       u.Sats,
+	}
+	switch u.Status {
+	case upload.StatusPending:
+		resp["lightning_invoice"] = u.LightningInvoice
+		resp["expires_at"] = u.InvoiceExpiresAt.Unix()
+	case upload.StatusProcessed:
+		for k, v := range h.sampleResponse(u.Sum, u.DownloadHash, json.RawMessage(u.Waveform)) {
+			resp[k] = v
+		}
+	}
+
+	return resp
+}
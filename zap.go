@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/stemstr/blastr"
+
+	"github.com/stemstr/storage/internal/subscription"
+	"github.com/stemstr/storage/internal/subscription/repo"
+	"github.com/stemstr/storage/internal/zap"
+)
+
+// lnurlError responds with a LUD-06 error. Wallets expect these with a 200.
+func lnurlError(w http.ResponseWriter, reason string) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "ERROR",
+		"reason": reason,
+	})
+}
+
+// handleLNURLPay serves the LNURL-pay endpoint behind the configured zap
+// lightning address.
+func (h *handlers) handleLNURLPay(w http.ResponseWriter, r *http.Request) {
+	if h.zaps == nil || chi.URLParam(r, "name") != h.config.ZapName {
+		http.NotFound(w, r)
+		return
+	}
+
+	callback, err := url.JoinPath(h.config.APIBase, "/lnurlp", h.config.ZapName, "callback")
+	if err != nil {
+		log.Printf("err: lnurlp callback: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	min, max := h.zaps.Sendable()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"tag":         "payRequest",
+		"callback":    callback,
+		"minSendable": min,
+		"maxSendable": max,
+		"metadata":    h.lnurlMetadata(),
+		"allowsNostr": true,
+		"nostrPubkey": h.zaps.Pubkey(),
+	})
+}
+
+func (h *handlers) lnurlMetadata() string {
+	metadata, _ := json.Marshal([][]string{
+		{"text/plain", "Stemstr subscription"},
+		{"text/identifier", h.config.ZapName + "@" + h.zapDomain()},
+	})
+	return string(metadata)
+}
+
+func (h *handlers) zapDomain() string {
+	u, err := url.Parse(h.config.APIBase)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// handleLNURLCallback creates the invoice for a zap. Only zaps are
+// accepted, since the zapper's pubkey is who the subscription is for.
+func (h *handlers) handleLNURLCallback(w http.ResponseWriter, r *http.Request) {
+	if h.zaps == nil || chi.URLParam(r, "name") != h.config.ZapName {
+		http.NotFound(w, r)
+		return
+	}
+
+	var (
+		ctx   = r.Context()
+		query = r.URL.Query()
+	)
+
+	amount, err := strconv.ParseInt(query.Get("amount"), 10, 64)
+	if err != nil {
+		lnurlError(w, "amount must be millisats")
+		return
+	}
+
+	rawRequest := query.Get("nostr")
+	if rawRequest == "" {
+		lnurlError(w, "only zaps are accepted")
+		return
+	}
+
+	req, err := h.zaps.ParseRequest(rawRequest, amount)
+	if err != nil {
+		lnurlError(w, err.Error())
+		return
+	}
+
+	banned, err := h.bans.IsBanned(ctx, req.Event.PubKey)
+	if err != nil {
+		log.Printf("err: bans.IsBanned: %v", err)
+		lnurlError(w, "internal error")
+		return
+	}
+	if banned {
+		log.Printf("zap blocked: %q is banned", req.Event.PubKey)
+		lnurlError(w, "pubkey banned")
+		return
+	}
+
+	sub, err := h.zaps.CreateInvoice(ctx, *req)
+	if err != nil {
+		if errors.Is(err, zap.ErrNoTier) {
+			lnurlError(w, err.Error())
+			return
+		}
+		log.Printf("err: zaps.CreateInvoice: %v", err)
+		lnurlError(w, "unable to create invoice")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"pr":     sub.LightningInvoice,
+		"routes": []any{},
+	})
+}
+
+// newZapService sets up zaps, which need a lightning provider that supports
+// description hashes and a blastr key to sign receipts with.
+func newZapService(cfg Config, subs *subscription.SubscriptionService, zaps repo.Repo) (*zap.Service, error) {
+	if !subs.SupportsDescriptionHash() {
+		return nil, fmt.Errorf("lightning_provider %q: %w", cfg.LightningProvider, subscription.ErrDescriptionHashUnsupported)
+	}
+
+	_, sk, err := nip19.Decode(cfg.BlastrNsec)
+	if err != nil {
+		return nil, fmt.Errorf("blastr_nsec: %w", err)
+	}
+	pubkey, err := nostr.GetPublicKey(sk.(string))
+	if err != nil {
+		return nil, fmt.Errorf("blastr_nsec: %w", err)
+	}
+
+	var tiers []zap.Tier
+	for _, opt := range cfg.SubscriptionOptions {
+		// Zaps are matched to tiers by exact amount, which a moving
+		// exchange rate would break.
+		if opt.Currency != "" {
+			continue
+		}
+		tiers = append(tiers, zap.Tier{Days: opt.Days, Sats: opt.Sats})
+	}
+
+	publish := func(ctx context.Context, ev nostr.Event, relays []string) error {
+		b, err := blastr.New(cfg.BlastrNsec, blastr.WithCustomRelays(relays))
+		if err != nil {
+			return err
+		}
+		return b.Send(ctx, ev)
+	}
+
+	return zap.New(subs, zaps, publish, pubkey, tiers)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stemstr/storage/internal/zap"
+)
+
+func TestHandleLNURLPay(t *testing.T) {
+	zaps, err := zap.New(nil, nil, nil, "zapperpubkey", []zap.Tier{{Days: 30, Sats: 1000}, {Days: 365, Sats: 10000}})
+	assert.NoError(t, err)
+
+	h := handlers{
+		config: Config{APIBase: "https://api.stemstr.app", ZapName: "stemstr"},
+		zaps:   zaps,
+	}
+	r := chi.NewRouter()
+	r.Get("/.well-known/lnurlp/{name}", h.handleLNURLPay)
+	r.Get("/lnurlp/{name}/callback", h.handleLNURLCallback)
+
+	var tests = []struct {
+		name   string
+		path   string
+		status int
+		body   map[string]any
+	}{
+		{
+			name:   "pay request",
+			path:   "/.well-known/lnurlp/stemstr",
+			status: http.StatusOK,
+			body: map[string]any{
+				"tag":         "payRequest",
+				"callback":    "https://api.stemstr.app/lnurlp/stemstr/callback",
+				"minSendable": float64(1000000),
+				"maxSendable": float64(10000000),
+				"metadata":    `[["text/plain","Stemstr subscription"],["text/identifier","stemstr@api.stemstr.app"]]`,
+				"allowsNostr": true,
+				"nostrPubkey": "zapperpubkey",
+			},
+		},
+		{
+			name:   "unknown name",
+			path:   "/.well-known/lnurlp/someone",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "callback without zap",
+			path:   "/lnurlp/stemstr/callback?amount=1000000",
+			status: http.StatusOK,
+			body:   map[string]any{"status": "ERROR", "reason": "only zaps are accepted"},
+		},
+		{
+			name:   "callback bad amount",
+			path:   "/lnurlp/stemstr/callback?amount=lots",
+			status: http.StatusOK,
+			body:   map[string]any{"status": "ERROR", "reason": "amount must be millisats"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.body != nil {
+				var body map[string]any
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+				assert.Equal(t, tt.body, body)
+			}
+		})
+	}
+}
+
+func TestHandleLNURLPayDisabled(t *testing.T) {
+	h := handlers{config: Config{ZapName: "stemstr"}}
+	r := chi.NewRouter()
+	r.Get("/.well-known/lnurlp/{name}", h.handleLNURLPay)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/.well-known/lnurlp/stemstr", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}